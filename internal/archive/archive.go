@@ -0,0 +1,528 @@
+// Package archive extracts downloaded release archives and decompresses
+// compressed assets
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Options control how an archive is extracted
+type Options struct {
+	StripComponents int // Leading path elements removed from every entry, like tar --strip-components
+}
+
+// IsArchive reports whether name has the extension of an archive Extract
+// understands: a tarball, compressed or not, or a zip file
+func IsArchive(name string) bool {
+	f := format(name)
+	return f == "tar" || f == "zip" || strings.HasPrefix(f, "tar.")
+}
+
+// IsCompressed reports whether name has the extension of a single compressed
+// file, which Extract decompresses rather than unpacks
+func IsCompressed(name string) bool {
+	_, ok := codecs[format(name)]
+	return ok
+}
+
+// codecs are the compression formats by the extension of a compressed file
+var codecs = map[string]func(io.Reader) (io.ReadCloser, error){
+	"gz": func(r io.Reader) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	},
+	"zst": func(r io.Reader) (io.ReadCloser, error) {
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	},
+	"xz": func(r io.Reader) (io.ReadCloser, error) {
+		x, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(x), nil
+	},
+	"bz2": func(r io.Reader) (io.ReadCloser, error) {
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	},
+}
+
+// extensions maps file name suffixes to formats, longest suffixes first
+var extensions = []struct{ suffix, format string }{
+	{".tar.gz", "tar.gz"}, {".tgz", "tar.gz"},
+	{".tar.zst", "tar.zst"}, {".tzst", "tar.zst"},
+	{".tar.xz", "tar.xz"}, {".txz", "tar.xz"},
+	{".tar.bz2", "tar.bz2"}, {".tbz2", "tar.bz2"}, {".tbz", "tar.bz2"},
+	{".tar", "tar"},
+	{".zip", "zip"},
+	{".gz", "gz"},
+	{".zst", "zst"},
+	{".xz", "xz"},
+	{".bz2", "bz2"},
+}
+
+// format returns the format of a file name, or "" if unknown
+func format(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range extensions {
+		if strings.HasSuffix(lower, ext.suffix) {
+			return ext.format
+		}
+	}
+	return ""
+}
+
+// TrimExtension removes an archive or compression extension from name, so
+// app-linux.tar.zst becomes app-linux
+func TrimExtension(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range extensions {
+		if strings.HasSuffix(lower, ext.suffix) {
+			return name[:len(name)-len(ext.suffix)]
+		}
+	}
+	return name
+}
+
+// sniff recognises the format of a file from its first bytes, for assets
+// whose name does not tell
+func sniff(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return "gz"
+	case bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return "zst"
+	case bytes.HasPrefix(header, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return "xz"
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return "bz2"
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		return "zip"
+	case isTar(header):
+		return "tar"
+	default:
+		return ""
+	}
+}
+
+// isTar reports whether header starts with a POSIX or GNU tar header
+func isTar(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+// Extract unpacks archivePath into destDir, which is created if needed.
+// Entries that would end up outside destDir are rejected. The format comes
+// from the file extension or, failing that, from the content. A single
+// compressed file is decompressed to destDir under its name without the
+// compression extension, unless it turns out to hold a tarball.
+func Extract(archivePath, destDir string, opts Options) error {
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", destDir, err)
+	}
+	// Entries are checked against the real location of destDir
+	destDir, err := filepath.EvalSymlinks(destDir)
+	if err != nil {
+		return err
+	}
+
+	file, f, err := open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if f == "zip" {
+		return extractZip(archivePath, destDir, opts)
+	}
+
+	r, tarball, closeFn, err := decompress(file, f)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", archivePath, err)
+	}
+	defer closeFn()
+	if tarball {
+		return extractTar(r, destDir, opts)
+	}
+
+	// Compressed single files are almost always binaries
+	target := filepath.Join(destDir, TrimExtension(filepath.Base(archivePath)))
+	return writeFile(target, r, 0755)
+}
+
+// ExtractFile writes the single regular file called name in the archive at
+// archivePath to target, leaving the rest of the archive alone. Leading ./
+// and / are ignored when matching the name.
+func ExtractFile(archivePath, name, target string) error {
+	want := path.Clean(strings.TrimLeft(strings.ReplaceAll(name, `\`, "/"), "/"))
+
+	file, f, err := open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if f == "zip" {
+		return extractZipFile(archivePath, want, target)
+	}
+
+	r, tarball, closeFn, err := decompress(file, f)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", archivePath, err)
+	}
+	defer closeFn()
+	if !tarball {
+		return fmt.Errorf("%s is not an archive", filepath.Base(archivePath))
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s not found in the archive", want)
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+		if path.Clean(strings.TrimLeft(header.Name, "/")) != want {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("%s is not a regular file in the archive", want)
+		}
+		return writeFile(target, tr, os.FileMode(header.Mode).Perm())
+	}
+}
+
+// File is a file read from an archive
+type File struct {
+	Path string
+	Data []byte
+}
+
+// FindFiles reads a tarball as it streams in, the format told by name or
+// else by its first bytes, and returns the regular files for which match
+// is true, in archive order. Zip files need random access and are not
+// supported. A matching file bigger than maxSize is an error.
+func FindFiles(r io.Reader, name string, match func(entry string) bool, maxSize int64) ([]File, error) {
+	br := bufio.NewReader(r)
+	f := format(name)
+	if f == "" {
+		header, _ := br.Peek(262)
+		f = sniff(header)
+	}
+	switch f {
+	case "":
+		return nil, fmt.Errorf("unsupported archive format: %s", name)
+	case "zip":
+		return nil, fmt.Errorf("%s is a zip file, which cannot be read while downloading", name)
+	}
+
+	content, tarball, closeFn, err := decompress(br, f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", name, err)
+	}
+	defer closeFn()
+	if !tarball {
+		return nil, fmt.Errorf("%s is not an archive", name)
+	}
+
+	var files []File
+	tr := tar.NewReader(content)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %v", err)
+		}
+		entry := path.Clean(strings.TrimLeft(header.Name, "/"))
+		if header.Typeflag != tar.TypeReg || !match(entry) {
+			continue
+		}
+		if header.Size > maxSize {
+			return nil, fmt.Errorf("%s in the archive is larger than %d bytes", entry, maxSize)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from the archive: %v", entry, err)
+		}
+		files = append(files, File{Path: entry, Data: data})
+	}
+}
+
+// open opens archivePath and determines its format, from the extension or
+// from the first bytes
+func open(archivePath string) (*os.File, string, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if f := format(archivePath); f != "" {
+		return file, f, nil
+	}
+	header := make([]byte, 262)
+	n, _ := io.ReadFull(file, header)
+	f := sniff(header[:n])
+	if f == "" {
+		file.Close()
+		return nil, "", fmt.Errorf("unsupported archive format: %s", filepath.Base(archivePath))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, "", err
+	}
+	return file, f, nil
+}
+
+// decompress returns the content of a file in format f, which is anything
+// but zip, and whether that content is a tarball. The name decides for
+// tarballs, other compressed files are checked for a tar header.
+func decompress(file io.Reader, f string) (io.Reader, bool, func(), error) {
+	if f == "tar" {
+		return file, true, func() {}, nil
+	}
+
+	codec, tarball := strings.CutPrefix(f, "tar.")
+	rc, err := codecs[codec](file)
+	if err != nil {
+		return nil, false, nil, err
+	}
+
+	r := bufio.NewReader(rc)
+	if !tarball {
+		header, _ := r.Peek(262)
+		tarball = isTar(header)
+	}
+	return r, tarball, func() { rc.Close() }, nil
+}
+
+func extractTar(r io.Reader, destDir string, opts Options) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+
+		target, ok, err := entryPath(destDir, header.Name, opts.StripComponents)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, mode); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := symlink(destDir, target, header.Linkname); err != nil {
+				return err
+			}
+		default:
+			// Devices, FIFOs and hard links have no place in a release archive
+			continue
+		}
+	}
+}
+
+func extractZip(archivePath, destDir string, opts Options) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", archivePath, err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		target, ok, err := entryPath(destDir, file.Name, opts.StripComponents)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", file.Name, err)
+		}
+
+		if file.Mode()&os.ModeSymlink != 0 {
+			linkname, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", file.Name, err)
+			}
+			if err := symlink(destDir, target, string(linkname)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Archives made on Windows often carry no permissions at all
+		mode := file.Mode().Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+		err = writeFile(target, rc, mode)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZipFile writes the zip entry called want to target
+func extractZipFile(archivePath, want, target string) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", archivePath, err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		if path.Clean(strings.TrimLeft(strings.ReplaceAll(file.Name, `\`, "/"), "/")) != want {
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file in the archive", want)
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", file.Name, err)
+		}
+		defer rc.Close()
+
+		mode := file.Mode().Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+		return writeFile(target, rc, mode)
+	}
+	return fmt.Errorf("%s not found in the archive", want)
+}
+
+// entryPath maps an archive entry name to its location in destDir, with
+// the links already extracted resolved. It reports false for entries removed
+// entirely by stripping.
+func entryPath(destDir, name string, strip int) (string, bool, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", false, fmt.Errorf("archive entry %s points outside the target directory", name)
+	}
+
+	parts := strings.Split(clean, "/")
+	if clean == "." || len(parts) <= strip {
+		return "", false, nil
+	}
+
+	target := filepath.Join(destDir, filepath.FromSlash(strings.Join(parts[strip:], "/")))
+	// An earlier link entry may send a parent directory elsewhere
+	dir, err := resolveDir(filepath.Dir(target))
+	if err != nil {
+		return "", false, err
+	}
+	if !within(destDir, dir) {
+		return "", false, fmt.Errorf("archive entry %s points outside the target directory", name)
+	}
+	return filepath.Join(dir, filepath.Base(target)), true, nil
+}
+
+// resolveDir resolves the symlinks in the part of dir that exists
+func resolveDir(dir string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err == nil {
+		return resolved, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	parent := filepath.Dir(dir)
+	if parent == dir {
+		return dir, nil
+	}
+	resolved, err = resolveDir(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(resolved, filepath.Base(dir)), nil
+}
+
+// within reports whether path is dir or lies below it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// symlink creates a link at target, unless it would point outside destDir
+func symlink(destDir, target, linkname string) error {
+	resolved := linkname
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(target), resolved)
+	}
+	if !within(destDir, resolved) {
+		return fmt.Errorf("archive link %s points outside the target directory", linkname)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+	return os.Symlink(linkname, target)
+}
+
+// writeFile writes r to target, replacing any existing file
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// Remove first so a running binary or a symlink is replaced, not written through
+	os.Remove(target)
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("error extracting %s: %v", target, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,133 @@
+package archive
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is a regular file, or a symlink when link is set
+type tarEntry struct {
+	name, link, data string
+}
+
+// writeTar writes entries to a tarball in a temporary directory
+func writeTar(t *testing.T, entries []tarEntry) string {
+	t.Helper()
+	archivePath := filepath.Join(t.TempDir(), "test.tar")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tw := tar.NewWriter(file)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(entry.data))}
+		if entry.link != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: entry.link}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		strip   int
+		want    map[string]string // File contents by path in the target directory
+		wantErr bool
+	}{
+		{
+			name:    "files",
+			entries: []tarEntry{{name: "bin/app", data: "app"}, {name: "README", data: "readme"}},
+			want:    map[string]string{"bin/app": "app", "README": "readme"},
+		},
+		{
+			name:    "strip components",
+			entries: []tarEntry{{name: "app-1.0/bin/app", data: "app"}, {name: "app-1.0", data: ""}},
+			strip:   1,
+			want:    map[string]string{"bin/app": "app"},
+		},
+		{
+			name:    "link inside",
+			entries: []tarEntry{{name: "bin/app", data: "app"}, {name: "app", link: "bin/app"}},
+			want:    map[string]string{"app": "app"},
+		},
+		{name: "parent entry", entries: []tarEntry{{name: "../evil", data: "evil"}}, wantErr: true},
+		{name: "absolute entry", entries: []tarEntry{{name: "/evil", data: "evil"}}, wantErr: true},
+		{name: "link outside", entries: []tarEntry{{name: "up", link: "../.."}}, wantErr: true},
+		{name: "absolute link", entries: []tarEntry{{name: "root", link: "/"}}, wantErr: true},
+		{
+			// Each link stays inside on its own, together they reach the parent
+			name:    "chained links",
+			entries: []tarEntry{{name: "a", link: "."}, {name: "a/b", link: ".."}, {name: "b/evil", data: "evil"}},
+			wantErr: true,
+		},
+		{
+			name:    "file through a link",
+			entries: []tarEntry{{name: "a", link: "."}, {name: "a/app", data: "app"}},
+			want:    map[string]string{"app": "app"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archivePath := writeTar(t, tt.entries)
+			parent := t.TempDir()
+			destDir := filepath.Join(parent, "dest")
+
+			err := Extract(archivePath, destDir, Options{StripComponents: tt.strip})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Extract succeeded, want an error")
+				}
+			} else if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+
+			if _, err := os.Lstat(filepath.Join(parent, "evil")); err == nil {
+				t.Error("Extract wrote outside the target directory")
+			}
+			for name, want := range tt.want {
+				data, err := os.ReadFile(filepath.Join(destDir, name))
+				if err != nil {
+					t.Errorf("reading %s: %v", name, err)
+				} else if string(data) != want {
+					t.Errorf("%s = %q, want %q", name, data, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrimExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"app-linux.tar.zst", "app-linux"},
+		{"app-linux.TGZ", "app-linux"},
+		{"app.gz", "app"},
+		{"app.zip", "app"},
+		{"app", "app"},
+		{"app.exe", "app.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimExtension(tt.name); got != tt.want {
+				t.Errorf("TrimExtension(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
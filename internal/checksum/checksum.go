@@ -0,0 +1,217 @@
+// Package checksum writes and reads checksum files in the format of
+// sha256sum and the other coreutils *sum tools, and BSD tagged lines such
+// as those of shasum --tag
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+// SumsFile is the name of the combined SHA-256 checksum file attached to
+// releases
+const SumsFile = "SHA256SUMS"
+
+// Algorithm is a hash function checksum files are made with
+type Algorithm struct {
+	Name     string   // Lower case, as accepted by ByName
+	Tag      string   // As in BSD tagged lines, e.g. SHA512 (file) = ...
+	SumsFile string   // Combined checksum file of a release, e.g. SHA512SUMS
+	Suffixes []string // Per-file checksum files are named <asset><suffix>, the first is written
+	Weak     bool     // Collisions can be made, so it only detects corruption
+
+	size    int // Digest length in bytes
+	newHash func() hash.Hash
+}
+
+// Supported algorithms. MD5 and SHA-1 are there for upstreams that publish
+// nothing else.
+var (
+	SHA256 = Algorithm{Name: "sha256", Tag: "SHA256", SumsFile: SumsFile, Suffixes: []string{".sha256", ".sha256sum"}, size: sha256.Size, newHash: sha256.New}
+	SHA512 = Algorithm{Name: "sha512", Tag: "SHA512", SumsFile: "SHA512SUMS", Suffixes: []string{".sha512", ".sha512sum"}, size: sha512.Size, newHash: sha512.New}
+	BLAKE3 = Algorithm{Name: "blake3", Tag: "BLAKE3", SumsFile: "B3SUMS", Suffixes: []string{".b3", ".blake3", ".b3sum"}, size: 32, newHash: func() hash.Hash { return blake3.New() }}
+	SHA1   = Algorithm{Name: "sha1", Tag: "SHA1", SumsFile: "SHA1SUMS", Suffixes: []string{".sha1", ".sha1sum"}, Weak: true, size: sha1.Size, newHash: sha1.New}
+	MD5    = Algorithm{Name: "md5", Tag: "MD5", SumsFile: "MD5SUMS", Suffixes: []string{".md5", ".md5sum"}, Weak: true, size: md5.Size, newHash: md5.New}
+)
+
+// Algorithms lists the supported algorithms, strongest and most common
+// first, in the order published checksums are looked for
+var Algorithms = []Algorithm{SHA256, SHA512, BLAKE3, SHA1, MD5}
+
+// ByName returns the algorithm called name, ignoring case and dashes so
+// SHA-512 works too; b3 is BLAKE3
+func ByName(name string) (Algorithm, error) {
+	name = strings.ToLower(strings.ReplaceAll(name, "-", ""))
+	if name == "b3" {
+		return BLAKE3, nil
+	}
+	for _, a := range Algorithms {
+		if a.Name == name {
+			return a, nil
+		}
+	}
+	return Algorithm{}, fmt.Errorf("unsupported checksum algorithm '%s', use %s", name, Names())
+}
+
+// Names lists the names of the supported algorithms for messages
+func Names() string {
+	names := make([]string, len(Algorithms))
+	for i, a := range Algorithms {
+		names[i] = a.Name
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+func (a Algorithm) String() string {
+	return a.Name
+}
+
+// New returns a hash of the algorithm
+func (a Algorithm) New() hash.Hash {
+	return a.newHash()
+}
+
+// File returns the hex encoded digest of a file
+func (a Algorithm) File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := a.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// SHA256File returns the hex encoded SHA-256 digest of a file
+func SHA256File(path string) (string, error) {
+	return SHA256.File(path)
+}
+
+// Digest is a checksum and the algorithm it was made with
+type Digest struct {
+	Algorithm Algorithm
+	Hex       string // Lower case
+}
+
+// Verify checks that the file at path has the digest
+func (d Digest) Verify(path string) error {
+	actual, err := d.Algorithm.File(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, d.Hex) {
+		return fmt.Errorf("%s mismatch: expected %s, got %s", d.Algorithm.Tag, d.Hex, actual)
+	}
+	return nil
+}
+
+// Format renders digests by file name as *sum output, sorted by name
+func Format(sums map[string]string) []byte {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[name], name)
+	}
+	return b.Bytes()
+}
+
+// taggedLine matches BSD style lines, SHA512 (file) = digest
+var taggedLine = regexp.MustCompile(`^([A-Za-z0-9-]+) \((.*)\) = ([0-9A-Fa-f]+)$`)
+
+// Parse reads the contents of the checksum file fileName into digests by
+// file name. A line holding only a digest, as in a per-file checksum, is
+// stored under the empty name. BSD tagged lines name their algorithm, for
+// the others it is told by fileName or else by the length of the digest,
+// taking SHA-256 for the 64 digits it shares with BLAKE3.
+func Parse(fileName string, data []byte) map[string]Digest {
+	named, hasName := Detect(fileName)
+
+	sums := make(map[string]Digest)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if m := taggedLine.FindStringSubmatch(line); m != nil {
+			if a, err := ByName(m[1]); err == nil && isDigest(m[3], a) {
+				sums[m[2]] = Digest{Algorithm: a, Hex: strings.ToLower(m[3])}
+			}
+			continue
+		}
+
+		digest, name, _ := strings.Cut(line, " ")
+		a, ok := named, hasName
+		if !ok {
+			a, ok = bySize(digest)
+		}
+		if !ok || !isDigest(digest, a) {
+			continue
+		}
+		// A leading * marks binary mode in *sum output
+		name = strings.TrimPrefix(strings.TrimSpace(name), "*")
+		sums[name] = Digest{Algorithm: a, Hex: strings.ToLower(digest)}
+	}
+	return sums
+}
+
+// Detect tells the algorithm of a checksum file from its name, such as
+// SHA512SUMS, app.tar.gz.md5 or sha1sums.txt
+func Detect(fileName string) (Algorithm, bool) {
+	lower := strings.ToLower(fileName)
+	for _, a := range Algorithms {
+		for _, suffix := range a.Suffixes {
+			if strings.HasSuffix(lower, suffix) {
+				return a, true
+			}
+		}
+	}
+	for _, a := range Algorithms {
+		if strings.Contains(lower, strings.ToLower(a.SumsFile)) || strings.Contains(lower, a.Name+"sum") {
+			return a, true
+		}
+	}
+	return Algorithm{}, false
+}
+
+// bySize guesses the algorithm of a hex digest from its length
+func bySize(digest string) (Algorithm, bool) {
+	for _, a := range Algorithms {
+		if len(digest) == a.size*2 {
+			return a, true
+		}
+	}
+	return Algorithm{}, false
+}
+
+func isDigest(s string, a Algorithm) bool {
+	if len(s) != a.size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,788 @@
+// Package client talks to the Gitea API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/earentir/gitearelease"
+)
+
+// maxRateLimitRetries bounds how often a rate limited request is retried
+const maxRateLimitRetries = 5
+
+// maxIdleConnsPerHost is how many idle connections to one server are kept
+// for reuse, enough for parallel chunked downloads and batch commands
+const maxIdleConnsPerHost = 16
+
+// Transport is shared by every client of a run, so API calls and downloads
+// to the same server reuse connections, over HTTP/2 where the server
+// offers it, instead of each opening their own
+var Transport = newTransport()
+
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	return transport
+}
+
+// HTTPClient is used for all Gitea API requests. Replace its Transport to
+// point the API at a test double such as giteatest.Server.
+var HTTPClient = &http.Client{Timeout: 15 * time.Second, Transport: Transport}
+
+// DownloadClient is used for asset downloads. It has no overall timeout,
+// large assets take as long as they take.
+var DownloadClient = &http.Client{Transport: Transport}
+
+// Authenticate returns a copy of httpClient that sends token with every
+// request to the host of baseURL, including redirects back to it, so
+// private assets download like API calls. Other hosts, such as object
+// storage the server redirects to, never see the token.
+func Authenticate(httpClient *http.Client, baseURL, token string) *http.Client {
+	u, err := url.Parse(baseURL)
+	if token == "" || err != nil {
+		return httpClient
+	}
+
+	authenticated := *httpClient
+	base := authenticated.Transport
+	if base == nil {
+		base = Transport
+	}
+	authenticated.Transport = &tokenTransport{base: base, host: u.Host, token: token}
+	return &authenticated
+}
+
+// tokenTransport adds the token to requests for a single host
+type tokenTransport struct {
+	base  http.RoundTripper
+	host  string
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host || req.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(req)
+	}
+	// A RoundTripper must not modify the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// RedirectPolicy limits the redirects asset downloads follow
+type RedirectPolicy struct {
+	MaxRedirects int      // Redirects to follow per request, zero refuses all
+	SameHost     bool     // Refuse redirects to hosts other than the one asked
+	AllowedHosts []string // Hosts, or globs such as *.s3.amazonaws.com, allowed despite SameHost
+}
+
+// CheckRedirect implements http.Client.CheckRedirect for the policy
+func (p RedirectPolicy) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > p.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects (see --max-redirects)", p.MaxRedirects)
+	}
+	origin := via[0].URL.Host
+	if !p.SameHost || req.URL.Host == origin {
+		return nil
+	}
+	for _, allowed := range p.AllowedHosts {
+		if ok, _ := path.Match(allowed, req.URL.Hostname()); ok || allowed == req.URL.Host {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing redirect from %s to %s (allow it with --allow-redirect-hosts)", origin, req.URL.Host)
+}
+
+// Debug enables printing of requests and rate limit information to stderr
+var Debug bool
+
+// Verbose enables printing of requests with their timing, cache hits and
+// retries to stderr. Debug implies it.
+var Verbose bool
+
+// Counters for the verbose summary of a run
+var (
+	requestCount  atomic.Int64
+	requestTime   atomic.Int64 // Nanoseconds spent waiting for responses
+	retryCount    atomic.Int64
+	cacheHitCount atomic.Int64
+	newConnCount  atomic.Int64
+)
+
+// Stats sums up the HTTP requests of a run
+type Stats struct {
+	Requests  int64
+	Time      time.Duration // Spent waiting for response headers, bodies not included
+	Retries   int64
+	CacheHits int64
+	NewConns  int64 // Connections opened rather than reused
+}
+
+// RequestStats returns the requests made so far
+func RequestStats() Stats {
+	return Stats{
+		Requests:  requestCount.Load(),
+		Time:      time.Duration(requestTime.Load()),
+		Retries:   retryCount.Load(),
+		CacheHits: cacheHitCount.Load(),
+		NewConns:  newConnCount.Load(),
+	}
+}
+
+// StatusError is returned when the API answers with an unexpected status
+type StatusError struct {
+	Method     string
+	URL        string
+	Status     string
+	StatusCode int
+	Message    string // Error message from the API response, if any
+}
+
+func (e *StatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s %q: server returned %s: %s", e.Method, e.URL, e.Status, e.Message)
+	}
+	return fmt.Sprintf("%s %q: server returned %s", e.Method, e.URL, e.Status)
+}
+
+// Client talks to the API of a single Gitea instance
+type Client struct {
+	BaseURL    string
+	Token      string // API token, requests are anonymous when empty
+	HTTPClient *http.Client
+}
+
+// New returns a client for the Gitea instance at baseURL authenticating
+// with token, if set
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:    baseURL,
+		Token:      token,
+		HTTPClient: HTTPClient,
+	}
+}
+
+// Debugf prints a debug message to stderr when Debug is enabled
+func Debugf(format string, args ...interface{}) {
+	if Debug {
+		fmt.Fprintf(os.Stderr, "Debug: "+format+"\n", args...)
+	}
+}
+
+// Verbosef prints a message to stderr when Verbose or Debug is enabled
+func Verbosef(format string, args ...interface{}) {
+	if Verbose || Debug {
+		fmt.Fprintf(os.Stderr, "Verbose: "+format+"\n", args...)
+	}
+}
+
+// CacheHit counts something answered from a cache instead of the server
+// and prints what with Verbosef
+func CacheHit(format string, args ...interface{}) {
+	cacheHitCount.Add(1)
+	Verbosef("cache hit: "+format, args...)
+}
+
+// redactURL returns u for logs, without the query of presigned URLs whose
+// signature would let anyone reading the log download the asset
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	for _, key := range []string{"X-Amz-Signature", "X-Goog-Signature", "Signature", "token", "access_token"} {
+		if query.Has(key) {
+			redacted := *u
+			redacted.RawQuery = "(signature omitted)"
+			return redacted.String()
+		}
+	}
+	return u.String()
+}
+
+// rateLimitHeader returns the first non-empty value of the GitHub/Gitea style
+// X-RateLimit-* header or its standardised RateLimit-* counterpart
+func rateLimitHeader(resp *http.Response, name string) string {
+	if v := resp.Header.Get("X-RateLimit-" + name); v != "" {
+		return v
+	}
+	return resp.Header.Get("RateLimit-" + name)
+}
+
+// retryDelay works out how long to wait before retrying a rate limited request
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return time.Until(t)
+		}
+	}
+
+	if v := rateLimitHeader(resp, "Reset"); v != "" {
+		if reset, err := strconv.ParseInt(v, 10, 64); err == nil {
+			// Reset is either an epoch timestamp or a number of seconds
+			if reset > 24*60*60 {
+				return time.Until(time.Unix(reset, 0))
+			}
+			return time.Duration(reset) * time.Second
+		}
+	}
+
+	// No hint from the server, back off exponentially
+	return time.Duration(1<<attempt) * time.Second
+}
+
+// Get performs a GET request, waiting and retrying when the server
+// answers with 429 Too Many Requests
+func Get(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Do(client, req)
+}
+
+// Do sends a request, waiting and retrying when the server answers with
+// 429 Too Many Requests. Request bodies are rewound through GetBody.
+func Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	req = req.WithContext(httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused {
+				newConnCount.Add(1)
+			}
+		},
+	}))
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		elapsed := time.Since(start)
+		requestCount.Add(1)
+		requestTime.Add(int64(elapsed))
+		if err != nil {
+			Verbosef("%s %s: failed after %s", req.Method, redactURL(req.URL), elapsed.Round(time.Millisecond))
+			return nil, err
+		}
+
+		Verbosef("%s %s: %s over %s (%s)", req.Method, redactURL(req.URL), resp.Status, resp.Proto, elapsed.Round(time.Millisecond))
+		if remaining := rateLimitHeader(resp, "Remaining"); remaining != "" {
+			if limit := rateLimitHeader(resp, "Limit"); limit != "" {
+				Debugf("rate limit: %s of %s requests remaining", remaining, limit)
+			} else {
+				Debugf("rate limit: %s requests remaining", remaining)
+			}
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRateLimitRetries {
+			return resp, nil
+		}
+
+		wait := retryDelay(resp, attempt)
+		if wait < 0 {
+			wait = 0
+		}
+		resp.Body.Close()
+
+		retryCount.Add(1)
+		Verbosef("rate limited, retrying in %s (attempt %d of %d)", wait.Round(time.Second), attempt+1, maxRateLimitRetries)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// newRequest builds an API request carrying the client's token
+func (c *Client) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "token "+c.Token)
+	}
+	return req, nil
+}
+
+// get performs an authenticated GET request against the API
+func (c *Client) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Do(c.HTTPClient, req)
+}
+
+// send performs an authenticated API request with in, if not nil, as JSON
+// body and decodes the JSON response into out, if not nil
+func (c *Client) send(ctx context.Context, method, apiURL string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("encode JSON: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, apiURL, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := Do(c.HTTPClient, req)
+	if err != nil {
+		return fmt.Errorf("%s %q: %w", method, apiURL, err)
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(method, apiURL, resp, out)
+}
+
+// decodeResponse turns an error status into a StatusError carrying the API
+// error message and otherwise decodes the JSON body into out, if not nil
+func decodeResponse(method, apiURL string, resp *http.Response, out interface{}) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		statusErr := &StatusError{Method: method, URL: apiURL, Status: resp.Status, StatusCode: resp.StatusCode}
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil {
+			statusErr.Message = apiErr.Message
+		}
+		return statusErr
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("parse JSON: %v", err)
+		}
+	}
+	return nil
+}
+
+// pageSize is the number of items requested per page of a list endpoint
+const pageSize = 50
+
+// getAll fetches every page of a paginated API list endpoint
+func getAll[T any](ctx context.Context, c *Client, apiURL string) ([]T, error) {
+	var all []T
+	err := eachPage(ctx, c, apiURL, func(items []T) bool {
+		all = append(all, items...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// eachPage passes the pages of a paginated API list endpoint to fn until
+// the last page or until fn returns false
+func eachPage[T any](ctx context.Context, c *Client, apiURL string, fn func([]T) bool) error {
+	separator := "?"
+	if strings.Contains(apiURL, "?") {
+		separator = "&"
+	}
+
+	for page := 1; ; page++ {
+		pageURL := fmt.Sprintf("%s%spage=%d&limit=%d", apiURL, separator, page, pageSize)
+		resp, err := c.get(ctx, pageURL)
+		if err != nil {
+			return fmt.Errorf("GET %q: %w", pageURL, err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return &StatusError{Method: http.MethodGet, URL: apiURL, Status: resp.Status, StatusCode: resp.StatusCode}
+		}
+
+		var items []T
+		err = json.NewDecoder(resp.Body).Decode(&items)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("parse JSON: %v", err)
+		}
+
+		if !fn(items) || len(items) < pageSize {
+			return nil
+		}
+	}
+}
+
+// GetRepositories returns all repositories owned by a user or organization
+func (c *Client) GetRepositories(ctx context.Context, owner string) ([]gitearelease.Repository, error) {
+	repos, err := getAll[gitearelease.Repository](ctx, c, fmt.Sprintf("%s/api/v1/users/%s/repos", c.BaseURL, owner))
+
+	// Fall back to the organization endpoint for instances that do not
+	// list organization repositories under the users endpoint
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return getAll[gitearelease.Repository](ctx, c, fmt.Sprintf("%s/api/v1/orgs/%s/repos", c.BaseURL, owner))
+	}
+	return repos, err
+}
+
+// CurrentUser returns the user the token belongs to
+func (c *Client) CurrentUser(ctx context.Context) (User, error) {
+	var user User
+	err := c.send(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/user", c.BaseURL), nil, &user)
+	return user, err
+}
+
+// GetRepository returns a repository as the token sees it
+func (c *Client) GetRepository(ctx context.Context, owner, repo string) (gitearelease.Repository, error) {
+	var repository gitearelease.Repository
+	err := c.send(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/repos/%s/%s", c.BaseURL, owner, repo), nil, &repository)
+	return repository, err
+}
+
+// RepositoryPermissions returns what the token may do in a repository
+func (c *Client) RepositoryPermissions(ctx context.Context, owner, repo string) (Permissions, error) {
+	var repository struct {
+		Permissions Permissions `json:"permissions"`
+	}
+	err := c.send(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/repos/%s/%s", c.BaseURL, owner, repo), nil, &repository)
+	return repository.Permissions, err
+}
+
+// CheckReleaseWrite reports whether the token may create releases, which
+// Gitea allows users with the write or admin permission on the repository.
+// It only reads the repository, so nothing is changed.
+func (c *Client) CheckReleaseWrite(ctx context.Context, owner, repo string) error {
+	perms, err := c.RepositoryPermissions(ctx, owner, repo)
+	if err != nil {
+		return err
+	}
+	if !perms.Push && !perms.Admin {
+		return fmt.Errorf("the token's user has no write permission on the repository")
+	}
+	return nil
+}
+
+// GetStarredRepositories returns all repositories starred by a user
+func (c *Client) GetStarredRepositories(ctx context.Context, user string) ([]gitearelease.Repository, error) {
+	return getAll[gitearelease.Repository](ctx, c, fmt.Sprintf("%s/api/v1/users/%s/starred", c.BaseURL, user))
+}
+
+// GetReleases returns all releases or only the latest release of a repository
+func (c *Client) GetReleases(ctx context.Context, owner, repo string, latest bool) ([]Release, error) {
+	if !latest {
+		releases, err := getAll[Release](ctx, c, fmt.Sprintf("%s/api/v1/repos/%s/%s/releases", c.BaseURL, owner, repo))
+		for i := range releases {
+			releases[i].setUploaders()
+		}
+		return releases, err
+	}
+
+	if !c.Supports(ctx, FeatureLatestRelease) {
+		return c.latestFromList(ctx, owner, repo)
+	}
+
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/latest", c.BaseURL, owner, repo)
+	resp, err := c.get(ctx, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("GET %q: %w", apiURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Method: http.MethodGet, URL: apiURL, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+
+	var release Release
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("parse JSON: %v", err)
+	}
+	release.setUploaders()
+	return []Release{release}, nil
+}
+
+// latestFromList finds the latest release in the release list, for servers
+// without the latest endpoint. Like the endpoint, it skips drafts and
+// pre-releases and answers 404 when there is no release.
+func (c *Client) latestFromList(ctx context.Context, owner, repo string) ([]Release, error) {
+	Debugf("Gitea %s has no latest release endpoint, searching the release list", c.ServerVersion(ctx))
+
+	latest, found, err := c.FindNewest(ctx, owner, repo, func(r Release) bool { return !r.Draft && !r.Prerelease })
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/latest", c.BaseURL, owner, repo)
+		return nil, &StatusError{Method: http.MethodGet, URL: apiURL, Status: "404 Not Found", StatusCode: http.StatusNotFound}
+	}
+	return []Release{latest}, nil
+}
+
+// FindNewest returns the newest release for which match is true, and
+// whether there is one. The release list, which Gitea sorts newest first,
+// is only read as far as needed.
+func (c *Client) FindNewest(ctx context.Context, owner, repo string, match func(Release) bool) (Release, bool, error) {
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases", c.BaseURL, owner, repo)
+	var newest *Release
+	err := eachPage(ctx, c, apiURL, func(releases []Release) bool {
+		for i := range releases {
+			if match(releases[i]) {
+				newest = &releases[i]
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil || newest == nil {
+		return Release{}, false, err
+	}
+	newest.setUploaders()
+	return *newest, true, nil
+}
+
+// CreateReleaseOptions describes a release to create. When the tag does not
+// exist yet Gitea creates it at Target, or the default branch when empty.
+type CreateReleaseOptions struct {
+	TagName    string `json:"tag_name"`
+	Target     string `json:"target_commitish,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// CreateRelease creates a release of a repository
+func (c *Client) CreateRelease(ctx context.Context, owner, repo string, opts CreateReleaseOptions) (Release, error) {
+	var release Release
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases", c.BaseURL, owner, repo)
+	err := c.send(ctx, http.MethodPost, apiURL, opts, &release)
+	release.setUploaders()
+	return release, err
+}
+
+// EditReleaseOptions holds the release fields to change, nil fields are left untouched
+type EditReleaseOptions struct {
+	Name       *string `json:"name,omitempty"`
+	Body       *string `json:"body,omitempty"`
+	Draft      *bool   `json:"draft,omitempty"`
+	Prerelease *bool   `json:"prerelease,omitempty"`
+}
+
+// EditRelease changes the metadata of the release with the given ID
+func (c *Client) EditRelease(ctx context.Context, owner, repo string, id int, opts EditReleaseOptions) (Release, error) {
+	var release Release
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/%d", c.BaseURL, owner, repo, id)
+	err := c.send(ctx, http.MethodPatch, apiURL, opts, &release)
+	release.setUploaders()
+	return release, err
+}
+
+// AssetContentType asks the server for the content type of an asset with a
+// HEAD request, as the API does not report it. The token only goes to the
+// Gitea instance, not to the hosts external assets link to.
+func (c *Client) AssetContentType(ctx context.Context, asset Asset) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, asset.BrowserDownloadURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := Do(Authenticate(c.HTTPClient, c.BaseURL, c.Token), req)
+	if err != nil {
+		return "", fmt.Errorf("HEAD %q: %w", asset.BrowserDownloadURL, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Method: http.MethodHead, URL: asset.BrowserDownloadURL, Status: resp.Status, StatusCode: resp.StatusCode}
+	}
+	return resp.Header.Get("Content-Type"), nil
+}
+
+// DeleteRelease deletes the release with the given ID, the tag is kept
+func (c *Client) DeleteRelease(ctx context.Context, owner, repo string, id int) error {
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/%d", c.BaseURL, owner, repo, id)
+	return c.send(ctx, http.MethodDelete, apiURL, nil, nil)
+}
+
+// DeleteReleaseAsset deletes a single asset from a release
+func (c *Client) DeleteReleaseAsset(ctx context.Context, owner, repo string, releaseID, assetID int) error {
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/%d/assets/%d", c.BaseURL, owner, repo, releaseID, assetID)
+	return c.send(ctx, http.MethodDelete, apiURL, nil, nil)
+}
+
+// Version returns the version reported by the Gitea server
+func (c *Client) Version(ctx context.Context) (string, error) {
+	var version struct {
+		Version string `json:"version"`
+	}
+	err := c.send(ctx, http.MethodGet, fmt.Sprintf("%s/api/v1/version", c.BaseURL), nil, &version)
+	return version.Version, err
+}
+
+// UploadReleaseAsset attaches the file at filePath to a release under name.
+// The file is streamed rather than read into memory, through track, if not
+// nil, so a progress display can count what is sent.
+func (c *Client) UploadReleaseAsset(ctx context.Context, owner, repo string, releaseID int, name, filePath string, track func(io.Reader) io.Reader) (Asset, error) {
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/%d/assets?name=%s", c.BaseURL, owner, repo, releaseID, url.QueryEscape(name))
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return Asset{}, err
+	}
+
+	// Render the multipart framing up front so the request has a length,
+	// the file itself goes between the header and the closing boundary
+	var framing bytes.Buffer
+	mw := multipart.NewWriter(&framing)
+	if _, err := mw.CreateFormFile("attachment", name); err != nil {
+		return Asset{}, err
+	}
+	headerLen := framing.Len()
+	if err := mw.Close(); err != nil {
+		return Asset{}, err
+	}
+	header, trailer := framing.Bytes()[:headerLen], framing.Bytes()[headerLen:]
+
+	newBody := func() (io.ReadCloser, error) {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		var content io.Reader = file
+		if track != nil {
+			content = track(file)
+		}
+		return fileBody{io.MultiReader(bytes.NewReader(header), content, bytes.NewReader(trailer)), file}, nil
+	}
+	body, err := newBody()
+	if err != nil {
+		return Asset{}, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, apiURL, body)
+	if err != nil {
+		body.Close()
+		return Asset{}, err
+	}
+	req.ContentLength = int64(len(header)) + info.Size() + int64(len(trailer))
+	req.GetBody = newBody
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	// Like downloads, uploads may take longer than the API timeout
+	uploadClient := *c.HTTPClient
+	uploadClient.Timeout = 0
+
+	resp, err := Do(&uploadClient, req)
+	if err != nil {
+		return Asset{}, fmt.Errorf("POST %q: %w", apiURL, err)
+	}
+	defer resp.Body.Close()
+
+	var asset Asset
+	err = decodeResponse(http.MethodPost, apiURL, resp, &asset)
+	return asset, err
+}
+
+// AddReleaseLink attaches a link to a file hosted elsewhere to a release
+// as an asset called name
+func (c *Client) AddReleaseLink(ctx context.Context, owner, repo string, releaseID int, name, externalURL string) (Asset, error) {
+	if err := c.Require(ctx, FeatureExternalAsset); err != nil {
+		return Asset{}, err
+	}
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/releases/%d/assets?name=%s", c.BaseURL, owner, repo, releaseID, url.QueryEscape(name))
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("external_url", externalURL); err != nil {
+		return Asset{}, err
+	}
+	if err := mw.Close(); err != nil {
+		return Asset{}, err
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, apiURL, &body)
+	if err != nil {
+		return Asset{}, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := Do(c.HTTPClient, req)
+	if err != nil {
+		return Asset{}, fmt.Errorf("POST %q: %w", apiURL, err)
+	}
+	defer resp.Body.Close()
+
+	var asset Asset
+	err = decodeResponse(http.MethodPost, apiURL, resp, &asset)
+	return asset, err
+}
+
+// fileBody is a request body read from a file, closing the file when done
+type fileBody struct {
+	io.Reader
+	io.Closer
+}
+
+// GetTag returns a tag of a repository
+func (c *Client) GetTag(ctx context.Context, owner, repo, name string) (Tag, error) {
+	if err := c.Require(ctx, FeatureTagAPI); err != nil {
+		return Tag{}, err
+	}
+	var tag Tag
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/tags/%s", c.BaseURL, owner, repo, url.PathEscape(name))
+	err := c.send(ctx, http.MethodGet, apiURL, nil, &tag)
+	return tag, err
+}
+
+// CreateTagOptions describes a tag to create. A message makes it an
+// annotated tag, an empty target tags the default branch.
+type CreateTagOptions struct {
+	TagName string `json:"tag_name"`
+	Target  string `json:"target,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// CreateTag creates a tag in a repository
+func (c *Client) CreateTag(ctx context.Context, owner, repo string, opts CreateTagOptions) (Tag, error) {
+	if err := c.Require(ctx, FeatureTagAPI); err != nil {
+		return Tag{}, err
+	}
+	var tag Tag
+	apiURL := fmt.Sprintf("%s/api/v1/repos/%s/%s/tags", c.BaseURL, owner, repo)
+	err := c.send(ctx, http.MethodPost, apiURL, opts, &tag)
+	return tag, err
+}
+
+// GetMilestones returns all open and closed milestones of a repository
+func (c *Client) GetMilestones(ctx context.Context, owner, repo string) ([]Milestone, error) {
+	return getAll[Milestone](ctx, c, fmt.Sprintf("%s/api/v1/repos/%s/%s/milestones?state=all", c.BaseURL, owner, repo))
+}
+
+// GetClosedIssues returns the closed issues and pull requests of a milestone
+func (c *Client) GetClosedIssues(ctx context.Context, owner, repo string, milestoneID int) ([]Issue, error) {
+	return getAll[Issue](ctx, c, fmt.Sprintf("%s/api/v1/repos/%s/%s/issues?state=closed&milestones=%d", c.BaseURL, owner, repo, milestoneID))
+}
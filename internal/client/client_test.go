@@ -0,0 +1,211 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/giteatest"
+)
+
+// countRequests returns how many requests with method and path were served
+func countRequests(srv *giteatest.Server, method, path string) int {
+	count := 0
+	for _, request := range srv.Requests() {
+		if request == method+" "+path {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDoRetriesRateLimited(t *testing.T) {
+	tests := []struct {
+		name       string
+		limited    int
+		wantStatus int
+		wantSent   int
+	}{
+		{"not limited", 0, http.StatusOK, 1},
+		{"limited twice", 2, http.StatusOK, 3},
+		{"limited beyond the retries", 10, http.StatusTooManyRequests, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := giteatest.NewServer()
+			defer srv.Close()
+			srv.RateLimit(tt.limited)
+
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, srv.URL+"/api/v1/version", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(srv.Client(), req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if sent := countRequests(srv, http.MethodGet, "/api/v1/version"); sent != tt.wantSent {
+				t.Errorf("sent %d requests, want %d", sent, tt.wantSent)
+			}
+		})
+	}
+}
+
+func TestDoRewindsBody(t *testing.T) {
+	srv := giteatest.NewServer()
+	defer srv.Close()
+	added := srv.AddRelease("owner", "repo", client.Release{TagName: "v1.0.0"}, nil)
+	srv.RateLimit(1)
+
+	api := &client.Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+	name := "Renamed"
+	rel, err := api.EditRelease(context.Background(), "owner", "repo", added.ID, client.EditReleaseOptions{Name: &name})
+	if err != nil {
+		t.Fatalf("EditRelease: %v", err)
+	}
+	if rel.Name != name {
+		t.Errorf("name = %q after a retried request, want %q", rel.Name, name)
+	}
+}
+
+func TestGetReleasesPaginates(t *testing.T) {
+	tests := []struct {
+		releases  int
+		wantPages int
+	}{
+		{0, 1},
+		{1, 1},
+		{49, 1},
+		{50, 2}, // A full page may be followed by more
+		{120, 3},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.releases), func(t *testing.T) {
+			srv := emptyRepo(t)
+			defer srv.Close()
+			for i := 0; i < tt.releases; i++ {
+				srv.AddRelease("owner", "repo", client.Release{TagName: fmt.Sprintf("v0.0.%d", i)}, nil)
+			}
+
+			api := &client.Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+			releases, err := api.GetReleases(context.Background(), "owner", "repo", false)
+			if err != nil {
+				t.Fatalf("GetReleases: %v", err)
+			}
+			if len(releases) != tt.releases {
+				t.Errorf("got %d releases, want %d", len(releases), tt.releases)
+			}
+			seen := make(map[string]bool)
+			for _, rel := range releases {
+				if seen[rel.TagName] {
+					t.Errorf("release %s listed twice", rel.TagName)
+				}
+				seen[rel.TagName] = true
+			}
+			if pages := countRequests(srv, http.MethodGet, "/api/v1/repos/owner/repo/releases"); pages != tt.wantPages {
+				t.Errorf("requested %d pages, want %d", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+// emptyRepo returns a server with a repository that has no releases
+func emptyRepo(t *testing.T) *giteatest.Server {
+	t.Helper()
+	srv := giteatest.NewServer()
+	rel := srv.AddRelease("owner", "repo", client.Release{TagName: "v0.0.0"}, nil)
+	if err := (&client.Client{BaseURL: srv.URL, HTTPClient: srv.Client()}).DeleteRelease(context.Background(), "owner", "repo", rel.ID); err != nil {
+		t.Fatalf("DeleteRelease: %v", err)
+	}
+	return srv
+}
+
+func TestFindNewestStopsEarly(t *testing.T) {
+	srv := giteatest.NewServer()
+	defer srv.Close()
+	for i := 0; i < 120; i++ {
+		srv.AddRelease("owner", "repo", client.Release{TagName: fmt.Sprintf("v1.0.%d", i), Prerelease: i != 60}, nil)
+	}
+
+	api := &client.Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+	tests := []struct {
+		name      string
+		match     func(client.Release) bool
+		wantTag   string
+		wantFound bool
+		wantPages int
+	}{
+		{"first page", func(client.Release) bool { return true }, "v1.0.119", true, 1},
+		{"second page", func(rel client.Release) bool { return !rel.Prerelease }, "v1.0.60", true, 2},
+		{"last page", func(rel client.Release) bool { return rel.TagName == "v1.0.0" }, "v1.0.0", true, 3},
+		{"no match", func(client.Release) bool { return false }, "", false, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := countRequests(srv, http.MethodGet, "/api/v1/repos/owner/repo/releases")
+			rel, found, err := api.FindNewest(context.Background(), "owner", "repo", tt.match)
+			if err != nil {
+				t.Fatalf("FindNewest: %v", err)
+			}
+			if found != tt.wantFound || rel.TagName != tt.wantTag {
+				t.Errorf("FindNewest = %q, %v, want %q, %v", rel.TagName, found, tt.wantTag, tt.wantFound)
+			}
+			if pages := countRequests(srv, http.MethodGet, "/api/v1/repos/owner/repo/releases") - before; pages != tt.wantPages {
+				t.Errorf("requested %d pages, want %d", pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestCheckReleaseWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"with a token", "secret", ""},
+		{"anonymous", "", "no write permission"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := giteatest.NewServer()
+			defer srv.Close()
+			srv.AddRelease("owner", "repo", client.Release{TagName: "v1.0.0"}, nil)
+
+			api := &client.Client{BaseURL: srv.URL, Token: tt.token, HTTPClient: srv.Client()}
+			err := api.CheckReleaseWrite(context.Background(), "owner", "repo")
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("CheckReleaseWrite: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Fatalf("CheckReleaseWrite = %v, want an error containing %q", err, tt.wantErr)
+			}
+			for _, request := range srv.Requests() {
+				if !strings.HasPrefix(request, http.MethodGet+" ") {
+					t.Errorf("CheckReleaseWrite sent %s", request)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	srv := giteatest.NewServer()
+	defer srv.Close()
+
+	api := &client.Client{BaseURL: srv.URL, HTTPClient: srv.Client()}
+	_, err := api.GetReleases(context.Background(), "owner", "missing", false)
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("GetReleases of a missing repository = %v, want a 404 StatusError", err)
+	}
+}
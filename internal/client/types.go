@@ -0,0 +1,111 @@
+package client
+
+// Release represents a release payload from Gitea
+type Release struct {
+	ID          int     `json:"id"`
+	TagName     string  `json:"tag_name"`
+	Target      string  `json:"target_commitish"` // Branch or commit the tag was created from
+	Name        string  `json:"name"`
+	Body        string  `json:"body"`
+	URL         string  `json:"url"`
+	HTMLURL     string  `json:"html_url"`
+	TarballURL  string  `json:"tarball_url"`
+	ZipballURL  string  `json:"zipball_url"`
+	Draft       bool    `json:"draft"`
+	Prerelease  bool    `json:"prerelease"`
+	CreatedAt   string  `json:"created_at"`
+	PublishedAt string  `json:"published_at"`
+	Author      User    `json:"author"`
+	Assets      []Asset `json:"assets"`
+}
+
+// User represents the author of a release
+type User struct {
+	ID       int    `json:"id"`
+	Login    string `json:"login"`
+	FullName string `json:"full_name"`
+}
+
+// Permissions are what the authenticated user may do in a repository
+type Permissions struct {
+	Admin bool `json:"admin"`
+	Push  bool `json:"push"`
+	Pull  bool `json:"pull"`
+}
+
+// Asset represents a file attached to a release
+type Asset struct {
+	ID                 int    `json:"id"`
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	DownloadCount      int    `json:"download_count"`
+	CreatedAt          string `json:"created_at"`
+	UUID               string `json:"uuid"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	Type               string `json:"type,omitempty"`
+
+	// Not part of the asset payload, filled in by the client
+	Uploader    string `json:"uploader,omitempty"`     // Login of the release author, who uploads the assets
+	ContentType string `json:"content_type,omitempty"` // Only set by AssetContentType
+}
+
+// AssetTypeExternal is the type of assets that link to a file hosted
+// outside Gitea, such as in object storage
+const AssetTypeExternal = "external"
+
+// IsExternal reports whether an asset is a link to a file outside Gitea,
+// whose size the server does not know
+func (a Asset) IsExternal() bool {
+	return a.Type == AssetTypeExternal
+}
+
+// setUploaders records the release author as uploader of every asset
+func (r *Release) setUploaders() {
+	for i := range r.Assets {
+		r.Assets[i].Uploader = r.Author.Login
+	}
+}
+
+// Tag represents a git tag payload from Gitea
+type Tag struct {
+	Name    string    `json:"name"`
+	Message string    `json:"message"` // Only set for annotated tags
+	ID      string    `json:"id"`
+	Commit  TagCommit `json:"commit"`
+}
+
+// TagCommit is the commit a tag points to
+type TagCommit struct {
+	SHA     string `json:"sha"`
+	Created string `json:"created"`
+}
+
+// Milestone represents a repository milestone
+type Milestone struct {
+	ID           int    `json:"id"`
+	Title        string `json:"title"`
+	State        string `json:"state"`
+	OpenIssues   int    `json:"open_issues"`
+	ClosedIssues int    `json:"closed_issues"`
+}
+
+// Issue represents an issue or pull request
+type Issue struct {
+	Number      int          `json:"number"`
+	Title       string       `json:"title"`
+	HTMLURL     string       `json:"html_url"`
+	State       string       `json:"state"`
+	User        User         `json:"user"`
+	Labels      []Label      `json:"labels"`
+	PullRequest *PullRequest `json:"pull_request"` // Only set for pull requests
+}
+
+// Label represents an issue label
+type Label struct {
+	Name string `json:"name"`
+}
+
+// PullRequest holds the pull request details of an issue
+type PullRequest struct {
+	Merged bool `json:"merged"`
+}
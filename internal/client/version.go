@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Feature is a part of the Gitea API that older servers do not have
+type Feature struct {
+	Name  string
+	Since string // First Gitea version with the feature
+}
+
+// API features gitea-release uses that came after Gitea 1.14
+var (
+	FeatureTagAPI        = Feature{"reading and creating tags through the API", "1.15"}
+	FeatureLatestRelease = Feature{"the latest release endpoint", "1.18"}
+	FeatureTokenScopes   = Feature{"scoped access tokens", "1.19"}
+	FeatureExternalAsset = Feature{"release assets linking to external URLs", "1.24"}
+)
+
+// serverVersions caches the version of each server by base URL, so it is
+// asked for once per run
+var serverVersions sync.Map
+
+// ServerVersion returns the Gitea version of the server, or "" if it does
+// not say
+func (c *Client) ServerVersion(ctx context.Context) string {
+	if v, ok := serverVersions.Load(c.BaseURL); ok {
+		CacheHit("version of %s", c.BaseURL)
+		return v.(string)
+	}
+	version, err := c.Version(ctx)
+	if err != nil {
+		Debugf("no version from %s: %v", c.BaseURL, err)
+		version = ""
+	}
+	serverVersions.Store(c.BaseURL, version)
+	return version
+}
+
+// Supports reports whether the server has a feature. Servers that do not
+// report their version are assumed to be recent.
+func (c *Client) Supports(ctx context.Context, f Feature) bool {
+	version := c.ServerVersion(ctx)
+	if version == "" {
+		return true
+	}
+	have, ok := parseVersion(version)
+	if !ok {
+		return true
+	}
+	need, _ := parseVersion(f.Since)
+	return !versionLess(have, need)
+}
+
+// UnsupportedError is returned for a feature the server is too old for
+type UnsupportedError struct {
+	Feature Feature
+	BaseURL string
+	Version string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s needs Gitea %s or newer, %s runs %s", e.Feature.Name, e.Feature.Since, e.BaseURL, e.Version)
+}
+
+// ServerInfo describes the software behind an API
+type ServerInfo struct {
+	Product string // Gitea or Forgejo
+	Version string // Version of the product
+	Gitea   string // Gitea version the API corresponds to
+}
+
+func (s ServerInfo) String() string {
+	if s.Product == "Forgejo" && s.Gitea != s.Version {
+		return fmt.Sprintf("Forgejo %s, compatible with Gitea %s", s.Version, s.Gitea)
+	}
+	return s.Product + " " + s.Version
+}
+
+// Identify tells Gitea and Forgejo apart. Forgejo 7 and later report
+// versions such as 7.0.0+gitea-1.22.0 on the Gitea endpoint; older Forgejo
+// releases kept Gitea's numbering, as in 1.21.11-0, and only show
+// themselves through Forgejo's own version endpoint.
+func (c *Client) Identify(ctx context.Context) (ServerInfo, error) {
+	version, err := c.Version(ctx)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	if forgejo, gitea, ok := strings.Cut(version, "+gitea-"); ok {
+		return ServerInfo{Product: "Forgejo", Version: forgejo, Gitea: gitea}, nil
+	}
+
+	var forgejo struct {
+		Version string `json:"version"`
+	}
+	err = c.send(ctx, http.MethodGet, fmt.Sprintf("%s/api/forgejo/v1/version", c.BaseURL), nil, &forgejo)
+	if err == nil && forgejo.Version != "" {
+		return ServerInfo{Product: "Forgejo", Version: forgejo.Version, Gitea: version}, nil
+	}
+	Debugf("no Forgejo version endpoint, assuming Gitea: %v", err)
+	return ServerInfo{Product: "Gitea", Version: version, Gitea: version}, nil
+}
+
+// Require returns an *UnsupportedError when the server lacks a feature
+func (c *Client) Require(ctx context.Context, f Feature) error {
+	if c.Supports(ctx, f) {
+		return nil
+	}
+	return &UnsupportedError{Feature: f, BaseURL: c.BaseURL, Version: c.ServerVersion(ctx)}
+}
+
+// parseVersion reads the major, minor and patch numbers of versions such as
+// 1.17.3 or 1.21.0+dev-12-g3e5f. Forgejo versions are compared by the Gitea
+// version they correspond to: 7.0.0+gitea-1.22.0 as 1.22.0, and 1.21.11-0
+// from before Forgejo 7 as 1.21.11.
+func parseVersion(version string) ([3]int, bool) {
+	if _, gitea, ok := strings.Cut(version, "+gitea-"); ok {
+		version = gitea
+	}
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "+-"); i >= 0 {
+		version = version[:i]
+	}
+
+	var parsed [3]int
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+func versionLess(a, b [3]int) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
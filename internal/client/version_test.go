@@ -0,0 +1,49 @@
+package client
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    [3]int
+		wantOK  bool
+	}{
+		{"1.17.3", [3]int{1, 17, 3}, true},
+		{"v1.22.0", [3]int{1, 22, 0}, true},
+		{"1.21", [3]int{1, 21, 0}, true},
+		{"1.21.0+dev-12-g3e5f", [3]int{1, 21, 0}, true},
+		{"1.22.0-rc1", [3]int{1, 22, 0}, true},
+		{"7.0.0+gitea-1.22.0", [3]int{1, 22, 0}, true},
+		{"1.21.11-0", [3]int{1, 21, 11}, true},
+		{"development", [3]int{}, false},
+		{"1", [3]int{}, false},
+		{"1.2.3.4", [3]int{}, false},
+		{"1.x.0", [3]int{}, false},
+		{"", [3]int{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, ok := parseVersion(tt.version)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("parseVersion(%q) = %v, %v, want %v, %v", tt.version, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b [3]int
+		want bool
+	}{
+		{[3]int{1, 17, 3}, [3]int{1, 18, 0}, true},
+		{[3]int{1, 18, 0}, [3]int{1, 17, 3}, false},
+		{[3]int{1, 18, 0}, [3]int{1, 18, 0}, false},
+		{[3]int{1, 9, 9}, [3]int{1, 10, 0}, true},
+	}
+	for _, tt := range tests {
+		if got := versionLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("versionLess(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
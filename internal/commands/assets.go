@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/download"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	assetsOutput  string
+	assetsDetails bool
+)
+
+var assetsCmd = &cobra.Command{
+	Use:   "assets [repo-alias[@channel]] [release-tag-or-channel]",
+	Short: "List the assets of a release, one per line",
+	Long: "List the assets of a release with name, size, download count and URL, one per line. Links to files " +
+		"hosted outside Gitea show external as their size. With --details the asset ID, UUID, creation time, " +
+		"uploader, content type and asset type (attachment or external) are included too.",
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias, releaseIdentifier, _, err := releaseArgs(args, 0)
+		if err != nil {
+			return err
+		}
+
+		cfg, repoDetails, err := loadRepo(alias)
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, alias, repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), releaseIdentifier)
+		if err != nil {
+			return err
+		}
+
+		assets := targetRelease.Assets
+		if assets == nil {
+			assets = []release.Asset{} // Encode as [] rather than null
+		}
+
+		if assetsDetails {
+			resolveContentTypes(cmd, repo, assets)
+		}
+
+		switch assetsOutput {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(assets)
+		case "csv", "tsv":
+			header := []string{"name", "size", "download_count", "url"}
+			if assetsDetails {
+				header = append(header, "id", "uuid", "created_at", "uploader", "content_type", "type")
+			}
+			rows := make([][]string, 0, len(assets))
+			for _, asset := range assets {
+				rows = append(rows, assetFields(asset))
+			}
+			return writeRecords(assetsOutput, header, rows)
+		case "text":
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, asset := range assets {
+				fmt.Fprint(w, assetLine(asset))
+			}
+			return w.Flush()
+		default:
+			return fmt.Errorf("unsupported output format '%s', use text, json, csv or tsv", assetsOutput)
+		}
+	},
+}
+
+// assetLine formats an asset as a tab separated line, with external as the
+// unknown size of a link
+func assetLine(asset release.Asset) string {
+	fields := assetFields(asset)
+	if asset.IsExternal() {
+		fields[1] = "external"
+	}
+	return strings.Join(fields, "\t") + "\n"
+}
+
+// assetFields returns the columns shown for an asset
+func assetFields(asset release.Asset) []string {
+	fields := []string{asset.Name, strconv.FormatInt(asset.Size, 10), strconv.Itoa(asset.DownloadCount), asset.BrowserDownloadURL}
+	if assetsDetails {
+		fields = append(fields, strconv.Itoa(asset.ID), asset.UUID, formatDate(asset.CreatedAt), asset.Uploader, asset.ContentType, asset.Type)
+	}
+	return fields
+}
+
+// matchAssets returns the assets of rel named pattern or, when there is no
+// such asset, matching it as a glob. It fails when nothing matches.
+func matchAssets(rel release.Release, pattern string) ([]release.Asset, error) {
+	for _, asset := range rel.Assets {
+		if asset.Name == pattern {
+			return []release.Asset{asset}, nil
+		}
+	}
+
+	var matches []release.Asset
+	for _, asset := range rel.Assets {
+		ok, err := path.Match(pattern, asset.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset pattern '%s': %v", pattern, err)
+		}
+		if ok {
+			matches = append(matches, asset)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no assets matching '%s' found in release %s", pattern, rel.Name)
+	}
+	return matches, nil
+}
+
+// resolveContentTypes looks up the content type of every asset, which the
+// API does not report, leaving it empty when the server does not answer
+func resolveContentTypes(cmd *cobra.Command, repo release.Repo, assets []release.Asset) {
+	api := client.New(repo.BaseURL, repo.Token)
+	for i := range assets {
+		contentType, err := api.AssetContentType(cmd.Context(), assets[i])
+		if err != nil {
+			client.Debugf("no content type for %s: %v", assets[i].Name, err)
+			continue
+		}
+		assets[i].ContentType = contentType
+	}
+}
+
+func init() {
+	assetsCmd.Flags().StringVarP(&assetsOutput, "output", "o", "text", "Output format: text, json, csv or tsv")
+	assetsCmd.Flags().BoolVar(&assetsDetails, "details", false, "Include asset ID, UUID, creation time, uploader and content type")
+
+	rootCmd.AddCommand(assetsCmd)
+}
+
+// fetchAssetData downloads an asset of at most maxSize bytes into memory
+func fetchAssetData(ctx context.Context, repo release.Repo, asset release.Asset, maxSize int64) ([]byte, error) {
+	body, err := repo.OpenAsset(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", asset.Name, err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%s is larger than %s", asset.Name, download.FormatBytes(maxSize))
+	}
+	return data, nil
+}
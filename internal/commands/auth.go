@@ -0,0 +1,174 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/client"
+
+	"github.com/spf13/cobra"
+)
+
+var authCheckWrite bool
+
+// scopePattern finds the scopes in Gitea's error for a token lacking them
+var scopePattern = regexp.MustCompile(`required scope\(s\): \[([^\]]*)\]`)
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Check API tokens",
+}
+
+var authCheckCmd = &cobra.Command{
+	Use:   "check [repo-alias]",
+	Short: "Verify that the token of a repository can read it, and write releases with --write",
+	Long: `Verify the token configured for a repository before a workflow depends on
+it: that Gitea accepts it, that it can read the repository and its releases,
+and with --write that it can create releases, as the release commands need.
+Missing token scopes and permissions are reported by name, where a workflow
+would only see a 404 or 403 later on.
+
+The write check reads the token's permissions on the repository and sends
+no request that changes anything.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		ctx := cmd.Context()
+		api := client.New(repo.BaseURL, repo.Token)
+		fullName := repoDetails.Owner + "/" + repoDetails.Name
+		var problems []string
+
+		server, err := api.Identify(ctx)
+		if err != nil {
+			return fmt.Errorf("error reaching %s: %v", repo.BaseURL, err)
+		}
+		fmt.Printf("Server:      %s (%s)\n", repo.BaseURL, server)
+
+		if repo.Token == "" {
+			fmt.Printf("Token:       none, requests are anonymous\n")
+		} else if user, err := api.CurrentUser(ctx); err == nil {
+			fmt.Printf("Token:       valid, authenticated as %s\n", user.Login)
+		} else if scopes := missingScopes(err); scopes != "" {
+			// Reading the user needs its own scope, which the token does not have to carry
+			fmt.Printf("Token:       valid, without the %s scope to show its user\n", scopes)
+		} else {
+			fmt.Printf("Token:       rejected\n")
+			problems = append(problems, describeAuthError(err, "authenticating"))
+		}
+		if repo.Token != "" && !api.Supports(ctx, client.FeatureTokenScopes) {
+			fmt.Printf("Scopes:      none before Gitea %s, the token has all access of its user\n", client.FeatureTokenScopes.Since)
+		}
+
+		perms, err := api.RepositoryPermissions(ctx, repoDetails.Owner, repoDetails.Name)
+		if err != nil {
+			fmt.Printf("Repository:  %s not readable\n", fullName)
+			problems = append(problems, describeAuthError(err, "reading "+fullName))
+		} else {
+			var granted []string
+			for _, p := range []struct {
+				name string
+				ok   bool
+			}{{"read", perms.Pull}, {"write", perms.Push}, {"admin", perms.Admin}} {
+				if p.ok {
+					granted = append(granted, p.name)
+				}
+			}
+			if len(granted) == 0 {
+				granted = append(granted, "read (public)")
+			}
+			fmt.Printf("Repository:  %s, permissions: %s\n", fullName, strings.Join(granted, ", "))
+
+			if _, err := api.GetReleases(ctx, repoDetails.Owner, repoDetails.Name, true); err != nil && !isNotFound(err) {
+				// 404 only means there is no release yet
+				problems = append(problems, describeAuthError(err, "reading the releases of "+fullName))
+			}
+
+			if authCheckWrite {
+				err := checkReleaseWrite(ctx, api, repoDetails.Owner, repoDetails.Name)
+				if err != nil {
+					fmt.Printf("Releases:    cannot be created\n")
+					problems = append(problems, describeAuthError(err, "creating releases in "+fullName))
+				} else {
+					fmt.Printf("Releases:    can be created\n")
+				}
+			}
+		}
+
+		if len(problems) > 0 {
+			fmt.Println()
+			for _, problem := range problems {
+				fmt.Printf("- %s\n", problem)
+			}
+			return fmt.Errorf("the token for %s is missing access", args[0])
+		}
+		return nil
+	},
+}
+
+// checkReleaseWrite checks that a token is configured before asking for
+// its write permission, anonymous requests can never create releases
+func checkReleaseWrite(ctx context.Context, api *client.Client, owner, name string) error {
+	if api.Token == "" {
+		return fmt.Errorf("no token is configured")
+	}
+	return api.CheckReleaseWrite(ctx, owner, name)
+}
+
+// describeAuthError explains an API error in terms of what the token lacks
+func describeAuthError(err error, action string) string {
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) {
+		return fmt.Sprintf("%s failed: %v", action, err)
+	}
+	if scopes := missingScopes(err); scopes != "" {
+		return fmt.Sprintf("%s needs a token with the %s scope", action, scopes)
+	}
+	switch statusErr.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Sprintf("%s failed: the token is invalid, expired or revoked", action)
+	case http.StatusForbidden:
+		return fmt.Sprintf("%s is forbidden: %s", action, statusErr.Message)
+	case http.StatusNotFound:
+		return fmt.Sprintf("%s failed: not found, the repository does not exist or the token cannot see it", action)
+	}
+	return fmt.Sprintf("%s failed: %v", action, err)
+}
+
+// missingScopes returns the scopes Gitea said a token lacks, or ""
+func missingScopes(err error) string {
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		return ""
+	}
+	match := scopePattern.FindStringSubmatch(statusErr.Message)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(match[1]), " or ")
+}
+
+// isNotFound reports whether the API answered 404 Not Found
+func isNotFound(err error) bool {
+	var statusErr *client.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+func init() {
+	authCheckCmd.Flags().BoolVar(&authCheckWrite, "write", false, "Also check that the token can create releases")
+
+	authCmd.AddCommand(authCheckCmd)
+	rootCmd.AddCommand(authCmd)
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+// exitStale is the exit status when a release is older than --max-age, so
+// alerting can tell abandoned dependencies apart from failures
+const exitStale = 3
+
+var checkMaxAge string
+
+var checkCmd = &cobra.Command{
+	Use:   "check [repo-alias...]",
+	Short: "Show how long ago the latest release of each repository was published",
+	Long: `Show the latest release of the given repositories, of those in a --group or
+of every configured repository, and how long ago it was published. With --max-age the command
+exits with status 3 when a latest release is older than the threshold, which
+can be used to alert on abandoned dependencies.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var maxAge time.Duration
+		if checkMaxAge != "" {
+			var err error
+			if maxAge, err = parseAge(checkMaxAge); err != nil {
+				return err
+			}
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		aliases, err := selectAliases(cfg, args, groupFlag)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ALIAS\t%s\tPUBLISHED\tSTATUS\n", paint(colorPlain, "TAG"))
+
+		var failed, stale int
+		for _, alias := range aliases {
+			details, ok := cfg.Repos[alias]
+			if !ok {
+				fmt.Fprintf(w, "%s\t%s\t-\t%s\n", alias, paint(colorPlain, "-"), paint(colorRed, "unknown alias"))
+				failed++
+				continue
+			}
+			repo, err := releaseRepo(cfg, alias, details)
+			if err == nil {
+				var latest release.Release
+				if latest, err = repo.Find(cmd.Context(), repo.DefaultChannel()); err == nil {
+					status := paint(colorGreen, "ok")
+					if err := checkReleaseAge(latest, maxAge); err != nil {
+						status = paint(colorYellow, "stale")
+						stale++
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", alias, paint(colorCyan, latest.TagName), publishedText(latest.PublishedAt), status)
+					continue
+				}
+			}
+			if cmd.Context().Err() != nil {
+				return cmd.Context().Err()
+			}
+			fmt.Fprintf(w, "%s\t%s\t-\t%s\n", alias, paint(colorPlain, "-"), paint(colorRed, "error: "+err.Error()))
+			failed++
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		switch {
+		case failed > 0:
+			return fmt.Errorf("%d of %d repositories could not be checked", failed, len(aliases))
+		case stale > 0:
+			return &exitError{code: exitStale, err: fmt.Errorf("%d of %d repositories have no release in the last %s", stale, len(aliases), checkMaxAge)}
+		}
+		return nil
+	},
+}
+
+// checkReleaseAge fails with exitStale when rel was published longer than
+// maxAge ago. A zero maxAge accepts any release.
+func checkReleaseAge(rel release.Release, maxAge time.Duration) error {
+	if maxAge == 0 {
+		return nil
+	}
+	published, err := time.Parse(time.RFC3339, rel.PublishedAt)
+	if err != nil {
+		return &exitError{code: exitStale, err: fmt.Errorf("release %s has no publish date", rel.TagName)}
+	}
+	if age := time.Since(published); age > maxAge {
+		return &exitError{code: exitStale, err: fmt.Errorf("release %s was published %s, more than %s ago",
+			rel.TagName, relativeTime(published, time.Now()), formatAge(maxAge))}
+	}
+	return nil
+}
+
+// formatAge prints a --max-age threshold in days when it is a whole number of days
+func formatAge(d time.Duration) string {
+	const day = 24 * time.Hour
+	if d >= day && d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
+
+func init() {
+	checkCmd.Flags().StringVar(&groupFlag, "group", "", "Check the repositories in this group")
+	checkCmd.Flags().StringVar(&checkMaxAge, "max-age", "", "Exit with status 3 when a latest release is older than this, e.g. 30d, 2w or 36h")
+
+	rootCmd.AddCommand(checkCmd)
+}
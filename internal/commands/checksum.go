@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/earentir/gitea-release/internal/checksum"
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/download"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	checksumCompute   bool
+	checksumOutput    string
+	checksumAlgorithm string
+)
+
+// assetChecksum is the digest of an asset and where it came from
+type assetChecksum struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+	SHA256    string `json:"sha256,omitempty"` // Kept for existing consumers of the JSON
+	Source    string `json:"source"`           // The checksum file it was read from, or "computed"
+}
+
+var checksumCmd = &cobra.Command{
+	Use:   "checksum [repo-alias[@channel]] [release-tag-or-channel] [asset]",
+	Short: "Print the checksums of release assets without keeping them",
+	Long: `Print the checksums of the assets of a release in sha256sum format, or that
+of sha512sum, b3sum and the others with --algorithm, for pinning hashes in
+other tools. The asset may be a name or a glob, and defaults to every asset
+apart from checksum files.
+
+Checksums are read from the checksum file of the release for the algorithm,
+such as <asset>.sha256 or SHA256SUMS, when there is one. Other assets, or
+every asset with --compute, are hashed by streaming them from the server
+without saving them.`,
+	Args: cobra.RangeArgs(1, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias, releaseIdentifier, rest, err := releaseArgs(args, 1)
+		if err != nil {
+			return err
+		}
+		if checksumOutput != "text" && checksumOutput != "json" {
+			return fmt.Errorf("unsupported output format '%s', use text or json", checksumOutput)
+		}
+		algorithm, err := checksum.ByName(checksumAlgorithm)
+		if err != nil {
+			return err
+		}
+
+		cfg, repoDetails, err := loadRepo(alias)
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, alias, repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), releaseIdentifier)
+		if err != nil {
+			return err
+		}
+
+		var pattern string
+		if len(rest) > 0 {
+			pattern = rest[0]
+		}
+		assets, err := checksummedAssets(targetRelease, pattern)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		sums := make([]assetChecksum, 0, len(assets))
+		files := make(map[string][]byte) // Checksum files by name, fetched once
+		for _, asset := range assets {
+			sum, err := findChecksum(cmd.Context(), repo, targetRelease, asset, files, algorithm)
+			if err != nil {
+				return err
+			}
+			sums = append(sums, sum)
+		}
+
+		if checksumOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(sums)
+		}
+		for _, sum := range sums {
+			fmt.Printf("%s  %s\n", sum.Digest, sum.Name)
+		}
+		return nil
+	},
+}
+
+// checksummedAssets returns the assets matching pattern, or every asset
+// apart from checksum files when pattern is empty
+func checksummedAssets(rel release.Release, pattern string) ([]release.Asset, error) {
+	if pattern != "" {
+		return matchAssets(rel, pattern)
+	}
+
+	var assets []release.Asset
+	for _, asset := range rel.Assets {
+		if !isChecksumFile(asset.Name) {
+			assets = append(assets, asset)
+		}
+	}
+	if len(assets) == 0 {
+		return nil, fmt.Errorf("release %s has no assets", rel.Name)
+	}
+	return assets, nil
+}
+
+// findChecksum returns the published checksum of asset with the algorithm, or
+// streams the asset to compute it when none is published or --compute is
+// given
+func findChecksum(ctx context.Context, repo release.Repo, rel release.Release, asset release.Asset, files map[string][]byte, algorithm checksum.Algorithm) (assetChecksum, error) {
+	if !checksumCompute {
+		if sumsAsset, perFile, ok := checksumFile(rel, asset.Name, []checksum.Algorithm{algorithm}); ok {
+			data, fetched := files[sumsAsset.Name]
+			if !fetched {
+				var err error
+				if data, err = fetchAssetData(ctx, repo, sumsAsset, maxChecksumSize); err != nil {
+					return assetChecksum{}, err
+				}
+				files[sumsAsset.Name] = data
+			}
+			digest, err := listedChecksum(data, sumsAsset, perFile, asset.Name)
+			if err == nil && digest.Algorithm.Name != algorithm.Name {
+				// checksums.txt may hold digests of another algorithm
+				err = fmt.Errorf("%s lists a %s checksum of %s", sumsAsset.Name, digest.Algorithm.Tag, asset.Name)
+			}
+			if err == nil {
+				return newAssetChecksum(asset.Name, digest, sumsAsset.Name), nil
+			}
+			client.Debugf("%v, computing the checksum", err)
+		}
+	}
+
+	digest, err := streamChecksum(ctx, repo, asset, algorithm)
+	if err != nil {
+		return assetChecksum{}, err
+	}
+	return newAssetChecksum(asset.Name, checksum.Digest{Algorithm: algorithm, Hex: digest}, "computed"), nil
+}
+
+// newAssetChecksum fills in an assetChecksum, with the sha256 field only for
+// SHA-256 digests
+func newAssetChecksum(name string, digest checksum.Digest, source string) assetChecksum {
+	sum := assetChecksum{Name: name, Algorithm: digest.Algorithm.Name, Digest: digest.Hex, Source: source}
+	if digest.Algorithm.Name == checksum.SHA256.Name {
+		sum.SHA256 = digest.Hex
+	}
+	return sum
+}
+
+// streamChecksum hashes an asset as it is downloaded, without storing it
+func streamChecksum(ctx context.Context, repo release.Repo, asset release.Asset, algorithm checksum.Algorithm) (string, error) {
+	// Keep stdout to the checksums alone
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "Computing checksum of %s (%s)\n", asset.Name, download.FormatBytes(asset.Size))
+	}
+
+	body, err := repo.OpenAsset(ctx, asset)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	hash := algorithm.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", fmt.Errorf("error downloading %s: %w", asset.Name, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func init() {
+	checksumCmd.Flags().BoolVar(&checksumCompute, "compute", false, "Hash every asset by streaming it, ignoring published checksum files")
+	checksumCmd.Flags().StringVarP(&checksumOutput, "output", "o", "text", "Output format: text (sha256sum) or json")
+	checksumCmd.Flags().StringVarP(&checksumAlgorithm, "algorithm", "a", "sha256", "Checksum algorithm: "+checksum.Names())
+
+	rootCmd.AddCommand(checksumCmd)
+}
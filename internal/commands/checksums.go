@@ -0,0 +1,133 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/checksum"
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+// Checksum files are small, anything bigger is not a checksum file
+const maxChecksumSize = 1 << 20
+
+// genericChecksumFile is a combined checksum file not named after its
+// algorithm, which is told by the length of its digests
+const genericChecksumFile = "checksums.txt"
+
+// checksumFileNames are the names of the combined checksum files of an
+// algorithm, which list every asset
+func checksumFileNames(a checksum.Algorithm) []string {
+	return []string{a.SumsFile, a.SumsFile + ".txt", strings.ToLower(a.SumsFile) + ".txt"}
+}
+
+// checksumVerifier returns a FetchOptions.Verify function that checks a
+// downloaded asset against the checksum published in the release, of the
+// strongest algorithm there is one for
+func checksumVerifier(repo release.Repo, rel release.Release, assetName string) (func(ctx context.Context, filePath string) error, error) {
+	sumsAsset, perFile, found := checksumFile(rel, assetName, checksum.Algorithms)
+	if !found {
+		return nil, fmt.Errorf("no checksum file found for %s in release %s", assetName, rel.Name)
+	}
+
+	return func(ctx context.Context, filePath string) error {
+		data, err := fetchAssetData(ctx, repo, sumsAsset, maxChecksumSize)
+		if err != nil {
+			return err
+		}
+		expected, err := listedChecksum(data, sumsAsset, perFile, assetName)
+		if err != nil {
+			return err
+		}
+
+		if err := expected.Verify(filePath); err != nil {
+			return fmt.Errorf("%s: %v", assetName, err)
+		}
+		if expected.Algorithm.Weak {
+			warnf("%s is only checked with %s, which does not protect against tampering\n", assetName, expected.Algorithm.Tag)
+		}
+		infof("Verified %s checksum from %s\n", expected.Algorithm.Tag, sumsAsset.Name)
+		return nil
+	}, nil
+}
+
+// checksumFile finds the asset publishing the checksum of assetName with one
+// of the algorithms, preferring them in order and per-file checksums to
+// combined lists, and reports whether it is a per-file checksum
+func checksumFile(rel release.Release, assetName string, algorithms []checksum.Algorithm) (release.Asset, bool, bool) {
+	for _, a := range algorithms {
+		if sumsAsset, ok := findAsset(rel, assetName, a.Suffixes); ok {
+			return sumsAsset, true, true
+		}
+	}
+	for _, a := range algorithms {
+		for _, name := range checksumFileNames(a) {
+			if sumsAsset, ok := findAsset(rel, name, []string{""}); ok {
+				return sumsAsset, false, true
+			}
+		}
+	}
+	if sumsAsset, ok := findAsset(rel, genericChecksumFile, []string{""}); ok {
+		return sumsAsset, false, true
+	}
+	return release.Asset{}, false, false
+}
+
+// listedChecksum returns the digest of assetName from the contents of
+// sumsAsset
+func listedChecksum(data []byte, sumsAsset release.Asset, perFile bool, assetName string) (checksum.Digest, error) {
+	sums := checksum.Parse(sumsAsset.Name, data)
+	expected, ok := sums[assetName]
+	if !ok && perFile && len(sums) == 1 {
+		// A per-file checksum may name the file differently, or not at all
+		for _, digest := range sums {
+			expected, ok = digest, true
+		}
+	}
+	if !ok {
+		return checksum.Digest{}, fmt.Errorf("%s does not list %s", sumsAsset.Name, assetName)
+	}
+	return expected, nil
+}
+
+// isChecksumFile reports whether an asset holds checksums of other assets
+func isChecksumFile(name string) bool {
+	if name == genericChecksumFile {
+		return true
+	}
+	for _, a := range checksum.Algorithms {
+		if slices.Contains(checksumFileNames(a), name) {
+			return true
+		}
+		for _, suffix := range a.Suffixes {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// chainVerifiers runs each non-nil verifier in turn
+func chainVerifiers(verifiers ...func(ctx context.Context, filePath string) error) func(ctx context.Context, filePath string) error {
+	var active []func(ctx context.Context, filePath string) error
+	for _, verify := range verifiers {
+		if verify != nil {
+			active = append(active, verify)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	return func(ctx context.Context, filePath string) error {
+		for _, verify := range active {
+			if err := verify(ctx, filePath); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
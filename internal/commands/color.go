@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+var noColor bool
+
+// ANSI colors of human-readable output. The codes all have two digits, so
+// tabwriter columns stay aligned when every cell of a column is painted,
+// the plain ones with colorPlain.
+const (
+	colorPlain  = "39"
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+	colorCyan   = "36"
+	colorGray   = "90"
+)
+
+// colorTo reports whether output to f is colored: only on a terminal, and
+// never with --no-color, NO_COLOR set to anything or a dumb terminal
+func colorTo(f *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// paint colors s for standard output
+func paint(color, s string) string {
+	if !colorTo(os.Stdout) {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
+
+// warnf prints a warning to standard error
+func warnf(format string, args ...interface{}) {
+	prefix := "Warning:"
+	if colorTo(os.Stderr) {
+		prefix = "\x1b[" + colorYellow + "m" + prefix + "\x1b[0m"
+	}
+	fmt.Fprintf(os.Stderr, prefix+" "+format, args...)
+}
+
+// printError prints the error a command failed with to standard error
+func printError(err error) {
+	prefix := "Error:"
+	if colorTo(os.Stderr) {
+		prefix = "\x1b[" + colorRed + "m" + prefix + "\x1b[0m"
+	}
+	fmt.Fprintf(os.Stderr, "%s %v\n", prefix, err)
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Do not color the output (or set NO_COLOR)")
+}
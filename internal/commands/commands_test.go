@@ -0,0 +1,327 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/giteatest"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// testEnv is a fake Gitea instance with a configuration file pointing at it
+type testEnv struct {
+	srv    *giteatest.Server
+	config string
+}
+
+// newTestEnv serves the repositories "app" (tools group) and "lib", and
+// configures them under the same aliases
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	srv := giteatest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddRelease("owner", "app", client.Release{TagName: "v1.0.0", PublishedAt: "2024-01-01T00:00:00Z"}, map[string][]byte{"app-linux-amd64": []byte("app 1.0.0")})
+	srv.AddRelease("owner", "app", client.Release{TagName: "v1.1.0", PublishedAt: "2024-02-01T00:00:00Z"}, map[string][]byte{"app-linux-amd64": []byte("app 1.1.0")})
+	srv.AddRelease("owner", "app", client.Release{TagName: "v2.0.0-beta.1", Prerelease: true, PublishedAt: "2024-03-01T00:00:00Z"}, nil)
+	srv.AddRelease("owner", "lib", client.Release{TagName: "v0.1.0", PublishedAt: "2024-01-15T00:00:00Z"}, nil)
+
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+	t.Setenv("GITEA_RELEASE_PROFILE", "")
+
+	cfg := config.Config{
+		GiteaURL: srv.URL,
+		Repos: map[string]config.RepoDetails{
+			"app": {Owner: "owner", Name: "app", Groups: []string{"tools"}},
+			"lib": {Owner: "owner", Name: "lib"},
+		},
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "gitea-release.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return &testEnv{srv: srv, config: path}
+}
+
+// run executes the command line args against the environment and returns
+// what it printed to standard output
+func (e *testEnv) run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	resetFlags(rootCmd)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+
+	rootCmd.SetArgs(append([]string{"--config", e.config, "--progress", "none"}, args...))
+	// Errors are returned, usage texts are not wanted
+	rootCmd.SetOut(io.Discard)
+	rootCmd.SetErr(io.Discard)
+	err = rootCmd.ExecuteContext(context.Background())
+	w.Close()
+	return <-output, err
+}
+
+// resetFlags returns the flags of cmd and its subcommands to their defaults,
+// as the flag variables outlive a command run
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			var values []string
+			if def := strings.Trim(f.DefValue, "[]"); def != "" {
+				values = strings.Split(def, ",")
+			}
+			slice.Replace(values)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, sub := range cmd.Commands() {
+		resetFlags(sub)
+	}
+}
+
+func TestFetchCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "stable tag", args: []string{"fetch", "app", "--tag"}, want: "v1.1.0"},
+		{name: "latest tag", args: []string{"fetch", "app", "latest", "--tag"}, want: "v2.0.0-beta.1"},
+		{name: "channel suffix", args: []string{"fetch", "app@latest", "--tag"}, want: "v2.0.0-beta.1"},
+		{name: "given tag", args: []string{"fetch", "app", "v1.0.0", "--tag"}, want: "v1.0.0"},
+		{name: "date", args: []string{"fetch", "app", "v1.0.0", "--date"}, want: "2024-01-01T00:00:00Z"},
+		{name: "epoch date", args: []string{"fetch", "app", "v1.0.0", "--date", "--date-format", "epoch"}, want: "1704067200"},
+		{name: "unknown tag", args: []string{"fetch", "app", "v9.9.9", "--tag"}, wantErr: true},
+		{name: "unknown alias", args: []string{"fetch", "missing", "--tag"}, wantErr: true},
+		{name: "missing asset", args: []string{"fetch", "app", "--download", "other"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			got, err := env.run(t, tt.args...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("%s printed %q, want an error", strings.Join(tt.args, " "), got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", strings.Join(tt.args, " "), err)
+			}
+			if got != tt.want {
+				t.Errorf("%s printed %q, want %q", strings.Join(tt.args, " "), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchCommandDownload(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantFile string
+		wantData string
+	}{
+		{name: "stable", args: []string{"fetch", "app", "--download", "app-linux-amd64"}, wantFile: "app-linux-amd64", wantData: "app 1.1.0"},
+		{name: "given tag", args: []string{"fetch", "app", "v1.0.0", "--download", "app-linux-amd64"}, wantFile: "app-linux-amd64", wantData: "app 1.0.0"},
+		{name: "download as", args: []string{"fetch", "app", "--download", "app-linux-amd64", "--download-as", "app"}, wantFile: "app", wantData: "app 1.1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			dir := t.TempDir()
+			if _, err := env.run(t, append(tt.args, "--deploy", dir, "--quiet")...); err != nil {
+				t.Fatalf("%s: %v", strings.Join(tt.args, " "), err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+			if err != nil {
+				t.Fatalf("reading the deployed file: %v", err)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("deployed %q, want %q", data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string // Lines printed
+		wantErr bool
+	}{
+		{
+			name: "one repository",
+			args: []string{"list", "app", "-o", "csv"},
+			want: []string{
+				"tag,name,published_at,prerelease,assets,downloads,url",
+				"v2.0.0-beta.1,v2.0.0-beta.1,2024-03-01T00:00:00Z,true,0,0,{url}/owner/app/releases/tag/v2.0.0-beta.1",
+				"v1.1.0,v1.1.0,2024-02-01T00:00:00Z,false,1,0,{url}/owner/app/releases/tag/v1.1.0",
+				"v1.0.0,v1.0.0,2024-01-01T00:00:00Z,false,1,0,{url}/owner/app/releases/tag/v1.0.0",
+			},
+		},
+		{
+			name: "text",
+			args: []string{"list", "app", "--limit", "2"},
+			want: []string{
+				"TAG            NAME           PUBLISHED             ASSETS",
+				"v2.0.0-beta.1  v2.0.0-beta.1  2024-03-01T00:00:00Z  0",
+				"v1.1.0         v1.1.0         2024-02-01T00:00:00Z  1",
+			},
+		},
+		{
+			name: "filters",
+			args: []string{"list", "app", "--tag-filter", "v1.*", "--reverse", "-o", "tsv"},
+			want: []string{
+				"tag\tname\tpublished_at\tprerelease\tassets\tdownloads\turl",
+				"v1.0.0\tv1.0.0\t2024-01-01T00:00:00Z\tfalse\t1\t0\t{url}/owner/app/releases/tag/v1.0.0",
+				"v1.1.0\tv1.1.0\t2024-02-01T00:00:00Z\tfalse\t1\t0\t{url}/owner/app/releases/tag/v1.1.0",
+			},
+		},
+		{
+			name: "several repositories",
+			args: []string{"list", "lib", "app", "--limit", "1", "-o", "csv"},
+			want: []string{
+				"repo,tag,name,published_at,prerelease,assets,downloads,url",
+				"lib,v0.1.0,v0.1.0,2024-01-15T00:00:00Z,false,0,0,{url}/owner/lib/releases/tag/v0.1.0",
+				"app,v2.0.0-beta.1,v2.0.0-beta.1,2024-03-01T00:00:00Z,true,0,0,{url}/owner/app/releases/tag/v2.0.0-beta.1",
+			},
+		},
+		{
+			name: "every repository",
+			args: []string{"list", "--limit", "1"},
+			want: []string{
+				"REPO  TAG            NAME           PUBLISHED             ASSETS",
+				"app   v2.0.0-beta.1  v2.0.0-beta.1  2024-03-01T00:00:00Z  0",
+				"lib   v0.1.0         v0.1.0         2024-01-15T00:00:00Z  0",
+			},
+		},
+		{
+			name: "group",
+			args: []string{"list", "--group", "tools", "--tag-filter", "v1.0.*"},
+			want: []string{
+				"REPO  TAG     NAME    PUBLISHED             ASSETS",
+				"app   v1.0.0  v1.0.0  2024-01-01T00:00:00Z  1",
+			},
+		},
+		{
+			name: "no matches",
+			args: []string{"list", "--tag-filter", "v9.*"},
+			want: []string{"No releases found in 2 repositories"},
+		},
+		{name: "group and aliases", args: []string{"list", "app", "--group", "tools"}, wantErr: true},
+		{name: "unknown group", args: []string{"list", "--group", "services"}, wantErr: true},
+		{name: "unknown alias", args: []string{"list", "app", "missing"}, wantErr: true},
+		{name: "unknown format", args: []string{"list", "app", "-o", "xml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			got, err := env.run(t, tt.args...)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("%s printed %q, want an error", strings.Join(tt.args, " "), got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", strings.Join(tt.args, " "), err)
+			}
+
+			want := strings.ReplaceAll(strings.Join(tt.want, "\n")+"\n", "{url}", env.srv.URL)
+			if got != want {
+				t.Errorf("%s printed\n%s\nwant\n%s", strings.Join(tt.args, " "), got, want)
+			}
+		})
+	}
+}
+
+func TestServeTagCacheDirectories(t *testing.T) {
+	env := newTestEnv(t)
+	// Tags that a naive directory name would make collide
+	env.srv.AddRelease("owner", "lib", client.Release{TagName: "release/1.0"}, map[string][]byte{"lib.tar.gz": []byte("slash")})
+	env.srv.AddRelease("owner", "lib", client.Release{TagName: "release_1.0"}, map[string][]byte{"lib.tar.gz": []byte("underscore")})
+	cfg, err := config.Load(env.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &assetCache{ctx: context.Background(), cfg: cfg, dir: t.TempDir()}
+
+	tests := []struct {
+		path     string
+		want     string
+		wantCode int
+	}{
+		{"/repo/lib/release/1.0/lib.tar.gz", "slash", http.StatusOK},
+		{"/repo/lib/release_1.0/lib.tar.gz", "underscore", http.StatusOK},
+		{"/repo/lib/release/1.0/lib.tar.gz", "slash", http.StatusOK}, // From the cache
+		{"/repo/lib/release/2.0/lib.tar.gz", "", http.StatusNotFound},
+		{"/repo/lib/../lib.tar.gz", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		cache.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if recorder.Code != tt.wantCode {
+			t.Errorf("GET %s: status %d, want %d", tt.path, recorder.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantCode == http.StatusOK && recorder.Body.String() != tt.want {
+			t.Errorf("GET %s = %q, want %q", tt.path, recorder.Body.String(), tt.want)
+		}
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	tests := []struct {
+		interval string
+		wantErr  bool
+	}{
+		{"0s", true},
+		{"-1m", true},
+		{"9s", true},
+		{"10s", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.interval, func(t *testing.T) {
+			env := newTestEnv(t)
+			_, err := env.run(t, "watch", "lib", "--once", "--interval", tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("watch --interval %s: %v, want error %v", tt.interval, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/deploy"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateOnline bool
+	showTokens     bool
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and edit the configuration file",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the configuration with tokens redacted",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return err
+		}
+		if !showTokens {
+			cfg = cfg.Redacted()
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(cfg)
+	},
+}
+
+var configPathCmd = &cobra.Command{
+	Use:   "path",
+	Short: "Print the path of the configuration file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if config.IsRemote(configFile) {
+			fmt.Println(configFile)
+			return nil
+		}
+		path, err := filepath.Abs(configFile)
+		if err != nil {
+			return fmt.Errorf("error resolving config path: %v", err)
+		}
+		fmt.Println(path)
+		return nil
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Open the configuration file in $EDITOR",
+	Long: `Open the configuration file in the editor named by $VISUAL or $EDITOR and
+validate it once the editor exits.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if config.IsRemote(configFile) {
+			return fmt.Errorf("%s is remote, change it at its source", configFile)
+		}
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+			if runtime.GOOS == "windows" {
+				editor = "notepad"
+			}
+		}
+
+		// Run through the shell so editors with arguments, like "code --wait", work
+		var editCmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			editCmd = exec.CommandContext(cmd.Context(), "cmd", "/C", editor+" "+configFile)
+		} else {
+			editCmd = exec.CommandContext(cmd.Context(), "sh", "-c", editor+` "$0"`, configFile)
+		}
+		editCmd.Stdin = os.Stdin
+		editCmd.Stdout = os.Stdout
+		editCmd.Stderr = os.Stderr
+		if err := editCmd.Run(); err != nil {
+			return fmt.Errorf("error running editor %s: %v", editor, err)
+		}
+
+		if _, err := os.Stat(configFile); os.IsNotExist(err) {
+			// The editor exited without saving a new file
+			return nil
+		}
+		var problems []string
+		if data, err := config.Merged(configFile); err != nil {
+			problems = []string{err.Error()}
+		} else {
+			problems = config.Validate(data)
+		}
+		if len(problems) > 0 {
+			warnf("%s has problems:\n", configFile)
+			for _, problem := range problems {
+				fmt.Fprintf(os.Stderr, "  %s\n", problem)
+			}
+		}
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file for problems",
+	Long: `Check the configuration file, with its includes merged in, for unknown
+fields, duplicate aliases, repositories without an owner or name and invalid
+file modes. All problems are reported at once. With --online every Gitea URL is
+also checked for reachability.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := config.Merged(configFile)
+		if err != nil {
+			return err
+		}
+
+		problems := config.Validate(data)
+
+		// Only check values when the file decodes at all
+		if cfg, err := config.Load(configFile); err == nil {
+			aliases := make([]string, 0, len(cfg.Repos))
+			for alias := range cfg.Repos {
+				aliases = append(aliases, alias)
+			}
+			sort.Strings(aliases)
+
+			for _, alias := range aliases {
+				if chmod := cfg.Repos[alias].Chmod; chmod != "" {
+					if _, err := deploy.ParseFileMode(chmod); err != nil {
+						problems = append(problems, fmt.Sprintf("repos.%s.chmod: %v", alias, err))
+					}
+				}
+			}
+
+			if validateOnline {
+				// The version endpoint needs no token
+				urls := map[string]string{"gitea_url": cfg.GiteaURL}
+				for name, profile := range cfg.Profiles {
+					urls["profiles."+name+".gitea_url"] = profile.GiteaURL
+				}
+
+				fields := make([]string, 0, len(urls))
+				for field := range urls {
+					fields = append(fields, field)
+				}
+				sort.Strings(fields)
+
+				for _, field := range fields {
+					if urls[field] == "" {
+						continue
+					}
+					if _, err := client.New(urls[field], "").Version(cmd.Context()); err != nil {
+						problems = append(problems, fmt.Sprintf("%s: %s is not reachable: %v", field, urls[field], err))
+					}
+				}
+			}
+		}
+
+		if len(problems) > 0 {
+			cmd.SilenceUsage = true
+			for _, problem := range problems {
+				fmt.Fprintln(os.Stderr, problem)
+			}
+			return fmt.Errorf("%d problem(s) found in %s", len(problems), configFile)
+		}
+
+		infof("%s is valid\n", configFile)
+		return nil
+	},
+}
+
+var configPullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Fetch the remote includes of the configuration now",
+	Long: `Fetch the HTTPS and git includes of the configuration file now instead of
+when their cached copies expire, and fail if one cannot be fetched. A remote
+configuration file is fetched again as well.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		count, err := config.Refresh(configFile)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			infof("%s has no remote includes\n", configFile)
+			return nil
+		}
+		infof("%d remote include(s) of %s fetched\n", count, configFile)
+		return nil
+	},
+}
+
+var configEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt the tokens stored in the configuration file",
+	Long: `Encrypt every plaintext token in the configuration file, including the
+tokens and passwords of notifiers, with AES-256-GCM, using a key derived from
+a passphrase. The passphrase is read from --key-file,
+$` + keyFileEnv + ` or $` + passphraseEnv + `, or prompted for. Commands that need
+an encrypted token read the passphrase the same way.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadFile(configFile)
+		if err != nil {
+			return err
+		}
+
+		passphrase, err := readPassphrase(true)
+		if err != nil {
+			return err
+		}
+
+		count, err := cfg.EncryptTokens(passphrase)
+		if err != nil {
+			return fmt.Errorf("error encrypting tokens: %v", err)
+		}
+		if count == 0 {
+			infof("No plaintext tokens to encrypt\n")
+			return nil
+		}
+
+		if err := config.Save(cfg, configFile); err != nil {
+			return err
+		}
+		infof("%d token(s) encrypted in %s\n", count, configFile)
+		return nil
+	},
+}
+
+var configDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt the tokens stored in the configuration file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadFile(configFile)
+		if err != nil {
+			return err
+		}
+
+		passphrase, err := readPassphrase(false)
+		if err != nil {
+			return err
+		}
+
+		count, err := cfg.DecryptTokens(passphrase)
+		if err != nil {
+			return fmt.Errorf("error decrypting tokens: %v", err)
+		}
+		if count == 0 {
+			infof("No encrypted tokens to decrypt\n")
+			return nil
+		}
+
+		if err := config.Save(cfg, configFile); err != nil {
+			return err
+		}
+		infof("%d token(s) decrypted in %s\n", count, configFile)
+		return nil
+	},
+}
+
+func init() {
+	configValidateCmd.Flags().BoolVar(&validateOnline, "online", false, "Also check that the Gitea URLs are reachable")
+
+	configShowCmd.Flags().BoolVar(&showTokens, "show-tokens", false, "Print tokens instead of redacting them")
+
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configPathCmd)
+	configCmd.AddCommand(configEditCmd)
+	configCmd.AddCommand(configEncryptCmd)
+	configCmd.AddCommand(configDecryptCmd)
+	configCmd.AddCommand(configPullCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/earentir/gitea-release/internal/cosign"
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+// Signature assets are small, anything bigger is not a signature
+const maxSignatureSize = 1 << 20
+
+// Asset name suffixes cosign output is looked up under, in order of preference
+var (
+	bundleSuffixes      = []string{".sigstore.json", ".sigstore", ".bundle"}
+	signatureSuffixes   = []string{".sig"}
+	certificateSuffixes = []string{".pem", ".crt", ".cert"}
+)
+
+var cosignPolicy cosign.Policy
+
+// cosignEnabled reports whether any cosign identity flag was given
+func cosignEnabled() bool {
+	p := cosignPolicy
+	return p.Identity != "" || p.IdentityRegexp != "" || p.Issuer != "" || p.IssuerRegexp != ""
+}
+
+// cosignVerifier returns a FetchOptions.Verify function that checks a
+// downloaded asset against the cosign bundle, or signature and certificate,
+// published next to it in the release
+func cosignVerifier(repo release.Repo, rel release.Release, assetName string) (func(ctx context.Context, filePath string) error, error) {
+	if bundleAsset, ok := findAsset(rel, assetName, bundleSuffixes); ok {
+		return func(ctx context.Context, filePath string) error {
+			bundleJSON, err := fetchAssetData(ctx, repo, bundleAsset, maxSignatureSize)
+			if err != nil {
+				return err
+			}
+			if err := cosign.VerifyBundle(filePath, bundleJSON, cosignPolicy); err != nil {
+				return fmt.Errorf("%s: %v", assetName, err)
+			}
+			infof("Verified cosign bundle %s\n", bundleAsset.Name)
+			return nil
+		}, nil
+	}
+
+	sigAsset, hasSig := findAsset(rel, assetName, signatureSuffixes)
+	certAsset, hasCert := findAsset(rel, assetName, certificateSuffixes)
+	if !hasSig || !hasCert {
+		return nil, fmt.Errorf("no cosign bundle or signature and certificate found for %s in release %s", assetName, rel.Name)
+	}
+
+	return func(ctx context.Context, filePath string) error {
+		sig, err := fetchAssetData(ctx, repo, sigAsset, maxSignatureSize)
+		if err != nil {
+			return err
+		}
+		cert, err := fetchAssetData(ctx, repo, certAsset, maxSignatureSize)
+		if err != nil {
+			return err
+		}
+		if err := cosign.VerifySignature(filePath, sig, cert, cosignPolicy); err != nil {
+			return fmt.Errorf("%s: %v", assetName, err)
+		}
+		infof("Verified cosign signature %s\n", sigAsset.Name)
+		return nil
+	}, nil
+}
+
+func findAsset(rel release.Release, assetName string, suffixes []string) (release.Asset, bool) {
+	for _, suffix := range suffixes {
+		for _, asset := range rel.Assets {
+			if asset.Name == assetName+suffix {
+				return asset, true
+			}
+		}
+	}
+	return release.Asset{}, false
+}
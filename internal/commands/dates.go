@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date formats accepted by --date-format besides Go time layouts
+const (
+	dateFormatRFC3339  = "rfc3339"
+	dateFormatRelative = "relative"
+	dateFormatEpoch    = "epoch"
+)
+
+// formatDate renders a timestamp from the API with --date-format, or the
+// date_format config default. Without either, and for values that are not
+// RFC 3339, the value is returned as the API sent it.
+func formatDate(value string) string {
+	if dateFormat == "" || dateFormat == dateFormatRFC3339 {
+		return value
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+
+	switch dateFormat {
+	case dateFormatRelative:
+		return relativeTime(t, time.Now())
+	case dateFormatEpoch:
+		return strconv.FormatInt(t.Unix(), 10)
+	default:
+		// Custom layouts are meant for people, so use their time zone
+		return t.Local().Format(dateFormat)
+	}
+}
+
+// publishedText formats a publish date and adds how long ago that was, as
+// in 2024-01-02T10:00:00Z, 3 days ago
+func publishedText(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil || dateFormat == dateFormatRelative {
+		return formatDate(value)
+	}
+	return fmt.Sprintf("%s, %s", formatDate(value), relativeTime(t, time.Now()))
+}
+
+// relativeTime describes t as seen from now, such as 3 days ago or in 2 hours
+func relativeTime(t, now time.Time) string {
+	const day = 24 * time.Hour
+
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var n time.Duration
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = d/time.Minute, "minute"
+	case d < day:
+		n, unit = d/time.Hour, "hour"
+	case d < 30*day:
+		n, unit = d/day, "day"
+	case d < 365*day:
+		n, unit = d/(30*day), "month"
+	default:
+		n, unit = d/(365*day), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+
+	if future {
+		return fmt.Sprintf("in %d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %s ago", n, unit)
+}
+
+// parseDate accepts a plain date (2006-01-02) or a full RFC 3339 timestamp
+func parseDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date '%s', use YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, false, nil
+}
+
+// parseAge parses a duration such as 90d, 2w or 36h
+func parseAge(value string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if number, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(number)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age '%s', use e.g. 90d, 2w or 36h", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age '%s', use e.g. 90d, 2w or 36h", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,153 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/earentir/gitea-release/internal/checksum"
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/lockfile"
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+// printInstalledDiff compares the assets of rel with the installed assets
+// recorded in the lockfile. Installed assets are CHANGED when their digest
+// differs from the checksum file of rel, or without one when their size
+// differs. Assets ADDED to or REMOVED from rel are relative to the release
+// installed last.
+func printInstalledDiff(ctx context.Context, repo release.Repo, alias string, rel release.Release) error {
+	lock, err := lockfile.Load(lockfile.PathFor(configFile))
+	if err != nil {
+		return err
+	}
+
+	// Keep only the newest entry per asset
+	installed := make(map[string]lockfile.Entry)
+	var newest lockfile.Entry
+	for _, entry := range lock.ForAlias(alias) {
+		if current, ok := installed[entry.Asset]; !ok || entry.DownloadedAt.After(current.DownloadedAt) {
+			installed[entry.Asset] = entry
+		}
+		if entry.DownloadedAt.After(newest.DownloadedAt) {
+			newest = entry
+		}
+	}
+	if len(installed) == 0 {
+		return fmt.Errorf("no installed files recorded for %s", alias)
+	}
+
+	assets := make(map[string]release.Asset)
+	for _, asset := range rel.Assets {
+		assets[asset.Name] = asset
+	}
+	sums := releaseChecksums(ctx, repo, rel)
+
+	type row struct{ status, asset, details string }
+	var rows []row
+
+	for name, entry := range installed {
+		asset, ok := assets[name]
+		sum, published := sums[name]
+		switch {
+		case !ok:
+			rows = append(rows, row{"REMOVED", name, "installed from " + entry.Tag})
+		case published && !sameDigest(sum, entry):
+			rows = append(rows, row{"CHANGED", name, fmt.Sprintf("%s -> %s, digest differs", entry.Tag, rel.TagName)})
+		case published:
+			rows = append(rows, row{"UNCHANGED", name, fmt.Sprintf("%s -> %s, same digest", entry.Tag, rel.TagName)})
+		case asset.Size != entry.Size:
+			rows = append(rows, row{"CHANGED", name, fmt.Sprintf("%s -> %s, %d -> %d bytes", entry.Tag, rel.TagName, entry.Size, asset.Size)})
+		case entry.Tag == rel.TagName:
+			rows = append(rows, row{"UNCHANGED", name, "installed from " + entry.Tag})
+		default:
+			rows = append(rows, row{"SAME SIZE", name, fmt.Sprintf("%s -> %s, no checksums to compare", entry.Tag, rel.TagName)})
+		}
+	}
+
+	// Assets new since the installed release, which may no longer exist
+	if newest.Tag != rel.TagName {
+		installedRelease, err := repo.Find(ctx, newest.Tag)
+		if err != nil {
+			client.Debugf("cannot list the assets of %s: %v", newest.Tag, err)
+		} else {
+			previous := make(map[string]bool)
+			for _, asset := range installedRelease.Assets {
+				previous[asset.Name] = true
+			}
+			for _, asset := range rel.Assets {
+				if _, ok := installed[asset.Name]; !ok && !previous[asset.Name] {
+					rows = append(rows, row{"ADDED", asset.Name, "new in " + rel.TagName})
+				}
+			}
+			for _, asset := range installedRelease.Assets {
+				if _, ok := assets[asset.Name]; !ok {
+					if _, ok := installed[asset.Name]; !ok {
+						rows = append(rows, row{"REMOVED", asset.Name, "not installed"})
+					}
+				}
+			}
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].asset < rows[j].asset })
+
+	fmt.Printf("Installed %s, comparing with %s\n", newest.Tag, rel.TagName)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tASSET\tDETAILS\n", paint(colorPlain, "STATUS"))
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", paint(diffColors[r.status], r.status), r.asset, r.details)
+	}
+	return w.Flush()
+}
+
+// diffColors are the colors of the statuses of installed assets
+var diffColors = map[string]string{
+	"CHANGED":   colorYellow,
+	"SAME SIZE": colorPlain,
+	"UNCHANGED": colorPlain,
+	"ADDED":     colorGreen,
+	"REMOVED":   colorRed,
+}
+
+// releaseChecksums collects the digests published in the combined checksum
+// files of a release, by asset name, of the strongest algorithm listing
+// each asset. Unreadable checksum files are skipped.
+func releaseChecksums(ctx context.Context, repo release.Repo, rel release.Release) map[string]checksum.Digest {
+	var names []string
+	for _, a := range checksum.Algorithms {
+		names = append(names, checksumFileNames(a)...)
+	}
+	names = append(names, genericChecksumFile)
+
+	sums := make(map[string]checksum.Digest)
+	for _, name := range names {
+		asset, ok := findAsset(rel, name, []string{""})
+		if !ok {
+			continue
+		}
+		data, err := fetchAssetData(ctx, repo, asset, maxChecksumSize)
+		if err != nil {
+			client.Debugf("cannot read %s: %v", asset.Name, err)
+			continue
+		}
+		for file, sum := range checksum.Parse(asset.Name, data) {
+			if _, seen := sums[file]; !seen {
+				sums[file] = sum
+			}
+		}
+	}
+	return sums
+}
+
+// sameDigest reports whether an installed file has the published digest,
+// comparing with the SHA-256 in the lockfile or, for other algorithms,
+// hashing the file
+func sameDigest(sum checksum.Digest, entry lockfile.Entry) bool {
+	if sum.Algorithm.Name == checksum.SHA256.Name {
+		return sum.Hex == entry.SHA256
+	}
+	return sum.Verify(entry.Path) == nil
+}
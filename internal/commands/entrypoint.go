@@ -0,0 +1,235 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/archive"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+// Environment variables read by the entrypoint command
+const (
+	envURL             = "GITEA_RELEASE_URL"
+	envToken           = "GITEA_RELEASE_TOKEN"
+	envTokenFile       = "GITEA_RELEASE_TOKEN_FILE"
+	envRepo            = "GITEA_RELEASE_REPO"
+	envTag             = "GITEA_RELEASE_TAG"
+	envAsset           = "GITEA_RELEASE_ASSET"
+	envTarget          = "GITEA_RELEASE_TARGET"
+	envExtract         = "GITEA_RELEASE_EXTRACT"
+	envStripComponents = "GITEA_RELEASE_STRIP_COMPONENTS"
+	envChmod           = "GITEA_RELEASE_CHMOD"
+	envFetchedTag      = "GITEA_RELEASE_FETCHED_TAG"
+)
+
+// entrypointSettings are the entrypoint options collected from the environment
+type entrypointSettings struct {
+	Repo            release.Repo
+	Tag             string
+	Asset           string // Asset name or glob
+	Target          string
+	Extract         string // auto, true or false
+	StripComponents int
+	Chmod           string
+}
+
+var entrypointCmd = &cobra.Command{
+	Use:   "entrypoint [-- command [args...]]",
+	Short: "Fetch a release asset configured through the environment, then run a command",
+	Long: `Fetch a release asset into a target directory and then replace this process with
+the given command, for Docker entrypoints and init containers. No config file is
+used, all settings come from the environment:
+
+  ` + envURL + `              Gitea URL (required)
+  ` + envRepo + `             Repository as owner/name (required)
+  ` + envAsset + `            Asset name or glob, e.g. app_*_linux_amd64.tar.gz (required)
+  ` + envToken + `            API token, or ` + envTokenFile + ` to read it from a file
+  ` + envTag + `              Release tag or title, or latest to include pre-releases (default: stable)
+  ` + envTarget + `           Directory to put the asset in (default: current directory)
+  ` + envExtract + `          auto, true or false; auto extracts tarballs, .zip and .gz, .zst, .xz or .bz2 files (default: auto)
+  ` + envStripComponents + ` Leading path elements to strip when extracting
+  ` + envChmod + `            File mode for an asset that is not extracted, e.g. 0755
+
+The command runs with ` + envFetchedTag + ` set to the fetched tag and without
+` + envToken + ` in its environment.`,
+	Example: `  ENTRYPOINT ["gitea-release", "entrypoint", "--"]
+  CMD ["/app/server", "--port", "8080"]`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Nothing on the command line is wrong when the environment is
+		cmd.SilenceUsage = true
+
+		settings, err := entrypointSettingsFromEnv()
+		if err != nil {
+			return err
+		}
+
+		targetRelease, err := settings.Repo.Find(cmd.Context(), settings.Tag)
+		if err != nil {
+			return err
+		}
+
+		assetName, err := matchAsset(targetRelease, settings.Asset)
+		if err != nil {
+			return err
+		}
+
+		if err := fetchEntrypointAsset(cmd.Context(), settings, targetRelease, assetName); err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			return nil
+		}
+
+		env := []string{envFetchedTag + "=" + targetRelease.TagName}
+		for _, entry := range os.Environ() {
+			if !strings.HasPrefix(entry, envToken+"=") && !strings.HasPrefix(entry, envFetchedTag+"=") {
+				env = append(env, entry)
+			}
+		}
+		return execCommand(args, env)
+	},
+}
+
+// fetchEntrypointAsset downloads the asset into the target directory,
+// extracting it if it is an archive. Temporary files are gone when it
+// returns, as nothing cleans up after the exec.
+func fetchEntrypointAsset(ctx context.Context, settings entrypointSettings, rel release.Release, assetName string) error {
+	extract := settings.Extract == "true" || (settings.Extract == "auto" && (archive.IsArchive(assetName) || archive.IsCompressed(assetName)))
+	if !extract {
+		finalPath, err := settings.Repo.Fetch(ctx, rel, release.FetchOptions{
+			Asset:        assetName,
+			DeployPath:   settings.Target,
+			Mode:         settings.Chmod,
+			HideProgress: !showProgress(),
+			ProgressJSON: progressJSON(),
+			StallTimeout: stallTimeout(),
+		})
+		if err != nil {
+			return err
+		}
+		infof("%s from release %s has been downloaded to %s\n", assetName, rel.TagName, finalPath)
+		return nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "gitea-release-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archivePath, err := settings.Repo.Fetch(ctx, rel, release.FetchOptions{
+		Asset:        assetName,
+		SaveAs:       filepath.Join(tmpDir, assetName),
+		HideProgress: !showProgress(),
+		ProgressJSON: progressJSON(),
+		StallTimeout: stallTimeout(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := archive.Extract(archivePath, settings.Target, archive.Options{StripComponents: settings.StripComponents}); err != nil {
+		return fmt.Errorf("error extracting %s: %v", assetName, err)
+	}
+	infof("%s from release %s has been extracted to %s\n", assetName, rel.TagName, settings.Target)
+	return nil
+}
+
+// entrypointSettingsFromEnv reads the entrypoint settings, reporting every
+// missing or invalid variable at once
+func entrypointSettingsFromEnv() (entrypointSettings, error) {
+	var problems []string
+	required := func(name string) string {
+		value := os.Getenv(name)
+		if value == "" {
+			problems = append(problems, name+" is not set")
+		}
+		return value
+	}
+
+	var settings entrypointSettings
+	settings.Repo.BaseURL = required(envURL)
+	repo := required(envRepo)
+	settings.Asset = required(envAsset)
+	settings.Tag = os.Getenv(envTag)
+	settings.Target = os.Getenv(envTarget)
+	settings.Extract = strings.ToLower(os.Getenv(envExtract))
+	settings.Chmod = os.Getenv(envChmod)
+
+	if repo != "" {
+
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+			problems = append(problems, fmt.Sprintf("%s must be owner/name, got %q", envRepo, repo))
+		}
+		settings.Repo.Owner, settings.Repo.Name = owner, name
+	}
+
+	settings.Repo.Token = os.Getenv(envToken)
+	if tokenFile := os.Getenv(envTokenFile); tokenFile != "" && settings.Repo.Token == "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", envTokenFile, err))
+		}
+		settings.Repo.Token = strings.TrimSpace(string(data))
+	}
+
+	if settings.Tag == "" {
+		settings.Tag = release.Stable
+	}
+	if settings.Target == "" {
+		settings.Target = "."
+	}
+
+	switch settings.Extract {
+	case "":
+		settings.Extract = "auto"
+	case "auto":
+	default:
+		extract, err := strconv.ParseBool(settings.Extract)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s must be auto, true or false, got %q", envExtract, settings.Extract))
+		}
+		settings.Extract = strconv.FormatBool(extract)
+	}
+
+	if strip := os.Getenv(envStripComponents); strip != "" {
+		n, err := strconv.Atoi(strip)
+		if err != nil || n < 0 {
+			problems = append(problems, fmt.Sprintf("%s must be a non-negative number, got %q", envStripComponents, strip))
+		}
+		settings.StripComponents = n
+	}
+
+	if len(problems) > 0 {
+		return entrypointSettings{}, fmt.Errorf("invalid entrypoint environment:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return settings, nil
+}
+
+// matchAsset returns the name of the asset matching a name or glob
+func matchAsset(rel release.Release, pattern string) (string, error) {
+	assets, err := matchAssets(rel, pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(assets) > 1 {
+		names := make([]string, len(assets))
+		for i, asset := range assets {
+			names[i] = asset.Name
+		}
+		return "", fmt.Errorf("'%s' matches several assets in release %s: %s", pattern, rel.Name, strings.Join(names, ", "))
+	}
+	return assets[0].Name, nil
+}
+
+func init() {
+	rootCmd.AddCommand(entrypointCmd)
+}
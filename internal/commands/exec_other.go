@@ -0,0 +1,31 @@
+//go:build !unix
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// execCommand runs command and exits with its exit code, as processes
+// cannot be replaced on this platform
+func execCommand(command []string, env []string) error {
+	c := exec.Command(command[0], command[1:]...)
+	c.Env = env
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return fmt.Errorf("error running %s: %v", command[0], err)
+	}
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package commands
+
+import (
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// execCommand replaces the current process with command, so it receives
+// signals directly and becomes PID 1 in a container
+func execCommand(command []string, env []string) error {
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		return fmt.Errorf("error finding %s: %v", command[0], err)
+	}
+	if err := syscall.Exec(path, command, env); err != nil {
+		return fmt.Errorf("error running %s: %v", command[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/feed"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	feedOut   string
+	feedLimit int
+)
+
+var feedCmd = &cobra.Command{
+	Use:   "feed [repo-alias...]",
+	Short: "Render the release history as an Atom feed",
+	Long: `Render the releases of the given repositories, of those in a --group or of
+every configured repository, as an Atom feed for feed readers. The feed is
+written to stdout unless --out is given. serve publishes the same feed at /feed
+and /feed/<alias>.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		aliases, err := selectAliases(cfg, args, groupFlag)
+		if err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		if err := writeFeed(cmd.Context(), &buf, cfg, aliases, feedLimit); err != nil {
+			return err
+		}
+
+		if feedOut == "" {
+			_, err := os.Stdout.Write(buf.Bytes())
+			return err
+		}
+		if err := os.WriteFile(feedOut, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing feed: %v", err)
+		}
+		infof("Feed written to %s\n", feedOut)
+		return nil
+	},
+}
+
+// writeFeed renders the newest limit releases of the aliases, or of every
+// configured repository when there are none, as an Atom feed
+func writeFeed(ctx context.Context, buf *bytes.Buffer, cfg *config.Config, aliases []string, limit int) error {
+	if len(aliases) == 0 {
+		for alias := range cfg.Repos {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+	}
+	if len(aliases) == 0 {
+		return fmt.Errorf("no repositories configured")
+	}
+
+	baseURL := strings.TrimRight(cfg.GiteaURL, "/")
+	f := feed.Feed{ID: baseURL + "/", Title: "Releases", Link: baseURL, Limit: limit}
+	for _, alias := range aliases {
+		details, ok := cfg.Repos[alias]
+		if !ok {
+			return fmt.Errorf("repository alias %s not found", alias)
+		}
+		repo, err := releaseRepo(cfg, alias, details)
+		if err != nil {
+			return err
+		}
+		releases, err := repo.List(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", alias, err)
+		}
+
+		name := details.Owner + "/" + details.Name
+		for _, rel := range releases {
+			f.Entries = append(f.Entries, feed.Entry{Repo: name, Release: rel})
+		}
+		if len(aliases) == 1 {
+			f.ID = baseURL + "/" + name + "/releases"
+			f.Title = "Releases of " + name
+			f.Link = f.ID
+		}
+	}
+
+	return f.WriteAtom(buf)
+}
+
+func init() {
+	feedCmd.Flags().StringVar(&groupFlag, "group", "", "Only releases of the repositories in this group")
+	feedCmd.Flags().StringVar(&feedOut, "out", "", "Write the feed to this file instead of stdout")
+	feedCmd.Flags().IntVar(&feedLimit, "limit", 50, "Maximum number of releases in the feed (0 for all)")
+
+	rootCmd.AddCommand(feedCmd)
+}
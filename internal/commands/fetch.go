@@ -0,0 +1,565 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/checksum"
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/delta"
+	"github.com/earentir/gitea-release/internal/download"
+	"github.com/earentir/gitea-release/internal/lockfile"
+	"github.com/earentir/gitea-release/internal/runlock"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	downloadFlag    string
+	sourceFormat    string
+	deployPath      string
+	tagOnly         bool
+	dateOnly        bool
+	assetURLPattern string
+	chmodFlag       string
+	chownFlag       string
+	downloadAs      string
+	deployStrategy  string
+	keepReleases    int
+	fetchDetails    bool
+	tempDir         string
+	noSpaceCheck    bool
+	limitRate       string
+	verifyChecksum  bool
+	commitOnly      bool
+	diffInstalled   bool
+	chunks          int
+	fetchMaxAge     string
+	listOnly        bool
+	noDelta         bool
+	extractFile     string
+	postVerify      string
+	expectOutput    string
+	redownload      bool
+	preserveTimes   bool
+)
+
+var fetchCmd = &cobra.Command{
+	Use:   "fetch [repo-alias[@channel]] [release-tag-or-channel]",
+	Short: "Fetch a specific or the latest release for a repository",
+	Long:  "Fetch a specific release by tag/title, the newest stable release (stable) or the newest release including pre-releases (latest) for a repository. Without one the repository's channel is used, stable unless configured otherwise. alias@channel selects the newest release of a channel named in the config, whose tags match its pattern.",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return showAvailableRepos()
+		}
+
+		// Without a release tag/title, the newest release of the repository's channel
+		alias, releaseIdentifier, _, err := releaseArgs(args, 0)
+		if err != nil {
+			return err
+		}
+
+		var maxAge time.Duration
+		if fetchMaxAge != "" {
+			var err error
+			if maxAge, err = parseAge(fetchMaxAge); err != nil {
+				return err
+			}
+		}
+
+		cfg, repoDetails, err := loadRepo(alias)
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, alias, repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), releaseIdentifier)
+		if err != nil {
+			return err
+		}
+		if releaseIdentifier == "" && repo.Pinned != "" {
+			if newer, ok := newerThanPinned(cmd.Context(), repo, targetRelease); ok {
+				warnf("%s is pinned to %s, %s is newer\n", alias, targetRelease.TagName, newer.TagName)
+			}
+		}
+
+		// Refuse stale releases before printing or downloading anything
+		if err := checkReleaseAge(targetRelease, maxAge); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+
+		if downloadFlag != "" && sourceFormat != "" {
+			return fmt.Errorf("--download and --source cannot be used together")
+		}
+		if listOnly && downloadFlag == "" {
+			return fmt.Errorf("--list-only needs --download")
+		}
+		if extractFile != "" && downloadFlag == "" && sourceFormat == "" {
+			return fmt.Errorf("--extract-file needs --download or --source")
+		}
+		if expectOutput != "" && postVerify == "" {
+			return fmt.Errorf("--expect-output needs --post-verify")
+		}
+		if postVerify != "" && deployStrategy == release.StrategyVersioned && keepReleases == 1 {
+			// The previous release must survive pruning to be rolled back to
+			return fmt.Errorf("--post-verify with the versioned deploy strategy needs --keep 0 or at least 2")
+		}
+
+		if diffInstalled {
+			return printInstalledDiff(cmd.Context(), repo, alias, targetRelease)
+		}
+
+		if downloadFlag != "" || sourceFormat != "" {
+			var rateLimit int64
+			if limitRate != "" {
+				if rateLimit, err = download.ParseRate(limitRate); err != nil {
+					return err
+				}
+			}
+
+			// Flags take precedence over the per-repo and profile defaults
+			deployTo := cfg.DeployPath
+			if deployPath != "" {
+				deployTo = deployPath
+			}
+			mode, owner := repoDetails.Chmod, repoDetails.Chown
+			if chmodFlag != "" {
+				mode = chmodFlag
+			}
+			if chownFlag != "" {
+				owner = chownFlag
+			}
+
+			if deployTo, err = expandPlaceholders(deployTo, "--deploy", repoDetails.Name, targetRelease); err != nil {
+				return err
+			}
+			saveAs, err := expandPlaceholders(downloadAs, "--download-as", repoDetails.Name, targetRelease)
+			if err != nil {
+				return err
+			}
+			member, err := expandPlaceholders(extractFile, "--extract-file", repoDetails.Name, targetRelease)
+			if err != nil {
+				return err
+			}
+			var checkDeployed func(ctx context.Context, finalPath string) error
+			if postVerify != "" {
+				expect, err := expandPlaceholders(expectOutput, "--expect-output", repoDetails.Name, targetRelease)
+				if err != nil {
+					return err
+				}
+				if checkDeployed, err = commandCheck("post-verify", postVerify, expect); err != nil {
+					return err
+				}
+			}
+
+			// A source archive is fetched by format, assets by name or glob
+			names := []string{""}
+			var assets []release.Asset
+			if downloadFlag != "" {
+				if assets, err = matchAssets(targetRelease, downloadFlag); err != nil {
+					return err
+				}
+				if listOnly {
+					return printAssetPreview(assets)
+				}
+				if len(assets) > 1 && downloadAs != "" {
+					return fmt.Errorf("--download-as needs a single asset, '%s' matches %d", downloadFlag, len(assets))
+				}
+				if len(assets) > 1 && extractFile != "" {
+					return fmt.Errorf("--extract-file needs a single asset, '%s' matches %d", downloadFlag, len(assets))
+				}
+				names = names[:0]
+				for _, asset := range assets {
+					names = append(names, asset.Name)
+				}
+			}
+
+			if verifyChecksum && downloadFlag == "" {
+				return fmt.Errorf("checksum verification is only available for assets, not source archives")
+			}
+			if cosignEnabled() && downloadFlag == "" {
+				return fmt.Errorf("cosign verification is only available for assets, not source archives")
+			}
+			if verifyProvenance && downloadFlag == "" {
+				return fmt.Errorf("provenance verification is only available for assets, not source archives")
+			}
+			if verifyProvenance && repoDetails.Provenance == nil {
+				return fmt.Errorf("repository %s has no provenance policy, add builder_id and source_uri under provenance in its config", alias)
+			}
+
+			// Set up verification of every asset before downloading any
+			verifiers := make(map[string]func(ctx context.Context, filePath string) error)
+			for _, name := range names {
+				var verifySum, verifySignature, verifyBuild func(ctx context.Context, filePath string) error
+				if verifyChecksum {
+					if verifySum, err = checksumVerifier(repo, targetRelease, name); err != nil {
+						return err
+					}
+				}
+				if cosignEnabled() {
+					if verifySignature, err = cosignVerifier(repo, targetRelease, name); err != nil {
+						return err
+					}
+				}
+				if verifyProvenance {
+					if verifyBuild, err = provenanceVerifier(repo, targetRelease, name, repoDetails.Provenance); err != nil {
+						return err
+					}
+				}
+				verifiers[name] = chainVerifiers(verifySum, verifySignature, verifyBuild)
+			}
+
+			// Anything failing from here on is not a usage mistake
+			cmd.SilenceUsage = true
+
+			// Another run deploying to the same place would race this one
+			if deployTo != "" {
+				lock, err := runlock.Acquire(cmd.Context(), deployTo, runLock)
+				if err != nil {
+					return err
+				}
+				defer lock.Release()
+			}
+
+			var summary *transferSummary
+			if len(assets) > 1 {
+				summary = startTransferSummary(repo.BaseURL, assets, rateLimit)
+			}
+			for _, name := range names {
+				var installed *release.InstalledAsset
+				// A patch applies to the whole asset, not to a file taken from it
+				if name != "" && !noDelta && member == "" {
+					installed = installedCopy(alias, name, targetRelease)
+				}
+
+				opts := release.FetchOptions{
+					Asset:      name,
+					Source:     sourceFormat,
+					SaveAs:     saveAs,
+					DeployPath: deployTo,
+					Strategy:   deployStrategy,
+					Keep:       keepReleases,
+					Mode:       mode,
+					Owner:      owner,
+					TempDir:    tempDir,
+
+					ExtractFile:    member,
+					SkipSpaceCheck: noSpaceCheck,
+					RateLimit:      rateLimit,
+					Chunks:         chunks,
+					HideProgress:   !showProgress(),
+					ProgressJSON:   progressJSON(),
+					StallTimeout:   stallTimeout(),
+					Verify:         verifiers[name],
+					PostVerify:     checkDeployed,
+					Installed:      installed,
+
+					PreserveTimestamps: preserveTimes,
+					ConfirmOverwrite:   confirmOverwrite,
+				}
+				if summary != nil {
+					opts.Received = &summary.received
+				}
+				if name != "" && !redownload {
+					opts.Identical = identicalCheck(repo, targetRelease, alias, name)
+				}
+				finalPath, err := repo.Fetch(cmd.Context(), targetRelease, opts)
+				var spaceErr *download.SpaceError
+				if errors.As(err, &spaceErr) {
+					return fmt.Errorf("%v (use --no-space-check to download anyway)", err)
+				}
+				upToDate := errors.Is(err, release.ErrUpToDate)
+				if err != nil && !upToDate {
+					return err
+				}
+
+				fileName := name
+				if fileName == "" {
+					fileName = filepath.Base(finalPath)
+				}
+				described := fileName
+				if member != "" {
+					described = fmt.Sprintf("%s in %s", member, fileName)
+				}
+
+				if err := recordInstall(alias, targetRelease.TagName, fileName, finalPath); err != nil {
+					return err
+				}
+
+				if upToDate {
+					if summary != nil {
+						summary.skipped++
+					}
+					infof("\n%s from release %s is already up to date at %s\n", described, targetRelease.Name, finalPath)
+					continue
+				}
+
+				if deployTo != "" {
+					infof("\n%s from release %s has been downloaded and deployed to %s\n",
+						described, targetRelease.Name, finalPath)
+				} else {
+					infof("\n%s from release %s has been downloaded to %s\n",
+						described, targetRelease.Name, finalPath)
+				}
+			}
+			if summary != nil {
+				summary.finish()
+			}
+
+			return nil
+		}
+
+		// Handle simplified output formats
+		if assetURLPattern != "" {
+			// Print only the download URLs of the matching assets
+			var matched bool
+			for _, asset := range targetRelease.Assets {
+				ok, err := path.Match(assetURLPattern, asset.Name)
+				if err != nil {
+					return fmt.Errorf("invalid asset pattern '%s': %v", assetURLPattern, err)
+				}
+				if ok {
+					fmt.Println(asset.BrowserDownloadURL)
+					matched = true
+				}
+			}
+
+			if !matched {
+				return fmt.Errorf("no assets matching '%s' found in release %s", assetURLPattern, targetRelease.Name)
+			}
+			return nil
+		}
+
+		if tagOnly {
+			// Just print the tag with no additional text
+			fmt.Print(targetRelease.TagName)
+			return nil
+		}
+
+		if dateOnly {
+			// Just print the date with no additional text
+			fmt.Print(formatDate(targetRelease.PublishedAt))
+			return nil
+		}
+
+		if commitOnly {
+			// Just print the commit SHA with no additional text
+			sha, err := repo.Commit(cmd.Context(), targetRelease)
+			if err != nil {
+				return err
+			}
+			fmt.Print(sha)
+			return nil
+		}
+
+		// The release list does not carry the commit, an unresolvable tag
+		// should not hide the rest of the release
+		sha, err := repo.Commit(cmd.Context(), targetRelease)
+		var unsupported *client.UnsupportedError
+		if errors.As(err, &unsupported) {
+			warnf("no commit shown, %v\n", unsupported)
+			sha = "unknown"
+		} else if err != nil {
+			client.Debugf("no commit for %s: %v", targetRelease.TagName, err)
+			sha = "unknown"
+		}
+
+		// Display release info
+		fmt.Printf("Release for %s/%s:\n", repoDetails.Owner, repoDetails.Name)
+		fmt.Printf("  Name: %s\n", targetRelease.Name)
+		fmt.Printf("  Tag: %s\n", paint(colorCyan, targetRelease.TagName))
+		if targetRelease.Target != "" {
+			fmt.Printf("  Target: %s\n", targetRelease.Target)
+		}
+		fmt.Printf("  Commit: %s\n", sha)
+		fmt.Printf("  Published: %s\n", paint(colorGray, publishedText(targetRelease.PublishedAt)))
+		fmt.Printf("  Assets:\n")
+		if fetchDetails {
+			resolveContentTypes(cmd, repo, targetRelease.Assets)
+		}
+		for _, asset := range targetRelease.Assets {
+			if asset.IsExternal() {
+				fmt.Printf("    %s (External: %s, Downloads: %d)\n", asset.Name, asset.BrowserDownloadURL, asset.DownloadCount)
+			} else {
+				fmt.Printf("    %s (Size: %d bytes, Downloads: %d)\n", asset.Name, asset.Size, asset.DownloadCount)
+			}
+			if fetchDetails {
+				fmt.Printf("      ID: %d\n", asset.ID)
+				fmt.Printf("      UUID: %s\n", asset.UUID)
+				fmt.Printf("      Created: %s\n", formatDate(asset.CreatedAt))
+				fmt.Printf("      Uploader: %s\n", asset.Uploader)
+				fmt.Printf("      Content type: %s\n", asset.ContentType)
+			}
+		}
+
+		return nil
+	},
+}
+
+// printAssetPreview lists the assets a download would fetch and their total size
+func printAssetPreview(assets []release.Asset) error {
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ASSET\tSIZE")
+	for _, asset := range assets {
+		size := download.FormatBytes(asset.Size)
+		if asset.IsExternal() {
+			size = "external"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", asset.Name, size)
+		total += asset.Size
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d assets, %s (%d bytes) in total\n", len(assets), download.FormatBytes(total), total)
+	return nil
+}
+
+func init() {
+	fetchCmd.Flags().StringVar(&downloadFlag, "download", "", "Download an asset from the release, or every asset matching a glob")
+	fetchCmd.Flags().BoolVar(&redownload, "redownload", false, "Download assets even when the file in place already matches their checksum")
+	fetchCmd.Flags().BoolVar(&noDelta, "no-delta", false, "Always download the full asset, even when the release has a patch from the installed version")
+	fetchCmd.Flags().BoolVar(&listOnly, "list-only", false, "Show the assets --download would fetch, with sizes and total, without downloading")
+	fetchCmd.Flags().StringVar(&downloadAs, "download-as", "", "Save the downloaded file under a different name, may contain the --deploy placeholders")
+	fetchCmd.Flags().StringVar(&extractFile, "extract-file", "", "Save or deploy only this file from the downloaded archive, e.g. app-{tag}/bin/app")
+	fetchCmd.Flags().StringVar(&sourceFormat, "source", "", "Download the source archive of the release (tar.gz or zip)")
+	fetchCmd.Flags().StringVar(&deployPath, "deploy", "", "Path to deploy the downloaded asset, may contain {tag}, {version}, {repo}, {os}, {arch} and {date}")
+	fetchCmd.Flags().StringVar(&assetURLPattern, "asset-url", "", "Output only the download URL(s) of assets matching a name or glob")
+	fetchCmd.Flags().StringVar(&tempDir, "temp-dir", "", "Directory for in-progress downloads (default: next to the destination as <name>.partial)")
+	fetchCmd.Flags().StringVar(&limitRate, "limit-rate", "", "Limit the download speed, e.g. 500K or 2M (bytes per second)")
+	fetchCmd.Flags().IntVar(&chunks, "chunks", 1, "Download assets of 32 MiB or more in this many parallel byte ranges")
+	fetchCmd.Flags().BoolVar(&noSpaceCheck, "no-space-check", false, "Skip the free disk space check before downloading")
+	fetchCmd.Flags().StringVar(&deployStrategy, "deploy-strategy", release.StrategyOverwrite, "How to deploy: overwrite in place or versioned (releases/<tag> with a current symlink)")
+	fetchCmd.Flags().IntVar(&keepReleases, "keep", 3, "Number of releases to keep with the versioned deploy strategy (0 keeps all)")
+	fetchCmd.Flags().BoolVar(&verifyChecksum, "verify", false, "Verify the asset against the <asset>.sha256 or SHA256SUMS file of the release")
+	fetchCmd.Flags().StringVar(&cosignPolicy.Identity, "cosign-identity", "", "Verify the asset with cosign, requiring this signer identity (certificate SAN)")
+	fetchCmd.Flags().StringVar(&cosignPolicy.IdentityRegexp, "cosign-identity-regexp", "", "Verify the asset with cosign, requiring a signer identity matching this regular expression")
+	fetchCmd.Flags().StringVar(&cosignPolicy.Issuer, "cosign-issuer", "", "OIDC issuer the cosign signing certificate must have")
+	fetchCmd.Flags().StringVar(&cosignPolicy.IssuerRegexp, "cosign-issuer-regexp", "", "Regular expression the cosign certificate OIDC issuer must match")
+	fetchCmd.Flags().StringVar(&cosignPolicy.TrustedRoot, "trusted-root", "", "Sigstore trusted_root.json to verify against (default: fetched from the public good instance)")
+	fetchCmd.Flags().BoolVar(&verifyProvenance, "verify-provenance", false, "Verify the asset's SLSA provenance attestation against the builder and source configured for the repository")
+	fetchCmd.Flags().StringVar(&postVerify, "post-verify", "", "Command to run once the file is in place, e.g. \"/usr/local/bin/app --version\"; rolls back if it fails")
+	fetchCmd.Flags().StringVar(&expectOutput, "expect-output", "", "Regular expression the --post-verify output must match, may contain the --deploy placeholders such as {version}")
+	fetchCmd.Flags().BoolVar(&preserveTimes, "preserve-timestamps", false, "Set the modification time of the file to when the asset was uploaded (published, for source archives)")
+	fetchCmd.Flags().StringVar(&chmodFlag, "chmod", "", "File mode to apply to the deployed file (e.g. 0755)")
+	fetchCmd.Flags().StringVar(&chownFlag, "chown", "", "Owner to apply to the deployed file (user:group, requires privileges)")
+	fetchCmd.Flags().BoolVar(&fetchDetails, "details", false, "Show asset ID, UUID, creation time, uploader and content type")
+	fetchCmd.Flags().BoolVar(&tagOnly, "tag", false, "Output only the tag name with no additional text")
+	fetchCmd.Flags().BoolVar(&dateOnly, "date", false, "Output only the published date with no additional text")
+	fetchCmd.Flags().BoolVar(&diffInstalled, "diff-installed", false, "Compare the assets of the release with the installed ones recorded in the lockfile")
+	fetchCmd.Flags().StringVar(&fetchMaxAge, "max-age", "", "Fail with exit status 3 when the release is older than this, e.g. 30d, 2w or 36h")
+	fetchCmd.Flags().BoolVar(&commitOnly, "commit", false, "Output only the SHA of the commit the release tag points to")
+
+	rootCmd.AddCommand(fetchCmd)
+}
+
+// installedCopy returns the most recently installed copy of an asset when
+// rel has a patch from its release, nil when there is none or the copy
+// changed since it was recorded
+func installedCopy(alias, asset string, rel release.Release) *release.InstalledAsset {
+	lock, err := lockfile.Load(lockfile.PathFor(configFile))
+	if err != nil {
+		return nil
+	}
+	entry, ok := lock.Installed(alias, asset)
+	if !ok || !hasAnyAsset(rel, delta.PatchNames(asset, entry.Tag)) {
+		return nil
+	}
+	// Hashing a large file takes a while, so only once a patch is known
+	if sum, _, err := lockfile.HashFile(entry.Path); err != nil || sum != entry.SHA256 {
+		client.Debugf("%s: %s changed since it was installed, not patching it", asset, entry.Path)
+		return nil
+	}
+	return &release.InstalledAsset{Tag: entry.Tag, Path: entry.Path}
+}
+
+// identicalCheck returns a FetchOptions.Identical function comparing an
+// existing file with the digest the release publishes for the asset or,
+// for releases without checksums, the digest recorded when the asset of
+// the same release was installed there. Without either it is downloaded.
+func identicalCheck(repo release.Repo, rel release.Release, alias, asset string) func(ctx context.Context, filePath string) (bool, error) {
+	return func(ctx context.Context, filePath string) (bool, error) {
+		var expected checksum.Digest
+		if sumsAsset, perFile, found := checksumFile(rel, asset, checksum.Algorithms); found {
+			data, err := fetchAssetData(ctx, repo, sumsAsset, maxChecksumSize)
+			if err == nil {
+				expected, err = listedChecksum(data, sumsAsset, perFile, asset)
+			}
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			if err != nil {
+				client.Debugf("%s: %v", asset, err)
+			}
+		}
+		if expected.Hex == "" {
+			expected = checksum.Digest{Algorithm: checksum.SHA256, Hex: recordedChecksum(alias, asset, rel.TagName, filePath)}
+		}
+		if expected.Hex == "" {
+			client.Debugf("%s: no checksum to compare %s with, downloading it again", asset, filePath)
+			return false, nil
+		}
+		return expected.Verify(filePath) == nil, nil
+	}
+}
+
+// recordedChecksum returns the digest the lockfile has for the asset of the
+// release tagged tag installed at filePath, or "" if it was not
+func recordedChecksum(alias, asset, tag, filePath string) string {
+	lock, err := lockfile.Load(lockfile.PathFor(configFile))
+	if err != nil {
+		return ""
+	}
+	absPath, _ := filepath.Abs(filePath)
+	for _, entry := range lock.ForAlias(alias) {
+		if entryPath, _ := filepath.Abs(entry.Path); entry.Asset == asset && entry.Tag == tag && entryPath == absPath {
+			return entry.SHA256
+		}
+	}
+	return ""
+}
+
+// hasAnyAsset reports whether rel has an asset with one of the names
+func hasAnyAsset(rel release.Release, names []string) bool {
+	for _, asset := range rel.Assets {
+		if slices.Contains(names, asset.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordInstall stores the digest of a downloaded file in the lockfile so
+// verify-installed can detect later changes
+func recordInstall(alias, tag, asset, filePath string) error {
+	sum, size, err := lockfile.HashFile(filePath)
+	if err != nil {
+		return fmt.Errorf("error hashing %s: %v", filePath, err)
+	}
+
+	return lockfile.Update(lockfile.PathFor(configFile), func(lock *lockfile.Lockfile) {
+		lock.Record(lockfile.Entry{
+			Alias:        alias,
+			Tag:          tag,
+			Asset:        asset,
+			Path:         filePath,
+			Size:         size,
+			SHA256:       sum,
+			DownloadedAt: time.Now().UTC(),
+		})
+	})
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+)
+
+// defaultHealthInterval is the time between health check attempts
+const defaultHealthInterval = 2 * time.Second
+
+// healthCheck is a parsed health_check setting
+type healthCheck struct {
+	checks   []func(ctx context.Context, finalPath string) error
+	wait     time.Duration
+	interval time.Duration
+}
+
+// newHealthCheck parses the health_check of a repository
+func newHealthCheck(settings config.HealthCheck) (*healthCheck, error) {
+	if settings.URL == "" && settings.Command == "" {
+		return nil, fmt.Errorf("health_check needs a url or a command")
+	}
+
+	h := &healthCheck{interval: defaultHealthInterval}
+	var err error
+	if settings.Wait != "" {
+		if h.wait, err = time.ParseDuration(settings.Wait); err != nil || h.wait < 0 {
+			return nil, fmt.Errorf("invalid health_check wait '%s', use e.g. 30s", settings.Wait)
+		}
+	}
+	if settings.Interval != "" {
+		if h.interval, err = time.ParseDuration(settings.Interval); err != nil || h.interval <= 0 {
+			return nil, fmt.Errorf("invalid health_check interval '%s', use e.g. 2s", settings.Interval)
+		}
+	}
+
+	var re *regexp.Regexp
+	if settings.Expect != "" {
+		if re, err = regexp.Compile(settings.Expect); err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %v", settings.Expect, err)
+		}
+	}
+	if settings.URL != "" {
+		h.checks = append(h.checks, urlCheck(settings.URL, re))
+	}
+	if settings.Command != "" {
+		check, err := commandCheck("health check", settings.Command, settings.Expect)
+		if err != nil {
+			return nil, err
+		}
+		h.checks = append(h.checks, check)
+	}
+	return h, nil
+}
+
+// once runs every check a single time
+func (h *healthCheck) once(ctx context.Context, finalPath string) error {
+	for _, check := range h.checks {
+		if err := check(ctx, finalPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// until runs the checks until they pass or the wait is over, giving a
+// service restarted with the new release time to come up
+func (h *healthCheck) until(ctx context.Context, finalPath string) error {
+	deadline := time.Now().Add(h.wait)
+	for {
+		err := h.once(ctx, finalPath)
+		if err == nil || !time.Now().Add(h.interval).Before(deadline) {
+			return err
+		}
+		client.Debugf("%v, checking again in %s", err, h.interval)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.interval):
+		}
+	}
+}
+
+// urlCheck requires url to answer a GET with a 2xx status and, if re is
+// set, a body matching it
+func urlCheck(url string, re *regexp.Regexp) func(ctx context.Context, finalPath string) error {
+	return func(ctx context.Context, _ string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.HTTPClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("health check %s failed: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("health check %s answered %s", url, resp.Status)
+		}
+		if re != nil && !re.Match(body) {
+			answer := strings.TrimSpace(string(body))
+			if len(answer) > 200 {
+				answer = answer[:200] + "..."
+			}
+			return fmt.Errorf("health check %s answered %q, which does not match '%s'", url, answer, re)
+		}
+		return nil
+	}
+}
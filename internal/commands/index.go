@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/index"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	indexOut   string
+	indexHTML  bool
+	indexLimit int
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Publish release metadata as a static index",
+}
+
+var indexGenerateCmd = &cobra.Command{
+	Use:   "generate [repo-alias...]",
+	Short: "Write a JSON (and HTML) index of releases and assets to a directory",
+	Long: `Write the releases of the given repositories, those in a --group or every
+configured repository, with their assets, to the --out directory as static
+files any web server can host as a downloads page:
+
+  index.json      every repository with its newest release
+  <alias>.json    the releases of a repository, newest first, with their
+                  notes and assets
+
+With --html, index.html and an <alias>.html page per repository are written
+alongside, linking straight to the asset downloads. Drafts are left out;
+pre-releases are included and marked. Files are replaced in one step, so the
+index can be regenerated from cron while it is being served.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		aliases, err := selectAliases(cfg, args, groupFlag)
+		if err != nil {
+			return err
+		}
+		if len(aliases) == 0 {
+			for alias := range cfg.Repos {
+				aliases = append(aliases, alias)
+			}
+			sort.Strings(aliases)
+		}
+		if len(aliases) == 0 {
+			return fmt.Errorf("no repositories configured")
+		}
+
+		idx := index.Index{Generated: time.Now()}
+		for _, alias := range aliases {
+			details, ok := cfg.Repos[alias]
+			if !ok {
+				return fmt.Errorf("repository alias %s not found", alias)
+			}
+			repo, err := releaseRepo(cfg, alias, details)
+			if err != nil {
+				return err
+			}
+			releases, err := repo.List(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("%s: %w", alias, err)
+			}
+
+			var published []release.Release
+			for _, rel := range releases {
+				if rel.Draft {
+					continue
+				}
+				if indexLimit > 0 && len(published) == indexLimit {
+					break
+				}
+				published = append(published, rel)
+			}
+			idx.Repos = append(idx.Repos, index.Repo{
+				Alias:    alias,
+				Name:     details.Owner + "/" + details.Name,
+				URL:      strings.TrimRight(repo.BaseURL, "/") + "/" + details.Owner + "/" + details.Name,
+				Releases: published,
+			})
+		}
+		cmd.SilenceUsage = true
+
+		if err := index.Write(indexOut, idx, indexHTML); err != nil {
+			return err
+		}
+		infof("Index of %s written to %s\n", plural(len(idx.Repos), "repository"), indexOut)
+		return nil
+	},
+}
+
+func init() {
+	indexGenerateCmd.Flags().StringVar(&indexOut, "out", "", "Directory to write the index to (created if needed)")
+	indexGenerateCmd.Flags().StringVar(&groupFlag, "group", "", "Only the repositories in this group")
+	indexGenerateCmd.Flags().BoolVar(&indexHTML, "html", false, "Also write HTML pages")
+	indexGenerateCmd.Flags().IntVar(&indexLimit, "limit", 0, "Maximum number of releases per repository (0 for all)")
+	indexGenerateCmd.MarkFlagRequired("out")
+
+	indexCmd.AddCommand(indexGenerateCmd)
+	rootCmd.AddCommand(indexCmd)
+}
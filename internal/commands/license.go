@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/archive"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+// License texts are small, anything bigger is not one
+const maxLicenseSize = 1 << 20
+
+// licensePrefixes start the names of license files, e.g. LICENSE-MIT or
+// COPYING.txt
+var licensePrefixes = []string{"LICENSE", "LICENCE", "COPYING", "UNLICENSE"}
+
+// licenseExtensions are the extensions a license file may have
+var licenseExtensions = []string{"", ".txt", ".md", ".rst"}
+
+var (
+	licenseAsset  string
+	licenseSource bool
+	licenseOutput string
+)
+
+// licenseFile is a license file found in a release and the license it
+// looks like
+type licenseFile struct {
+	File    string `json:"file"`
+	Source  string `json:"source"`            // The asset it was read from, or "source archive"
+	License string `json:"license,omitempty"` // SPDX identifier, when recognised
+	Text    string `json:"text"`
+}
+
+var licenseCmd = &cobra.Command{
+	Use:   "license [repo-alias[@channel]] [release-tag-or-channel]",
+	Short: "Print the license of a release",
+	Long: `Print the LICENSE (or LICENCE, COPYING, UNLICENSE) file of a release, for
+a quick compliance check before adopting it. License files attached as assets
+are printed as they are; otherwise the file is read from the top of the
+release's source archive as it downloads. --asset reads it from an archive
+asset instead, and --source skips the assets.
+
+Common licenses (MIT, Apache-2.0, the GPL family, BSD, MPL-2.0, ISC and the
+Unlicense) are recognised and named on standard error, or in the license
+field with -o json.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias, releaseIdentifier, _, err := releaseArgs(args, 0)
+		if err != nil {
+			return err
+		}
+		if licenseOutput != "text" && licenseOutput != "json" {
+			return fmt.Errorf("unsupported output format '%s', use text or json", licenseOutput)
+		}
+		if licenseAsset != "" && licenseSource {
+			return fmt.Errorf("--asset and --source cannot be used together")
+		}
+
+		cfg, repoDetails, err := loadRepo(alias)
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, alias, repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), releaseIdentifier)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		files, err := findLicenses(cmd.Context(), repo, targetRelease)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no license file found in release %s", targetRelease.Name)
+		}
+
+		if licenseOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(files)
+		}
+		for i, file := range files {
+			// Keep stdout to the license text alone
+			if !quiet {
+				name := file.License
+				if name == "" {
+					name = "not recognised"
+				}
+				fmt.Fprintf(os.Stderr, "%s from %s: %s\n", file.File, file.Source, name)
+			}
+			if len(files) > 1 {
+				if i > 0 {
+					fmt.Println()
+				}
+				fmt.Printf("==> %s <==\n", file.File)
+			}
+			fmt.Print(file.Text)
+			if !strings.HasSuffix(file.Text, "\n") {
+				fmt.Println()
+			}
+		}
+		return nil
+	},
+}
+
+// findLicenses returns the license files of a release: those attached as
+// assets, or else those at the top of an archive asset or the source archive
+func findLicenses(ctx context.Context, repo release.Repo, rel release.Release) ([]licenseFile, error) {
+	if licenseAsset != "" {
+		for _, asset := range rel.Assets {
+			if asset.Name == licenseAsset {
+				return archiveLicenses(ctx, repo, asset, asset.Name)
+			}
+		}
+		return nil, fmt.Errorf("asset %s not found in release %s", licenseAsset, rel.Name)
+	}
+
+	if !licenseSource {
+		var files []licenseFile
+		for _, asset := range rel.Assets {
+			if !isLicenseFile(asset.Name) {
+				continue
+			}
+			data, err := fetchAssetData(ctx, repo, asset, maxLicenseSize)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, newLicenseFile(asset.Name, asset.Name, data))
+		}
+		if len(files) > 0 {
+			return files, nil
+		}
+	}
+
+	if rel.TarballURL == "" {
+		return nil, fmt.Errorf("release %s has no license asset and no source archive", rel.Name)
+	}
+	source := release.Asset{Name: fmt.Sprintf("%s-%s.tar.gz", repo.Name, rel.TagName), BrowserDownloadURL: rel.TarballURL}
+	return archiveLicenses(ctx, repo, source, "source archive")
+}
+
+// archiveLicenses reads the license files at the top of an archive, or in
+// the single directory source archives and many release tarballs hold
+func archiveLicenses(ctx context.Context, repo release.Repo, asset release.Asset, source string) ([]licenseFile, error) {
+	body, err := repo.OpenAsset(ctx, asset)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	found, err := archive.FindFiles(body, asset.Name, func(entry string) bool {
+		return strings.Count(entry, "/") <= 1 && isLicenseFile(path.Base(entry))
+	}, maxLicenseSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", asset.Name, err)
+	}
+
+	files := make([]licenseFile, len(found))
+	for i, file := range found {
+		files[i] = newLicenseFile(file.Path, source, file.Data)
+	}
+	return files, nil
+}
+
+func newLicenseFile(name, source string, data []byte) licenseFile {
+	text := string(data)
+	return licenseFile{File: name, Source: source, License: identifyLicense(text), Text: text}
+}
+
+// isLicenseFile reports whether a file name is that of a license file, such
+// as LICENSE, COPYING.md or LICENSE-APACHE
+func isLicenseFile(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, prefix := range licensePrefixes {
+		rest, ok := strings.CutPrefix(upper, prefix)
+		if !ok {
+			continue
+		}
+		if strings.HasPrefix(rest, "-") {
+			// LICENSE-MIT, LICENSE-APACHE.txt
+			rest = path.Ext(rest)
+		}
+		for _, ext := range licenseExtensions {
+			if rest == strings.ToUpper(ext) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// licenseMarkers recognise common licenses by phrases of their text, more
+// specific licenses first
+var licenseMarkers = []struct {
+	id      string
+	phrases []string
+}{
+	{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE"}},
+	{"LGPL-3.0", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"LGPL-2.1", []string{"GNU LESSER GENERAL PUBLIC LICENSE", "Version 2.1"}},
+	{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"GPL-2.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 2"}},
+	{"Apache-2.0", []string{"Apache License", "Version 2.0"}},
+	{"MPL-2.0", []string{"Mozilla Public License", "2.0"}},
+	{"Unlicense", []string{"This is free and unencumbered software released into the public domain"}},
+	{"BSD-3-Clause", []string{"Redistribution and use in source and binary forms", "Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+	{"ISC", []string{"Permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+}
+
+// identifyLicense returns the SPDX identifier of a common license text, or
+// "" when it is not recognised
+func identifyLicense(text string) string {
+	// Line breaks fall anywhere in a license text
+	text = strings.Join(strings.Fields(text), " ")
+	for _, marker := range licenseMarkers {
+		matched := true
+		for _, phrase := range marker.phrases {
+			if !strings.Contains(text, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return marker.id
+		}
+	}
+	return ""
+}
+
+func init() {
+	licenseCmd.Flags().StringVar(&licenseAsset, "asset", "", "Read the license from this archive asset instead")
+	licenseCmd.Flags().BoolVar(&licenseSource, "source", false, "Read the license from the source archive even when it is attached as an asset")
+	licenseCmd.Flags().StringVarP(&licenseOutput, "output", "o", "text", "Output format: text or json")
+
+	rootCmd.AddCommand(licenseCmd)
+}
@@ -0,0 +1,271 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/download"
+	"github.com/earentir/gitea-release/internal/feed"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	listSince   string
+	listUntil   string
+	listLimit   int
+	listReverse bool
+	listOutput  string
+	listTagGlob string
+	listRegex   string
+)
+
+// listedRepo is a repository listed by list with its matching releases
+type listedRepo struct {
+	alias    string
+	name     string // owner/name
+	releases []release.Release
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list [repo-alias...]",
+	Short: "List all releases for a repository",
+	Long: `List the releases of the given repositories, of those in a --group or of
+every configured repository. The filters and --limit apply to each repository;
+with more than one repository a REPO column (repo with csv and tsv) tells
+their releases apart.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		aliases, err := selectAliases(cfg, args, groupFlag)
+		if err != nil {
+			return err
+		}
+		// Label the releases unless exactly one repository was asked for
+		labeled := len(args) != 1
+
+		var repos []listedRepo
+		for _, alias := range aliases {
+			details, ok := cfg.Repos[alias]
+			if !ok {
+				return fmt.Errorf("repository alias %s not found", alias)
+			}
+			repo, err := releaseRepo(cfg, alias, details)
+			if err != nil {
+				return err
+			}
+			releases, err := repo.List(cmd.Context())
+			if err != nil {
+				if labeled {
+					return fmt.Errorf("%s: %w", alias, err)
+				}
+				return err
+			}
+
+			releases, err = matchReleases(releases, listTagGlob, listRegex)
+			if err != nil {
+				return err
+			}
+			releases, err = filterReleases(releases, listSince, listUntil, listLimit, listReverse)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, listedRepo{alias: alias, name: details.Owner + "/" + details.Name, releases: releases})
+		}
+
+		switch listOutput {
+		case "ics":
+			f := feed.Feed{Title: "Releases"}
+			if !labeled {
+				f.Title = "Releases of " + repos[0].name
+			}
+			for _, repo := range repos {
+				for _, rel := range repo.releases {
+					f.Entries = append(f.Entries, feed.Entry{Repo: repo.name, Release: rel})
+				}
+			}
+			return f.WriteICS(os.Stdout)
+		case "csv", "tsv":
+			header := []string{"tag", "name", "published_at", "prerelease", "assets", "downloads", "url"}
+			if labeled {
+				header = append([]string{"repo"}, header...)
+			}
+			var rows [][]string
+			for _, repo := range repos {
+				for _, rel := range repo.releases {
+					var downloads int
+					for _, asset := range rel.Assets {
+						downloads += asset.DownloadCount
+					}
+					row := []string{rel.TagName, rel.Name, formatDate(rel.PublishedAt), strconv.FormatBool(rel.Prerelease),
+						strconv.Itoa(len(rel.Assets)), strconv.Itoa(downloads), rel.HTMLURL}
+					if labeled {
+						row = append([]string{repo.alias}, row...)
+					}
+					rows = append(rows, row)
+				}
+			}
+			return writeRecords(listOutput, header, rows)
+		case "text", "wide":
+		default:
+			return fmt.Errorf("unsupported output format '%s', use text, wide, csv, tsv or ics", listOutput)
+		}
+
+		found := 0
+		for _, repo := range repos {
+			found += len(repo.releases)
+		}
+		if found == 0 {
+			if labeled {
+				fmt.Printf("No releases found in %s\n", plural(len(repos), "repository"))
+			} else {
+				fmt.Printf("No releases found for %s\n", repos[0].name)
+			}
+			return nil
+		}
+
+		wide := listOutput == "wide"
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := fmt.Sprintf("%s\tNAME\t%s\tASSETS", paint(colorPlain, "TAG"), paint(colorPlain, "PUBLISHED"))
+		if labeled {
+			header = "REPO\t" + header
+		}
+		if wide {
+			header += "\tTYPE\tDOWNLOADS\tSIZE\tURL"
+		}
+		fmt.Fprintln(w, header)
+		for _, repo := range repos {
+			for _, rel := range repo.releases {
+				line := fmt.Sprintf("%s\t%s\t%s\t%d", paint(colorCyan, rel.TagName), orDash(rel.Name),
+					paint(colorGray, formatDate(rel.PublishedAt)), len(rel.Assets))
+				if labeled {
+					line = repo.alias + "\t" + line
+				}
+				if wide {
+					var downloads int
+					var size int64
+					for _, asset := range rel.Assets {
+						downloads += asset.DownloadCount
+						size += asset.Size
+					}
+					kind := "release"
+					if rel.Draft {
+						kind = "draft"
+					} else if rel.Prerelease {
+						kind = "prerelease"
+					}
+					line += fmt.Sprintf("\t%s\t%d\t%s\t%s", kind, downloads, download.FormatBytes(size), orDash(rel.HTMLURL))
+				}
+				fmt.Fprintln(w, line)
+			}
+		}
+		return w.Flush()
+	},
+}
+
+// matchReleases keeps the releases whose tag matches the glob and the
+// regular expression, either of which may be empty
+func matchReleases(releases []release.Release, glob, pattern string) ([]release.Release, error) {
+	if glob != "" {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("invalid tag filter '%s': %v", glob, err)
+		}
+	}
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %v", pattern, err)
+		}
+	}
+
+	matched := make([]release.Release, 0, len(releases))
+	for _, rel := range releases {
+		if glob != "" {
+			if ok, _ := path.Match(glob, rel.TagName); !ok {
+				continue
+			}
+		}
+		if re != nil && !re.MatchString(rel.TagName) {
+			continue
+		}
+		matched = append(matched, rel)
+	}
+	return matched, nil
+}
+
+// filterReleases keeps the releases published between since and until
+// (inclusive), limits them to the newest limit releases and optionally
+// reverses them to oldest first
+func filterReleases(releases []release.Release, since, until string, limit int, reverse bool) ([]release.Release, error) {
+	var sinceTime, untilTime time.Time
+	if since != "" {
+		t, _, err := parseDate(since)
+		if err != nil {
+			return nil, err
+		}
+		sinceTime = t
+	}
+	if until != "" {
+		t, dateOnly, err := parseDate(until)
+		if err != nil {
+			return nil, err
+		}
+		// A plain date includes the whole day
+		if dateOnly {
+			t = t.Add(24*time.Hour - time.Nanosecond)
+		}
+		untilTime = t
+	}
+
+	filtered := make([]release.Release, 0, len(releases))
+	for _, rel := range releases {
+		if since != "" || until != "" {
+			published, err := time.Parse(time.RFC3339, rel.PublishedAt)
+			if err != nil {
+				continue
+			}
+			if since != "" && published.Before(sinceTime) {
+				continue
+			}
+			if until != "" && published.After(untilTime) {
+				continue
+			}
+		}
+		filtered = append(filtered, rel)
+	}
+
+	// The API returns the newest releases first
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
+
+	if reverse {
+		for i, j := 0, len(filtered)-1; i < j; i, j = i+1, j-1 {
+			filtered[i], filtered[j] = filtered[j], filtered[i]
+		}
+	}
+
+	return filtered, nil
+}
+
+func init() {
+	listCmd.Flags().StringVar(&listSince, "since", "", "Only show releases published on or after this date (YYYY-MM-DD)")
+	listCmd.Flags().StringVar(&listUntil, "until", "", "Only show releases published on or before this date (YYYY-MM-DD)")
+	listCmd.Flags().IntVar(&listLimit, "limit", 0, "Show at most this many of the newest matching releases")
+	listCmd.Flags().BoolVar(&listReverse, "reverse", false, "Show the oldest releases first")
+	listCmd.Flags().StringVar(&listTagGlob, "tag-filter", "", "Only show releases whose tag matches this glob, e.g. 'v1.*'")
+	listCmd.Flags().StringVar(&listRegex, "match-regex", "", "Only show releases whose tag matches this regular expression")
+	listCmd.Flags().StringVar(&groupFlag, "group", "", "List the releases of the repositories in this group")
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "text", "Output format: text, wide (with type, downloads, size and URL), csv, tsv or ics (iCalendar)")
+
+	rootCmd.AddCommand(listCmd)
+}
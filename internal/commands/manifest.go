@@ -0,0 +1,324 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/archive"
+	"github.com/earentir/gitea-release/internal/checksum"
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	manifestBinary      string
+	manifestDescription string
+)
+
+// osPatterns and archPatterns recognise platforms in asset names. amd64
+// comes before 386 as x86_64 would also match x86.
+var (
+	osPatterns = []platformPattern{
+		{"darwin", regexp.MustCompile(`(^|[-_.])(darwin|macos|mac|osx|apple)([-_.]|$)`)},
+		{"linux", regexp.MustCompile(`(^|[-_.])linux([-_.]|$)`)},
+		{"windows", regexp.MustCompile(`(^|[-_.])(windows|win|win64|win32)([-_.]|$)|\.exe$`)},
+	}
+	archPatterns = []platformPattern{
+		{"amd64", regexp.MustCompile(`(^|[-_.])(amd64|x86_64|x64|64bit|win64)([-_.]|$)`)},
+		{"arm64", regexp.MustCompile(`(^|[-_.])(arm64|aarch64)([-_.]|$)`)},
+		{"386", regexp.MustCompile(`(^|[-_.])(386|i386|i686|x86|32bit|win32)([-_.]|$)`)},
+	}
+)
+
+type platformPattern struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// Assets that accompany binaries rather than being one
+var manifestSkipSuffixes = []string{".sig", ".asc", ".pem", ".crt", ".cert", ".sigstore", ".bundle", ".json", ".jsonl", ".txt", ".sbom",
+	".deb", ".rpm", ".apk", ".msi", ".dmg", ".pkg"}
+
+// platformAsset is a release asset for one platform with its checksum
+type platformAsset struct {
+	release.Asset
+	OS, Arch string // Arch is empty for universal assets
+	SHA256   string
+}
+
+// manifestRelease is what both manifest formats are generated from
+type manifestRelease struct {
+	Binary      string
+	Description string
+	Homepage    string
+	Version     string
+	Assets      []platformAsset
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Generate package manager manifests for a release",
+	Long: `Generate a Homebrew formula or a Scoop manifest for a release, with the
+download URL and SHA-256 of the asset for each platform. Platforms are
+recognised from asset names such as app_1.2.3_darwin_arm64.tar.gz or
+app-windows-amd64.exe.`,
+}
+
+var manifestBrewCmd = &cobra.Command{
+	Use:   "brew [repo-alias[@channel]] [release-tag-or-channel]",
+	Short: "Print a Homebrew formula for the macOS and Linux assets of a release",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := loadManifestRelease(cmd, args, "darwin", "linux")
+		if err != nil {
+			return err
+		}
+		fmt.Print(brewFormula(m))
+		return nil
+	},
+}
+
+var manifestScoopCmd = &cobra.Command{
+	Use:   "scoop [repo-alias[@channel]] [release-tag-or-channel]",
+	Short: "Print a Scoop manifest for the Windows assets of a release",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := loadManifestRelease(cmd, args, "windows")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		encoder.SetEscapeHTML(false)
+		return encoder.Encode(scoopManifest(m))
+	},
+}
+
+// loadManifestRelease finds the release and its assets for the given
+// operating systems, with their checksums
+func loadManifestRelease(cmd *cobra.Command, args []string, systems ...string) (manifestRelease, error) {
+	alias, releaseIdentifier, _, err := releaseArgs(args, 0)
+	if err != nil {
+		return manifestRelease{}, err
+	}
+
+	cfg, repoDetails, err := loadRepo(alias)
+	if err != nil {
+		return manifestRelease{}, err
+	}
+
+	repo, err := releaseRepo(cfg, alias, repoDetails)
+	if err != nil {
+		return manifestRelease{}, err
+	}
+	targetRelease, err := repo.Find(cmd.Context(), releaseIdentifier)
+	if err != nil {
+		return manifestRelease{}, err
+	}
+
+	m := manifestRelease{
+		Binary:      manifestBinary,
+		Description: manifestDescription,
+		Homepage:    fmt.Sprintf("%s/%s/%s", strings.TrimRight(repo.BaseURL, "/"), repoDetails.Owner, repoDetails.Name),
+		Version:     strings.TrimPrefix(targetRelease.TagName, "v"),
+	}
+	if m.Binary == "" {
+		m.Binary = repoDetails.Name
+	}
+	if m.Description == "" {
+		m.Description = repoDetails.Name
+	}
+
+	cmd.SilenceUsage = true
+	m.Assets = platformAssets(targetRelease, systems)
+	if len(m.Assets) == 0 {
+		return manifestRelease{}, fmt.Errorf("no %s assets found in release %s", strings.Join(systems, " or "), targetRelease.Name)
+	}
+
+	if err := addChecksums(cmd.Context(), repo, targetRelease, m.Assets); err != nil {
+		return manifestRelease{}, err
+	}
+	return m, nil
+}
+
+// platformAssets picks one asset per platform of the given operating
+// systems, the first one when several match
+func platformAssets(rel release.Release, systems []string) []platformAsset {
+	var assets []platformAsset
+	seen := make(map[string]bool)
+	for _, asset := range rel.Assets {
+		if !isBinaryAsset(asset.Name) {
+			continue
+		}
+		goos, arch := assetPlatform(asset.Name)
+		if goos == "" || !slices.Contains(systems, goos) {
+			continue
+		}
+		if seen[goos+"/"+arch] {
+			client.Debugf("skipping %s, already have an asset for %s/%s", asset.Name, goos, arch)
+			continue
+		}
+		seen[goos+"/"+arch] = true
+		assets = append(assets, platformAsset{Asset: asset, OS: goos, Arch: arch})
+	}
+	return assets
+}
+
+// assetPlatform recognises the operating system and architecture an asset
+// is built for, or returns empty strings
+func assetPlatform(name string) (goos, arch string) {
+	lower := strings.ToLower(name)
+	for _, p := range osPatterns {
+		if p.pattern.MatchString(lower) {
+			goos = p.name
+			break
+		}
+	}
+	for _, p := range archPatterns {
+		if p.pattern.MatchString(lower) {
+			arch = p.name
+			break
+		}
+	}
+	return goos, arch
+}
+
+// isBinaryAsset reports whether an asset can hold a program, rather than
+// checksums, signatures or OS packages
+func isBinaryAsset(name string) bool {
+	if isChecksumFile(name) {
+		return false
+	}
+	lower := strings.ToLower(name)
+	for _, suffix := range manifestSkipSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// addChecksums fills in the SHA-256 of every asset, published or computed
+func addChecksums(ctx context.Context, repo release.Repo, rel release.Release, assets []platformAsset) error {
+	files := make(map[string][]byte)
+	for i := range assets {
+		sum, err := findChecksum(ctx, repo, rel, assets[i].Asset, files, checksum.SHA256)
+		if err != nil {
+			return err
+		}
+		assets[i].SHA256 = sum.Digest
+	}
+	return nil
+}
+
+// brewFormula renders a Homebrew formula with a block per platform
+func brewFormula(m manifestRelease) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "class %s < Formula\n", brewClassName(m.Binary))
+	fmt.Fprintf(&b, "  desc %q\n", m.Description)
+	fmt.Fprintf(&b, "  homepage %q\n", m.Homepage)
+	fmt.Fprintf(&b, "  version %q\n", m.Version)
+
+	allArchives := true
+	for _, system := range []struct{ goos, block string }{{"darwin", "on_macos"}, {"linux", "on_linux"}} {
+		var assets []platformAsset
+		for _, asset := range m.Assets {
+			if asset.OS == system.goos {
+				assets = append(assets, asset)
+				allArchives = allArchives && archive.IsArchive(asset.Name)
+			}
+		}
+		if len(assets) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n  %s do\n", system.block)
+		for _, asset := range assets {
+			switch asset.Arch {
+			case "arm64":
+				fmt.Fprintf(&b, "    on_arm do\n      url %q\n      sha256 %q\n    end\n", asset.BrowserDownloadURL, asset.SHA256)
+			case "amd64":
+				fmt.Fprintf(&b, "    on_intel do\n      url %q\n      sha256 %q\n    end\n", asset.BrowserDownloadURL, asset.SHA256)
+			case "":
+				fmt.Fprintf(&b, "    url %q\n    sha256 %q\n", asset.BrowserDownloadURL, asset.SHA256)
+			}
+		}
+		fmt.Fprintf(&b, "  end\n")
+	}
+
+	fmt.Fprintf(&b, "\n  def install\n")
+	if allArchives {
+		fmt.Fprintf(&b, "    bin.install %q\n", m.Binary)
+	} else {
+		// A plain binary is staged under its asset name
+		fmt.Fprintf(&b, "    bin.install Dir[\"*\"].first => %q\n", m.Binary)
+	}
+	fmt.Fprintf(&b, "  end\n")
+	fmt.Fprintf(&b, "\n  test do\n    system \"#{bin}/%s\", \"--version\"\n  end\nend\n", m.Binary)
+	return b.String()
+}
+
+// brewClassName turns a formula name like my-tool into MyTool
+func brewClassName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// scoopArchitecture is one entry of the architecture map of a Scoop manifest
+type scoopArchitecture struct {
+	URL  string `json:"url"`
+	Hash string `json:"hash"`
+}
+
+// scoopManifestFile is the layout of a Scoop app manifest
+type scoopManifestFile struct {
+	Version      string                       `json:"version"`
+	Description  string                       `json:"description"`
+	Homepage     string                       `json:"homepage"`
+	Architecture map[string]scoopArchitecture `json:"architecture"`
+	Bin          string                       `json:"bin"`
+}
+
+// scoopManifest builds a Scoop manifest with an entry per architecture
+func scoopManifest(m manifestRelease) scoopManifestFile {
+	scoopArch := map[string]string{"amd64": "64bit", "": "64bit", "arm64": "arm64", "386": "32bit"}
+	binary := m.Binary + ".exe"
+
+	manifest := scoopManifestFile{
+		Version:      m.Version,
+		Description:  m.Description,
+		Homepage:     m.Homepage,
+		Architecture: make(map[string]scoopArchitecture),
+		Bin:          binary,
+	}
+	for _, asset := range m.Assets {
+		url := asset.BrowserDownloadURL
+		if !archive.IsArchive(asset.Name) {
+			// Scoop renames a download to the name after #/
+			url += "#/" + binary
+		}
+		if _, ok := manifest.Architecture[scoopArch[asset.Arch]]; !ok {
+			manifest.Architecture[scoopArch[asset.Arch]] = scoopArchitecture{URL: url, Hash: asset.SHA256}
+		}
+	}
+	return manifest
+}
+
+func init() {
+	manifestCmd.PersistentFlags().StringVar(&manifestBinary, "bin", "", "Name of the installed program (default: the repository name)")
+	manifestCmd.PersistentFlags().StringVar(&manifestDescription, "description", "", "Description of the package (default: the repository name)")
+
+	manifestCmd.AddCommand(manifestBrewCmd)
+	manifestCmd.AddCommand(manifestScoopCmd)
+	rootCmd.AddCommand(manifestCmd)
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	orgURLFlag string
+	orgOutput  string
+)
+
+var orgCmd = &cobra.Command{
+	Use:   "org",
+	Short: "Work with Gitea organizations",
+}
+
+var orgReleasesCmd = &cobra.Command{
+	Use:   "releases [org]",
+	Short: "Show the latest release of every repository in an organization",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if orgOutput != "text" && orgOutput != "wide" {
+			return fmt.Errorf("unsupported output format '%s', use text or wide", orgOutput)
+		}
+		org := args[0]
+
+		// The config is optional when the URL is given explicitly
+		cfg, err := loadConfig()
+		if err != nil {
+			if orgURLFlag == "" || !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			cfg = &config.Config{}
+		}
+
+		giteaURL := cfg.GiteaURL
+		if orgURLFlag != "" {
+			giteaURL = orgURLFlag
+		}
+
+		token, err := cfg.TokenFor("")
+		if err != nil {
+			return err
+		}
+		api := client.New(giteaURL, token)
+		repos, err := api.GetRepositories(cmd.Context(), org)
+		if err != nil {
+			return fmt.Errorf("error getting repositories: %w", err)
+		}
+
+		wide := orgOutput == "wide"
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := fmt.Sprintf("REPO\t%s\tPUBLISHED\tASSETS", paint(colorPlain, "TAG"))
+		if wide {
+			header += "\tDOWNLOADS\tURL"
+		}
+		fmt.Fprintln(w, header)
+		for _, repo := range repos {
+			if repo.ReleaseCounter == 0 {
+				continue
+			}
+
+			releases, err := api.GetReleases(cmd.Context(), repo.Owner.Login, repo.Name, true)
+			if err != nil || len(releases) == 0 {
+				// Repositories with only drafts or prereleases have no latest release
+				client.Debugf("no latest release for %s: %v", repo.FullName, err)
+				line := fmt.Sprintf("%s\t%s\t-\t-", repo.Name, paint(colorPlain, "-"))
+				if wide {
+					line += "\t-\t" + orDash(repo.HTMLURL)
+				}
+				fmt.Fprintln(w, line)
+				continue
+			}
+
+			latest := releases[0]
+			line := fmt.Sprintf("%s\t%s\t%s\t%d", repo.Name, paint(colorCyan, latest.TagName), formatDate(latest.PublishedAt), len(latest.Assets))
+			if wide {
+				var downloads int
+				for _, asset := range latest.Assets {
+					downloads += asset.DownloadCount
+				}
+				line += fmt.Sprintf("\t%d\t%s", downloads, orDash(latest.HTMLURL))
+			}
+			fmt.Fprintln(w, line)
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	orgReleasesCmd.Flags().StringVar(&orgURLFlag, "url", "", "Gitea URL (defaults to the configured Gitea URL)")
+	orgReleasesCmd.Flags().StringVarP(&orgOutput, "output", "o", "text", "Output format: text, or wide for downloads and URLs")
+
+	orgCmd.AddCommand(orgReleasesCmd)
+	rootCmd.AddCommand(orgCmd)
+}
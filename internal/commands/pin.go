@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/archive"
+	"github.com/earentir/gitea-release/internal/checksum"
+
+	"github.com/spf13/cobra"
+)
+
+var pinFormat string
+
+var pinCmd = &cobra.Command{
+	Use:   "pin [repo-alias[@channel]] [release-tag-or-channel] [asset]",
+	Short: "Print Nix or Bazel fetch stanzas for release assets",
+	Long: `Print ready to paste fetch stanzas with the download URL and SHA-256 of
+release assets, for pinning them in hermetic builds: Nix fetchurl attributes
+with --format nix, or Bazel http_archive rules (http_file for assets that are
+not archives) with --format bazel.
+
+The asset may be a name or a glob and defaults to every asset apart from
+checksum files. Checksums are found as by the checksum command.`,
+	Args: cobra.RangeArgs(1, 3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias, releaseIdentifier, rest, err := releaseArgs(args, 1)
+		if err != nil {
+			return err
+		}
+		if pinFormat != "nix" && pinFormat != "bazel" {
+			return fmt.Errorf("unsupported format '%s', use nix or bazel", pinFormat)
+		}
+
+		cfg, repoDetails, err := loadRepo(alias)
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, alias, repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), releaseIdentifier)
+		if err != nil {
+			return err
+		}
+
+		var pattern string
+		if len(rest) > 0 {
+			pattern = rest[0]
+		}
+		assets, err := checksummedAssets(targetRelease, pattern)
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		files := make(map[string][]byte)
+		for i, asset := range assets {
+			sum, err := findChecksum(cmd.Context(), repo, targetRelease, asset, files, checksum.SHA256)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+
+			if pinFormat == "nix" {
+				hash, err := sriHash(sum.Digest)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%q = fetchurl {\n  url = %q;\n  hash = %q;\n};\n", asset.Name, asset.BrowserDownloadURL, hash)
+				continue
+			}
+
+			rule := "http_file"
+			if archive.IsArchive(asset.Name) {
+				rule = "http_archive"
+			}
+			fmt.Printf("%s(\n    name = %q,\n    urls = [%q],\n    sha256 = %q,\n)\n",
+				rule, bazelName(repoDetails.Name, asset.Name), asset.BrowserDownloadURL, sum.Digest)
+		}
+		return nil
+	},
+}
+
+// sriHash converts a hex SHA-256 digest into the sha256-<base64> form Nix uses
+func sriHash(digest string) (string, error) {
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return "", fmt.Errorf("invalid SHA-256 digest '%s': %v", digest, err)
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+var bazelNameInvalid = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// bazelName derives a repository rule name from the repository and asset,
+// e.g. myapp_myapp_1_2_linux for myapp-1.2-linux.tar.gz
+func bazelName(repoName, assetName string) string {
+	name := bazelNameInvalid.ReplaceAllString(repoName+"_"+archive.TrimExtension(assetName), "_")
+	return strings.Trim(name, "_")
+}
+
+func init() {
+	pinCmd.Flags().StringVar(&pinFormat, "format", "nix", "Stanza format: nix (fetchurl) or bazel (http_archive)")
+
+	rootCmd.AddCommand(pinCmd)
+}
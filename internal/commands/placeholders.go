@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+var placeholderPattern = regexp.MustCompile(`\{[a-z]+\}`)
+
+// expandPlaceholders fills in {tag}, {version} (the tag without a leading
+// v), {repo}, {os}, {arch} and {date} in a deploy path or file name; setting
+// names the value in errors. {date} is the publish date of the release
+// rather than today, so fetching the same release again lands in the same
+// place. Slashes in tags become underscores as in versioned deploys.
+func expandPlaceholders(value, setting, repoName string, rel release.Release) (string, error) {
+	date := rel.PublishedAt
+	if t, err := time.Parse(time.RFC3339, rel.PublishedAt); err == nil {
+		date = t.Format("2006-01-02")
+	}
+	values := map[string]string{
+		"{tag}":     strings.ReplaceAll(rel.TagName, "/", "_"),
+		"{version}": strings.TrimPrefix(strings.ReplaceAll(rel.TagName, "/", "_"), "v"),
+		"{repo}":    repoName,
+		"{os}":      runtime.GOOS,
+		"{arch}":    runtime.GOARCH,
+		"{date}":    date,
+	}
+
+	var unknown string
+	expanded := placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+		v, ok := values[placeholder]
+		if !ok && unknown == "" {
+			unknown = placeholder
+		}
+		return v
+	})
+	if unknown != "" {
+		return "", fmt.Errorf("unknown placeholder %s in %s, use {tag}, {version}, {repo}, {os}, {arch} or {date}", unknown, setting)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+)
+
+// envDeployedPath tells --post-verify and health check commands where the
+// new file is
+const envDeployedPath = "GITEA_RELEASE_DEPLOYED_PATH"
+
+// checkCommandTimeout bounds how long a check command may run
+const checkCommandTimeout = time.Minute
+
+// commandCheck returns a check that runs command through the shell and
+// requires it to succeed and, if expect is set, to print something matching
+// that regular expression. what names the check in errors.
+func commandCheck(what, command, expect string) (func(ctx context.Context, finalPath string) error, error) {
+	var re *regexp.Regexp
+	if expect != "" {
+		var err error
+		if re, err = regexp.Compile(expect); err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %v", expect, err)
+		}
+	}
+
+	return func(ctx context.Context, finalPath string) error {
+		ctx, cancel := context.WithTimeout(ctx, checkCommandTimeout)
+		defer cancel()
+
+		var c *exec.Cmd
+		if runtime.GOOS == "windows" {
+			c = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			c = exec.CommandContext(ctx, "sh", "-c", command)
+		}
+		c.Env = append(os.Environ(), envDeployedPath+"="+finalPath)
+		output, err := c.CombinedOutput()
+		client.Debugf("%s %q printed %q", what, command, output)
+
+		trimmed := strings.TrimSpace(string(output))
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				err = fmt.Errorf("no result after %s", checkCommandTimeout)
+			}
+			if trimmed != "" {
+				err = fmt.Errorf("%v: %s", err, trimmed)
+			}
+			return fmt.Errorf("%s command '%s' failed: %v", what, command, err)
+		}
+		if re != nil && !re.Match(output) {
+			return fmt.Errorf("%s command '%s' printed %q, which does not match '%s'", what, command, trimmed, expect)
+		}
+		return nil
+	}, nil
+}
@@ -0,0 +1,75 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/provenance"
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+// Attestations are small, anything bigger is not one
+const maxAttestationSize = 4 << 20
+
+// provenanceSuffixes name the attestations of one asset, <asset><suffix>.
+// Release-wide files such as multiple.intoto.jsonl, covering every asset,
+// end in one of them too.
+var provenanceSuffixes = []string{".intoto.jsonl", ".intoto.json", ".provenance.json"}
+
+var verifyProvenance bool
+
+// provenanceVerifier returns a FetchOptions.Verify function that checks a
+// downloaded asset against the SLSA provenance published in the release,
+// from its own attestation file or else the release-wide ones
+func provenanceVerifier(repo release.Repo, rel release.Release, assetName string, expected *config.Provenance) (func(ctx context.Context, filePath string) error, error) {
+	var candidates []release.Asset
+	if own, ok := findAsset(rel, assetName, provenanceSuffixes); ok {
+		candidates = append(candidates, own)
+	} else {
+		for _, asset := range rel.Assets {
+			if isProvenanceFile(asset.Name) {
+				candidates = append(candidates, asset)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no provenance attestation found for %s in release %s", assetName, rel.Name)
+	}
+
+	policy := provenance.Policy{
+		BuilderID:   expected.BuilderID,
+		SourceURI:   expected.SourceURI,
+		Signer:      expected.SignerIdentity,
+		Issuer:      expected.Issuer,
+		TrustedRoot: cosignPolicy.TrustedRoot,
+	}
+	return func(ctx context.Context, filePath string) error {
+		var lastErr error
+		for _, asset := range candidates {
+			data, err := fetchAssetData(ctx, repo, asset, maxAttestationSize)
+			if err != nil {
+				return err
+			}
+			p, err := provenance.Verify(filePath, data, policy)
+			if err != nil {
+				lastErr = fmt.Errorf("%s: provenance from %s: %v", assetName, asset.Name, err)
+				continue
+			}
+			infof("Verified provenance from %s: built by %s from %s\n", asset.Name, p.BuilderID, p.SourceURI)
+			return nil
+		}
+		return lastErr
+	}, nil
+}
+
+// isProvenanceFile reports whether an asset holds provenance attestations
+func isProvenanceFile(name string) bool {
+	for _, suffix := range provenanceSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"encoding/csv"
+	"os"
+)
+
+// writeRecords writes a header row and rows to stdout as CSV, or as TSV
+// when format is tsv, for --output csv and tsv
+func writeRecords(format string, header []string, rows [][]string) error {
+	w := csv.NewWriter(os.Stdout)
+	if format == "tsv" {
+		w.Comma = '\t'
+	}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	return w.WriteAll(rows)
+}
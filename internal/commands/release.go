@@ -0,0 +1,1110 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/checksum"
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/download"
+	"github.com/earentir/gitea-release/internal/notes"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+var releaseCmd = &cobra.Command{
+	Use:   "release",
+	Short: "Manage releases",
+}
+
+var (
+	editTitle      string
+	editNotes      string
+	editNotesFile  string
+	editChangelog  bool
+	editAppend     bool
+	editPrerelease bool
+	editDraft      bool
+)
+
+var releaseEditCmd = &cobra.Command{
+	Use:   "edit [repo-alias] [release-tag]",
+	Short: "Edit the title, notes or state of an existing release",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if editNotes != "" && editNotesFile != "" {
+			return fmt.Errorf("--notes and --notes-file cannot be used together")
+		}
+		if editChangelog && editNotesFile == "" {
+			return fmt.Errorf("--changelog needs --notes-file")
+		}
+
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), args[1])
+		if err != nil {
+			return err
+		}
+
+		// Only send the fields that were asked for
+		var opts client.EditReleaseOptions
+		if cmd.Flags().Changed("title") {
+			opts.Name = &editTitle
+		}
+
+		body, notesChanged, err := readNotes(cmd, editNotes, editNotesFile, editChangelog, targetRelease.TagName)
+		if err != nil {
+			return err
+		}
+		if notesChanged {
+			if editAppend && targetRelease.Body != "" {
+				body = targetRelease.Body + "\n\n" + body
+			}
+			opts.Body = &body
+		}
+
+		if cmd.Flags().Changed("prerelease") {
+			opts.Prerelease = &editPrerelease
+		}
+		if cmd.Flags().Changed("draft") {
+			opts.Draft = &editDraft
+		}
+
+		if opts == (client.EditReleaseOptions{}) {
+			return fmt.Errorf("nothing to change, use --title, --notes, --notes-file, --prerelease or --draft")
+		}
+
+		api := client.New(repo.BaseURL, repo.Token)
+		updated, err := api.EditRelease(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, opts)
+		if err != nil {
+			return fmt.Errorf("error editing release: %w", err)
+		}
+
+		infof("Release %s of %s/%s has been updated\n", updated.TagName, repo.Owner, repo.Name)
+		return nil
+	},
+}
+
+// readNotes returns the release notes given with --notes or read from a
+// --notes-file, only the section of tag with --changelog, and whether
+// either flag was given
+func readNotes(cmd *cobra.Command, text, file string, changelog bool, tag string) (string, bool, error) {
+	if file == "" {
+		return text, cmd.Flags().Changed("notes"), nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("error reading notes file: %v", err)
+	}
+	body := string(data)
+	if changelog {
+		if body, err = notes.ChangelogSection(body, tag); err != nil {
+			return "", false, fmt.Errorf("%s: %v", file, err)
+		}
+	}
+	return body, true, nil
+}
+
+var (
+	ensureTitle      string
+	ensureNotes      string
+	ensureNotesFile  string
+	ensureChangelog  bool
+	ensureTarget     string
+	ensurePrerelease bool
+	ensureDraft      bool
+)
+
+var releaseCreateCmd = &cobra.Command{
+	Use:   "create [repo-alias] [release-tag] [file|directory|pattern...]",
+	Short: "Create a release and upload files to it",
+	Long: `Create a release for a tag, and the tag too, at --target, if it does not
+exist yet, then upload the files given as release upload does. It fails if
+the repository already has a release for the tag; release ensure updates it
+instead.
+
+With --changelog, only the section of the --notes-file for the tag becomes
+the release notes, e.g. "## [1.2.0] - 2024-05-01" up to the next version in a
+Keep a Changelog CHANGELOG.md.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ensureRelease(cmd, args, true)
+	},
+}
+
+var releaseEnsureCmd = &cobra.Command{
+	Use:   "ensure [repo-alias] [release-tag] [file|directory|pattern...]",
+	Short: "Create a release, or bring the existing one up to date",
+	Long: `Make sure a release exists for a tag as described, whether or not an earlier
+run got there first: the release is created if the repository has none for
+the tag (and the tag too, at --target, if it does not exist yet), otherwise
+the title, notes and state given are applied where they differ. Files given
+are uploaded as with release upload --resume, so assets already in the
+release as they are here are left alone and the rest uploaded or replaced;
+--overwrite replaces them all. Running it again changes nothing.
+
+--target only applies when the release is created; the tag of an existing
+release is not moved.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return ensureRelease(cmd, args, false)
+	},
+}
+
+// ensureRelease runs release ensure or, with create, release create, which
+// refuses to touch a release that already exists
+func ensureRelease(cmd *cobra.Command, args []string, create bool) error {
+	if ensureNotes != "" && ensureNotesFile != "" {
+		return fmt.Errorf("--notes and --notes-file cannot be used together")
+	}
+	if ensureChangelog && ensureNotesFile == "" {
+		return fmt.Errorf("--changelog needs --notes-file")
+	}
+	algorithms, err := checkUploadFlags()
+	if err != nil {
+		return err
+	}
+	var files map[string]string
+	var names []string
+	if len(args) > 2 {
+		if files, names, err = collectUploads(args[2:]); err != nil {
+			return err
+		}
+	}
+
+	tag := args[1]
+	body, notesSet, err := readNotes(cmd, ensureNotes, ensureNotesFile, ensureChangelog, tag)
+	if err != nil {
+		return err
+	}
+
+	cfg, repoDetails, err := loadRepo(args[0])
+	if err != nil {
+		return err
+	}
+
+	repo, err := releaseRepo(cfg, args[0], repoDetails)
+	if err != nil {
+		return err
+	}
+	releases, err := repo.List(cmd.Context())
+	if err != nil {
+		return err
+	}
+	cmd.SilenceUsage = true
+
+	var targetRelease release.Release
+	found := false
+	for _, rel := range releases {
+		if rel.TagName == tag {
+			targetRelease, found = rel, true
+			break
+		}
+	}
+
+	if found && create {
+		return fmt.Errorf("release %s already exists in %s/%s, use release ensure or release edit to change it", tag, repo.Owner, repo.Name)
+	}
+
+	api := client.New(repo.BaseURL, repo.Token)
+	if !found {
+		opts := client.CreateReleaseOptions{
+			TagName:    tag,
+			Target:     ensureTarget,
+			Name:       ensureTitle,
+			Body:       body,
+			Draft:      ensureDraft,
+			Prerelease: ensurePrerelease,
+		}
+		created, err := api.CreateRelease(cmd.Context(), repo.Owner, repo.Name, opts)
+		if err != nil {
+			return fmt.Errorf("error creating release: %w", err)
+		}
+		infof("Release %s of %s/%s has been created\n", created.TagName, repo.Owner, repo.Name)
+		targetRelease = created
+	} else {
+		// Only send the fields that were asked for and differ
+		var opts client.EditReleaseOptions
+		if cmd.Flags().Changed("title") && ensureTitle != targetRelease.Name {
+			opts.Name = &ensureTitle
+		}
+		if notesSet && body != targetRelease.Body {
+			opts.Body = &body
+		}
+		if cmd.Flags().Changed("prerelease") && ensurePrerelease != targetRelease.Prerelease {
+			opts.Prerelease = &ensurePrerelease
+		}
+		if cmd.Flags().Changed("draft") && ensureDraft != targetRelease.Draft {
+			opts.Draft = &ensureDraft
+		}
+
+		if opts == (client.EditReleaseOptions{}) {
+			infof("Release %s of %s/%s is up to date\n", targetRelease.TagName, repo.Owner, repo.Name)
+		} else {
+			updated, err := api.EditRelease(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, opts)
+			if err != nil {
+				return fmt.Errorf("error editing release: %w", err)
+			}
+			infof("Release %s of %s/%s has been updated\n", updated.TagName, repo.Owner, repo.Name)
+			targetRelease = updated
+		}
+	}
+
+	if len(names) == 0 {
+		return nil
+	}
+	// A new release has nothing to resume
+	uploadResume = !create && !uploadOverwrite
+	return uploadAssets(cmd, repo, targetRelease, files, names, algorithms)
+}
+
+var publishTitle string
+
+var releasePublishCmd = &cobra.Command{
+	Use:   "publish [repo-alias] [release-tag]",
+	Short: "Promote a draft or prerelease to a published release",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), args[1])
+		if err != nil {
+			return err
+		}
+
+		if !targetRelease.Draft && !targetRelease.Prerelease && publishTitle == "" {
+			infof("Release %s of %s/%s is already published\n", targetRelease.TagName, repo.Owner, repo.Name)
+			return nil
+		}
+
+		final := false
+		opts := client.EditReleaseOptions{Draft: &final, Prerelease: &final}
+		if publishTitle != "" {
+			opts.Name = &publishTitle
+		}
+
+		api := client.New(repo.BaseURL, repo.Token)
+		updated, err := api.EditRelease(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, opts)
+		if err != nil {
+			return fmt.Errorf("error publishing release: %w", err)
+		}
+
+		infof("Release %s of %s/%s has been published as %s\n", updated.TagName, repo.Owner, repo.Name, updated.Name)
+		return nil
+	},
+}
+
+var (
+	pruneKeepLast     int
+	pruneKeepPatterns []string
+	pruneOlderThan    string
+	pruneAssetsOnly   bool
+	pruneDryRun       bool
+)
+
+var releasePruneCmd = &cobra.Command{
+	Use:   "prune [repo-alias]",
+	Short: "Delete old releases or their assets according to a retention policy",
+	Long: "Delete releases (or only their assets with --assets-only) that are not among the newest --keep-last releases, " +
+		"do not match any --keep-pattern and are older than --older-than. Draft releases are never pruned.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pruneKeepLast <= 0 && pruneOlderThan == "" {
+			return fmt.Errorf("refusing to prune without a policy, use --keep-last and/or --older-than")
+		}
+
+		var maxAge time.Duration
+		if pruneOlderThan != "" {
+			var err error
+			if maxAge, err = parseAge(pruneOlderThan); err != nil {
+				return err
+			}
+		}
+
+		for _, pattern := range pruneKeepPatterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid keep pattern '%s': %v", pattern, err)
+			}
+		}
+
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+		releases, err := repo.List(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		api := client.New(repo.BaseURL, repo.Token)
+		var pruned int
+		published := 0
+		for _, rel := range releases {
+			if rel.Draft {
+				continue
+			}
+
+			// The API returns the newest releases first
+			published++
+			if published <= pruneKeepLast {
+				continue
+			}
+
+			if matchesAny(pruneKeepPatterns, rel.TagName) {
+				continue
+			}
+
+			if maxAge > 0 {
+				publishedAt, err := time.Parse(time.RFC3339, rel.PublishedAt)
+				if err != nil || time.Since(publishedAt) < maxAge {
+					continue
+				}
+			}
+
+			pruned++
+			if pruneAssetsOnly {
+				for _, asset := range rel.Assets {
+					if pruneDryRun {
+						fmt.Printf("Would delete asset %s of release %s\n", asset.Name, rel.TagName)
+						continue
+					}
+					if err := api.DeleteReleaseAsset(cmd.Context(), repo.Owner, repo.Name, rel.ID, asset.ID); err != nil {
+						return fmt.Errorf("error deleting asset %s of release %s: %w", asset.Name, rel.TagName, err)
+					}
+					infof("Deleted asset %s of release %s\n", asset.Name, rel.TagName)
+				}
+				continue
+			}
+
+			if pruneDryRun {
+				fmt.Printf("Would delete release %s (Published: %s)\n", rel.TagName, formatDate(rel.PublishedAt))
+				continue
+			}
+			if err := api.DeleteRelease(cmd.Context(), repo.Owner, repo.Name, rel.ID); err != nil {
+				return fmt.Errorf("error deleting release %s: %w", rel.TagName, err)
+			}
+			infof("Deleted release %s (Published: %s)\n", rel.TagName, formatDate(rel.PublishedAt))
+		}
+
+		if pruned == 0 {
+			infof("Nothing to prune\n")
+		}
+		return nil
+	},
+}
+
+var (
+	notesMilestone string
+	notesApply     bool
+	notesAppend    bool
+)
+
+var releaseNotesCmd = &cobra.Command{
+	Use:   "notes [repo-alias] [release-tag]",
+	Short: "Generate release notes from the closed issues and pull requests of a milestone",
+	Long: "Generate markdown release notes from the closed issues and merged pull requests of the milestone named " +
+		"after the tag (v1.2.0 and 1.2.0 both match), grouped by their first label. The notes are printed, or " +
+		"written to the release with --apply (appended to the existing notes with --append).",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if notesAppend && !notesApply {
+			return fmt.Errorf("--append only works with --apply")
+		}
+
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+
+		api := client.New(repo.BaseURL, repo.Token)
+		milestones, err := api.GetMilestones(cmd.Context(), repo.Owner, repo.Name)
+		if err != nil {
+			return fmt.Errorf("error getting milestones: %w", err)
+		}
+
+		name := args[1]
+		if notesMilestone != "" {
+			name = notesMilestone
+		}
+		milestone, ok := notes.FindMilestone(milestones, name)
+		if !ok {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("no milestone named %s in %s/%s", name, repo.Owner, repo.Name)
+		}
+
+		issues, err := api.GetClosedIssues(cmd.Context(), repo.Owner, repo.Name, milestone.ID)
+		if err != nil {
+			return fmt.Errorf("error getting issues of milestone %s: %w", milestone.Title, err)
+		}
+		body := notes.Markdown(issues)
+
+		if !notesApply {
+			fmt.Print(body)
+			return nil
+		}
+
+		targetRelease, err := repo.Find(cmd.Context(), args[1])
+		if err != nil {
+			return err
+		}
+		if notesAppend && targetRelease.Body != "" {
+			body = targetRelease.Body + "\n\n" + body
+		}
+
+		updated, err := api.EditRelease(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, client.EditReleaseOptions{Body: &body})
+		if err != nil {
+			return fmt.Errorf("error editing release: %w", err)
+		}
+		infof("Release notes of %s updated from milestone %s\n", updated.TagName, milestone.Title)
+		return nil
+	},
+}
+
+var (
+	uploadChecksums bool
+	uploadSumAlgs   []string
+	uploadSign      bool
+	uploadSignKey   string
+	uploadOverwrite bool
+	uploadSkip      bool
+	uploadResume    bool
+	uploadFail      bool
+	uploadParallel  int
+)
+
+var releaseUploadCmd = &cobra.Command{
+	Use:   "upload [repo-alias] [release-tag] [file|directory|pattern...]",
+	Short: "Upload files as assets of an existing release",
+	Long: "Upload files as assets of an existing release. A directory uploads the files at its top, leaving out " +
+		"hidden ones, and a quoted glob pattern such as 'dist/*' every file it matches. --parallel files (4 by " +
+		"default) upload at a time under a combined progress bar, each followed by its checksum and signature " +
+		"files; a failed upload does not stop the others and each file's result is reported at the end. With " +
+		"--checksums a SHA256SUMS file and a <file>.sha256 per file are generated and uploaded too, so fetch " +
+		"--verify can check downloads; --checksum-algorithm makes them with SHA-512, BLAKE3, SHA-1 or MD5 " +
+		"instead, or as well when repeated. With --sign every uploaded file, including the checksum files, gets " +
+		"an ASCII armored GPG signature <file>.asc made with the local gpg. " +
+		"When the release already has an asset of the same name the upload fails before anything is uploaded, " +
+		"unless --overwrite replaces the asset or --skip-existing leaves it alone. --resume, for re-running an " +
+		"interrupted upload, leaves the assets alone that match the local file in size and SHA-256 digest and " +
+		"replaces the others.",
+	Args: cobra.MinimumNArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policies := 0
+		for _, set := range []bool{uploadOverwrite, uploadSkip, uploadResume, uploadFail} {
+			if set {
+				policies++
+			}
+		}
+		if policies > 1 {
+			return fmt.Errorf("--overwrite, --skip-existing, --resume and --fail-if-exists cannot be used together")
+		}
+
+		algorithms, err := checkUploadFlags()
+		if err != nil {
+			return err
+		}
+		files, names, err := collectUploads(args[2:])
+		if err != nil {
+			return err
+		}
+
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), args[1])
+		if err != nil {
+			return err
+		}
+
+		return uploadAssets(cmd, repo, targetRelease, files, names, algorithms)
+	},
+}
+
+// checkUploadFlags checks the upload flags shared by release upload and
+// release ensure and returns the --checksum-algorithm algorithms
+func checkUploadFlags() ([]checksum.Algorithm, error) {
+	if uploadParallel < 1 {
+		return nil, fmt.Errorf("--parallel must be at least 1")
+	}
+	var algorithms []checksum.Algorithm
+	for _, name := range uploadSumAlgs {
+		a, err := checksum.ByName(name)
+		if err != nil {
+			return nil, err
+		}
+		algorithms = append(algorithms, a)
+	}
+	return algorithms, nil
+}
+
+// collectUploads returns the files the arguments name by asset name, and
+// the names in order
+func collectUploads(args []string) (map[string]string, []string, error) {
+	paths, err := uploadPaths(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := make(map[string]string) // Path by asset name
+	var names []string
+	for _, filePath := range paths {
+		name := filepath.Base(filePath)
+		if _, ok := files[name]; ok {
+			return nil, nil, fmt.Errorf("more than one file is named %s", name)
+		}
+		files[name] = filePath
+		names = append(names, name)
+	}
+	return files, names, nil
+}
+
+// uploadAssets uploads files, by asset name, to a release in the order of
+// names, with the checksum and signature files the upload flags ask for.
+// Existing assets are handled as the --overwrite, --skip-existing and
+// --resume flags say.
+func uploadAssets(cmd *cobra.Command, repo release.Repo, targetRelease release.Release, files map[string]string, names []string, algorithms []checksum.Algorithm) error {
+	// Generated checksum and signature files live here until uploaded
+	tmpDir, err := os.MkdirTemp("", "gitea-release-upload-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Checksum and signature files go up right after the file they
+	// are for, combined checksum files once everything they cover is in
+	follows := make(map[string]bool)
+	last := make(map[string]bool)
+
+	if uploadChecksums {
+		perFile := make(map[string][]string) // Checksum files by asset name
+		var sumsFiles []string
+		for _, a := range algorithms {
+			sums := make(map[string]string)
+			for _, name := range names {
+				sum, err := a.File(files[name])
+				if err != nil {
+					return fmt.Errorf("error hashing %s: %v", files[name], err)
+				}
+				sums[name] = sum
+
+				sumName := name + a.Suffixes[0]
+				sumPath := filepath.Join(tmpDir, sumName)
+				if err := os.WriteFile(sumPath, checksum.Format(map[string]string{name: sum}), 0644); err != nil {
+					return fmt.Errorf("error writing %s: %v", sumPath, err)
+				}
+				files[sumName] = sumPath
+				follows[sumName] = true
+				perFile[name] = append(perFile[name], sumName)
+			}
+
+			sumsPath := filepath.Join(tmpDir, a.SumsFile)
+			if err := os.WriteFile(sumsPath, checksum.Format(sums), 0644); err != nil {
+				return fmt.Errorf("error writing %s: %v", sumsPath, err)
+			}
+			files[a.SumsFile] = sumsPath
+			sumsFiles = append(sumsFiles, a.SumsFile)
+			last[a.SumsFile] = true
+		}
+
+		// Upload each checksum file after its asset and the combined
+		// files such as SHA256SUMS last
+		var withSums []string
+		for _, name := range names {
+			withSums = append(withSums, name)
+			withSums = append(withSums, perFile[name]...)
+		}
+		names = append(withSums, sumsFiles...)
+	}
+
+	if uploadSign {
+		var withSignatures []string
+		for _, name := range names {
+			sigPath := filepath.Join(tmpDir, name+".asc")
+			if err := gpgSign(cmd.Context(), files[name], sigPath, uploadSignKey); err != nil {
+				return err
+			}
+			files[name+".asc"] = sigPath
+			follows[name+".asc"] = true
+			withSignatures = append(withSignatures, name, name+".asc")
+		}
+		names = withSignatures
+	}
+
+	existing := make(map[string]release.Asset)
+	for _, asset := range targetRelease.Assets {
+		existing[asset.Name] = asset
+	}
+
+	// Check everything first so a conflict leaves the release untouched
+	if !uploadOverwrite && !uploadSkip && !uploadResume {
+		var conflicts []string
+		for _, name := range names {
+			if _, ok := existing[name]; ok {
+				conflicts = append(conflicts, name)
+			}
+		}
+		if len(conflicts) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("release %s already has %s (use --overwrite, --skip-existing or --resume)",
+				targetRelease.TagName, strings.Join(conflicts, ", "))
+		}
+	}
+
+	// Existing assets left alone: all of them with --skip-existing, those
+	// that are the same as the local file with --resume
+	keep := make(map[string]bool)
+	sumFiles := make(map[string][]byte) // Checksum files fetched by name
+	for _, name := range names {
+		old, ok := existing[name]
+		switch {
+		case !ok:
+		case uploadSkip:
+			keep[name] = true
+		case uploadResume && follows[name] && strings.HasSuffix(name, ".asc"):
+			// A new signature differs from the old one anyway, which
+			// still holds for an unchanged file
+			keep[name] = keep[strings.TrimSuffix(name, ".asc")]
+		case uploadResume:
+			same, err := sameAsset(cmd.Context(), repo, targetRelease, old, files[name], sumFiles)
+			if err != nil {
+				if cmd.Context().Err() != nil {
+					return err
+				}
+				client.Debugf("%s: %v, uploading it again", name, err)
+			}
+			keep[name] = same
+		}
+	}
+
+	var total int64
+	var pending []string
+	for _, name := range names {
+		if keep[name] {
+			continue
+		}
+		info, err := os.Stat(files[name])
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", files[name], err)
+		}
+		total += info.Size()
+		pending = append(pending, name)
+	}
+
+	// Results are printed as they come without a bar, after it with one
+	var bar *download.Progress
+	if showProgress() || progressJSON() != nil {
+		bar = download.NewProgress(download.Options{Label: plural(len(pending), "file"), ProgressJSON: progressJSON()}, "Uploading:", total)
+	}
+	show := func(r uploadResult) {
+		// The error of a single file is what the command fails with;
+		// uploads never started after an interrupt are not reported
+		if r.Name != "" && (r.Err == nil || len(names) > 1) {
+			r.print(targetRelease.TagName)
+		}
+	}
+
+	api := client.New(repo.BaseURL, repo.Token)
+	var track func(io.Reader) io.Reader
+	if bar != nil {
+		track = bar.NewProxyReader
+	}
+
+	results := make([]uploadResult, len(names))
+	var mu sync.Mutex // Guards finished and the output
+	finished := 0
+	upload := func(i int) {
+		name := names[i]
+		old, exists := existing[name]
+		var r uploadResult
+		switch {
+		case cmd.Context().Err() != nil:
+			// Interrupted, it would fail like the running ones
+			return
+		case keep[name]:
+			r = uploadResult{Name: name, Skipped: true}
+		default:
+			r = uploadResult{Name: name}
+			if exists {
+				if err := api.DeleteReleaseAsset(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, old.ID); err != nil {
+					r.Err = fmt.Errorf("error replacing %s: %w", name, err)
+					break
+				}
+			}
+			asset, err := api.UploadReleaseAsset(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, name, files[name], track)
+			if err != nil {
+				r.Err = fmt.Errorf("error uploading %s: %w", name, err)
+				break
+			}
+			r.Size = asset.Size
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = r
+		if bar == nil {
+			show(r)
+		} else if !r.Skipped {
+			finished++
+			bar.SetLabel(fmt.Sprintf("%d/%d files", finished, len(pending)))
+		}
+	}
+
+	// A job is a file with the files that follow it, uploaded in order
+	var jobs [][]int
+	for i, name := range names {
+		if follows[name] && len(jobs) > 0 {
+			jobs[len(jobs)-1] = append(jobs[len(jobs)-1], i)
+		} else {
+			jobs = append(jobs, []int{i})
+		}
+	}
+	for _, final := range []bool{false, true} {
+		var group errgroup.Group
+		group.SetLimit(uploadParallel)
+		for _, job := range jobs {
+			if last[names[job[0]]] != final {
+				continue
+			}
+			group.Go(func() error {
+				for _, i := range job {
+					upload(i)
+				}
+				return nil
+			})
+		}
+		group.Wait()
+	}
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil || r.Name == "" {
+			failed++
+		}
+	}
+	if bar != nil {
+		var err error
+		if failed > 0 {
+			err = fmt.Errorf("%d of %d uploads failed", failed, len(pending))
+		}
+		bar.SetLabel(plural(len(pending), "file"))
+		bar.Finish(err)
+		for _, r := range results {
+			show(r)
+		}
+	}
+
+	cmd.SilenceUsage = true
+	switch {
+	case failed == 1 && len(names) == 1 && results[0].Err != nil:
+		return results[0].Err
+	case failed > 0:
+		return fmt.Errorf("%d of %d uploads to release %s failed", failed, len(pending), targetRelease.TagName)
+	}
+	return nil
+}
+
+// sameAsset reports whether an asset is the file at filePath: of the same
+// size and SHA-256 digest, as published in the release's checksum files or
+// else computed by downloading it. Small files such as checksum files are
+// compared byte by byte. sumFiles caches the checksum files.
+func sameAsset(ctx context.Context, repo release.Repo, rel release.Release, asset release.Asset, filePath string, sumFiles map[string][]byte) (bool, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return false, err
+	}
+	if asset.IsExternal() || asset.Size != info.Size() {
+		return false, nil
+	}
+
+	if asset.Size <= maxChecksumSize {
+		remote, err := fetchAssetData(ctx, repo, asset, maxChecksumSize)
+		if err != nil {
+			return false, err
+		}
+		local, err := os.ReadFile(filePath)
+		if err != nil {
+			return false, err
+		}
+		return bytes.Equal(local, remote), nil
+	}
+
+	sum, err := findChecksum(ctx, repo, rel, asset, sumFiles, checksum.SHA256)
+	if err != nil {
+		return false, err
+	}
+	digest := checksum.Digest{Algorithm: checksum.SHA256, Hex: sum.Digest}
+	return digest.Verify(filePath) == nil, nil
+}
+
+// uploadResult is the outcome of uploading one file
+type uploadResult struct {
+	Name    string
+	Size    int64
+	Skipped bool  // The release already had it and --skip-existing was set
+	Err     error // The upload failed
+}
+
+func (r uploadResult) print(tag string) {
+	switch {
+	case r.Err != nil:
+		printError(r.Err)
+	case r.Skipped:
+		infof("Skipped %s, release %s already has it\n", r.Name, tag)
+	default:
+		infof("Uploaded %s to release %s (%s)\n", r.Name, tag, download.FormatBytes(r.Size))
+	}
+}
+
+// uploadPaths expands the file arguments of release upload: glob patterns
+// such as 'dist/*', for shells that do not expand them, and directories,
+// whose top-level files are uploaded. Hidden files in directories and
+// anything but regular files matched by a pattern are left out.
+func uploadPaths(args []string) ([]string, error) {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(filePath string) {
+		if clean := filepath.Clean(filePath); !seen[clean] {
+			seen[clean] = true
+			paths = append(paths, clean)
+		}
+	}
+
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern '%s': %v", arg, err)
+			}
+			found := false
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+					add(match)
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("no files match %s", arg)
+			}
+			continue
+		}
+
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", arg, err)
+		}
+		if !info.IsDir() {
+			if !info.Mode().IsRegular() {
+				return nil, fmt.Errorf("%s is not a regular file", arg)
+			}
+			add(arg)
+			continue
+		}
+
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", arg, err)
+		}
+		found := false
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") || !entry.Type().IsRegular() {
+				continue
+			}
+			add(filepath.Join(arg, entry.Name()))
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("no files in directory %s", arg)
+		}
+	}
+	return paths, nil
+}
+
+var linkOverwrite bool
+
+var releaseAddLinkCmd = &cobra.Command{
+	Use:   "add-link [repo-alias] [release-tag] [name] [url]",
+	Short: "Attach a link to a file hosted elsewhere as a release asset",
+	Long: "Attach a link to a file hosted outside Gitea, such as a big artifact in object storage, as an asset " +
+		"of an existing release (Gitea 1.24 and later). The link is listed and downloaded like any other asset; " +
+		"its size is unknown until it is downloaded. An existing asset of the same name is only replaced with --overwrite.",
+	Args: cobra.ExactArgs(4),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, externalURL := args[2], args[3]
+		if u, err := url.Parse(externalURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL '%s', use an http or https URL", externalURL)
+		}
+
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), args[1])
+		if err != nil {
+			return err
+		}
+		cmd.SilenceUsage = true
+
+		api := client.New(repo.BaseURL, repo.Token)
+		for _, asset := range targetRelease.Assets {
+			if asset.Name != name {
+				continue
+			}
+			if !linkOverwrite {
+				return fmt.Errorf("release %s already has %s (use --overwrite)", targetRelease.TagName, name)
+			}
+			if err := api.DeleteReleaseAsset(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, asset.ID); err != nil {
+				return fmt.Errorf("error replacing %s: %w", name, err)
+			}
+		}
+
+		if _, err := api.AddReleaseLink(cmd.Context(), repo.Owner, repo.Name, targetRelease.ID, name, externalURL); err != nil {
+			return fmt.Errorf("error adding %s: %w", name, err)
+		}
+		infof("Linked %s to release %s as %s\n", externalURL, targetRelease.TagName, name)
+		return nil
+	},
+}
+
+// gpgSign writes an ASCII armored detached signature of filePath to sigPath,
+// made with key or the default key of the local gpg
+func gpgSign(ctx context.Context, filePath, sigPath, key string) error {
+	gpgArgs := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", sigPath}
+	if key != "" {
+		gpgArgs = append(gpgArgs, "--local-user", key)
+	}
+	gpgArgs = append(gpgArgs, filePath)
+
+	gpg := exec.CommandContext(ctx, "gpg", gpgArgs...)
+	gpg.Stderr = os.Stderr
+	if err := gpg.Run(); err != nil {
+		return fmt.Errorf("error signing %s with gpg: %v", filePath, err)
+	}
+	return nil
+}
+
+// matchesAny reports whether name matches any of the glob patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	releaseEditCmd.Flags().StringVar(&editTitle, "title", "", "New release title")
+	releaseEditCmd.Flags().StringVar(&editNotes, "notes", "", "New release notes")
+	releaseEditCmd.Flags().StringVar(&editNotesFile, "notes-file", "", "Read the new release notes from a file")
+	releaseEditCmd.Flags().BoolVar(&editChangelog, "changelog", false, "Use only the section of --notes-file for the release's tag, as in a Keep a Changelog CHANGELOG.md")
+	releaseEditCmd.Flags().BoolVar(&editAppend, "append", false, "Append the notes to the existing release notes instead of replacing them")
+	releaseEditCmd.Flags().BoolVar(&editPrerelease, "prerelease", false, "Mark the release as a prerelease (--prerelease=false to clear)")
+	releaseEditCmd.Flags().BoolVar(&editDraft, "draft", false, "Mark the release as a draft (--draft=false to publish)")
+
+	releaseEnsureCmd.Flags().StringVar(&ensureTitle, "title", "", "Release title (default: the tag)")
+	releaseEnsureCmd.Flags().StringVar(&ensureNotes, "notes", "", "Release notes")
+	releaseEnsureCmd.Flags().StringVar(&ensureNotesFile, "notes-file", "", "Read the release notes from a file")
+	releaseEnsureCmd.Flags().BoolVar(&ensureChangelog, "changelog", false, "Use only the section of --notes-file for the tag, as in a Keep a Changelog CHANGELOG.md")
+	releaseEnsureCmd.Flags().StringVar(&ensureTarget, "target", "", "Branch or commit to create the tag at if it does not exist (default: the default branch)")
+	releaseEnsureCmd.Flags().BoolVar(&ensurePrerelease, "prerelease", false, "Mark the release as a prerelease (--prerelease=false to clear)")
+	releaseEnsureCmd.Flags().BoolVar(&ensureDraft, "draft", false, "Mark the release as a draft (--draft=false to publish)")
+	releaseEnsureCmd.Flags().BoolVar(&uploadChecksums, "checksums", false, "Also upload a SHA256SUMS file and a <file>.sha256 per file")
+	releaseEnsureCmd.Flags().StringSliceVar(&uploadSumAlgs, "checksum-algorithm", []string{"sha256"}, "Algorithms of the --checksums files (repeatable): "+checksum.Names())
+	releaseEnsureCmd.Flags().BoolVar(&uploadSign, "sign", false, "Also upload a GPG signature <file>.asc for every uploaded file")
+	releaseEnsureCmd.Flags().StringVar(&uploadSignKey, "sign-key", "", "GPG key to sign with (default: the default gpg key)")
+	releaseEnsureCmd.Flags().BoolVar(&uploadOverwrite, "overwrite", false, "Replace every asset that already exists in the release, even unchanged ones")
+	releaseEnsureCmd.Flags().IntVar(&uploadParallel, "parallel", 4, "Upload this many files at a time")
+
+	releaseCreateCmd.Flags().StringVar(&ensureTitle, "title", "", "Release title (default: the tag)")
+	releaseCreateCmd.Flags().StringVar(&ensureNotes, "notes", "", "Release notes")
+	releaseCreateCmd.Flags().StringVar(&ensureNotesFile, "notes-file", "", "Read the release notes from a file")
+	releaseCreateCmd.Flags().BoolVar(&ensureChangelog, "changelog", false, "Use only the section of --notes-file for the tag, as in a Keep a Changelog CHANGELOG.md")
+	releaseCreateCmd.Flags().StringVar(&ensureTarget, "target", "", "Branch or commit to create the tag at if it does not exist (default: the default branch)")
+	releaseCreateCmd.Flags().BoolVar(&ensurePrerelease, "prerelease", false, "Mark the release as a prerelease")
+	releaseCreateCmd.Flags().BoolVar(&ensureDraft, "draft", false, "Create the release as a draft")
+	releaseCreateCmd.Flags().BoolVar(&uploadChecksums, "checksums", false, "Also upload a SHA256SUMS file and a <file>.sha256 per file")
+	releaseCreateCmd.Flags().StringSliceVar(&uploadSumAlgs, "checksum-algorithm", []string{"sha256"}, "Algorithms of the --checksums files (repeatable): "+checksum.Names())
+	releaseCreateCmd.Flags().BoolVar(&uploadSign, "sign", false, "Also upload a GPG signature <file>.asc for every uploaded file")
+	releaseCreateCmd.Flags().StringVar(&uploadSignKey, "sign-key", "", "GPG key to sign with (default: the default gpg key)")
+	releaseCreateCmd.Flags().IntVar(&uploadParallel, "parallel", 4, "Upload this many files at a time")
+
+	releasePublishCmd.Flags().StringVar(&publishTitle, "title", "", "Re-title the release when publishing it")
+
+	releasePruneCmd.Flags().IntVar(&pruneKeepLast, "keep-last", 0, "Always keep the newest N releases")
+	releasePruneCmd.Flags().StringArrayVar(&pruneKeepPatterns, "keep-pattern", nil, "Always keep releases whose tag matches this glob (repeatable)")
+	releasePruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "", "Only prune releases older than this age (e.g. 90d, 2w, 36h)")
+	releasePruneCmd.Flags().BoolVar(&pruneAssetsOnly, "assets-only", false, "Delete the assets of matching releases but keep the releases")
+	releasePruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Show what would be deleted without deleting anything")
+
+	releaseNotesCmd.Flags().StringVar(&notesMilestone, "milestone", "", "Milestone to use instead of the one named after the tag")
+	releaseNotesCmd.Flags().BoolVar(&notesApply, "apply", false, "Write the notes to the release instead of printing them")
+	releaseNotesCmd.Flags().BoolVar(&notesAppend, "append", false, "Append the notes to the existing release notes (with --apply)")
+
+	releaseUploadCmd.Flags().BoolVar(&uploadChecksums, "checksums", false, "Also upload a SHA256SUMS file and a <file>.sha256 per file")
+	releaseUploadCmd.Flags().StringSliceVar(&uploadSumAlgs, "checksum-algorithm", []string{"sha256"}, "Algorithms of the --checksums files (repeatable): "+checksum.Names())
+	releaseUploadCmd.Flags().BoolVar(&uploadSign, "sign", false, "Also upload a GPG signature <file>.asc for every uploaded file")
+	releaseUploadCmd.Flags().StringVar(&uploadSignKey, "sign-key", "", "GPG key to sign with (default: the default gpg key)")
+	releaseUploadCmd.Flags().BoolVar(&uploadOverwrite, "overwrite", false, "Replace assets that already exist in the release")
+	releaseUploadCmd.Flags().BoolVar(&uploadSkip, "skip-existing", false, "Leave assets that already exist in the release alone and upload the rest")
+	releaseUploadCmd.Flags().BoolVar(&uploadResume, "resume", false, "Leave assets that are already complete alone and upload what is missing or different, e.g. after an interrupted run")
+	releaseUploadCmd.Flags().BoolVar(&uploadFail, "fail-if-exists", false, "Fail without uploading anything if an asset already exists (the default)")
+	releaseUploadCmd.Flags().IntVar(&uploadParallel, "parallel", 4, "Upload this many files at a time")
+
+	releaseAddLinkCmd.Flags().BoolVar(&linkOverwrite, "overwrite", false, "Replace an asset of the same name")
+
+	releaseCmd.AddCommand(releaseCreateCmd)
+	releaseCmd.AddCommand(releaseEditCmd)
+	releaseCmd.AddCommand(releaseEnsureCmd)
+	releaseCmd.AddCommand(releasePublishCmd)
+	releaseCmd.AddCommand(releasePruneCmd)
+	releaseCmd.AddCommand(releaseUploadCmd)
+	releaseCmd.AddCommand(releaseAddLinkCmd)
+	releaseCmd.AddCommand(releaseNotesCmd)
+	rootCmd.AddCommand(releaseCmd)
+}
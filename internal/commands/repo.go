@@ -0,0 +1,571 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/deploy"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/earentir/gitearelease"
+	"github.com/spf13/cobra"
+)
+
+var repoCmd = &cobra.Command{
+	Use:   "repo",
+	Short: "Manage repositories",
+}
+
+var urlFlag, hostFlag, ownerFlag, nameFlag, aliasFlag, repoChmodFlag, repoChownFlag, repoTokenFlag string
+var repoGroupsFlag []string
+
+var repoAddCmd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a repository to the configuration",
+	Long: "Add a repository to the configuration. Without --owner, --name, --url and --host\n" +
+		"a wizard asks for the instance and lists repositories to pick from.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if ownerFlag == "" && nameFlag == "" && urlFlag == "" && hostFlag == "" {
+			return repoAddWizard(cmd.Context())
+		}
+		if ownerFlag == "" || nameFlag == "" {
+			return fmt.Errorf("--owner and --name are required, or run repo add without them for a wizard")
+		}
+
+		// If alias is not provided, use the repository name
+		if aliasFlag == "" {
+			aliasFlag = nameFlag
+		}
+
+		if repoChmodFlag != "" {
+			if _, err := deploy.ParseFileMode(repoChmodFlag); err != nil {
+				return err
+			}
+		}
+
+		url, err := repoURL()
+		if err != nil {
+			return err
+		}
+		cfg, giteaURL, err := loadConfigForURL(url)
+		if err != nil {
+			return err
+		}
+
+		// Try to check if the repository exists, but proceed even if we get an error
+		// since we're working with public repos which may exist but have limited API access
+		_, _ = client.New(giteaURL, repoTokenFlag).GetRepositories(cmd.Context(), ownerFlag)
+
+		// Skip the existence check - we'll assume the repo exists
+		// and let the user verify manually
+
+		if err := checkGiteaURL(cfg, giteaURL); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+
+		// Update config
+		cfg.GiteaURL = giteaURL
+		cfg.Repos[aliasFlag] = config.RepoDetails{
+			Owner:  ownerFlag,
+			Name:   nameFlag,
+			Chmod:  repoChmodFlag,
+			Chown:  repoChownFlag,
+			Token:  repoTokenFlag,
+			Groups: repoGroupsFlag,
+		}
+
+		// Save config
+		if err := config.Save(cfg, configFile); err != nil {
+			return err
+		}
+
+		infof("Repository %s/%s added with alias %s\n", ownerFlag, nameFlag, aliasFlag)
+		return nil
+	},
+}
+
+var importUserFlag string
+var importStarred, importAll, importDryRun bool
+
+var repoImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Add all repositories of a user or organization to the configuration",
+	Long: "Add all repositories of a user or organization (or the repositories they starred) " +
+		"that have releases to the configuration, using the repository name as alias",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		url, err := repoURL()
+		if err != nil {
+			return err
+		}
+		cfg, giteaURL, err := loadConfigForURL(url)
+		if err != nil {
+			return err
+		}
+		if err := checkGiteaURL(cfg, giteaURL); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		cfg.GiteaURL = giteaURL
+
+		token, err := cfg.TokenFor("")
+		if err != nil {
+			return err
+		}
+		api := client.New(giteaURL, token)
+		var repos []gitearelease.Repository
+		if importStarred {
+			repos, err = api.GetStarredRepositories(cmd.Context(), importUserFlag)
+		} else {
+			repos, err = api.GetRepositories(cmd.Context(), importUserFlag)
+		}
+		if err != nil {
+			return fmt.Errorf("error getting repositories: %w", err)
+		}
+
+		// Index the configured repositories so re-imports are idempotent
+		configured := make(map[string]bool)
+		for _, repo := range cfg.Repos {
+			configured[repo.Owner+"/"+repo.Name] = true
+		}
+
+		var added int
+		for _, repo := range repos {
+			if repo.ReleaseCounter == 0 && !importAll {
+				continue
+			}
+			if configured[repo.Owner.Login+"/"+repo.Name] {
+				continue
+			}
+
+			alias := importAlias(cfg, repo.Owner.Login, repo.Name)
+			if alias == "" {
+				infof("Skipping %s/%s: no free alias\n", repo.Owner.Login, repo.Name)
+				continue
+			}
+
+			cfg.Repos[alias] = config.RepoDetails{
+				Owner: repo.Owner.Login,
+				Name:  repo.Name,
+			}
+			configured[repo.Owner.Login+"/"+repo.Name] = true
+			added++
+			infof("  %s: %s/%s\n", alias, repo.Owner.Login, repo.Name)
+		}
+
+		if added == 0 {
+			infof("No new repositories to import\n")
+			return nil
+		}
+
+		if importDryRun {
+			fmt.Printf("%d repositories would be imported\n", added)
+			return nil
+		}
+
+		if err := config.Save(cfg, configFile); err != nil {
+			return err
+		}
+
+		infof("%d repositories imported\n", added)
+		return nil
+	},
+}
+
+// repoURL returns the URL given with --url, or the URL of the well-known
+// host given with --host
+func repoURL() (string, error) {
+	switch {
+	case urlFlag != "" && hostFlag != "":
+		return "", fmt.Errorf("--url and --host cannot be used together")
+	case hostFlag != "":
+		url, ok := config.HostURL(hostFlag)
+		if !ok {
+			return "", fmt.Errorf("unknown host %s, use one of %s or --url", hostFlag, strings.Join(config.HostNames(), ", "))
+		}
+		return url, nil
+	case urlFlag == "":
+		return "", fmt.Errorf("--url or --host is required")
+	}
+	return urlFlag, nil
+}
+
+// loadConfigForURL loads the config, or starts a new one when it does not
+// exist yet, and resolves url, which may be an existing alias, to a Gitea URL
+func loadConfigForURL(url string) (*config.Config, string, error) {
+	// Load existing config if available
+	cfg, err := config.LoadFile(configFile)
+	if err != nil {
+		// If config doesn't exist, create a new one
+		if errors.Is(err, fs.ErrNotExist) {
+			cfg = &config.Config{
+				GiteaURL: url, // use the provided URL initially
+				Repos:    make(map[string]config.RepoDetails),
+			}
+		} else {
+			return nil, "", err
+		}
+	}
+
+	// Check if url is an existing alias in the config
+	if _, exists := cfg.Repos[url]; exists {
+		// Use the same Gitea URL as the referenced repo
+		infof("Using Gitea URL from existing alias '%s'\n", url)
+		return cfg, cfg.GiteaURL, nil
+	}
+
+	// Use the URL as provided
+	return cfg, url, nil
+}
+
+// checkGiteaURL refuses to add repositories of another Gitea instance: the
+// configured repositories all use gitea_url, so changing it would point
+// every one of them at the new instance
+func checkGiteaURL(cfg *config.Config, giteaURL string) error {
+	if cfg.GiteaURL == "" || len(cfg.Repos) == 0 {
+		return nil
+	}
+	if strings.TrimRight(cfg.GiteaURL, "/") == strings.TrimRight(giteaURL, "/") {
+		return nil
+	}
+	return fmt.Errorf("the configured repositories use %s, add repositories of %s to a separate --config or a profile", cfg.GiteaURL, giteaURL)
+}
+
+// importAlias picks an unused alias for an imported repository, trying the
+// repository name first and the owner-qualified name second
+func importAlias(cfg *config.Config, owner, name string) string {
+	for _, alias := range []string{strings.ToLower(name), strings.ToLower(owner + "-" + name)} {
+		if _, exists := cfg.Repos[alias]; !exists {
+			return alias
+		}
+	}
+	return ""
+}
+
+var repoListOutput string
+
+var repoListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all configured repositories, or those in a --group",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if repoListOutput != "text" && repoListOutput != "wide" {
+			return fmt.Errorf("unsupported output format '%s', use text or wide", repoListOutput)
+		}
+
+		cfg, err := config.Load(configFile)
+		if err != nil {
+			return err
+		}
+
+		aliases, err := selectAliases(cfg, nil, groupFlag)
+		if err != nil && groupFlag != "" {
+			return err
+		}
+		if len(aliases) == 0 {
+			fmt.Println("No repositories configured")
+			return nil
+		}
+
+		wide := repoListOutput == "wide"
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		header := "ALIAS\tREPOSITORY\tGROUPS\tPINNED"
+		if wide {
+			header += "\tCHANNEL\tBLOCKED\tASSET\tDEPLOY PATH"
+		}
+		fmt.Fprintln(w, header)
+		for _, alias := range aliases {
+			repo := cfg.Repos[alias]
+			line := fmt.Sprintf("%s\t%s/%s\t%s\t%s", alias, repo.Owner, repo.Name,
+				orDash(strings.Join(repo.Groups, ",")), orDash(repo.PinnedTag))
+			if wide {
+				channel := repo.Channel
+				if channel == "" {
+					channel = release.Stable
+				}
+				line += fmt.Sprintf("\t%s\t%s\t%s\t%s", channel, orDash(strings.Join(repo.BlockedTags, ",")),
+					orDash(repo.Asset), orDash(repo.DeployPath))
+			}
+			fmt.Fprintln(w, line)
+		}
+		return w.Flush()
+	},
+}
+
+var verifyAll bool
+
+var repoVerifyCmd = &cobra.Command{
+	Use:   "verify [repo-alias...]",
+	Short: "Check that configured repositories exist and are reachable",
+	Long: `Check that the given repositories, those in a --group or all of them with
+--all, exist and can be read with the configured token, which repo add does not check. Each
+repository gets a line with its status; the command fails if any of them
+cannot be read.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verifyAll == (len(args) > 0 || groupFlag != "") {
+			return fmt.Errorf("give repository aliases, --group or --all")
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		aliases, err := selectAliases(cfg, args, groupFlag)
+		if err != nil {
+			return err
+		}
+		for _, alias := range aliases {
+			if _, ok := cfg.Repos[alias]; !ok {
+				return fmt.Errorf("repository alias %s not found", alias)
+			}
+		}
+		cmd.SilenceUsage = true
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ALIAS\tREPOSITORY\t%s\tDETAILS\n", paint(colorPlain, "STATUS"))
+		failed := 0
+		for _, alias := range aliases {
+			details := cfg.Repos[alias]
+			status, info := verifyRepo(cmd.Context(), cfg, alias, details)
+			if cmd.Context().Err() != nil {
+				return cmd.Context().Err()
+			}
+			if status != "ok" {
+				failed++
+			}
+			color := colorGreen
+			if status != "ok" {
+				color = colorRed
+			}
+			fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\n", alias, details.Owner, details.Name, paint(color, status), info)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d repositories could not be verified", failed, len(aliases))
+		}
+		return nil
+	},
+}
+
+// verifyRepo reads a repository and its latest release with the configured
+// token and returns a status and details for the table
+func verifyRepo(ctx context.Context, cfg *config.Config, alias string, details config.RepoDetails) (string, string) {
+	token, err := cfg.TokenFor(alias)
+	if err != nil {
+		return "error", fmt.Sprintf("reading the token failed: %v", err)
+	}
+	api := client.New(cfg.GiteaURL, token)
+
+	repo, err := api.GetRepository(ctx, details.Owner, details.Name)
+	if err != nil {
+		return verifyFailure(err)
+	}
+
+	var info []string
+	if repo.Private {
+		info = append(info, "private")
+	} else {
+		info = append(info, "public")
+	}
+	if repo.Archived {
+		info = append(info, "archived")
+	}
+
+	releases, err := api.GetReleases(ctx, details.Owner, details.Name, true)
+	switch {
+	case isNotFound(err) || err == nil && len(releases) == 0:
+		info = append(info, "no published release")
+	case err != nil:
+		status, reason := verifyFailure(err)
+		return status, "releases: " + reason
+	default:
+		info = append(info, "latest "+releases[0].TagName)
+	}
+	return "ok", strings.Join(info, ", ")
+}
+
+// verifyFailure turns an API error into a status and its reason
+func verifyFailure(err error) (string, string) {
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) {
+		return "unreachable", err.Error()
+	}
+	if scopes := missingScopes(err); scopes != "" {
+		return "forbidden", "the token needs the " + scopes + " scope"
+	}
+	switch statusErr.StatusCode {
+	case http.StatusUnauthorized:
+		return "unauthorized", "the token is invalid, expired or revoked"
+	case http.StatusForbidden:
+		return "forbidden", statusErr.Message
+	case http.StatusNotFound:
+		return "not found", "the repository does not exist or the token cannot see it"
+	}
+	return "error", err.Error()
+}
+
+var repoPinCmd = &cobra.Command{
+	Use:   "pin [repo-alias] [release-tag-or-channel]",
+	Short: "Hold a repository at one release",
+	Long: `Pin a repository to a release, to hold back a bad upstream release. fetch
+and the other commands given no tag use the pinned release instead of the
+newest one, and watch deploys it, until repo unpin. fetch and watch warn when
+newer releases exist. A channel such as stable pins its current release.
+
+This is not the pin command, which writes Nix and Bazel pins.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias := args[0]
+		cfg, repoDetails, err := loadRepo(alias)
+		if err != nil {
+			return err
+		}
+		repoDetails.PinnedTag = ""
+		repo, err := releaseRepo(cfg, alias, repoDetails)
+		if err != nil {
+			return err
+		}
+		rel, err := repo.Find(cmd.Context(), args[1])
+		if err != nil {
+			return err
+		}
+
+		err = updateRepoDetails(alias, func(details *config.RepoDetails) { details.PinnedTag = rel.TagName })
+		if err != nil {
+			return err
+		}
+		infof("Pinned %s to %s\n", alias, rel.TagName)
+		return nil
+	},
+}
+
+var repoUnpinCmd = &cobra.Command{
+	Use:   "unpin [repo-alias]",
+	Short: "Follow the newest release of a pinned repository again",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := updateRepoDetails(args[0], func(details *config.RepoDetails) { details.PinnedTag = "" }); err != nil {
+			return err
+		}
+		infof("Unpinned %s\n", args[0])
+		return nil
+	},
+}
+
+var repoBlockCmd = &cobra.Command{
+	Use:   "block [repo-alias] [release-tag...]",
+	Short: "Skip known-bad releases of a repository",
+	Long: `Block releases by tag. A blocked release is never the newest release of a
+channel, so fetch and the other commands given no tag, status and watch fall
+back to the newest release that is not blocked, even when a blocked release
+is the latest. Tags can be blocked before they are released. A blocked
+release can still be fetched by its tag.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias, tags := args[0], args[1:]
+		err := updateRepoDetails(alias, func(details *config.RepoDetails) {
+			for _, tag := range tags {
+				if !slices.Contains(details.BlockedTags, tag) {
+					details.BlockedTags = append(details.BlockedTags, tag)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		infof("Blocked %s of %s\n", strings.Join(tags, ", "), alias)
+		return nil
+	},
+}
+
+var repoUnblockCmd = &cobra.Command{
+	Use:   "unblock [repo-alias] [release-tag...]",
+	Short: "Allow blocked releases of a repository again",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias := args[0]
+		var unblocked, missing []string
+		err := updateRepoDetails(alias, func(details *config.RepoDetails) {
+			for _, tag := range args[1:] {
+				if i := slices.Index(details.BlockedTags, tag); i >= 0 {
+					details.BlockedTags = slices.Delete(details.BlockedTags, i, i+1)
+					unblocked = append(unblocked, tag)
+				} else {
+					missing = append(missing, tag)
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			warnf("%s of %s was not blocked\n", strings.Join(missing, ", "), alias)
+		}
+		if len(unblocked) > 0 {
+			infof("Unblocked %s of %s\n", strings.Join(unblocked, ", "), alias)
+		}
+		return nil
+	},
+}
+
+// updateRepoDetails changes the entry of a repository in the configuration
+// file, which must define it rather than an included file, and saves it
+func updateRepoDetails(alias string, change func(*config.RepoDetails)) error {
+	cfg, err := config.LoadFile(configFile)
+	if err != nil {
+		return err
+	}
+	details, ok := cfg.Repos[alias]
+	if !ok {
+		return fmt.Errorf("repository alias %s is not defined in %s", alias, configFile)
+	}
+	change(&details)
+	cfg.Repos[alias] = details
+	return config.Save(cfg, configFile)
+}
+
+func init() {
+	repoAddCmd.Flags().StringVar(&urlFlag, "url", "", "Gitea URL or an existing repository alias")
+	repoAddCmd.Flags().StringVar(&hostFlag, "host", "", "Well-known host to use instead of --url ("+strings.Join(config.HostNames(), ", ")+")")
+	repoAddCmd.Flags().StringVar(&ownerFlag, "owner", "", "Repository owner")
+	repoAddCmd.Flags().StringVar(&nameFlag, "name", "", "Repository name")
+	repoAddCmd.Flags().StringVar(&aliasFlag, "alias", "", "Repository alias (defaults to repository name if not provided)")
+	repoAddCmd.Flags().StringVar(&repoChmodFlag, "chmod", "", "Default file mode for deployed files (e.g. 0755)")
+	repoAddCmd.Flags().StringVar(&repoChownFlag, "chown", "", "Default owner for deployed files (user:group)")
+	repoAddCmd.Flags().StringVar(&repoTokenFlag, "token", "", "API token used for this repository only")
+	repoAddCmd.Flags().StringSliceVar(&repoGroupsFlag, "group", nil, "Group to put the repository in, for --group of batch commands (repeatable)")
+
+	repoImportCmd.Flags().StringVar(&urlFlag, "url", "", "Gitea URL or an existing repository alias")
+	repoImportCmd.Flags().StringVar(&hostFlag, "host", "", "Well-known host to use instead of --url ("+strings.Join(config.HostNames(), ", ")+")")
+	repoImportCmd.Flags().StringVar(&importUserFlag, "user", "", "User or organization whose repositories are imported")
+	repoImportCmd.Flags().BoolVar(&importStarred, "starred", false, "Import the repositories starred by the user instead")
+	repoImportCmd.Flags().BoolVar(&importAll, "all", false, "Also import repositories without releases")
+	repoImportCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Show which repositories would be imported without saving")
+	repoImportCmd.MarkFlagRequired("user")
+
+	repoListCmd.Flags().StringVar(&groupFlag, "group", "", "List the repositories in this group")
+	repoListCmd.Flags().StringVarP(&repoListOutput, "output", "o", "text", "Output format: text, or wide for the channel, blocked releases and deploy settings")
+	repoVerifyCmd.Flags().StringVar(&groupFlag, "group", "", "Verify the repositories in this group")
+	repoVerifyCmd.Flags().BoolVar(&verifyAll, "all", false, "Verify every configured repository")
+
+	repoCmd.AddCommand(repoAddCmd)
+	repoCmd.AddCommand(repoImportCmd)
+	repoCmd.AddCommand(repoListCmd)
+	repoCmd.AddCommand(repoVerifyCmd)
+	repoCmd.AddCommand(repoPinCmd)
+	repoCmd.AddCommand(repoUnpinCmd)
+	repoCmd.AddCommand(repoBlockCmd)
+	repoCmd.AddCommand(repoUnblockCmd)
+	rootCmd.AddCommand(repoCmd)
+}
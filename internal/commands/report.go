@@ -0,0 +1,258 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	reportSince  string
+	reportOutput string
+	reportOut    string
+	reportLines  int
+)
+
+// reportRepo is a repository in a release report with its releases of the
+// period, newest first
+type reportRepo struct {
+	Name     string
+	Releases []reportRelease
+}
+
+// reportRelease is a release in a report with the start of its notes
+type reportRelease struct {
+	Tag        string
+	Title      string
+	URL        string
+	Date       string
+	Prerelease bool
+	Excerpt    []string
+	Truncated  bool // The notes go on after the excerpt
+}
+
+// releaseReport is every new release of the reported repositories
+type releaseReport struct {
+	Since     string
+	Until     string
+	Total     int
+	Repos     []reportRepo // Repositories with new releases
+	Unchanged []string     // Repositories without any
+}
+
+var reportCmd = &cobra.Command{
+	Use:   "report [repo-alias...]",
+	Short: "Summarize the new releases of several repositories",
+	Long: `Summarize the releases published in a period across the given repositories,
+those in a --group (all for every configured repository) or every configured
+repository, with the first lines of their release notes. The report is
+Markdown or, with --output html, an HTML fragment, ready to paste into an
+update email. Drafts are left out; pre-releases are marked.
+
+--since takes an age such as 7d (the default), 2w or 36h, or a date.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if reportOutput != "markdown" && reportOutput != "html" {
+			return fmt.Errorf("unsupported output format '%s', use markdown or html", reportOutput)
+		}
+		since, err := parseSince(reportSince)
+		if err != nil {
+			return err
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		group := groupFlag
+		if strings.EqualFold(group, "all") {
+			group = ""
+		}
+		aliases, err := selectAliases(cfg, args, group)
+		if err != nil {
+			return err
+		}
+
+		report := releaseReport{Since: since.Format("2006-01-02"), Until: time.Now().Format("2006-01-02")}
+		for _, alias := range aliases {
+			details, ok := cfg.Repos[alias]
+			if !ok {
+				return fmt.Errorf("repository alias %s not found", alias)
+			}
+			repo, err := releaseRepo(cfg, alias, details)
+			if err != nil {
+				return err
+			}
+			releases, err := repo.List(cmd.Context())
+			if err != nil {
+				return fmt.Errorf("%s: %w", alias, err)
+			}
+
+			entry := reportRepo{Name: details.Owner + "/" + details.Name}
+			for _, rel := range releases {
+				published, err := time.Parse(time.RFC3339, rel.PublishedAt)
+				if rel.Draft || err != nil || published.Before(since) {
+					continue
+				}
+				entry.Releases = append(entry.Releases, newReportRelease(rel, published, reportLines))
+			}
+			if len(entry.Releases) == 0 {
+				report.Unchanged = append(report.Unchanged, entry.Name)
+				continue
+			}
+			report.Total += len(entry.Releases)
+			report.Repos = append(report.Repos, entry)
+		}
+		cmd.SilenceUsage = true
+
+		var buf bytes.Buffer
+		if reportOutput == "html" {
+			if err := reportTemplate.Execute(&buf, report); err != nil {
+				return fmt.Errorf("error rendering report: %v", err)
+			}
+		} else {
+			writeMarkdownReport(&buf, report)
+		}
+
+		if reportOut == "" {
+			_, err := os.Stdout.Write(buf.Bytes())
+			return err
+		}
+		if err := os.WriteFile(reportOut, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("error writing report: %v", err)
+		}
+		infof("Report written to %s\n", reportOut)
+		return nil
+	},
+}
+
+// parseSince accepts an age such as 30d, counted back from now, or a date
+func parseSince(value string) (time.Time, error) {
+	if age, err := parseAge(value); err == nil {
+		return time.Now().Add(-age), nil
+	}
+	t, _, err := parseDate(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since '%s', use an age such as 30d or a date (YYYY-MM-DD)", value)
+	}
+	return t, nil
+}
+
+func newReportRelease(rel release.Release, published time.Time, lines int) reportRelease {
+	r := reportRelease{
+		Tag:        rel.TagName,
+		Title:      rel.Name,
+		URL:        rel.HTMLURL,
+		Date:       published.Local().Format("2006-01-02"),
+		Prerelease: rel.Prerelease,
+	}
+	if r.Title == r.Tag {
+		r.Title = ""
+	}
+	r.Excerpt, r.Truncated = notesExcerpt(rel.Body, lines)
+	return r
+}
+
+// notesExcerpt returns the first lines of release notes, leaving out blank
+// lines and headings, and whether there are more
+func notesExcerpt(notes string, lines int) ([]string, bool) {
+	if lines <= 0 {
+		return nil, false
+	}
+	var excerpt []string
+	for _, line := range strings.Split(notes, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(strings.TrimLeft(trimmed, "#"), " ") {
+			continue
+		}
+		if len(excerpt) == lines {
+			return excerpt, true
+		}
+		excerpt = append(excerpt, line)
+	}
+	return excerpt, false
+}
+
+// writeMarkdownReport renders a report as Markdown
+func writeMarkdownReport(buf *bytes.Buffer, report releaseReport) {
+	fmt.Fprintf(buf, "# Releases from %s to %s\n\n", report.Since, report.Until)
+	fmt.Fprintf(buf, "%s in %s.\n", plural(report.Total, "new release"), plural(len(report.Repos), "repository"))
+
+	for _, repo := range report.Repos {
+		fmt.Fprintf(buf, "\n## %s\n", repo.Name)
+		for _, rel := range repo.Releases {
+			heading := rel.Tag
+			if rel.URL != "" {
+				heading = fmt.Sprintf("[%s](%s)", rel.Tag, rel.URL)
+			}
+			if rel.Title != "" {
+				heading += " " + rel.Title
+			}
+			heading += " (" + rel.Date
+			if rel.Prerelease {
+				heading += ", pre-release"
+			}
+			fmt.Fprintf(buf, "\n### %s)\n", heading)
+
+			if len(rel.Excerpt) > 0 {
+				buf.WriteString("\n")
+				for _, line := range rel.Excerpt {
+					fmt.Fprintf(buf, "> %s\n", line)
+				}
+				if rel.Truncated {
+					buf.WriteString("> …\n")
+				}
+			}
+		}
+	}
+
+	if len(report.Unchanged) > 0 {
+		fmt.Fprintf(buf, "\nNo new releases: %s.\n", strings.Join(report.Unchanged, ", "))
+	}
+}
+
+// plural counts things, as in 1 repository or 3 repositories
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	if strings.HasSuffix(noun, "y") {
+		return fmt.Sprintf("%d %sies", n, strings.TrimSuffix(noun, "y"))
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// reportTemplate renders a report as an HTML fragment for email
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"plural": plural}).Parse(`<h1>Releases from {{.Since}} to {{.Until}}</h1>
+<p>{{plural .Total "new release"}} in {{plural (len .Repos) "repository"}}.</p>
+{{- range .Repos}}
+<h2>{{.Name}}</h2>
+{{- range .Releases}}
+<h3>{{if .URL}}<a href="{{.URL}}">{{.Tag}}</a>{{else}}{{.Tag}}{{end}}{{with .Title}} {{.}}{{end}} ({{.Date}}{{if .Prerelease}}, pre-release{{end}})</h3>
+{{- if .Excerpt}}
+<blockquote>{{range $i, $line := .Excerpt}}{{if $i}}<br>
+{{end}}{{$line}}{{end}}{{if .Truncated}}<br>
+…{{end}}</blockquote>
+{{- end}}
+{{- end}}
+{{- end}}
+{{- with .Unchanged}}
+<p>No new releases: {{range $i, $name := .}}{{if $i}}, {{end}}{{$name}}{{end}}.</p>
+{{- end}}
+`))
+
+func init() {
+	reportCmd.Flags().StringVar(&groupFlag, "group", "", "Only the repositories in this group, all for every repository")
+	reportCmd.Flags().StringVar(&reportSince, "since", "7d", "Start of the period: an age such as 30d or 2w, or a date (YYYY-MM-DD)")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "markdown", "Output format: markdown or html")
+	reportCmd.Flags().StringVar(&reportOut, "out", "", "Write the report to this file instead of stdout")
+	reportCmd.Flags().IntVar(&reportLines, "notes-lines", 3, "Lines of release notes quoted per release (0 for none)")
+
+	rootCmd.AddCommand(reportCmd)
+}
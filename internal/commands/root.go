@@ -0,0 +1,372 @@
+// Package commands implements the gitea-release command line interface
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/runlock"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/earentir/gitearelease"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// Global variables for flags
+var (
+	configFile string
+	timeout    int
+	stallAfter int
+	quiet      bool
+	profile    string
+	progress   string
+	assumeYes  bool
+	noClobber  bool
+	dateFormat string
+	redirects  client.RedirectPolicy
+	runLock    runlock.Options
+	groupFlag  string // --group of the commands working on several repositories
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "gitea-release",
+	Short: "Interact with Gitea releases",
+	// Execute prints errors, in color on a terminal
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// Only report errors, without the usage text
+		if quiet {
+			cmd.SilenceUsage = true
+		}
+
+		if assumeYes && noClobber {
+			return fmt.Errorf("--yes and --no-clobber cannot be used together")
+		}
+
+		switch progress {
+		case "auto", "bar", "json", "none":
+		default:
+			return fmt.Errorf("unsupported progress mode '%s', use auto, bar, json or none", progress)
+		}
+
+		// Set the HTTP timeout if specified
+		if timeout > 0 {
+			gitearelease.SetHTTPTimeout(time.Duration(timeout) * time.Second)
+			client.HTTPClient.Timeout = time.Duration(timeout) * time.Second
+		}
+
+		if redirects.MaxRedirects < 0 {
+			return fmt.Errorf("--max-redirects cannot be negative")
+		}
+		client.DownloadClient.CheckRedirect = redirects.CheckRedirect
+
+		if runLock.Timeout < 0 {
+			return fmt.Errorf("--lock-timeout cannot be negative")
+		}
+		if runLock.Timeout > 0 {
+			runLock.Wait = true
+		}
+		return nil
+	},
+}
+
+func init() {
+	// Set a reasonable default timeout
+	gitearelease.SetHTTPTimeout(15 * time.Second)
+
+	config.PassphraseFunc = runtimePassphrase
+	config.HTTPClient = client.HTTPClient
+	config.CacheHitFunc = client.CacheHit
+
+	// Global flags
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "gitea-release.json", "Path to the configuration file")
+	rootCmd.PersistentFlags().IntVar(&timeout, "timeout", 15, "HTTP timeout in seconds for API requests")
+	rootCmd.PersistentFlags().IntVar(&stallAfter, "stall-timeout", 60, "Abort downloads that receive no data for this many seconds (0 waits forever)")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print errors and requested data, no progress bars or status messages")
+	rootCmd.PersistentFlags().StringVar(&progress, "progress", "auto", "Download progress: auto (bar on a terminal), bar, json (events on stderr) or none")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", os.Getenv("GITEA_RELEASE_PROFILE"), "Configuration profile to use (or set GITEA_RELEASE_PROFILE)")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "File holding the passphrase for encrypted tokens (or set "+keyFileEnv+")")
+	rootCmd.PersistentFlags().StringVar(&dateFormat, "date-format", "", "How dates are printed: rfc3339 (as sent by Gitea), relative, epoch or a Go time layout such as 2006-01-02")
+	rootCmd.PersistentFlags().BoolVarP(&assumeYes, "yes", "y", false, "Overwrite existing files without asking")
+	rootCmd.PersistentFlags().BoolVar(&assumeYes, "force", false, "Same as --yes")
+	rootCmd.PersistentFlags().BoolVar(&noClobber, "no-clobber", false, "Never overwrite existing files")
+	rootCmd.PersistentFlags().IntVar(&redirects.MaxRedirects, "max-redirects", 10, "Redirects to follow when downloading assets (0 follows none)")
+	rootCmd.PersistentFlags().BoolVar(&redirects.SameHost, "no-cross-host-redirects", false, "Refuse download redirects to other hosts, such as object storage")
+	rootCmd.PersistentFlags().StringSliceVar(&redirects.AllowedHosts, "allow-redirect-hosts", nil, "Hosts downloads may still be redirected to with --no-cross-host-redirects (globs such as *.example.com allowed)")
+	rootCmd.PersistentFlags().BoolVar(&runLock.Wait, "wait", false, "Wait for another run deploying to the same directory to finish instead of failing")
+	rootCmd.PersistentFlags().DurationVar(&runLock.Timeout, "lock-timeout", 0, "Give up waiting for another run after this long, e.g. 5m (implies --wait)")
+	rootCmd.PersistentFlags().BoolVarP(&client.Verbose, "verbose", "v", false, "Print HTTP requests with their timing, cache hits and retries to stderr, and a summary at the end")
+	rootCmd.PersistentFlags().BoolVar(&client.Debug, "debug", false, "Print what --verbose does and rate limit information to stderr")
+}
+
+// Execute runs the root command and exits with a non-zero status on error.
+// SIGINT and SIGTERM cancel the command context so in-progress downloads
+// can clean up after themselves.
+func Execute() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	err := rootCmd.ExecuteContext(ctx)
+	printRequestStats(time.Since(start))
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Interrupted")
+			os.Exit(130)
+		}
+		printError(err)
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		os.Exit(1)
+	}
+}
+
+// printRequestStats sums up the HTTP requests of the run with --verbose,
+// to tell slow servers from slow downloads and rate limiting
+func printRequestStats(elapsed time.Duration) {
+	stats := client.RequestStats()
+	if stats.Requests == 0 && stats.CacheHits == 0 {
+		return
+	}
+	client.Verbosef("took %s; requests: %d, %s waiting for responses; connections opened: %d; retries: %d; cache hits: %d",
+		elapsed.Round(time.Millisecond), stats.Requests, stats.Time.Round(time.Millisecond), stats.NewConns, stats.Retries, stats.CacheHits)
+}
+
+// exitError makes Execute exit with a status other than 1
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
+// stallTimeout returns the --stall-timeout for downloads
+func stallTimeout() time.Duration {
+	return time.Duration(stallAfter) * time.Second
+}
+
+// infof prints an informational message unless --quiet is set
+func infof(format string, args ...interface{}) {
+	if !quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// orDash returns s, or "-" for an empty table cell
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// showProgress reports whether progress bars should be drawn: with
+// --progress bar, or by default on an interactive terminal without --quiet
+func showProgress() bool {
+	switch {
+	case progress == "bar":
+		return true
+	case progress != "auto" || quiet:
+		return false
+	}
+	return isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stderr.Fd())
+}
+
+// progressJSON returns where --progress json events go, or nil without it
+func progressJSON() io.Writer {
+	if progress == "json" {
+		return os.Stderr
+	}
+	return nil
+}
+
+// confirmOverwrite decides whether an existing file may be replaced: never
+// with --no-clobber, always with --yes, otherwise the user is asked. Without
+// a terminal to ask on the file is kept.
+func confirmOverwrite(path string) error {
+	switch {
+	case noClobber:
+		return fmt.Errorf("%s already exists, not overwriting it (--no-clobber)", path)
+	case assumeYes:
+		return nil
+	case !term.IsTerminal(int(os.Stdin.Fd())):
+		return fmt.Errorf("%s already exists, use --yes to overwrite it", path)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s already exists. Overwrite it? [y/N] ", path)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("error reading answer: %v", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("%s already exists, not overwriting it", path)
+	}
+}
+
+// loadConfig loads the config with the selected profile applied. Commands
+// that save the config load it with config.LoadFile instead.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if profile != "" {
+		if err := cfg.UseProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+
+	// --date-format takes precedence over the configured default
+	if dateFormat == "" {
+		dateFormat = cfg.DateFormat
+	}
+	return cfg, nil
+}
+
+// loadRepo loads the config and looks up the repository with the given alias
+func loadRepo(alias string) (*config.Config, config.RepoDetails, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, config.RepoDetails{}, err
+	}
+
+	repoDetails, ok := cfg.Repos[alias]
+	if !ok {
+		return nil, config.RepoDetails{}, fmt.Errorf("repository alias %s not found", alias)
+	}
+
+	return cfg, repoDetails, nil
+}
+
+// selectAliases returns the aliases given as arguments, or every configured
+// alias in sorted order, or with group those of the repositories in it
+func selectAliases(cfg *config.Config, args []string, group string) ([]string, error) {
+	if group != "" && len(args) > 0 {
+		return nil, fmt.Errorf("--group cannot be used with repository aliases")
+	}
+	if len(args) > 0 {
+		return args, nil
+	}
+
+	var aliases []string
+	for alias, details := range cfg.Repos {
+		if group == "" || details.InGroup(group) {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	switch {
+	case len(aliases) > 0:
+		return aliases, nil
+	case group != "":
+		return nil, fmt.Errorf("no repositories in group %s", group)
+	}
+	return nil, fmt.Errorf("no repositories configured")
+}
+
+// releaseRepo builds the release.Repo for a repository alias
+func releaseRepo(cfg *config.Config, alias string, repoDetails config.RepoDetails) (release.Repo, error) {
+	repo := release.Repo{
+		BaseURL:  cfg.GiteaURL,
+		Owner:    repoDetails.Owner,
+		Name:     repoDetails.Name,
+		Channel:  repoDetails.Channel,
+		Channels: cfg.ChannelsFor(alias),
+		Pinned:   repoDetails.PinnedTag,
+		Blocked:  repoDetails.BlockedTags,
+	}
+	if repo.Channel != "" && !repo.IsChannel(repo.Channel) {
+		return release.Repo{}, fmt.Errorf("unknown channel %q for %s, use %s, %s or a channel from channels", repo.Channel, alias, release.Stable, release.Latest)
+	}
+
+	token, err := cfg.TokenFor(alias)
+	if err != nil {
+		return release.Repo{}, fmt.Errorf("error reading token for %s: %w", alias, err)
+	}
+	repo.Token = token
+	return repo, nil
+}
+
+// newerThanPinned returns the newest release of the channel of a pinned
+// repository when it was published after the pinned release
+func newerThanPinned(ctx context.Context, repo release.Repo, pinned release.Release) (release.Release, bool) {
+	newest, err := repo.Find(ctx, repo.DefaultChannel())
+	if err != nil || !publishedAfter(newest, pinned) {
+		return release.Release{}, false
+	}
+	return newest, true
+}
+
+// publishedAfter reports whether a is a different release published after
+// b, or b has no publish time
+func publishedAfter(a, b release.Release) bool {
+	if a.TagName == b.TagName {
+		return false
+	}
+	aTime, err := time.Parse(time.RFC3339, a.PublishedAt)
+	if err != nil {
+		return false
+	}
+	bTime, err := time.Parse(time.RFC3339, b.PublishedAt)
+	return err != nil || aTime.After(bTime)
+}
+
+// releaseArgs splits the [repo-alias] [tag] arguments of the commands that
+// read one release, followed by up to extra more arguments which are
+// returned as rest. alias@channel picks the newest release of a channel
+// instead of a tag; with neither the identifier is empty, which Find takes
+// as the repository's channel.
+func releaseArgs(args []string, extra int) (alias, identifier string, rest []string, err error) {
+	alias, channel, hasChannel := strings.Cut(args[0], "@")
+	if !hasChannel {
+		if len(args) > 1 {
+			identifier, rest = args[1], args[2:]
+		}
+		return alias, identifier, rest, nil
+	}
+
+	if channel == "" {
+		return "", "", nil, fmt.Errorf("missing channel name after %s@", alias)
+	}
+	if rest = args[1:]; len(rest) > extra {
+		return "", "", nil, fmt.Errorf("give either %s or a release tag, not both", args[0])
+	}
+	return alias, channel, rest, nil
+}
+
+func showAvailableRepos() error {
+	cfg, err := loadConfig()
+	if err == nil && len(cfg.Repos) > 0 {
+		fmt.Println("Available repository aliases:")
+		for alias := range cfg.Repos {
+			fmt.Printf("  %s\n", alias)
+		}
+		return fmt.Errorf("please specify one of the repository aliases listed above")
+	}
+	return fmt.Errorf("repository alias is required")
+}
@@ -0,0 +1,195 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/earentir/gitea-release/internal/sbom"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+// SBOMs of large images can be big, but not unbounded
+const maxSBOMSize = 64 << 20
+
+var (
+	sbomAsset  string
+	sbomOutput string
+	sbomSave   string
+	sbomChecks []string
+)
+
+var sbomCmd = &cobra.Command{
+	Use:   "sbom [repo-alias[@channel]] [release-tag-or-channel]",
+	Short: "Show the software bill of materials attached to a release",
+	Long: `Show the components of an SPDX or CycloneDX (JSON) SBOM attached to a release.
+SBOM assets are recognised by names such as *.spdx.json, *.cdx.json or *sbom*.json;
+use --asset when a release has more than one. --save writes the original document
+to a file and --check name=version fails unless the SBOM lists that component at
+that version.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias, releaseIdentifier, _, err := releaseArgs(args, 0)
+		if err != nil {
+			return err
+		}
+
+		expected := make(map[string]string)
+		for _, check := range sbomChecks {
+			name, version, ok := strings.Cut(check, "=")
+			if !ok || name == "" || version == "" {
+				return fmt.Errorf("invalid --check '%s', use name=version", check)
+			}
+			expected[name] = version
+		}
+
+		cfg, repoDetails, err := loadRepo(alias)
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, alias, repoDetails)
+		if err != nil {
+			return err
+		}
+		targetRelease, err := repo.Find(cmd.Context(), releaseIdentifier)
+		if err != nil {
+			return err
+		}
+
+		asset, err := findSBOMAsset(targetRelease, sbomAsset)
+		if err != nil {
+			return err
+		}
+
+		data, err := fetchAssetData(cmd.Context(), repo, asset, maxSBOMSize)
+		if err != nil {
+			return err
+		}
+
+		doc, err := sbom.Parse(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", asset.Name, err)
+		}
+
+		if sbomSave != "" {
+			if err := os.WriteFile(sbomSave, data, 0644); err != nil {
+				return fmt.Errorf("error saving SBOM: %v", err)
+			}
+			// Keep JSON output parseable
+			if sbomOutput != "json" {
+				infof("%s saved to %s\n", asset.Name, sbomSave)
+			}
+		}
+
+		switch sbomOutput {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(doc); err != nil {
+				return err
+			}
+		case "text":
+			fmt.Printf("%s (%s) from %s\n", asset.Name, doc.Format, targetRelease.TagName)
+			if doc.Name != "" {
+				fmt.Printf("Describes: %s %s\n", doc.Name, doc.Version)
+			}
+			fmt.Printf("Components: %d\n\n", len(doc.Components))
+
+			components := append([]sbom.Component{}, doc.Components...)
+			sort.Slice(components, func(i, j int) bool { return components[i].Name < components[j].Name })
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tLICENSE")
+			for _, c := range components {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, c.Version, c.License)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		case "none":
+		default:
+			return fmt.Errorf("unsupported output format '%s', use text, json or none", sbomOutput)
+		}
+
+		if err := checkComponents(doc, expected); err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+		return nil
+	},
+}
+
+// findSBOMAsset returns the named asset, or the only SBOM asset of the release
+func findSBOMAsset(rel release.Release, name string) (release.Asset, error) {
+	if name != "" {
+		for _, asset := range rel.Assets {
+			if asset.Name == name {
+				return asset, nil
+			}
+		}
+		return release.Asset{}, fmt.Errorf("asset %s not found in release %s", name, rel.Name)
+	}
+
+	var candidates []release.Asset
+	for _, asset := range rel.Assets {
+		if sbom.IsSBOMName(asset.Name) {
+			candidates = append(candidates, asset)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return release.Asset{}, fmt.Errorf("no SBOM found in release %s", rel.Name)
+	case 1:
+		return candidates[0], nil
+	default:
+		names := make([]string, len(candidates))
+		for i, asset := range candidates {
+			names[i] = asset.Name
+		}
+		return release.Asset{}, fmt.Errorf("release %s has several SBOMs, choose one with --asset: %s", rel.Name, strings.Join(names, ", "))
+	}
+}
+
+// checkComponents compares component versions with the expected ones
+func checkComponents(doc *sbom.Document, expected map[string]string) error {
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var mismatches []string
+	for _, name := range names {
+		component, ok := doc.Find(name)
+		switch {
+		case !ok:
+			mismatches = append(mismatches, fmt.Sprintf("%s: not in SBOM", name))
+		case component.Version != expected[name]:
+			mismatches = append(mismatches, fmt.Sprintf("%s: expected %s, found %s", name, expected[name], component.Version))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return fmt.Errorf("component check failed:\n  %s", strings.Join(mismatches, "\n  "))
+	}
+	if len(expected) > 0 {
+		infof("All %d component check(s) passed\n", len(expected))
+	}
+	return nil
+}
+
+func init() {
+	sbomCmd.Flags().StringVar(&sbomAsset, "asset", "", "Name of the SBOM asset (default: the only SBOM in the release)")
+	sbomCmd.Flags().StringVarP(&sbomOutput, "output", "o", "text", "Output format: text, json or none")
+	sbomCmd.Flags().StringVar(&sbomSave, "save", "", "Write the original SBOM document to this file")
+	sbomCmd.Flags().StringArrayVar(&sbomChecks, "check", nil, "Require a component at a version (name=version, repeatable)")
+
+	rootCmd.AddCommand(sbomCmd)
+}
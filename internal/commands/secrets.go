@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/earentir/gitea-release/internal/config"
+
+	"golang.org/x/term"
+)
+
+// Environment variables the token passphrase can be read from
+const (
+	passphraseEnv = "GITEA_RELEASE_PASSPHRASE"
+	keyFileEnv    = "GITEA_RELEASE_KEY_FILE"
+)
+
+var keyFile string
+
+// runtimePassphrase asks for the passphrase at most once per run
+var runtimePassphrase = sync.OnceValues(func() (string, error) {
+	return readPassphrase(false)
+})
+
+// readPassphrase reads the token passphrase from the key file, the
+// environment or, on a terminal, a prompt. With confirm the prompt asks twice.
+func readPassphrase(confirm bool) (string, error) {
+	path := keyFile
+	if path == "" {
+		path = os.Getenv(keyFileEnv)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading key file: %v", err)
+		}
+		passphrase := strings.TrimRight(string(data), "\r\n")
+		if passphrase == "" {
+			return "", fmt.Errorf("key file %s is empty", path)
+		}
+		return passphrase, nil
+	}
+
+	if passphrase := os.Getenv(passphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("%w: set %s or %s, or use --key-file", config.ErrNoPassphrase, passphraseEnv, keyFileEnv)
+	}
+
+	passphrase, err := promptPassphrase("Passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase cannot be empty")
+	}
+
+	if confirm {
+		again, err := promptPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+func promptPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("error reading passphrase: %v", err)
+	}
+	return string(data), nil
+}
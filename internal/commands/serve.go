@@ -0,0 +1,271 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/sdnotify"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	serveListen   string
+	serveCacheDir string
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve release assets over HTTP as a read-through cache",
+	Long: `Serve the assets of the configured repositories at /repo/<alias>/<tag>/<asset>.
+An asset is downloaded from Gitea the first time it is requested and served
+from the cache directory afterwards, so a build farm fetches every asset from
+Gitea only once. Requests for a channel, such as stable or latest, instead
+of a tag are redirected to its newest release. /feed and /feed/<alias> serve the release history as an Atom feed.
+Runs until interrupted.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(serveCacheDir, 0755); err != nil {
+			return fmt.Errorf("error creating cache directory: %v", err)
+		}
+
+		listener, err := net.Listen("tcp", serveListen)
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		mux := http.NewServeMux()
+		mux.Handle("/repo/", &assetCache{ctx: ctx, cfg: cfg, dir: serveCacheDir})
+		mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) { serveFeed(w, r, cfg, nil) })
+		mux.HandleFunc("/feed/{alias}", func(w http.ResponseWriter, r *http.Request) {
+			alias := r.PathValue("alias")
+			if _, ok := cfg.Repos[alias]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			serveFeed(w, r, cfg, []string{alias})
+		})
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+
+		if !quiet {
+			log.Printf("Serving release assets on %s from %s", listener.Addr(), serveCacheDir)
+		}
+		sdnotify.Ready()
+
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		sdnotify.Stopping()
+		return nil
+	},
+}
+
+// assetCache serves release assets from dir, downloading missing ones
+type assetCache struct {
+	ctx   context.Context // Downloads outlive the request that started them
+	cfg   *config.Config
+	dir   string
+	group singleflight.Group // One download per asset however many clients ask for it
+}
+
+func (c *assetCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Tags may contain slashes, the alias and asset name cannot
+	alias, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/repo/"), "/")
+	slash := strings.LastIndex(rest, "/")
+	if slash < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	tag, assetName := rest[:slash], rest[slash+1:]
+	if !validCacheName(alias) || !validCacheName(assetName) || tag == "" {
+		http.NotFound(w, r)
+		return
+	}
+	// Escaped rather than with the slashes replaced, so release/1.0 and
+	// release_1.0 do not share a directory
+	tagDir := url.PathEscape(tag)
+	if !validCacheName(tagDir) {
+		http.NotFound(w, r)
+		return
+	}
+
+	details, ok := c.cfg.Repos[alias]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	repo, err := releaseRepo(c.cfg, alias, details)
+	if err != nil {
+		log.Printf("serve: %s: %v", alias, err)
+		http.Error(w, "repository unavailable", http.StatusBadGateway)
+		return
+	}
+
+	// The newest release of a channel changes, so channels are never cached
+	if repo.IsChannel(tag) {
+		rel, err := repo.Find(r.Context(), tag)
+		if err != nil {
+			log.Printf("serve: %s: %v", alias, err)
+			http.Error(w, "cannot find the newest release of "+tag, http.StatusBadGateway)
+			return
+		}
+		target := "/repo/" + url.PathEscape(alias) + "/" + escapeTag(rel.TagName) + "/" + url.PathEscape(assetName)
+		http.Redirect(w, r, target, http.StatusFound)
+		return
+	}
+
+	cachePath := filepath.Join(c.dir, alias, tagDir, assetName)
+	if _, err := os.Stat(cachePath); err == nil {
+		client.CacheHit("%s", cachePath)
+	} else {
+		_, err, _ := c.group.Do(cachePath, func() (interface{}, error) {
+			return nil, c.download(repo, alias, tag, assetName, filepath.Dir(cachePath))
+		})
+		var notFound *assetNotFoundError
+		if errors.As(err, &notFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("serve: %s: %v", alias, err)
+			http.Error(w, "error fetching the asset from Gitea", http.StatusBadGateway)
+			return
+		}
+	}
+
+	// ServeContent handles ranges and conditional requests, unlike
+	// ServeFile it leaves assets named index.html alone
+	file, err := os.Open(cachePath)
+	if err != nil {
+		log.Printf("serve: %s: %v", alias, err)
+		http.Error(w, "error reading the cached asset", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("serve: %s: %v", alias, err)
+		http.Error(w, "error reading the cached asset", http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, assetName, info.ModTime(), file)
+}
+
+// serveFeed answers with the Atom feed of the aliases, all when nil
+func serveFeed(w http.ResponseWriter, r *http.Request, cfg *config.Config, aliases []string) {
+	var buf bytes.Buffer
+	if err := writeFeed(r.Context(), &buf, cfg, aliases, feedLimit); err != nil {
+		log.Printf("serve: feed: %v", err)
+		http.Error(w, "error building the feed", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// assetNotFoundError reports a release or asset Gitea does not have
+type assetNotFoundError struct {
+	msg string
+}
+
+func (e *assetNotFoundError) Error() string {
+	return e.msg
+}
+
+// download fetches an asset into the cache directory of its release
+func (c *assetCache) download(repo release.Repo, alias, tag, assetName, dir string) error {
+	// Releases are looked up by tag only, titles could alias another cache entry
+	releases, err := repo.List(c.ctx)
+	if err != nil {
+		return err
+	}
+	var rel *release.Release
+	for i := range releases {
+		if releases[i].TagName == tag {
+			rel = &releases[i]
+			break
+		}
+	}
+	if rel == nil {
+		return &assetNotFoundError{fmt.Sprintf("release %s not found", tag)}
+	}
+
+	var found bool
+	for _, asset := range rel.Assets {
+		if asset.Name == assetName {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return &assetNotFoundError{fmt.Sprintf("asset %s not found in release %s", assetName, tag)}
+	}
+
+	finalPath, err := repo.Fetch(c.ctx, *rel, release.FetchOptions{
+		Asset:        assetName,
+		DeployPath:   dir,
+		HideProgress: true,
+		StallTimeout: stallTimeout(),
+	})
+	if err != nil {
+		return err
+	}
+	if !quiet {
+		log.Printf("serve: %s: cached %s", alias, finalPath)
+	}
+	return nil
+}
+
+// validCacheName reports whether name can be used as a single path element
+func validCacheName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// escapeTag escapes a tag for a URL path, keeping the slashes it may contain
+func escapeTag(tag string) string {
+	parts := strings.Split(tag, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveListen, "listen", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVar(&serveCacheDir, "cache-dir", "cache", "Directory downloaded assets are cached in")
+	serveCmd.Flags().IntVar(&feedLimit, "feed-limit", 50, "Maximum number of releases in the /feed endpoints (0 for all)")
+
+	rootCmd.AddCommand(serveCmd)
+}
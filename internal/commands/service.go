@@ -0,0 +1,130 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	serviceName     string
+	serviceUser     bool
+	serviceTask     bool
+	serviceInterval time.Duration
+	servicePrint    bool
+)
+
+// serviceSpec describes the watch process a service runs
+type serviceSpec struct {
+	Name       string
+	Executable string
+	Args       []string
+	User       bool // Install for the current user instead of system wide
+	Task       bool // Install as a Windows scheduled task instead of a service
+}
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run watch as a background service",
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install [repo-alias...]",
+	Short: "Install and start a service that runs watch with the current config",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkWatchInterval(serviceInterval); err != nil {
+			return err
+		}
+		spec, err := newServiceSpec(args)
+		if err != nil {
+			return err
+		}
+		return installService(cmd, spec)
+	},
+}
+
+var serviceStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the installed service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return serviceStatus(cmd, serviceSpec{Name: serviceName, User: serviceUser, Task: serviceTask})
+	},
+}
+
+var serviceRemoveCmd = &cobra.Command{
+	Use:   "remove",
+	Short: "Stop and remove the installed service",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return removeService(cmd, serviceSpec{Name: serviceName, User: serviceUser, Task: serviceTask})
+	},
+}
+
+// newServiceSpec builds the watch command line from the global flags, with
+// absolute paths as services do not run in the current directory
+func newServiceSpec(aliases []string) (serviceSpec, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return serviceSpec{}, fmt.Errorf("error finding the gitea-release executable: %v", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return serviceSpec{}, fmt.Errorf("error finding the gitea-release executable: %v", err)
+	}
+
+	// A remote configuration is passed on as its URL
+	configPath := configFile
+	if !config.IsRemote(configFile) {
+		if configPath, err = filepath.Abs(configFile); err != nil {
+			return serviceSpec{}, fmt.Errorf("error resolving config path: %v", err)
+		}
+		if _, err := os.Stat(configPath); err != nil {
+			return serviceSpec{}, fmt.Errorf("error reading config file: %v", err)
+		}
+	}
+
+	args := []string{"--config", configPath}
+	if profile != "" {
+		args = append(args, "--profile", profile)
+	}
+	if keyFile != "" {
+		path, err := filepath.Abs(keyFile)
+		if err != nil {
+			return serviceSpec{}, fmt.Errorf("error resolving key file path: %v", err)
+		}
+		args = append(args, "--key-file", path)
+	}
+	args = append(args, "watch", "--interval", serviceInterval.String())
+	if serviceName != "gitea-release" {
+		// The Windows service looks up its Event Log source by name
+		args = append(args, "--service-name", serviceName)
+	}
+	if groupFlag != "" {
+		if len(aliases) > 0 {
+			return serviceSpec{}, fmt.Errorf("--group cannot be used with repository aliases")
+		}
+		args = append(args, "--group", groupFlag)
+	}
+	args = append(args, aliases...)
+
+	return serviceSpec{Name: serviceName, Executable: executable, Args: args, User: serviceUser, Task: serviceTask}, nil
+}
+
+func init() {
+	serviceCmd.PersistentFlags().StringVar(&serviceName, "name", "gitea-release", "Service name")
+	serviceCmd.PersistentFlags().BoolVar(&serviceUser, "user", false, "Install for the current user instead of system wide")
+	serviceCmd.PersistentFlags().BoolVar(&serviceTask, "scheduled-task", false, "Use a scheduled task instead of a service (Windows only)")
+	serviceInstallCmd.Flags().DurationVar(&serviceInterval, "interval", 5*time.Minute, "Time between polls, at least 10s")
+	serviceInstallCmd.Flags().StringVar(&groupFlag, "group", "", "Watch the repositories in this group")
+	serviceInstallCmd.Flags().BoolVar(&servicePrint, "print", false, "Print the service definition instead of installing it")
+
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceStatusCmd)
+	serviceCmd.AddCommand(serviceRemoveCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
@@ -0,0 +1,166 @@
+//go:build linux
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// errScheduledTask is returned for --scheduled-task, which only exists on Windows
+var errScheduledTask = errors.New("--scheduled-task is only supported on windows")
+
+// unitPath returns where the systemd unit of a service is installed
+func unitPath(spec serviceSpec) (string, error) {
+	if !spec.User {
+		return filepath.Join("/etc/systemd/system", spec.Name+".service"), nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "systemd", "user", spec.Name+".service"), nil
+}
+
+// unitFile renders a Type=notify unit, watch reports readiness and pings
+// the watchdog through sd_notify
+func unitFile(spec serviceSpec) string {
+	words := []string{systemdQuote(spec.Executable)}
+	for _, arg := range spec.Args {
+		words = append(words, systemdQuote(arg))
+	}
+
+	wantedBy := "multi-user.target"
+	if spec.User {
+		wantedBy = "default.target"
+	}
+
+	return fmt.Sprintf(`[Unit]
+Description=gitea-release watch
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+RestartSec=30
+WatchdogSec=120
+
+[Install]
+WantedBy=%s
+`, strings.Join(words, " "), wantedBy)
+}
+
+// systemdQuote quotes an ExecStart argument when needed, % and $ would
+// otherwise be expanded by systemd
+func systemdQuote(arg string) string {
+	arg = strings.ReplaceAll(arg, "%", "%%")
+	arg = strings.ReplaceAll(arg, "$", "$$")
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// systemctl runs systemctl for the system or user manager
+func systemctl(cmd *cobra.Command, user bool, args ...string) error {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+
+	c := exec.CommandContext(cmd.Context(), "systemctl", args...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func installService(cmd *cobra.Command, spec serviceSpec) error {
+	if spec.Task {
+		return errScheduledTask
+	}
+
+	unit := unitFile(spec)
+	if servicePrint {
+		fmt.Print(unit)
+		return nil
+	}
+
+	path, err := unitPath(spec)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating unit directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(unit), 0644); err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return fmt.Errorf("error writing %s: %v (run as root or use --user)", path, err)
+		}
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+
+	if err := systemctl(cmd, spec.User, "daemon-reload"); err != nil {
+		return err
+	}
+	if err := systemctl(cmd, spec.User, "enable", "--now", spec.Name+".service"); err != nil {
+		return err
+	}
+
+	infof("Service %s installed as %s\n", spec.Name, path)
+	return nil
+}
+
+func serviceStatus(cmd *cobra.Command, spec serviceSpec) error {
+	if spec.Task {
+		return errScheduledTask
+	}
+
+	// systemctl status exits non-zero for stopped services, the output says why
+	systemctl(cmd, spec.User, "status", "--no-pager", spec.Name+".service")
+	return nil
+}
+
+func removeService(cmd *cobra.Command, spec serviceSpec) error {
+	if spec.Task {
+		return errScheduledTask
+	}
+
+	path, err := unitPath(spec)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service %s is not installed: %v", spec.Name, err)
+	}
+
+	if err := systemctl(cmd, spec.User, "disable", "--now", spec.Name+".service"); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("error removing %s: %v", path, err)
+	}
+	if err := systemctl(cmd, spec.User, "daemon-reload"); err != nil {
+		return err
+	}
+
+	infof("Service %s removed\n", spec.Name)
+	return nil
+}
+
+// runAsService runs watch directly, systemd talks to it through sd_notify
+func runAsService(ctx context.Context, run func(ctx context.Context) error) error {
+	return run(ctx)
+}
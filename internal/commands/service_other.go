@@ -0,0 +1,27 @@
+//go:build !linux && !windows
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+func installService(cmd *cobra.Command, spec serviceSpec) error {
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func serviceStatus(cmd *cobra.Command, spec serviceSpec) error {
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func removeService(cmd *cobra.Command, spec serviceSpec) error {
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+func runAsService(ctx context.Context, run func(ctx context.Context) error) error {
+	return run(ctx)
+}
@@ -0,0 +1,368 @@
+//go:build windows
+
+package commands
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf16"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// commandLine joins the executable and arguments with Windows quoting
+func commandLine(spec serviceSpec) string {
+	words := []string{syscall.EscapeArg(spec.Executable)}
+	for _, arg := range spec.Args {
+		words = append(words, syscall.EscapeArg(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+func installService(cmd *cobra.Command, spec serviceSpec) error {
+	if spec.Task {
+		return installTask(cmd, spec)
+	}
+	if spec.User {
+		return fmt.Errorf("--user is only supported with --scheduled-task on windows")
+	}
+
+	if servicePrint {
+		fmt.Println(commandLine(spec))
+		return nil
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to the service manager: %v (run as administrator)", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(spec.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s is already installed", spec.Name)
+	}
+
+	s, err := m.CreateService(spec.Name, spec.Executable, mgr.Config{
+		DisplayName:      spec.Name,
+		Description:      "gitea-release watch",
+		StartType:        mgr.StartAutomatic,
+		DelayedAutoStart: true, // Start once the network is likely up
+	}, spec.Args...)
+	if err != nil {
+		return fmt.Errorf("error creating service %s: %v", spec.Name, err)
+	}
+	defer s.Close()
+
+	// Restart after crashes and after watch exits with an error
+	if err := s.SetRecoveryActions([]mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 30 * time.Second}}, 86400); err != nil {
+		return fmt.Errorf("error setting recovery actions: %v", err)
+	}
+	if err := s.SetRecoveryActionsOnNonCrashFailures(true); err != nil {
+		return fmt.Errorf("error setting recovery actions: %v", err)
+	}
+
+	// Without an Event Log source the service still runs, only its log is lost
+	if err := eventlog.InstallAsEventCreate(spec.Name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		infof("Warning: Event Log source %s not registered: %v\n", spec.Name, err)
+	}
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("error starting service %s: %v", spec.Name, err)
+	}
+
+	infof("Service %s installed and started\n", spec.Name)
+	return nil
+}
+
+func serviceStatus(cmd *cobra.Command, spec serviceSpec) error {
+	if spec.Task {
+		return schtasks(cmd, "/Query", "/TN", spec.Name, "/V", "/FO", "LIST")
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to the service manager: %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(spec.Name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %v", spec.Name, err)
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("error querying service %s: %v", spec.Name, err)
+	}
+	config, err := s.Config()
+	if err != nil {
+		return fmt.Errorf("error querying service %s: %v", spec.Name, err)
+	}
+
+	fmt.Printf("Service: %s\n", spec.Name)
+	fmt.Printf("  State: %s\n", serviceState(status.State))
+	if status.ProcessId != 0 {
+		fmt.Printf("  PID: %d\n", status.ProcessId)
+	}
+	fmt.Printf("  Command: %s\n", config.BinaryPathName)
+	return nil
+}
+
+// serviceState names a service state the way services.msc does
+func serviceState(state svc.State) string {
+	switch state {
+	case svc.Stopped:
+		return "Stopped"
+	case svc.StartPending:
+		return "Starting"
+	case svc.StopPending:
+		return "Stopping"
+	case svc.Running:
+		return "Running"
+	case svc.ContinuePending:
+		return "Continuing"
+	case svc.PausePending:
+		return "Pausing"
+	case svc.Paused:
+		return "Paused"
+	default:
+		return fmt.Sprintf("Unknown (%d)", state)
+	}
+}
+
+func removeService(cmd *cobra.Command, spec serviceSpec) error {
+	if spec.Task {
+		// Ending a task that is not running fails, which is fine
+		schtasks(cmd, "/End", "/TN", spec.Name)
+		if err := schtasks(cmd, "/Delete", "/TN", spec.Name, "/F"); err != nil {
+			return err
+		}
+		infof("Scheduled task %s removed\n", spec.Name)
+		return nil
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("error connecting to the service manager: %v (run as administrator)", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(spec.Name)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed: %v", spec.Name, err)
+	}
+	defer s.Close()
+
+	// Stopping a service that is not running fails, which is fine
+	s.Control(svc.Stop)
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("error removing service %s: %v", spec.Name, err)
+	}
+	eventlog.Remove(spec.Name)
+
+	infof("Service %s removed\n", spec.Name)
+	return nil
+}
+
+// taskXML renders a task definition that starts watch at boot, or at logon
+// with --user. Unlike schtasks /Create flags, XML can lift the default
+// 72 hour run time limit and restart the task when it fails.
+func taskXML(spec serviceSpec) (string, error) {
+	principal := `<UserId>S-1-5-18</UserId><RunLevel>HighestAvailable</RunLevel>` // LocalSystem
+	trigger := `<BootTrigger><Enabled>true</Enabled></BootTrigger>`
+	if spec.User {
+		current, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("error looking up the current user: %v", err)
+		}
+		principal = `<UserId>` + xmlEscape(current.Username) + `</UserId><LogonType>InteractiveToken</LogonType>`
+		trigger = `<LogonTrigger><Enabled>true</Enabled><UserId>` + xmlEscape(current.Username) + `</UserId></LogonTrigger>`
+	}
+
+	args := make([]string, 0, len(spec.Args))
+	for _, arg := range spec.Args {
+		args = append(args, syscall.EscapeArg(arg))
+	}
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-16"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>gitea-release watch</Description>
+  </RegistrationInfo>
+  <Triggers>
+    %s
+  </Triggers>
+  <Principals>
+    <Principal id="Author">%s</Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+    <StartWhenAvailable>true</StartWhenAvailable>
+    <ExecutionTimeLimit>PT0S</ExecutionTimeLimit>
+    <RestartOnFailure>
+      <Interval>PT1M</Interval>
+      <Count>999</Count>
+    </RestartOnFailure>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>%s</Command>
+      <Arguments>%s</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`, trigger, principal, xmlEscape(spec.Executable), xmlEscape(strings.Join(args, " "))), nil
+}
+
+// xmlEscape escapes text for use in an XML element
+func xmlEscape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+func installTask(cmd *cobra.Command, spec serviceSpec) error {
+	definition, err := taskXML(spec)
+	if err != nil {
+		return err
+	}
+	if servicePrint {
+		fmt.Print(definition)
+		return nil
+	}
+
+	// schtasks reads the definition as UTF-16, as declared in the XML header
+	encoded := []uint16{0xfeff}
+	encoded = append(encoded, utf16.Encode([]rune(definition))...)
+	data := make([]byte, 0, len(encoded)*2)
+	for _, unit := range encoded {
+		data = binary.LittleEndian.AppendUint16(data, unit)
+	}
+
+	file, err := os.CreateTemp("", "gitea-release-task-*.xml")
+	if err != nil {
+		return fmt.Errorf("error creating task definition: %v", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing task definition: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing task definition: %v", err)
+	}
+
+	if err := schtasks(cmd, "/Create", "/TN", spec.Name, "/XML", file.Name(), "/F"); err != nil {
+		return err
+	}
+	if err := schtasks(cmd, "/Run", "/TN", spec.Name); err != nil {
+		return err
+	}
+
+	infof("Scheduled task %s installed and started\n", spec.Name)
+	return nil
+}
+
+// schtasks runs schtasks.exe with its output passed through
+func schtasks(cmd *cobra.Command, args ...string) error {
+	c := exec.CommandContext(cmd.Context(), "schtasks.exe", args...)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("schtasks %s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// runAsService runs watch under the service control manager when started as
+// a Windows service, and directly otherwise
+func runAsService(ctx context.Context, run func(ctx context.Context) error) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return run(ctx)
+	}
+
+	// Services have no console, log to the Event Log instead
+	if elog, err := eventlog.Open(serviceName); err == nil {
+		defer elog.Close()
+		log.SetFlags(0)
+		log.SetOutput(eventLogWriter{elog})
+	}
+
+	handler := &watchService{ctx: ctx, run: run}
+	if err := svc.Run(serviceName, handler); err != nil {
+		return fmt.Errorf("error running as service: %v", err)
+	}
+	return handler.err
+}
+
+// watchService adapts the watch loop to the service control manager
+type watchService struct {
+	ctx context.Context
+	run func(ctx context.Context) error
+	err error
+}
+
+func (h *watchService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	ctx, cancel := context.WithCancel(h.ctx)
+	defer cancel()
+
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() { done <- h.run(ctx) }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case h.err = <-done:
+			status <- svc.Status{State: svc.StopPending}
+			if h.err != nil {
+				// A failure exit code lets the recovery actions restart the service
+				return true, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
+
+// eventLogWriter sends log lines to the Windows Event Log, lines mentioning
+// an error are logged as errors
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSpace(string(p))
+	write := w.elog.Info
+	if strings.Contains(strings.ToLower(message), "error") {
+		write = w.elog.Error
+	}
+	if err := write(1, message); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var statsOutput string
+
+// releaseStats holds the download counts of a single release
+type releaseStats struct {
+	Tag         string       `json:"tag"`
+	Name        string       `json:"name"`
+	PublishedAt string       `json:"published_at"`
+	Downloads   int          `json:"downloads"`
+	Assets      []assetStats `json:"assets"`
+}
+
+// assetStats holds the download count of an asset, or of an asset name
+// across releases in the totals
+type assetStats struct {
+	Name      string `json:"name"`
+	Downloads int    `json:"downloads"`
+}
+
+// repoStats summarises the downloads of all releases of a repository
+type repoStats struct {
+	Repo           string         `json:"repo"`
+	TotalDownloads int            `json:"total_downloads"`
+	Releases       []releaseStats `json:"releases"`
+	Assets         []assetStats   `json:"assets"` // Totals per asset name with the version replaced by {version}
+}
+
+// assetTemplate replaces the version in an asset name with {version} so the
+// same artifact can be compared across releases
+func assetTemplate(assetName, tag string) string {
+	for _, version := range []string{tag, strings.TrimPrefix(tag, "v")} {
+		if version != "" && strings.Contains(assetName, version) {
+			return strings.ReplaceAll(assetName, version, "{version}")
+		}
+	}
+	return assetName
+}
+
+func collectStats(repoName string, releases []release.Release) repoStats {
+	stats := repoStats{Repo: repoName, Releases: []releaseStats{}, Assets: []assetStats{}}
+	totals := make(map[string]int)
+
+	for _, rel := range releases {
+		rs := releaseStats{
+			Tag:         rel.TagName,
+			Name:        rel.Name,
+			PublishedAt: rel.PublishedAt,
+			Assets:      []assetStats{},
+		}
+		for _, asset := range rel.Assets {
+			rs.Downloads += asset.DownloadCount
+			rs.Assets = append(rs.Assets, assetStats{Name: asset.Name, Downloads: asset.DownloadCount})
+			totals[assetTemplate(asset.Name, rel.TagName)] += asset.DownloadCount
+		}
+		stats.TotalDownloads += rs.Downloads
+		stats.Releases = append(stats.Releases, rs)
+	}
+
+	for name, downloads := range totals {
+		stats.Assets = append(stats.Assets, assetStats{Name: name, Downloads: downloads})
+	}
+	sort.Slice(stats.Assets, func(i, j int) bool {
+		if stats.Assets[i].Downloads != stats.Assets[j].Downloads {
+			return stats.Assets[i].Downloads > stats.Assets[j].Downloads
+		}
+		return stats.Assets[i].Name < stats.Assets[j].Name
+	})
+
+	return stats
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats [repo-alias]",
+	Short: "Summarise release and asset download counts",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+		releases, err := repo.List(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		stats := collectStats(repoDetails.Owner+"/"+repoDetails.Name, releases)
+
+		switch statsOutput {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(stats)
+		case "text":
+			fmt.Printf("Download statistics for %s:\n\n", stats.Repo)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TAG\tPUBLISHED\tASSETS\tDOWNLOADS")
+			for _, rs := range stats.Releases {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", rs.Tag, formatDate(rs.PublishedAt), len(rs.Assets), rs.Downloads)
+			}
+			fmt.Fprintln(w)
+			fmt.Fprintln(w, "ASSET\tDOWNLOADS")
+			for _, as := range stats.Assets {
+				fmt.Fprintf(w, "%s\t%d\n", as.Name, as.Downloads)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			fmt.Printf("\nTotal downloads: %d\n", stats.TotalDownloads)
+			return nil
+		case "csv", "tsv":
+			// One row per asset of every release, with the version folded out
+			// of the asset name so platforms can be compared in a pivot table
+			var rows [][]string
+			for _, rs := range stats.Releases {
+				for _, as := range rs.Assets {
+					rows = append(rows, []string{rs.Tag, formatDate(rs.PublishedAt), as.Name, assetTemplate(as.Name, rs.Tag), strconv.Itoa(as.Downloads)})
+				}
+			}
+			return writeRecords(statsOutput, []string{"tag", "published_at", "asset", "asset_template", "downloads"}, rows)
+		default:
+			return fmt.Errorf("unsupported output format '%s', use text, json, csv or tsv", statsOutput)
+		}
+	},
+}
+
+func init() {
+	statsCmd.Flags().StringVarP(&statsOutput, "output", "o", "text", "Output format: text, json, csv or tsv")
+
+	rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/download"
+	"github.com/earentir/gitea-release/internal/lockfile"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var statusOutput string
+
+// deploymentStatus is the JSON report of status, keyed by alias so it can be
+// used as Ansible facts or read by other configuration management tools
+type deploymentStatus struct {
+	GeneratedAt time.Time             `json:"generated_at"`
+	Repos       map[string]repoStatus `json:"repos"`
+}
+
+// repoStatus is what is installed from a repository and its latest release
+type repoStatus struct {
+	Owner     string            `json:"owner"`
+	Name      string            `json:"name"`
+	LatestTag string            `json:"latest_tag,omitempty"`
+	PinnedTag string            `json:"pinned_tag,omitempty"`
+	UpToDate  bool              `json:"up_to_date"` // Something is installed and all of it is from the latest release, or the pinned one
+	Installed []installedStatus `json:"installed"`
+	Error     string            `json:"error,omitempty"` // Why the latest release is unknown
+}
+
+// installedStatus is one installed file from the lockfile
+type installedStatus struct {
+	Asset        string    `json:"asset"`
+	Tag          string    `json:"tag"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	Current      bool      `json:"current"` // Installed from the latest release, or the pinned one
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status [repo-alias...]",
+	Short: "Show installed versions next to the latest release",
+	Long: `Show the files installed from the given repositories, from those in a
+--group or from every configured repository, as recorded in the lockfile, with their tag, path and
+checksum next to the latest available release. --output json emits a report
+keyed by alias for Ansible facts or configuration management reporting.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if statusOutput != "text" && statusOutput != "wide" && statusOutput != "json" {
+			return fmt.Errorf("unsupported output format '%s', use text, wide or json", statusOutput)
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		lock, err := lockfile.Load(lockfile.PathFor(configFile))
+		if err != nil {
+			return err
+		}
+
+		aliases, err := selectAliases(cfg, args, groupFlag)
+		if err != nil {
+			return err
+		}
+		for _, alias := range aliases {
+			if _, ok := cfg.Repos[alias]; !ok {
+				return fmt.Errorf("repository alias %s not found", alias)
+			}
+		}
+		cmd.SilenceUsage = true
+
+		report := deploymentStatus{GeneratedAt: time.Now().UTC(), Repos: make(map[string]repoStatus)}
+		failed := 0
+		for _, alias := range aliases {
+			details := cfg.Repos[alias]
+			status := repoStatus{Owner: details.Owner, Name: details.Name, PinnedTag: details.PinnedTag, Installed: []installedStatus{}}
+
+			repo, err := releaseRepo(cfg, alias, details)
+			if err == nil {
+				var latest release.Release
+				if latest, err = repo.Find(cmd.Context(), repo.DefaultChannel()); err == nil {
+					status.LatestTag = latest.TagName
+				}
+			}
+			if err != nil {
+				if cmd.Context().Err() != nil {
+					return cmd.Context().Err()
+				}
+				status.Error = err.Error()
+				failed++
+			}
+
+			target := status.LatestTag
+			if status.PinnedTag != "" {
+				target = status.PinnedTag
+			}
+			for _, entry := range lock.ForAlias(alias) {
+				status.Installed = append(status.Installed, installedStatus{
+					Asset:        entry.Asset,
+					Tag:          entry.Tag,
+					Path:         entry.Path,
+					Size:         entry.Size,
+					SHA256:       entry.SHA256,
+					DownloadedAt: entry.DownloadedAt,
+					Current:      target != "" && entry.Tag == target,
+				})
+			}
+			status.UpToDate = len(status.Installed) > 0
+			for _, installed := range status.Installed {
+				status.UpToDate = status.UpToDate && installed.Current
+			}
+
+			report.Repos[alias] = status
+		}
+
+		if statusOutput == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+		} else if err := printStatus(aliases, report, statusOutput == "wide"); err != nil {
+			return err
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("the latest release of %d of %d repositories could not be found", failed, len(aliases))
+		}
+		return nil
+	},
+}
+
+// printStatus writes the report as a table, one line per installed file,
+// wide adding the size, checksum and download time of each file
+func printStatus(aliases []string, report deploymentStatus, wide bool) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := fmt.Sprintf("ALIAS\tASSET\t%s\t%s\tPATH", paint(colorPlain, "INSTALLED"), paint(colorPlain, "LATEST"))
+	if wide {
+		header += "\tSIZE\tSHA256\tDOWNLOADED"
+	}
+	fmt.Fprintln(w, header)
+	for _, alias := range aliases {
+		status := report.Repos[alias]
+		latest := paint(colorCyan, status.LatestTag)
+		if status.Error != "" {
+			latest = paint(colorRed, "error: "+status.Error)
+		} else if status.PinnedTag != "" {
+			latest = paint(colorCyan, status.LatestTag+" (pinned to "+status.PinnedTag+")")
+		}
+		if len(status.Installed) == 0 {
+			line := fmt.Sprintf("%s\t-\t%s\t%s\t-", alias, paint(colorPlain, "-"), latest)
+			if wide {
+				line += "\t-\t-\t-"
+			}
+			fmt.Fprintln(w, line)
+			continue
+		}
+		for _, installed := range status.Installed {
+			// Files behind the release they should be on stand out
+			tag := paint(colorGreen, installed.Tag)
+			if !installed.Current {
+				tag = paint(colorYellow, installed.Tag)
+			}
+			line := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", alias, installed.Asset, tag, latest, installed.Path)
+			if wide {
+				downloaded := "-"
+				if !installed.DownloadedAt.IsZero() {
+					downloaded = formatDate(installed.DownloadedAt.Format(time.RFC3339))
+				}
+				line += fmt.Sprintf("\t%s\t%s\t%s", download.FormatBytes(installed.Size), orDash(installed.SHA256), downloaded)
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+	return w.Flush()
+}
+
+func init() {
+	statusCmd.Flags().StringVar(&groupFlag, "group", "", "Show the repositories in this group")
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", "text", "Output format: text, wide (with size, checksum and download time) or json")
+
+	rootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/download"
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+// minSpeedSample is the smallest transfer whose speed is remembered, below
+// it the time is mostly spent setting up connections
+const minSpeedSample = 1 << 20
+
+// transferSummary reports a download of several assets before and after
+// it, for CI logs
+type transferSummary struct {
+	host     string
+	files    int
+	skipped  int // Already up to date, not downloaded
+	start    time.Time
+	received atomic.Int64
+}
+
+// startTransferSummary prints the number and total size of the assets and,
+// from the speed measured on the last download from the same host or the
+// rate limit, how long they should take
+func startTransferSummary(giteaURL string, assets []release.Asset, rateLimit int64) *transferSummary {
+	s := &transferSummary{files: len(assets)}
+	if u, err := url.Parse(giteaURL); err == nil {
+		s.host = u.Host
+	}
+
+	var total int64
+	for _, asset := range assets {
+		total += asset.Size
+	}
+	line := fmt.Sprintf("Downloading %d assets, %s in total", len(assets), download.FormatBytes(total))
+
+	speed, measured := loadSpeeds()[s.host], true
+	if rateLimit > 0 && (speed == 0 || rateLimit < speed) {
+		speed, measured = rateLimit, false
+	}
+	if speed > 0 {
+		estimate := time.Duration(float64(total) / float64(speed) * float64(time.Second)).Round(time.Second)
+		source := "the rate limit"
+		if measured {
+			source = "the speed of the last download"
+		}
+		line += fmt.Sprintf(", about %s at %s/s, %s", max(estimate, time.Second), download.FormatBytes(speed), source)
+	}
+	infof("%s\n", line)
+
+	s.start = time.Now()
+	return s
+}
+
+// finish prints what was transferred and remembers the average speed
+func (s *transferSummary) finish() {
+	elapsed := time.Since(s.start)
+	received := s.received.Load()
+	speed := int64(float64(received) / max(elapsed.Seconds(), 0.001))
+
+	precision := 100 * time.Millisecond
+	if elapsed < time.Second {
+		precision = time.Millisecond
+	}
+	line := fmt.Sprintf("Downloaded %d assets in %s: %s transferred, %s/s on average",
+		s.files-s.skipped, elapsed.Round(precision), download.FormatBytes(received), download.FormatBytes(speed))
+	if s.skipped > 0 {
+		line += fmt.Sprintf("; %d already up to date", s.skipped)
+	}
+	infof("\n%s\n", line)
+
+	if received >= minSpeedSample && s.host != "" {
+		speeds := loadSpeeds()
+		speeds[s.host] = speed
+		saveSpeeds(speeds)
+	}
+}
+
+// speedsPath is where measured download speeds are kept between runs
+func speedsPath() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "gitea-release", "speeds.json"), nil
+}
+
+// loadSpeeds returns the last measured speed per host in bytes per second,
+// empty when none could be read
+func loadSpeeds() map[string]int64 {
+	speeds := make(map[string]int64)
+	path, err := speedsPath()
+	if err != nil {
+		return speeds
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &speeds) != nil || speeds == nil {
+		return make(map[string]int64)
+	}
+	return speeds
+}
+
+// saveSpeeds writes the measured speeds, failing quietly as they only
+// improve estimates
+func saveSpeeds(speeds map[string]int64) {
+	path, err := speedsPath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(speeds)
+	if err != nil || os.MkdirAll(filepath.Dir(path), 0700) != nil {
+		return
+	}
+	os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/earentir/gitea-release/internal/client"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tagRef         string
+	tagMessage     string
+	tagMessageFile string
+)
+
+var tagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage repository tags",
+}
+
+var tagCreateCmd = &cobra.Command{
+	Use:   "create [repo-alias] [tag]",
+	Short: "Create a tag, annotated when a message is given",
+	Long: "Create a tag through the Gitea API, for pipelines that need the tag before creating the release. " +
+		"The tag points at --ref (a branch, tag or commit SHA) or the default branch. With --message or " +
+		"--message-file an annotated tag is created.",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if tagMessage != "" && tagMessageFile != "" {
+			return fmt.Errorf("--message and --message-file cannot be used together")
+		}
+
+		message := tagMessage
+		if tagMessageFile != "" {
+			data, err := os.ReadFile(tagMessageFile)
+			if err != nil {
+				return fmt.Errorf("error reading message file: %v", err)
+			}
+			message = string(data)
+		}
+
+		cfg, repoDetails, err := loadRepo(args[0])
+		if err != nil {
+			return err
+		}
+
+		repo, err := releaseRepo(cfg, args[0], repoDetails)
+		if err != nil {
+			return err
+		}
+
+		api := client.New(repo.BaseURL, repo.Token)
+		tag, err := api.CreateTag(cmd.Context(), repo.Owner, repo.Name, client.CreateTagOptions{
+			TagName: args[1],
+			Target:  tagRef,
+			Message: message,
+		})
+		var statusErr *client.StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("tag %s already exists in %s/%s", args[1], repo.Owner, repo.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("error creating tag: %w", err)
+		}
+
+		infof("Tag %s created in %s/%s at %s\n", tag.Name, repo.Owner, repo.Name, tag.Commit.SHA)
+		return nil
+	},
+}
+
+func init() {
+	tagCreateCmd.Flags().StringVar(&tagRef, "ref", "", "Branch, tag or commit SHA to tag (default: the default branch)")
+	tagCreateCmd.Flags().StringVar(&tagMessage, "message", "", "Tag message, makes the tag annotated")
+	tagCreateCmd.Flags().StringVar(&tagMessageFile, "message-file", "", "Read the tag message from a file")
+
+	tagCmd.AddCommand(tagCreateCmd)
+	rootCmd.AddCommand(tagCmd)
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/earentir/gitea-release/internal/lockfile"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyInstalledCmd = &cobra.Command{
+	Use:   "verify-installed [repo-alias]",
+	Short: "Re-hash installed files and compare them with the lockfile",
+	Long: `Re-hash every file recorded in the lockfile for a repository alias and
+report files that are missing or whose size or SHA256 digest changed since they
+were downloaded. The lockfile lives next to the configuration file, e.g.
+gitea-release.lock.json for gitea-release.json.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		alias := args[0]
+
+		lock, err := lockfile.Load(lockfile.PathFor(configFile))
+		if err != nil {
+			return err
+		}
+
+		entries := lock.ForAlias(alias)
+		if len(entries) == 0 {
+			return fmt.Errorf("no installed files recorded for %s", alias)
+		}
+
+		failed := 0
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "%s\tTAG\tPATH\n", paint(colorPlain, "STATUS"))
+		for _, entry := range entries {
+			status := "OK"
+			sum, size, err := lockfile.HashFile(entry.Path)
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				status = "MISSING"
+			case err != nil:
+				status = fmt.Sprintf("ERROR (%v)", err)
+			case size != entry.Size:
+				status = "SIZE CHANGED"
+			case sum != entry.SHA256:
+				status = "MODIFIED"
+			}
+			color := colorGreen
+			if status != "OK" {
+				failed++
+				color = colorRed
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", paint(color, status), entry.Tag, entry.Path)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if failed > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d of %d installed file(s) failed verification", failed, len(entries))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyInstalledCmd)
+}
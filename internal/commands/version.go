@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"runtime/debug"
+
+	"github.com/earentir/gitea-release/internal/client"
+)
+
+// version is set at build time with
+// -ldflags "-X github.com/earentir/gitea-release/internal/commands.version=v1.2.3"
+var version string
+
+// buildVersion returns the version of this binary, falling back to the
+// module version go install records
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+func init() {
+	rootCmd.Version = buildVersion()
+	rootCmd.SetVersionTemplate(`gitea-release {{.Version}}
+Works with Gitea ` + client.FeatureTagAPI.Since + ` and newer, and with Forgejo
+`)
+}
@@ -0,0 +1,360 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+	"github.com/earentir/gitea-release/internal/lockfile"
+	"github.com/earentir/gitea-release/internal/notify"
+	"github.com/earentir/gitea-release/internal/runlock"
+	"github.com/earentir/gitea-release/internal/schedule"
+	"github.com/earentir/gitea-release/internal/sdnotify"
+	"github.com/earentir/gitea-release/pkg/release"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	watchInterval time.Duration
+	watchOnce     bool
+)
+
+// minWatchInterval keeps watch from polling Gitea in a tight loop
+const minWatchInterval = 10 * time.Second
+
+// checkWatchInterval rejects poll intervals below minWatchInterval
+func checkWatchInterval(interval time.Duration) error {
+	if interval < minWatchInterval {
+		return fmt.Errorf("--interval must be at least %s, got %s", minWatchInterval, interval)
+	}
+	return nil
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [repo-alias...]",
+	Short: "Poll repositories for new releases, deploy them and send notifications",
+	Long: `Poll the given repositories, those in a --group or every configured
+repository, for new releases. Repositories with an asset and deploy_path in
+the config get the asset of each new release deployed, and the notifiers in
+their notify list are told about new releases and about deploys that succeed
+or fail. Runs until interrupted unless --once is given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkWatchInterval(watchInterval); err != nil {
+			return err
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		aliases, err := selectAliases(cfg, args, groupFlag)
+		if err != nil {
+			return err
+		}
+		for _, alias := range aliases {
+			details, ok := cfg.Repos[alias]
+			if !ok {
+				return fmt.Errorf("repository alias %s not found", alias)
+			}
+			if err := schedule.Validate(details.Windows); err != nil {
+				return fmt.Errorf("%s: %v", alias, err)
+			}
+			if details.Rollout != nil {
+				if err := details.Rollout.Validate(); err != nil {
+					return fmt.Errorf("%s: %v", alias, err)
+				}
+			}
+			if details.HealthCheck != nil {
+				if _, err := newHealthCheck(*details.HealthCheck); err != nil {
+					return fmt.Errorf("%s: %v", alias, err)
+				}
+			}
+		}
+
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("error getting hostname: %v", err)
+		}
+
+		w := &watcher{cfg: cfg, host: host, seen: make(map[string]string), failed: make(map[string]string),
+			held: make(map[string]string), behind: make(map[string]string), rolledBack: make(map[string]string)}
+
+		// Under the Windows service manager the loop runs until the service is stopped
+		return runAsService(cmd.Context(), func(ctx context.Context) error {
+			watchLogf("Watching %d repositories every %s", len(aliases), watchInterval)
+
+			// Report readiness and liveness when running as a systemd Type=notify unit
+			sdnotify.Ready()
+			go sdnotify.Watchdog(ctx)
+
+			for {
+				for _, alias := range aliases {
+					w.poll(ctx, alias)
+				}
+				sdnotify.Status(fmt.Sprintf("Last poll %s", time.Now().Format(time.RFC3339)))
+
+				if watchOnce {
+					return nil
+				}
+
+				select {
+				case <-ctx.Done():
+					watchLogf("Stopping")
+					sdnotify.Stopping()
+					return nil
+				case <-time.After(watchInterval):
+				}
+			}
+		})
+	},
+}
+
+// watcher remembers what it has seen between polls
+type watcher struct {
+	cfg    *config.Config
+	seen   map[string]string // Latest tag per alias
+	failed map[string]string // Tag whose deploy last failed per alias, to avoid repeated alerts
+	host   string            // Hostname, which places this host in a rollout
+	held   map[string]string // Why the latest release is not deployed yet per alias, logged once
+	behind map[string]string // Newer release a pinned alias was last logged as missing
+
+	// Tag per alias that failed its health check after deploying, not
+	// deployed again until watch restarts
+	rolledBack map[string]string
+}
+
+// watchLogf logs a watch status message unless --quiet is set
+func watchLogf(format string, args ...interface{}) {
+	if !quiet {
+		log.Printf(format, args...)
+	}
+}
+
+// poll checks one repository for a new release and deploys it if configured
+func (w *watcher) poll(ctx context.Context, alias string) {
+	details := w.cfg.Repos[alias]
+
+	repo, err := releaseRepo(w.cfg, alias, details)
+	if err != nil {
+		log.Printf("%s: %v", alias, err)
+		return
+	}
+
+	latest, err := repo.Find(ctx, repo.DefaultChannel())
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("%s: %v", alias, err)
+		}
+		return
+	}
+
+	event := notify.Event{
+		Alias: alias,
+		Repo:  details.Owner + "/" + details.Name,
+		Tag:   latest.TagName,
+		URL:   latest.HTMLURL,
+	}
+
+	// The first poll only records the current release
+	previous, known := w.seen[alias]
+	w.seen[alias] = latest.TagName
+	if known && previous != latest.TagName {
+		watchLogf("%s: new release %s", alias, latest.TagName)
+		w.notify(ctx, details, notify.EventRelease, event)
+	}
+
+	// A pinned repository stays on its pinned release
+	if repo.Pinned != "" {
+		pinned, err := repo.Find(ctx, "")
+		if err != nil {
+			log.Printf("%s: %v", alias, err)
+			return
+		}
+		if publishedAfter(latest, pinned) && w.behind[alias] != latest.TagName {
+			w.behind[alias] = latest.TagName
+			watchLogf("%s: pinned to %s, %s is newer", alias, pinned.TagName, latest.TagName)
+		}
+		latest = pinned
+		event.Tag, event.URL = pinned.TagName, pinned.HTMLURL
+	}
+
+	if details.Asset == "" {
+		return
+	}
+
+	lock, err := lockfile.Load(lockfile.PathFor(configFile))
+	if err != nil {
+		log.Printf("%s: %v", alias, err)
+		return
+	}
+	installed, isInstalled := lock.Installed(alias, details.Asset)
+	if isInstalled && installed.Tag == latest.TagName {
+		return
+	}
+	if w.rolledBack[alias] == latest.TagName {
+		return
+	}
+
+	// A release that is not due yet waits for a later poll; a newer release
+	// arriving meanwhile replaces it
+	if reason := w.holdReason(alias, details, latest); reason != "" {
+		if w.held[alias] != latest.TagName+" "+reason {
+			w.held[alias] = latest.TagName + " " + reason
+			watchLogf("%s: holding back %s %s", alias, latest.TagName, reason)
+		}
+		return
+	}
+	delete(w.held, alias)
+
+	var current string
+	if isInstalled {
+		current = installed.Path
+	}
+	finalPath, err := w.deploy(ctx, alias, details, repo, latest, current)
+	if errors.Is(err, runlock.ErrLocked) {
+		watchLogf("%s: not deploying %s yet, %v", alias, latest.TagName, err)
+		return
+	}
+	var rollbackErr *release.RollbackError
+	if errors.As(err, &rollbackErr) {
+		log.Printf("%s: %s failed its health check: %v", alias, latest.TagName, err)
+		w.rolledBack[alias] = latest.TagName
+		event.Path = rollbackErr.Path
+		event.Error = rollbackErr.Err.Error()
+		w.notify(ctx, details, notify.EventRollback, event)
+		return
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("%s: deploying %s failed: %v", alias, latest.TagName, err)
+		if w.failed[alias] != latest.TagName {
+			w.failed[alias] = latest.TagName
+			event.Error = err.Error()
+			w.notify(ctx, details, notify.EventDeployFailure, event)
+		}
+		return
+	}
+
+	delete(w.failed, alias)
+	watchLogf("%s: deployed %s to %s", alias, latest.TagName, finalPath)
+	event.Path = finalPath
+	w.notify(ctx, details, notify.EventDeploySuccess, event)
+}
+
+// holdReason explains why rel may not be deployed yet, by its rollout stage
+// for this host or the maintenance windows, or returns "" if it may
+func (w *watcher) holdReason(alias string, details config.RepoDetails, rel release.Release) string {
+	now := time.Now()
+
+	if details.Rollout != nil {
+		published, err := time.Parse(time.RFC3339, rel.PublishedAt)
+		if err != nil {
+			client.Debugf("%s: no publish time for %s, not staggering it", alias, rel.TagName)
+		} else if due, _ := details.Rollout.Due(schedule.Bucket(w.host, alias), published); now.Before(due) {
+			return "until its rollout stage for this host at " + due.Format(time.RFC3339)
+		}
+	}
+
+	if open, _ := schedule.Open(details.Windows, now); !open {
+		if next, _ := schedule.NextOpening(details.Windows, now); !next.IsZero() {
+			return "until the maintenance window opens at " + next.Format(time.RFC3339)
+		}
+		return "as no maintenance window opens within a year"
+	}
+	return ""
+}
+
+// deploy fetches the configured asset of rel into the deploy path. With a
+// health check, the copy at current (if any) must be healthy first and the
+// new one afterwards.
+func (w *watcher) deploy(ctx context.Context, alias string, details config.RepoDetails, repo release.Repo, rel release.Release, current string) (string, error) {
+	deployTo := details.DeployPath
+	if deployTo == "" {
+		deployTo = w.cfg.DeployPath
+	}
+	if deployTo == "" {
+		return "", fmt.Errorf("no deploy_path configured")
+	}
+	deployTo, err := expandPlaceholders(deployTo, "deploy_path", details.Name, rel)
+	if err != nil {
+		return "", err
+	}
+
+	lock, err := runlock.Acquire(ctx, deployTo, runLock)
+	if err != nil {
+		return "", err
+	}
+	defer lock.Release()
+
+	var checkDeployed func(ctx context.Context, finalPath string) error
+	if details.HealthCheck != nil {
+		health, err := newHealthCheck(*details.HealthCheck)
+		if err != nil {
+			return "", err
+		}
+		// Nothing to check before the first install
+		if current != "" {
+			if err := health.once(ctx, current); err != nil {
+				return "", fmt.Errorf("not deploying, unhealthy before the deploy: %v", err)
+			}
+		}
+		checkDeployed = health.until
+	}
+
+	finalPath, err := repo.Fetch(ctx, rel, release.FetchOptions{
+		Asset:        details.Asset,
+		DeployPath:   deployTo,
+		Mode:         details.Chmod,
+		Owner:        details.Chown,
+		HideProgress: true,
+		StallTimeout: stallTimeout(),
+		Installed:    installedCopy(alias, details.Asset, rel),
+		PostVerify:   checkDeployed,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := recordInstall(alias, rel.TagName, details.Asset, finalPath); err != nil {
+		return "", err
+	}
+	return finalPath, nil
+}
+
+// notify sends an event to every notifier of the repository subscribed to it
+func (w *watcher) notify(ctx context.Context, details config.RepoDetails, eventType string, event notify.Event) {
+	event.Type = eventType
+	event.Time = time.Now().UTC()
+
+	for _, target := range details.Notify {
+		if !target.Wants(eventType) {
+			continue
+		}
+		target, err := config.RevealTarget(target)
+		if err != nil {
+			log.Printf("%s: %s notification failed: %v", event.Alias, target.Type, err)
+			continue
+		}
+		if err := notify.Send(ctx, client.HTTPClient, target, event); err != nil {
+			log.Printf("%s: %s notification failed: %v", event.Alias, target.Type, err)
+		}
+	}
+}
+
+func init() {
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", 5*time.Minute, "Time between polls, at least 10s")
+	watchCmd.Flags().StringVar(&groupFlag, "group", "", "Watch the repositories in this group")
+	watchCmd.Flags().BoolVar(&watchOnce, "once", false, "Poll once and exit, e.g. when run from cron")
+	watchCmd.Flags().StringVar(&serviceName, "service-name", "gitea-release", "Name of the service watch runs as")
+	watchCmd.Flags().MarkHidden("service-name")
+
+	rootCmd.AddCommand(watchCmd)
+}
@@ -0,0 +1,281 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/config"
+
+	"github.com/earentir/gitearelease"
+	"golang.org/x/term"
+)
+
+// wizard asks the questions of repo add on the terminal
+type wizard struct {
+	in *bufio.Reader
+}
+
+// ask prints question and returns the trimmed answer, or def for an empty
+// answer
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: ", question)
+	}
+	answer, err := w.in.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", fmt.Errorf("error reading answer: %v", err)
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// confirm asks a yes/no question, def is the answer for an empty line
+func (w *wizard) confirm(question string, def bool) (bool, error) {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		answer, err := w.ask(question+" ["+choices+"]", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+	}
+}
+
+// repoAddWizard runs repo add interactively: it asks for the instance,
+// lists the repositories of a user or organization to pick from and
+// suggests an alias, then saves after confirmation
+func repoAddWizard(ctx context.Context) error {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("--owner and --name are required when not running on a terminal")
+	}
+	w := &wizard{in: bufio.NewReader(os.Stdin)}
+
+	cfg, err := config.LoadFile(configFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		cfg = &config.Config{Repos: make(map[string]config.RepoDetails)}
+	} else if err != nil {
+		return err
+	}
+
+	giteaURL, api, err := w.askInstance(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if err := checkGiteaURL(cfg, giteaURL); err != nil {
+		return err
+	}
+	owner, name, err := w.askRepository(ctx, api)
+	if err != nil {
+		return err
+	}
+
+	alias := aliasFlag
+	if alias == "" {
+		alias = importAlias(cfg, owner, name)
+	}
+	for {
+		if alias, err = w.ask("Alias", alias); err != nil {
+			return err
+		}
+		existing, taken := cfg.Repos[alias]
+		if alias != "" && !taken {
+			break
+		}
+		if taken {
+			fmt.Fprintf(os.Stderr, "The alias %s is already used for %s/%s\n", alias, existing.Owner, existing.Name)
+		}
+		alias = ""
+	}
+
+	fmt.Fprintf(os.Stderr, "\nGitea URL:   %s\nRepository:  %s/%s\nAlias:       %s\n", giteaURL, owner, name, alias)
+	save, err := w.confirm("Save to "+configFile+"?", true)
+	if err != nil {
+		return err
+	}
+	if !save {
+		infof("Nothing saved\n")
+		return nil
+	}
+
+	cfg.GiteaURL = giteaURL
+	cfg.Repos[alias] = config.RepoDetails{
+		Owner:  owner,
+		Name:   name,
+		Chmod:  repoChmodFlag,
+		Chown:  repoChownFlag,
+		Token:  repoTokenFlag,
+		Groups: repoGroupsFlag,
+	}
+	if err := config.Save(cfg, configFile); err != nil {
+		return err
+	}
+	infof("Repository %s/%s added with alias %s\n", owner, name, alias)
+	return nil
+}
+
+// askInstance asks for the Gitea URL, or the name of a well-known host,
+// until the server answers the version endpoint
+func (w *wizard) askInstance(ctx context.Context, cfg *config.Config) (string, *client.Client, error) {
+	for {
+		answer, err := w.ask("Gitea URL or host ("+strings.Join(config.HostNames(), ", ")+")", cfg.GiteaURL)
+		if err != nil {
+			return "", nil, err
+		}
+		giteaURL, err := instanceURL(answer)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		token := repoTokenFlag
+		if token == "" {
+			probe := *cfg
+			probe.GiteaURL = giteaURL
+			if token, err = probe.TokenFor(""); err != nil {
+				return "", nil, err
+			}
+		}
+		api := client.New(giteaURL, token)
+		server, err := api.Identify(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "No Gitea API at %s: %v\n", giteaURL, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Found %s\n", server)
+		return giteaURL, api, nil
+	}
+}
+
+// instanceURL turns an answer into the base URL of an instance: well-known
+// host names are looked up and https is assumed without a scheme
+func instanceURL(answer string) (string, error) {
+	if hostURL, ok := config.HostURL(answer); ok {
+		return hostURL, nil
+	}
+	if !strings.Contains(answer, "://") {
+		answer = "https://" + answer
+	}
+	u, err := url.Parse(answer)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("%s is not an http or https URL", answer)
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
+// askRepository asks for a user or organization and lets the user pick one
+// of its repositories
+func (w *wizard) askRepository(ctx context.Context, api *client.Client) (string, string, error) {
+	for {
+		owner, err := w.ask("User or organization", ownerFlag)
+		if err != nil {
+			return "", "", err
+		}
+		if owner == "" {
+			continue
+		}
+
+		repos, err := api.GetRepositories(ctx, owner)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot list the repositories of %s: %v\n", owner, err)
+			continue
+		}
+		if len(repos) == 0 {
+			fmt.Fprintf(os.Stderr, "%s has no repositories the token can see\n", owner)
+			continue
+		}
+
+		// Repositories with releases first, then by name
+		sort.SliceStable(repos, func(i, j int) bool {
+			if (repos[i].ReleaseCounter > 0) != (repos[j].ReleaseCounter > 0) {
+				return repos[i].ReleaseCounter > 0
+			}
+			return strings.ToLower(repos[i].Name) < strings.ToLower(repos[j].Name)
+		})
+		for i, repo := range repos {
+			fmt.Fprintf(os.Stderr, "%3d) %s%s\n", i+1, repo.Name, repoSummary(repo))
+		}
+
+		repo, err := w.pickRepository(repos)
+		if err != nil {
+			return "", "", err
+		}
+		if repo != nil {
+			if repo.Owner.Login != "" {
+				owner = repo.Owner.Login
+			}
+			return owner, repo.Name, nil
+		}
+	}
+}
+
+// pickRepository asks for a number or name from the list. A nil result goes
+// back to the owner question.
+func (w *wizard) pickRepository(repos []gitearelease.Repository) (*gitearelease.Repository, error) {
+	for {
+		answer, err := w.ask("Repository (number or name, empty for another owner)", "")
+		if err != nil || answer == "" {
+			return nil, err
+		}
+		if n, err := strconv.Atoi(answer); err == nil {
+			if n >= 1 && n <= len(repos) {
+				return &repos[n-1], nil
+			}
+			fmt.Fprintf(os.Stderr, "Pick a number from 1 to %d\n", len(repos))
+			continue
+		}
+		for i := range repos {
+			if strings.EqualFold(repos[i].Name, answer) {
+				return &repos[i], nil
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s is not in the list\n", answer)
+	}
+}
+
+// repoSummary describes a repository in the wizard's list
+func repoSummary(repo gitearelease.Repository) string {
+	var parts []string
+	switch repo.ReleaseCounter {
+	case 0:
+		parts = append(parts, "no releases")
+	case 1:
+		parts = append(parts, "1 release")
+	default:
+		parts = append(parts, fmt.Sprintf("%d releases", repo.ReleaseCounter))
+	}
+	if repo.Private {
+		parts = append(parts, "private")
+	}
+	summary := " (" + strings.Join(parts, ", ") + ")"
+	if description := strings.TrimSpace(repo.Description); description != "" {
+		if runes := []rune(description); len(runes) > 60 {
+			description = string(runes[:57]) + "..."
+		}
+		summary += " " + description
+	}
+	return summary
+}
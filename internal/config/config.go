@@ -0,0 +1,284 @@
+// Package config loads and saves the gitea-release configuration file
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/notify"
+	"github.com/earentir/gitea-release/internal/schedule"
+)
+
+// Config represents the configuration for the application
+type Config struct {
+	Includes   []string               `json:"includes,omitempty"` // Files merged into this one, globs allowed
+	GiteaURL   string                 `json:"gitea_url"`
+	Token      string                 `json:"token,omitempty"`       // Default API token
+	Tokens     map[string]string      `json:"tokens,omitempty"`      // API tokens per Gitea instance URL
+	DeployPath string                 `json:"deploy_path,omitempty"` // Default deploy directory for downloads
+	DateFormat string                 `json:"date_format,omitempty"` // Default for --date-format
+	Profiles   map[string]Profile     `json:"profiles,omitempty"`
+	Channels   map[string]string      `json:"channels,omitempty"` // Named channels of all repositories, see RepoDetails.Channels
+	Repos      map[string]RepoDetails `json:"repos"`
+}
+
+// Profile holds the settings that differ between environments, such as
+// staging and production, empty fields keep the top-level value
+type Profile struct {
+	GiteaURL   string `json:"gitea_url,omitempty"`
+	Token      string `json:"token,omitempty"` // Takes precedence over the tokens map
+	DeployPath string `json:"deploy_path,omitempty"`
+}
+
+// RepoDetails contains information about a repository
+type RepoDetails struct {
+	Owner string `json:"owner"`
+	Name  string `json:"name"`
+	Chmod string `json:"chmod,omitempty"` // Default file mode for deployed files
+	Chown string `json:"chown,omitempty"` // Default owner (user:group) for deployed files
+	Token string `json:"token,omitempty"` // API token for this repository only
+
+	// Groups label the repository for commands run with --group
+	Groups []string `json:"groups,omitempty"`
+
+	// Channel is the release commands use when no tag is given and watch
+	// deploys: "stable" (the default) skips pre-releases, "latest" does not,
+	// or the name of a channel from Channels
+	Channel string `json:"channel,omitempty"`
+
+	// Channels name regular expressions of release tags, e.g. "beta":
+	// "-beta", for upstreams that encode channels in their tags. They are
+	// added to the top-level channels and replace those of the same name.
+	Channels map[string]string `json:"channels,omitempty"`
+
+	// PinnedTag holds the repository at one release: it replaces the
+	// channel's newest release for commands given no tag and for watch
+	PinnedTag string `json:"pinned_tag,omitempty"`
+
+	// BlockedTags are known-bad releases, skipped when looking for the
+	// newest release of a channel
+	BlockedTags []string `json:"blocked_tags,omitempty"`
+
+	// Settings used by watch
+	Asset      string          `json:"asset,omitempty"`       // Asset to deploy when a new release appears
+	DeployPath string          `json:"deploy_path,omitempty"` // Defaults to the top-level deploy_path
+	Notify     []notify.Target `json:"notify,omitempty"`
+
+	// Windows restrict deploys to maintenance windows, new releases are
+	// held back until one opens
+	Windows []schedule.Window `json:"maintenance_windows,omitempty"`
+
+	// Rollout, if set, staggers deploys across the hosts running watch
+	Rollout *schedule.Rollout `json:"rollout,omitempty"`
+
+	// HealthCheck, if set, must pass before a deploy starts and after it,
+	// or the deploy is rolled back
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+
+	// Provenance is what the SLSA provenance of assets must show for
+	// fetch --verify-provenance
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// HealthCheck is a URL that must answer with a 2xx status, a command that
+// must succeed, or both
+type HealthCheck struct {
+	URL      string `json:"url,omitempty"`
+	Command  string `json:"command,omitempty"`  // Run through the shell
+	Expect   string `json:"expect,omitempty"`   // Regular expression the response body or command output must match
+	Wait     string `json:"wait,omitempty"`     // Keep retrying after a deploy for this long, e.g. 30s
+	Interval string `json:"interval,omitempty"` // Time between retries, default 2s
+}
+
+// Provenance names the builder and source repository release assets must
+// come from. Identities without an @ref match at any ref.
+type Provenance struct {
+	BuilderID      string `json:"builder_id"`                // e.g. the URL of the SLSA generator workflow
+	SourceURI      string `json:"source_uri"`                // e.g. github.com/org/app
+	SignerIdentity string `json:"signer_identity,omitempty"` // Signing certificate identity, defaults to builder_id
+	Issuer         string `json:"issuer,omitempty"`          // Signing certificate OIDC issuer, defaults to GitHub Actions
+}
+
+// ChannelsFor returns the named channels of a repository alias: the
+// top-level ones with the repository's own added or replacing them
+func (c *Config) ChannelsFor(alias string) map[string]string {
+	own := c.Repos[alias].Channels
+	if len(c.Channels) == 0 {
+		return own
+	}
+	channels := make(map[string]string, len(c.Channels)+len(own))
+	for name, pattern := range c.Channels {
+		channels[name] = pattern
+	}
+	for name, pattern := range own {
+		channels[name] = pattern
+	}
+	return channels
+}
+
+// TokenFor returns the API token for a repository alias, preferring the
+// repository's own token over the instance token and the default token.
+// Encrypted tokens are decrypted with the passphrase from PassphraseFunc.
+func (c *Config) TokenFor(alias string) (string, error) {
+	if repo, ok := c.Repos[alias]; ok && repo.Token != "" {
+		return reveal(repo.Token)
+	}
+	if token := c.Tokens[strings.TrimRight(c.GiteaURL, "/")]; token != "" {
+		return reveal(token)
+	}
+	return reveal(c.Token)
+}
+
+// InGroup reports whether the repository carries the group label
+func (r RepoDetails) InGroup(group string) bool {
+	for _, g := range r.Groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// UseProfile applies the settings of the named profile on top of the
+// top-level settings. The result should not be saved.
+func (c *Config) UseProfile(name string) error {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %s not found", name)
+	}
+
+	if profile.GiteaURL != "" {
+		c.GiteaURL = profile.GiteaURL
+	}
+	if profile.Token != "" {
+		c.Token = profile.Token
+		c.Tokens = nil
+	}
+	if profile.DeployPath != "" {
+		c.DeployPath = profile.DeployPath
+	}
+	return nil
+}
+
+// Load reads the configuration from filename with its included files merged
+// in, see Merged
+func Load(filename string) (*Config, error) {
+	data, err := Merged(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(config); err != nil {
+		return nil, fmt.Errorf("error decoding config file: %v", err)
+	}
+	return config, nil
+}
+
+// LoadFile reads filename alone, without its includes, for commands that
+// change the configuration and save it back. A remote configuration file
+// cannot be changed this way.
+func LoadFile(filename string) (*Config, error) {
+	if IsRemote(filename) {
+		return nil, fmt.Errorf("%s is remote, change it at its source", filename)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config file: %w", err)
+	}
+	defer file.Close()
+
+	config := &Config{}
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("error decoding config file: %v", err)
+	}
+
+	return config, nil
+}
+
+// Save writes the configuration to filename
+func Save(config *Config, filename string) error {
+	if IsRemote(filename) {
+		return fmt.Errorf("%s is remote, change it at its source", filename)
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding config file: %v", err)
+	}
+
+	// The config is written to a temporary file next to it, created with
+	// mode 0600 as it holds tokens, and renamed over it, so a failed write
+	// never leaves a truncated config behind
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating config file: %v", err)
+	}
+	tmp := file.Name()
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing config file: %v", err)
+	}
+
+	return nil
+}
+
+// Redacted returns a copy of the configuration with every token replaced by
+// a placeholder, for display
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Token = redact(c.Token)
+
+	if c.Tokens != nil {
+		redacted.Tokens = make(map[string]string, len(c.Tokens))
+		for url, token := range c.Tokens {
+			redacted.Tokens[url] = redact(token)
+		}
+	}
+
+	if c.Profiles != nil {
+		redacted.Profiles = make(map[string]Profile, len(c.Profiles))
+		for name, profile := range c.Profiles {
+			profile.Token = redact(profile.Token)
+			redacted.Profiles[name] = profile
+		}
+	}
+
+	if c.Repos != nil {
+		redacted.Repos = make(map[string]RepoDetails, len(c.Repos))
+		for alias, repo := range c.Repos {
+			repo.Token = redact(repo.Token)
+			if repo.Notify != nil {
+				targets := make([]notify.Target, len(repo.Notify))
+				for i, target := range repo.Notify {
+					target.Token = redact(target.Token)
+					target.Password = redact(target.Password)
+					targets[i] = target
+				}
+				repo.Notify = targets
+			}
+			redacted.Repos[alias] = repo
+		}
+	}
+
+	return &redacted
+}
+
+func redact(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "********"
+}
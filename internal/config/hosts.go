@@ -0,0 +1,38 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// Hosts maps the names accepted by --host to the URLs of well-known public
+// instances. Codeberg runs Forgejo, whose release API matches Gitea's.
+var Hosts = map[string]string{
+	"gitea.com":    "https://gitea.com",
+	"codeberg.org": "https://codeberg.org",
+}
+
+// HostURL returns the URL of a well-known host, ignoring case and the www.
+// prefix, and also accepting the name without its domain (codeberg)
+func HostURL(name string) (string, bool) {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "www.")
+	if url, ok := Hosts[name]; ok {
+		return url, true
+	}
+	for host, url := range Hosts {
+		if strings.TrimSuffix(host, host[strings.LastIndex(host, "."):]) == name {
+			return url, true
+		}
+	}
+	return "", false
+}
+
+// HostNames returns the names of the well-known hosts, sorted
+func HostNames() []string {
+	names := make([]string, 0, len(Hosts))
+	for name := range Hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
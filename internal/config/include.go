@@ -0,0 +1,174 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Merged returns the configuration file as JSON with the files it includes
+// merged in. Included files are applied in order, files matching a glob in
+// name order, and the including file last, so its own settings win. Objects
+// such as repos merge key by key, other values are replaced. A remote
+// configuration file is read from its cached copy, like a remote include,
+// and can only include remote files.
+func Merged(filename string) ([]byte, error) {
+	remote := IsRemote(filename)
+	if remote {
+		cached, err := fetchRemote(filename, false)
+		if err != nil {
+			return nil, err
+		}
+		filename = cached
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening config file: %w", err)
+	}
+
+	var head struct {
+		Includes []string `json:"includes"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, fmt.Errorf("error decoding config file: %v", err)
+	}
+	if len(head.Includes) == 0 {
+		return data, nil
+	}
+	if remote {
+		for _, include := range head.Includes {
+			if !IsRemote(include) {
+				return nil, fmt.Errorf("a remote configuration file can only include remote files, not %s", include)
+			}
+		}
+	}
+
+	files, err := includedFiles(filename, head.Includes, false)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]interface{}{}
+	for _, file := range append(files, filename) {
+		fragment, err := readObject(file)
+		if err != nil {
+			return nil, err
+		}
+		if _, nested := fragment["includes"]; nested && file != filename {
+			return nil, fmt.Errorf("error in %s: included files cannot include others", file)
+		}
+		mergeObjects(merged, fragment)
+	}
+	delete(merged, "includes")
+
+	return json.Marshal(merged)
+}
+
+// Refresh fetches the remote includes of the configuration file now rather
+// than when their cached copies expire, and returns how many there are. A
+// remote configuration file is fetched again too and counts as one of them.
+func Refresh(filename string) (int, error) {
+	fetched := 0
+	if IsRemote(filename) {
+		cached, err := fetchRemote(filename, true)
+		if err != nil {
+			return 0, err
+		}
+		filename, fetched = cached, 1
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("error opening config file: %w", err)
+	}
+	var head struct {
+		Includes []string `json:"includes"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return 0, fmt.Errorf("error decoding config file: %v", err)
+	}
+
+	var remote []string
+	for _, include := range head.Includes {
+		if IsRemote(include) {
+			remote = append(remote, include)
+		}
+	}
+	_, err = includedFiles(filename, remote, true)
+	return fetched + len(remote), err
+}
+
+// includedFiles resolves include patterns, relative to the directory of
+// the including file and with ~ for the home directory. A glob may match
+// nothing, a plain path must exist. Remote includes resolve to their cached
+// copy, fetched again first with refresh.
+func includedFiles(filename string, patterns []string, refresh bool) ([]string, error) {
+	self, _ := filepath.Abs(filename)
+
+	var files []string
+	for _, pattern := range patterns {
+		if IsRemote(pattern) {
+			path, err := fetchRemote(pattern, refresh)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, path)
+			continue
+		}
+		if pattern == "~" || strings.HasPrefix(pattern, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("error expanding include %s: %v", pattern, err)
+			}
+			pattern = filepath.Join(home, pattern[1:])
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(filename), pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %s: %v", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("included file %s does not exist", pattern)
+		}
+		for _, match := range matches {
+			if abs, _ := filepath.Abs(match); abs != self {
+				files = append(files, match)
+			}
+		}
+	}
+	return files, nil
+}
+
+// readObject reads a JSON object, keeping numbers as written
+func readObject(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading included file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", filename, err)
+	}
+	return object, nil
+}
+
+// mergeObjects merges src into dst, recursing into objects present in both
+func mergeObjects(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcObject, srcIsObject := value.(map[string]interface{})
+		dstObject, dstIsObject := dst[key].(map[string]interface{})
+		if srcIsObject && dstIsObject {
+			mergeObjects(dstObject, srcObject)
+			continue
+		}
+		dst[key] = value
+	}
+}
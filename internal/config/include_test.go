@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMerged(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string // Relative to a temporary directory, config.json is loaded
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "no includes",
+			files: map[string]string{"config.json": `{"gitea_url": "https://gitea.example.com", "repos": {}}`},
+			want:  `{"gitea_url": "https://gitea.example.com", "repos": {}}`,
+		},
+		{
+			name: "including file wins",
+			files: map[string]string{
+				"config.json": `{"includes": ["shared.json"], "gitea_url": "https://own.example.com", "repos": {"app": {"deploy_path": "/opt/app"}}}`,
+				"shared.json": `{"gitea_url": "https://shared.example.com", "timeout": 30, "repos": {"app": {"owner": "platform", "name": "app"}, "lib": {"owner": "platform", "name": "lib"}}}`,
+			},
+			want: `{"gitea_url": "https://own.example.com", "timeout": 30, "repos": {
+				"app": {"owner": "platform", "name": "app", "deploy_path": "/opt/app"},
+				"lib": {"owner": "platform", "name": "lib"}}}`,
+		},
+		{
+			name: "glob in name order",
+			files: map[string]string{
+				"config.json":        `{"includes": ["conf.d/*.json"]}`,
+				"conf.d/20-b.json":   `{"gitea_url": "https://b.example.com", "groups": ["b"]}`,
+				"conf.d/10-a.json":   `{"gitea_url": "https://a.example.com", "groups": ["a"], "repos": {"a": {}}}`,
+				"conf.d/ignored.txt": `not JSON`,
+			},
+			want: `{"gitea_url": "https://b.example.com", "groups": ["b"], "repos": {"a": {}}}`,
+		},
+		{
+			name:  "glob without matches",
+			files: map[string]string{"config.json": `{"includes": ["conf.d/*.json"], "repos": {}}`},
+			want:  `{"repos": {}}`,
+		},
+		{
+			name:    "missing file",
+			files:   map[string]string{"config.json": `{"includes": ["missing.json"]}`},
+			wantErr: true,
+		},
+		{
+			name: "nested include",
+			files: map[string]string{
+				"config.json": `{"includes": ["shared.json"]}`,
+				"shared.json": `{"includes": ["other.json"]}`,
+				"other.json":  `{}`,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid fragment",
+			files: map[string]string{
+				"config.json": `{"includes": ["shared.json"]}`,
+				"shared.json": `["not an object"]`,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data, err := Merged(filepath.Join(dir, "config.json"))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Merged = %s, want an error", data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merged: %v", err)
+			}
+
+			var got, want interface{}
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Merged returned invalid JSON %s: %v", data, err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Merged = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergedKeepsNumbers(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"includes": ["shared.json"]}`), 0644)
+	os.WriteFile(filepath.Join(dir, "shared.json"), []byte(`{"rate_limit": 12345678901234567890}`), 0644)
+
+	data, err := Merged(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatalf("Merged: %v", err)
+	}
+	if !strings.Contains(string(data), "12345678901234567890") {
+		t.Errorf("Merged = %s, want the number as written", data)
+	}
+}
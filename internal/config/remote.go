@@ -0,0 +1,225 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RemoteTTL is how long a fetched remote include is used before it is
+// fetched again
+var RemoteTTL = 15 * time.Minute
+
+// HTTPClient fetches includes from https:// URLs
+var HTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// CacheHitFunc, if set, is told about remote includes read from their
+// cached copy without asking the source
+var CacheHitFunc func(format string, args ...interface{})
+
+// IsRemote reports whether a configuration file or include is a URL rather
+// than a file: http:// and https:// URLs, and git+ URLs of a file in a git
+// repository such as git+https://git.example.com/platform/config.git//gitea-release.json?ref=main
+func IsRemote(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "git+")
+}
+
+// secureSchemes are the remote sources configuration is taken from. Anyone
+// on the path of a plain http:// or git:// fetch could add repositories or
+// health check commands, which are run by the shell.
+var secureSchemes = []string{"https://", "git+https://", "git+ssh://"}
+
+// checkSecure fails for remote sources fetched without TLS or SSH
+func checkSecure(source string) error {
+	for _, scheme := range secureSchemes {
+		if strings.HasPrefix(source, scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not fetched securely, use an https://, git+https:// or git+ssh:// URL", source)
+}
+
+// fetchRemote returns the path of a cached copy of a remote include,
+// fetching it again once it is older than RemoteTTL, or always with force.
+// When the source cannot be reached an existing copy is used with a warning,
+// unless force is set.
+func fetchRemote(source string, force bool) (string, error) {
+	if err := checkSecure(source); err != nil {
+		return "", err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the cache directory for %s: %v", source, err)
+	}
+	sum := sha256.Sum256([]byte(source))
+	cachePath := filepath.Join(cacheDir, "gitea-release", "includes", hex.EncodeToString(sum[:8]))
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return "", fmt.Errorf("error creating cache directory: %v", err)
+	}
+
+	fetch, cached := fetchHTTP, cachePath+".json"
+	if strings.HasPrefix(source, "git+") {
+		repoURL, file, ref, err := parseGitSource(source)
+		if err != nil {
+			return "", err
+		}
+		fetch = func(source, cachePath string) error { return fetchGit(repoURL, ref, cachePath) }
+		cached = filepath.Join(cachePath, filepath.FromSlash(file))
+	}
+
+	// The marker's time is when the source was last fetched
+	marker := cachePath + ".fetched"
+	if info, err := os.Stat(marker); err == nil && !force && time.Since(info.ModTime()) < RemoteTTL {
+		if _, err := os.Stat(cached); err == nil {
+			if CacheHitFunc != nil {
+				CacheHitFunc("include %s", source)
+			}
+			return cached, nil
+		}
+	}
+
+	if err := fetch(source, cachePath); err != nil {
+		info, statErr := os.Stat(marker)
+		if _, cacheErr := os.Stat(cached); force || statErr != nil || cacheErr != nil {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v, using the copy fetched %s\n", err, info.ModTime().Format(time.RFC3339))
+		return cached, nil
+	}
+	if _, err := os.Stat(cached); err != nil {
+		return "", fmt.Errorf("included file %s does not exist", source)
+	}
+	if err := os.WriteFile(marker, nil, 0600); err != nil {
+		return "", fmt.Errorf("error writing cache: %v", err)
+	}
+	return cached, nil
+}
+
+// fetchHTTP downloads source to cachePath.json, sending the ETag of the
+// cached copy so an unchanged file is not transferred again
+func fetchHTTP(source, cachePath string) error {
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return fmt.Errorf("invalid include URL %s: %v", source, err)
+	}
+	etagPath := cachePath + ".etag"
+	if etag, err := os.ReadFile(etagPath); err == nil {
+		if _, err := os.Stat(cachePath + ".json"); err == nil {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %v", source, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("error fetching %s: %s", source, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %v", source, err)
+	}
+	// Keep the last good copy rather than caching an error page
+	if !json.Valid(data) {
+		return fmt.Errorf("error fetching %s: the response is not JSON", source)
+	}
+	if err := writeAtomic(cachePath+".json", data); err != nil {
+		return err
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		return os.WriteFile(etagPath, []byte(etag), 0600)
+	}
+	os.Remove(etagPath)
+	return nil
+}
+
+// parseGitSource splits git+<repository>//<file>?ref=<ref> into its parts.
+// Without a ref the default branch is used.
+func parseGitSource(source string) (repoURL, file, ref string, err error) {
+	rest := strings.TrimPrefix(source, "git+")
+	if i := strings.LastIndex(rest, "?ref="); i >= 0 {
+		rest, ref = rest[:i], rest[i+len("?ref="):]
+	}
+
+	// The file follows the first // after the scheme
+	start := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(rest[start:], "//")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("invalid include %s, use git+<repository>//<file>[?ref=<branch or tag>]", source)
+	}
+	repoURL, file = rest[:start+i], rest[start+i+2:]
+
+	if file == "" || filepath.IsAbs(file) || strings.HasPrefix(filepath.Clean(filepath.FromSlash(file)), "..") {
+		return "", "", "", fmt.Errorf("invalid file %q in include %s", file, source)
+	}
+	return repoURL, file, ref, nil
+}
+
+// fetchGit clones the repository into dir, or updates the clone, with a
+// shallow fetch of ref
+func fetchGit(repoURL, ref, dir string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git is needed for the include %s", repoURL)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		os.RemoveAll(dir)
+		args := []string{"clone", "--quiet", "--depth", "1"}
+		if ref != "" {
+			args = append(args, "--branch", ref)
+		}
+		return runGit(repoURL, append(args, "--", repoURL, dir)...)
+	}
+
+	target := ref
+	if target == "" {
+		target = "HEAD"
+	}
+	if err := runGit(repoURL, "-C", dir, "fetch", "--quiet", "--depth", "1", "origin", target); err != nil {
+		return err
+	}
+	return runGit(repoURL, "-C", dir, "checkout", "--quiet", "--force", "FETCH_HEAD")
+}
+
+// runGit runs git without prompting for credentials, which would hang
+// commands run from cron or services
+func runGit(repoURL string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error fetching %s: %v: %s", repoURL, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// writeAtomic replaces filename with data, so readers never see a partial file
+func writeAtomic(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing cache: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseGitSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		wantRepo string
+		wantFile string
+		wantRef  string
+		wantErr  bool
+	}{
+		{
+			source:   "git+https://git.example.com/platform/config.git//gitea-release.json?ref=main",
+			wantRepo: "https://git.example.com/platform/config.git",
+			wantFile: "gitea-release.json",
+			wantRef:  "main",
+		},
+		{
+			source:   "git+ssh://git@git.example.com/platform/config.git//gitea-release/repos.json",
+			wantRepo: "ssh://git@git.example.com/platform/config.git",
+			wantFile: "gitea-release/repos.json",
+		},
+		{source: "git+https://git.example.com/platform/config.git", wantErr: true},
+		{source: "git+https://git.example.com/platform/config.git//", wantErr: true},
+		{source: "git+https://git.example.com/platform/config.git//../secrets.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			repo, file, ref, err := parseGitSource(tt.source)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseGitSource = %q, %q, %q, want an error", repo, file, ref)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseGitSource: %v", err)
+			}
+			if repo != tt.wantRepo || file != tt.wantFile || ref != tt.wantRef {
+				t.Errorf("parseGitSource = %q, %q, %q, want %q, %q, %q", repo, file, ref, tt.wantRepo, tt.wantFile, tt.wantRef)
+			}
+		})
+	}
+}
+
+func TestCheckSecure(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{"https://platform.example.com/gitea-release.json", false},
+		{"git+https://git.example.com/config.git//gitea-release.json", false},
+		{"git+ssh://git@git.example.com/config.git//gitea-release.json", false},
+		{"http://platform.example.com/gitea-release.json", true},
+		{"git+http://git.example.com/config.git//gitea-release.json", true},
+		{"git+git://git.example.com/config.git//gitea-release.json", true},
+		{"git+file:///srv/config.git//gitea-release.json", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if err := checkSecure(tt.source); (err != nil) != tt.wantErr {
+				t.Errorf("checkSecure = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMergedRemote(t *testing.T) {
+	files := map[string]string{
+		"/main.json":     `{"includes": ["{url}/shared.json"], "gitea_url": "https://gitea.example.com"}`,
+		"/shared.json":   `{"gitea_url": "https://shared.example.com", "repos": {"app": {"owner": "platform", "name": "app"}}}`,
+		"/relative.json": `{"includes": ["local.json"]}`,
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(strings.ReplaceAll(data, "{url}", "https://"+r.Host)))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", dir)
+	client := HTTPClient
+	HTTPClient = srv.Client()
+	defer func() { HTTPClient = client }()
+
+	data, err := Merged(srv.URL + "/main.json")
+	if err != nil {
+		t.Fatalf("Merged: %v", err)
+	}
+	var merged Config
+	if err := json.Unmarshal(data, &merged); err != nil {
+		t.Fatal(err)
+	}
+	if merged.GiteaURL != "https://gitea.example.com" || merged.Repos["app"].Owner != "platform" {
+		t.Errorf("Merged = %s", data)
+	}
+
+	if _, err := Merged(srv.URL + "/relative.json"); err == nil {
+		t.Error("Merged of a remote file with a local include succeeded, want an error")
+	}
+	if _, err := Merged(strings.Replace(srv.URL, "https://", "http://", 1) + "/main.json"); err == nil {
+		t.Error("Merged of an http:// URL succeeded, want an error")
+	}
+	if _, err := LoadFile(srv.URL + "/main.json"); err == nil {
+		t.Error("LoadFile of a remote file succeeded, want an error")
+	}
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/earentir/gitea-release/internal/notify"
+)
+
+// Encrypted tokens are stored as encryptedPrefix followed by the base64
+// encoding of salt, nonce and AES-256-GCM ciphertext
+const (
+	encryptedPrefix = "enc:v1:"
+	saltSize        = 16
+	keyIterations   = 600000
+)
+
+// PassphraseFunc returns the passphrase used to decrypt tokens. It is only
+// called when an encrypted token is actually needed.
+var PassphraseFunc func() (string, error)
+
+// ErrNoPassphrase is returned when an encrypted token is used but no
+// passphrase is available
+var ErrNoPassphrase = errors.New("no passphrase available to decrypt the token")
+
+// Deriving a key is deliberately slow, so keys are cached per salt
+var (
+	keyCacheMu sync.Mutex
+	keyCache   = make(map[string][]byte)
+)
+
+// IsEncrypted reports whether a token value is encrypted
+func IsEncrypted(token string) bool {
+	return strings.HasPrefix(token, encryptedPrefix)
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	keyCacheMu.Lock()
+	defer keyCacheMu.Unlock()
+
+	cacheKey := passphrase + "\x00" + string(salt)
+	if key, ok := keyCache[cacheKey]; ok {
+		return key, nil
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, keyIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	keyCache[cacheKey] = key
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealer encrypts tokens that share one salt, so a whole config file only
+// needs a single key derivation
+type sealer struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+func newSealer(passphrase string) (*sealer, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{salt: salt, aead: aead}, nil
+}
+
+func (s *sealer) seal(token string) (string, error) {
+	if token == "" || IsEncrypted(token) {
+		return token, nil
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	data := append(append([]byte{}, s.salt...), nonce...)
+	data = s.aead.Seal(data, nonce, []byte(token), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// DecryptToken decrypts a token with the passphrase, plaintext tokens are
+// returned unchanged
+func DecryptToken(token, passphrase string) (string, error) {
+	if !IsEncrypted(token) {
+		return token, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(token, encryptedPrefix))
+	if err != nil || len(data) < saltSize {
+		return "", fmt.Errorf("malformed encrypted token")
+	}
+
+	key, err := deriveKey(passphrase, data[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	data = data[saltSize:]
+	if len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted token")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("wrong passphrase or corrupted token")
+	}
+	return string(plaintext), nil
+}
+
+// reveal decrypts token if it is encrypted, asking PassphraseFunc for the
+// passphrase
+func reveal(token string) (string, error) {
+	if !IsEncrypted(token) {
+		return token, nil
+	}
+	if PassphraseFunc == nil {
+		return "", ErrNoPassphrase
+	}
+
+	passphrase, err := PassphraseFunc()
+	if err != nil {
+		return "", err
+	}
+	return DecryptToken(token, passphrase)
+}
+
+// mapTokens replaces every non-empty token in the configuration, API tokens
+// as well as notifier tokens and passwords, with the result of fn and
+// returns how many tokens fn changed
+func (c *Config) mapTokens(fn func(string) (string, error)) (int, error) {
+	changed := 0
+	apply := func(token string) (string, error) {
+		if token == "" {
+			return token, nil
+		}
+		mapped, err := fn(token)
+		if err != nil {
+			return "", err
+		}
+		if mapped != token {
+			changed++
+		}
+		return mapped, nil
+	}
+
+	token, err := apply(c.Token)
+	if err != nil {
+		return changed, fmt.Errorf("token: %v", err)
+	}
+	c.Token = token
+
+	for url, token := range c.Tokens {
+		if token, err = apply(token); err != nil {
+			return changed, fmt.Errorf("tokens.%s: %v", url, err)
+		}
+		c.Tokens[url] = token
+	}
+
+	for name, profile := range c.Profiles {
+		if profile.Token, err = apply(profile.Token); err != nil {
+			return changed, fmt.Errorf("profiles.%s.token: %v", name, err)
+		}
+		c.Profiles[name] = profile
+	}
+
+	for alias, repo := range c.Repos {
+		if repo.Token, err = apply(repo.Token); err != nil {
+			return changed, fmt.Errorf("repos.%s.token: %v", alias, err)
+		}
+		if repo.Notify != nil {
+			targets := make([]notify.Target, len(repo.Notify))
+			for i, target := range repo.Notify {
+				if target.Token, err = apply(target.Token); err != nil {
+					return changed, fmt.Errorf("repos.%s.notify[%d].token: %v", alias, i, err)
+				}
+				if target.Password, err = apply(target.Password); err != nil {
+					return changed, fmt.Errorf("repos.%s.notify[%d].password: %v", alias, i, err)
+				}
+				targets[i] = target
+			}
+			repo.Notify = targets
+		}
+		c.Repos[alias] = repo
+	}
+
+	return changed, nil
+}
+
+// RevealTarget returns the notifier with its token and password decrypted,
+// asking PassphraseFunc for the passphrase if either is encrypted
+func RevealTarget(target notify.Target) (notify.Target, error) {
+	var err error
+	if target.Token, err = reveal(target.Token); err != nil {
+		return target, err
+	}
+	if target.Password, err = reveal(target.Password); err != nil {
+		return target, err
+	}
+	return target, nil
+}
+
+// EncryptTokens encrypts every plaintext token with the passphrase and
+// returns how many tokens were encrypted
+func (c *Config) EncryptTokens(passphrase string) (int, error) {
+	s, err := newSealer(passphrase)
+	if err != nil {
+		return 0, fmt.Errorf("error preparing encryption: %v", err)
+	}
+	return c.mapTokens(s.seal)
+}
+
+// DecryptTokens decrypts every encrypted token with the passphrase and
+// returns how many tokens were decrypted
+func (c *Config) DecryptTokens(passphrase string) (int, error) {
+	return c.mapTokens(func(token string) (string, error) {
+		return DecryptToken(token, passphrase)
+	})
+}
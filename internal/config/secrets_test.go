@@ -0,0 +1,122 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/earentir/gitea-release/internal/notify"
+)
+
+// secretConfig has a token in every place tokens are kept
+func secretConfig() *Config {
+	return &Config{
+		GiteaURL: "https://gitea.example.com",
+		Token:    "default",
+		Tokens:   map[string]string{"https://gitea.example.com": "instance"},
+		Profiles: map[string]Profile{"staging": {Token: "staging"}},
+		Repos: map[string]RepoDetails{
+			"app": {Owner: "owner", Name: "app", Token: "repo", Notify: []notify.Target{{Type: "ntfy", Token: "ntfy"}, {Type: "email", Password: "smtp"}}},
+			"lib": {Owner: "owner", Name: "lib"},
+		},
+	}
+}
+
+func TestEncryptTokens(t *testing.T) {
+	cfg := secretConfig()
+	count, err := cfg.EncryptTokens("passphrase")
+	if err != nil {
+		t.Fatalf("EncryptTokens: %v", err)
+	}
+	if count != 6 {
+		t.Errorf("EncryptTokens encrypted %d tokens, want 6", count)
+	}
+
+	encrypted := map[string]string{
+		"token":                      cfg.Token,
+		"tokens":                     cfg.Tokens["https://gitea.example.com"],
+		"profiles.staging.token":     cfg.Profiles["staging"].Token,
+		"repos.app.token":            cfg.Repos["app"].Token,
+		"repos.app.notify[0].token":  cfg.Repos["app"].Notify[0].Token,
+		"repos.app.notify[1].secret": cfg.Repos["app"].Notify[1].Password,
+	}
+	for field, token := range encrypted {
+		if !IsEncrypted(token) {
+			t.Errorf("%s = %q after EncryptTokens", field, token)
+		}
+	}
+	if cfg.Repos["lib"].Token != "" {
+		t.Errorf("an empty token became %q", cfg.Repos["lib"].Token)
+	}
+
+	// Encrypted tokens are left alone
+	if count, err := cfg.EncryptTokens("passphrase"); err != nil || count != 0 {
+		t.Errorf("EncryptTokens again = %d, %v, want 0, nil", count, err)
+	}
+
+	if _, err := cfg.DecryptTokens("wrong"); err == nil {
+		t.Error("DecryptTokens with the wrong passphrase succeeded")
+	}
+	count, err = cfg.DecryptTokens("passphrase")
+	if err != nil {
+		t.Fatalf("DecryptTokens: %v", err)
+	}
+	if count != 6 {
+		t.Errorf("DecryptTokens decrypted %d tokens, want 6", count)
+	}
+	want := secretConfig()
+	if cfg.Token != want.Token || cfg.Repos["app"].Notify[1].Password != "smtp" || cfg.Profiles["staging"].Token != "staging" {
+		t.Errorf("decrypted tokens differ from the originals: %+v", cfg)
+	}
+}
+
+func TestTokenFor(t *testing.T) {
+	cfg := secretConfig()
+	if _, err := cfg.EncryptTokens("passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	delete(cfg.Tokens, "https://gitea.example.com")
+
+	tests := []struct {
+		name       string
+		passphrase func() (string, error)
+		alias      string
+		want       string
+		wantErr    string
+	}{
+		{name: "repository token", passphrase: func() (string, error) { return "passphrase", nil }, alias: "app", want: "repo"},
+		{name: "default token", passphrase: func() (string, error) { return "passphrase", nil }, alias: "lib", want: "default"},
+		{name: "no passphrase", alias: "app", wantErr: ErrNoPassphrase.Error()},
+		{name: "wrong passphrase", passphrase: func() (string, error) { return "wrong", nil }, alias: "app", wantErr: "wrong passphrase or corrupted token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PassphraseFunc = tt.passphrase
+			defer func() { PassphraseFunc = nil }()
+
+			got, err := cfg.TokenFor(tt.alias)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("TokenFor(%s) = %q, %v, want error %v", tt.alias, got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TokenFor(%s): %v", tt.alias, err)
+			}
+			if got != tt.want {
+				t.Errorf("TokenFor(%s) = %q, want %q", tt.alias, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecryptTokenMalformed(t *testing.T) {
+	tests := []string{"enc:v1:not base64!", "enc:v1:c2hvcnQ=", "enc:v1:" + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}
+	for _, token := range tests {
+		if _, err := DecryptToken(token, "passphrase"); err == nil {
+			t.Errorf("DecryptToken(%q) succeeded", token)
+		}
+	}
+	if got, err := DecryptToken("plain", "passphrase"); err != nil || got != "plain" {
+		t.Errorf("DecryptToken of a plaintext token = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Validate checks raw configuration data and returns every problem found,
+// rather than stopping at the first one like Load does
+func Validate(data []byte) []string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return []string{fmt.Sprintf("invalid JSON: %v", err)}
+	}
+
+	var problems []string
+	problems = append(problems, unknownFields("", fields, reflect.TypeOf(Config{}))...)
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return append(problems, fmt.Sprintf("invalid value: %v", err))
+	}
+
+	if cfg.GiteaURL == "" {
+		problems = append(problems, "gitea_url: missing")
+	} else if u, err := url.Parse(cfg.GiteaURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("gitea_url: %q is not an absolute URL", cfg.GiteaURL))
+	}
+
+	if profiles, ok := fields["profiles"]; ok {
+		var rawProfiles map[string]json.RawMessage
+		if err := json.Unmarshal(profiles, &rawProfiles); err == nil {
+			names := make([]string, 0, len(rawProfiles))
+			for name := range rawProfiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				var profileFields map[string]json.RawMessage
+				if err := json.Unmarshal(rawProfiles[name], &profileFields); err != nil {
+					problems = append(problems, fmt.Sprintf("profiles.%s: %v", name, err))
+					continue
+				}
+				problems = append(problems, unknownFields("profiles."+name+".", profileFields, reflect.TypeOf(Profile{}))...)
+
+				if profileURL := cfg.Profiles[name].GiteaURL; profileURL != "" {
+					if u, err := url.Parse(profileURL); err != nil || u.Scheme == "" || u.Host == "" {
+						problems = append(problems, fmt.Sprintf("profiles.%s.gitea_url: %q is not an absolute URL", name, profileURL))
+					}
+				}
+			}
+		}
+	}
+
+	problems = append(problems, channelProblems("channels", cfg.Channels)...)
+
+	repos, ok := fields["repos"]
+	if !ok || bytes.Equal(bytes.TrimSpace(repos), []byte("null")) {
+		return append(problems, "repos: missing")
+	}
+
+	members, err := objectMembers(repos)
+	if err != nil {
+		return append(problems, fmt.Sprintf("repos: %v", err))
+	}
+
+	// Check every repository in file order, including duplicates that
+	// json.Unmarshal would silently merge
+	seen := make(map[string]bool)
+	for _, member := range members {
+		alias := member.key
+		if seen[alias] {
+			problems = append(problems, fmt.Sprintf("repos.%s: duplicate alias", alias))
+		}
+		seen[alias] = true
+
+		var repoFields map[string]json.RawMessage
+		var repo RepoDetails
+		if err := json.Unmarshal(member.value, &repoFields); err != nil {
+			problems = append(problems, fmt.Sprintf("repos.%s: %v", alias, err))
+			continue
+		}
+		if err := json.Unmarshal(member.value, &repo); err != nil {
+			problems = append(problems, fmt.Sprintf("repos.%s: %v", alias, err))
+			continue
+		}
+		problems = append(problems, unknownFields("repos."+alias+".", repoFields, reflect.TypeOf(RepoDetails{}))...)
+
+		if repo.Owner == "" {
+			problems = append(problems, fmt.Sprintf("repos.%s: missing owner", alias))
+		}
+		if repo.Name == "" {
+			problems = append(problems, fmt.Sprintf("repos.%s: missing name", alias))
+		}
+		problems = append(problems, channelProblems("repos."+alias+".channels", repo.Channels)...)
+		_, named := repo.Channels[repo.Channel]
+		if _, shared := cfg.Channels[repo.Channel]; repo.Channel != "" && repo.Channel != "stable" && repo.Channel != "latest" && !named && !shared {
+			problems = append(problems, fmt.Sprintf("repos.%s.channel: %q is not stable, latest or a defined channel", alias, repo.Channel))
+		}
+		if p := repo.Provenance; p != nil {
+			if p.BuilderID == "" {
+				problems = append(problems, fmt.Sprintf("repos.%s.provenance: missing builder_id", alias))
+			}
+			if p.SourceURI == "" {
+				problems = append(problems, fmt.Sprintf("repos.%s.provenance: missing source_uri", alias))
+			}
+		}
+		for i, target := range repo.Notify {
+			if err := target.Validate(); err != nil {
+				problems = append(problems, fmt.Sprintf("repos.%s.notify[%d]: %v", alias, i, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// channelProblems reports channel names that could not be used as
+// alias@channel and patterns that are not valid regular expressions
+func channelProblems(prefix string, channels map[string]string) []string {
+	var problems []string
+	for name, pattern := range channels {
+		if name == "" || strings.Contains(name, "@") {
+			problems = append(problems, fmt.Sprintf("%s: invalid channel name %q", prefix, name))
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems = append(problems, fmt.Sprintf("%s.%s: %v", prefix, name, err))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// unknownFields reports the keys in fields that have no matching JSON tag in t
+func unknownFields(prefix string, fields map[string]json.RawMessage, t reflect.Type) []string {
+	known := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		known[name] = true
+	}
+
+	var unknown []string
+	for key := range fields {
+		if !known[key] {
+			unknown = append(unknown, fmt.Sprintf("%s%s: unknown field", prefix, key))
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+type objectMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// objectMembers returns the members of a JSON object in order
+func objectMembers(data []byte) ([]objectMember, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("expected an object")
+	}
+
+	var members []objectMember
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		member := objectMember{key: token.(string)}
+		if err := decoder.Decode(&member.value); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "valid",
+			data: `{"gitea_url": "https://gitea.example.com", "repos": {"app": {"owner": "owner", "name": "app", "channel": "beta", "channels": {"beta": "-beta"}}}}`,
+		},
+		{
+			name: "not JSON",
+			data: `{"gitea_url": `,
+			want: []string{"invalid JSON: unexpected end of JSON input"},
+		},
+		{
+			name: "missing settings",
+			data: `{}`,
+			want: []string{"gitea_url: missing", "repos: missing"},
+		},
+		{
+			name: "unknown fields",
+			data: `{"gitea_url": "https://gitea.example.com", "gitea": "x", "repos": {"app": {"owner": "owner", "name": "app", "tag": "v1"}}}`,
+			want: []string{"gitea: unknown field", "repos.app.tag: unknown field"},
+		},
+		{
+			name: "relative URL",
+			data: `{"gitea_url": "gitea.example.com", "profiles": {"old": {"gitea_url": "/gitea"}}, "repos": {}}`,
+			want: []string{`gitea_url: "gitea.example.com" is not an absolute URL`, `profiles.old.gitea_url: "/gitea" is not an absolute URL`},
+		},
+		{
+			name: "duplicate alias",
+			data: `{"gitea_url": "https://gitea.example.com", "repos": {"app": {"owner": "a", "name": "app"}, "app": {"owner": "b", "name": "app"}}}`,
+			want: []string{"repos.app: duplicate alias"},
+		},
+		{
+			name: "incomplete repository",
+			data: `{"gitea_url": "https://gitea.example.com", "repos": {"app": {"channel": "nightly"}}}`,
+			want: []string{"repos.app: missing owner", "repos.app: missing name", `repos.app.channel: "nightly" is not stable, latest or a defined channel`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Validate([]byte(tt.data))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateWrongType(t *testing.T) {
+	got := Validate([]byte(`{"gitea_url": "https://gitea.example.com", "repos": {"app": {"owner": 1, "name": "app"}}}`))
+	if len(got) != 1 || !strings.HasPrefix(got[0], "invalid value: ") {
+		t.Errorf("Validate = %q, want one invalid value", got)
+	}
+}
@@ -0,0 +1,212 @@
+// Package cosign verifies release assets signed keylessly with cosign
+// against the Sigstore public good instance or a supplied trusted root
+package cosign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sigstore/sigstore-go/pkg/bundle"
+	"github.com/sigstore/sigstore-go/pkg/fulcio/certificate"
+	"github.com/sigstore/sigstore-go/pkg/root"
+	"github.com/sigstore/sigstore-go/pkg/verify"
+	"github.com/sigstore/sigstore/pkg/signature"
+)
+
+// Policy is the identity a signing certificate must match. Exact values and
+// regular expressions are alternatives, one of each pair must be set.
+type Policy struct {
+	Identity       string // Expected subject alternative name, e.g. a CI workflow URL
+	IdentityRegexp string
+	Issuer         string // Expected OIDC issuer, e.g. https://token.actions.githubusercontent.com
+	IssuerRegexp   string
+
+	TrustedRoot string // Path to a trusted_root.json, fetched through TUF when empty
+}
+
+func (p Policy) certificateIdentity() (verify.CertificateIdentity, error) {
+	if p.Identity == "" && p.IdentityRegexp == "" {
+		return verify.CertificateIdentity{}, fmt.Errorf("a certificate identity is required")
+	}
+	if p.Issuer == "" && p.IssuerRegexp == "" {
+		return verify.CertificateIdentity{}, fmt.Errorf("a certificate OIDC issuer is required")
+	}
+	return verify.NewShortCertificateIdentity(p.Issuer, p.IssuerRegexp, p.Identity, p.IdentityRegexp)
+}
+
+func (p Policy) trustedRoot() (*root.TrustedRoot, error) {
+	if p.TrustedRoot != "" {
+		trustedRoot, err := root.NewTrustedRootFromPath(p.TrustedRoot)
+		if err != nil {
+			return nil, fmt.Errorf("error loading trusted root: %v", err)
+		}
+		return trustedRoot, nil
+	}
+
+	trustedRoot, err := root.FetchTrustedRoot()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching Sigstore trusted root: %v", err)
+	}
+	return trustedRoot, nil
+}
+
+// VerifyBundle verifies the file at artifactPath with a Sigstore bundle, as
+// written by cosign sign-blob --bundle. This checks the certificate chain,
+// the signer identity, the signature and the transparency log entry.
+func VerifyBundle(artifactPath string, bundleJSON []byte, policy Policy) error {
+	_, err := verifyBundle(artifactPath, bundleJSON, policy)
+	return err
+}
+
+// VerifyAttestation verifies the file at artifactPath with a Sigstore bundle
+// holding a signed in-toto attestation about it, as written by cosign
+// attest-blob --bundle or GitHub's attest actions, and returns the in-toto
+// statement. Besides what VerifyBundle checks, the artifact's digest must
+// be one of the statement's subjects.
+func VerifyAttestation(artifactPath string, bundleJSON []byte, policy Policy) ([]byte, error) {
+	b, err := verifyBundle(artifactPath, bundleJSON, policy)
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := b.Envelope()
+	if err != nil {
+		return nil, fmt.Errorf("bundle holds no attestation: %v", err)
+	}
+	if envelope.PayloadType != bundle.IntotoMediaType {
+		return nil, fmt.Errorf("attestation has payload type %s, not in-toto", envelope.PayloadType)
+	}
+	statement, err := envelope.DecodeB64Payload()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding attestation: %v", err)
+	}
+	return statement, nil
+}
+
+func verifyBundle(artifactPath string, bundleJSON []byte, policy Policy) (*bundle.Bundle, error) {
+	identity, err := policy.certificateIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bundle.Bundle
+	if err := b.UnmarshalJSON(bundleJSON); err != nil {
+		return nil, fmt.Errorf("error parsing bundle: %v", err)
+	}
+
+	trustedRoot, err := policy.trustedRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := verify.NewVerifier(trustedRoot,
+		verify.WithSignedCertificateTimestamps(1),
+		verify.WithTransparencyLog(1),
+		verify.WithObserverTimestamps(1))
+	if err != nil {
+		return nil, fmt.Errorf("error creating verifier: %v", err)
+	}
+
+	artifact, err := os.Open(artifactPath)
+	if err != nil {
+		return nil, err
+	}
+	defer artifact.Close()
+
+	_, err = verifier.Verify(&b, verify.NewPolicy(verify.WithArtifact(artifact), verify.WithCertificateIdentity(identity)))
+	if err != nil {
+		return nil, fmt.Errorf("signature verification failed: %v", err)
+	}
+	return &b, nil
+}
+
+// VerifySignature verifies the file at artifactPath with a detached
+// signature and signing certificate, as written by cosign sign-blob
+// --output-signature and --output-certificate. The certificate chain is
+// checked at the time the certificate was issued, but without a bundle
+// there is no transparency log entry to check.
+func VerifySignature(artifactPath string, sig, cert []byte, policy Policy) error {
+	identity, err := policy.certificateIdentity()
+	if err != nil {
+		return err
+	}
+
+	leaf, err := parseCertificate(cert)
+	if err != nil {
+		return err
+	}
+
+	trustedRoot, err := policy.trustedRoot()
+	if err != nil {
+		return err
+	}
+
+	var chainErr error
+	trusted := false
+	for _, ca := range trustedRoot.FulcioCertificateAuthorities() {
+		if _, chainErr = ca.Verify(leaf, leaf.NotBefore); chainErr == nil {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("signing certificate is not issued by a trusted Fulcio CA: %v", chainErr)
+	}
+
+	summary, err := certificate.SummarizeCertificate(leaf)
+	if err != nil {
+		return fmt.Errorf("error reading signing certificate: %v", err)
+	}
+	if err := identity.Verify(summary); err != nil {
+		return fmt.Errorf("signing certificate does not match: %v", err)
+	}
+
+	rawSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("error decoding signature: %v", err)
+	}
+
+	verifier, err := signature.LoadVerifier(leaf.PublicKey, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("error loading certificate key: %v", err)
+	}
+
+	artifact, err := os.Open(artifactPath)
+	if err != nil {
+		return err
+	}
+	defer artifact.Close()
+
+	if err := verifier.VerifySignature(bytes.NewReader(rawSig), artifact); err != nil {
+		return fmt.Errorf("signature verification failed: %v", err)
+	}
+	return nil
+}
+
+// parseCertificate accepts a PEM certificate, optionally base64 encoded as
+// some cosign versions write it
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding certificate: %v", err)
+		}
+		data = decoded
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("error decoding certificate: no PEM data")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %v", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,164 @@
+// Package delta applies binary patches in the bsdiff 4 format, so an
+// installed asset can be brought up to a new release by downloading only
+// the difference
+package delta
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// PatchSuffixes are the extensions of patch assets. A patch that turns the
+// asset of release v1.2.0 into the one of the release it is attached to is
+// named <asset>.v1.2.0.patch or <asset>.v1.2.0.bsdiff.
+var PatchSuffixes = []string{".patch", ".bsdiff"}
+
+// PatchNames returns the asset names a patch from fromTag to asset may have
+func PatchNames(asset, fromTag string) []string {
+	names := make([]string, 0, len(PatchSuffixes))
+	for _, suffix := range PatchSuffixes {
+		names = append(names, asset+"."+fromTag+suffix)
+	}
+	return names
+}
+
+const headerSize = 32
+
+// errCorrupt reports a patch that does not match its own header
+var errCorrupt = errors.New("corrupt patch")
+
+// Apply writes the result of applying the bsdiff patch at patchPath to the
+// file at oldPath to newPath. The old file is read in place rather than
+// loaded, so large assets need little memory.
+func Apply(oldPath, patchPath, newPath string) error {
+	patch, err := os.Open(patchPath)
+	if err != nil {
+		return err
+	}
+	defer patch.Close()
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(patch, header); err != nil {
+		return fmt.Errorf("error reading patch: %v", err)
+	}
+	if string(header[:8]) != "BSDIFF40" {
+		return fmt.Errorf("not a bsdiff patch")
+	}
+	info, err := patch.Stat()
+	if err != nil {
+		return err
+	}
+	ctrlLen, diffLen, newSize := offtin(header[8:]), offtin(header[16:]), offtin(header[24:])
+	extraStart := headerSize + ctrlLen + diffLen
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || extraStart > info.Size() {
+		return errCorrupt
+	}
+
+	// The three blocks are compressed separately and read side by side
+	block := func(offset, length int64) io.Reader {
+		return bzip2.NewReader(io.NewSectionReader(patch, offset, length))
+	}
+	ctrl := block(headerSize, ctrlLen)
+	diff := bufio.NewReaderSize(block(headerSize+ctrlLen, diffLen), 64<<10)
+	extra := bufio.NewReaderSize(block(extraStart, info.Size()-extraStart), 64<<10)
+
+	old, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+	if info, err = old.Stat(); err != nil {
+		return err
+	}
+	oldSize := info.Size()
+
+	out, err := os.Create(newPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(out, 64<<10)
+
+	err = apply(old, oldSize, ctrl, diff, extra, w, newSize)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(newPath)
+		return fmt.Errorf("error applying patch: %v", err)
+	}
+	return nil
+}
+
+// apply runs the control triples of the patch: add diff bytes to old bytes,
+// copy extra bytes, then seek in the old file
+func apply(old io.ReaderAt, oldSize int64, ctrl, diff, extra io.Reader, w io.Writer, newSize int64) error {
+	triple := make([]byte, 24)
+	buf := make([]byte, 64<<10)
+	oldBuf := make([]byte, 64<<10)
+
+	var newPos, oldPos int64
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, triple); err != nil {
+			return fmt.Errorf("reading control block: %v", err)
+		}
+		add, copyLen, seek := offtin(triple), offtin(triple[8:]), offtin(triple[16:])
+		if add < 0 || copyLen < 0 || newPos+add+copyLen > newSize {
+			return errCorrupt
+		}
+
+		for remaining := add; remaining > 0; {
+			n := min(remaining, int64(len(buf)))
+			if _, err := io.ReadFull(diff, buf[:n]); err != nil {
+				return fmt.Errorf("reading diff block: %v", err)
+			}
+			if err := readOld(old, oldSize, oldPos, oldBuf[:n]); err != nil {
+				return err
+			}
+			for i := range n {
+				buf[i] += oldBuf[i]
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			remaining -= n
+			oldPos += n
+			newPos += n
+		}
+
+		if _, err := io.CopyN(w, extra, copyLen); err != nil {
+			return fmt.Errorf("reading extra block: %v", err)
+		}
+		newPos += copyLen
+		oldPos += seek
+	}
+	return nil
+}
+
+// readOld fills p with the old file from offset on, with zeros where that
+// lies outside the file, as bspatch does
+func readOld(old io.ReaderAt, oldSize, offset int64, p []byte) error {
+	clear(p)
+	start, end := max(offset, 0), min(offset+int64(len(p)), oldSize)
+	if start >= end {
+		return nil
+	}
+	_, err := old.ReadAt(p[start-offset:end-offset], start)
+	return err
+}
+
+// offtin decodes the sign and magnitude integers bsdiff uses
+func offtin(b []byte) int64 {
+	v := int64(binary.LittleEndian.Uint64(b) &^ (1 << 63))
+	if b[7]&0x80 != 0 {
+		return -v
+	}
+	return v
+}
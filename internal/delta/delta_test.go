@@ -0,0 +1,103 @@
+package delta
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The bzip2 compressed blocks of a patch from "The quick brown fox" to
+// "THE quick red fox!!": add 10 bytes, copy "red", skip "brown", then add
+// 4 bytes and copy "!!"
+const (
+	oldContent = "The quick brown fox"
+	newContent = "THE quick red fox!!"
+	ctrlBlock  = "425a6839314159265359506ba53a00000e40005e18200021847a82180c001b7544a2ebe2ee48a70a120a0d74a740"
+	diffBlock  = "425a683931415926535908690a1b000002400140804000200021981984e890bb9229c28480434850d8"
+	extraBlock = "425a683931415926535913eed8030000021180200006001000200030cd3419900e78bb9229c284809f76c018"
+)
+
+// buildPatch assembles the blocks into a patch claiming newSize bytes of
+// output
+func buildPatch(t *testing.T, magic string, newSize int64) []byte {
+	t.Helper()
+	var blocks [3][]byte
+	for i, block := range []string{ctrlBlock, diffBlock, extraBlock} {
+		data, err := hex.DecodeString(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blocks[i] = data
+	}
+
+	patch := []byte(magic)
+	patch = binary.LittleEndian.AppendUint64(patch, uint64(len(blocks[0])))
+	patch = binary.LittleEndian.AppendUint64(patch, uint64(len(blocks[1])))
+	patch = binary.LittleEndian.AppendUint64(patch, uint64(newSize))
+	for _, block := range blocks {
+		patch = append(patch, block...)
+	}
+	return patch
+}
+
+func TestApply(t *testing.T) {
+	valid := buildPatch(t, "BSDIFF40", int64(len(newContent)))
+	tests := []struct {
+		name    string
+		old     string
+		patch   []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "patch", old: oldContent, patch: valid, want: newContent},
+		{name: "shorter output", old: oldContent, patch: buildPatch(t, "BSDIFF40", 13), want: "THE quick red"},
+		{name: "old file shorter", old: "The quick", patch: valid, want: "THE quick\x00red\x00\x00\x00\x00!!"},
+		{name: "not a patch", old: oldContent, patch: buildPatch(t, "BSDIFF41", int64(len(newContent))), wantErr: true},
+		{name: "longer output", old: oldContent, patch: buildPatch(t, "BSDIFF40", 40), wantErr: true},
+		{name: "truncated header", old: oldContent, patch: valid[:20], wantErr: true},
+		{name: "truncated blocks", old: oldContent, patch: valid[:40], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			oldPath, patchPath, newPath := filepath.Join(dir, "old"), filepath.Join(dir, "patch"), filepath.Join(dir, "new")
+			if err := os.WriteFile(oldPath, []byte(tt.old), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(patchPath, tt.patch, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Apply(oldPath, patchPath, newPath)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Apply succeeded, want an error")
+				}
+				if _, err := os.Stat(newPath); err == nil {
+					t.Error("Apply left a partial file behind")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			got, err := os.ReadFile(newPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Apply wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchNames(t *testing.T) {
+	want := []string{"app.v1.2.0.patch", "app.v1.2.0.bsdiff"}
+	if got := PatchNames("app", "v1.2.0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("PatchNames = %q, want %q", got, want)
+	}
+}
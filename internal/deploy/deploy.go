@@ -0,0 +1,190 @@
+// Package deploy moves downloaded files into their deploy location
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Deploy strategies
+const (
+	StrategyOverwrite = "overwrite" // Replace the file in the deploy directory
+	StrategyVersioned = "versioned" // Install into releases/<tag>/ and switch a current symlink
+)
+
+// ValidStrategy reports whether strategy is a known deploy strategy
+func ValidStrategy(strategy string) bool {
+	return strategy == StrategyOverwrite || strategy == StrategyVersioned
+}
+
+// Destination returns where File deploys fileName with the given strategy
+func Destination(deployPath, fileName, tag, strategy string) string {
+	if strategy == StrategyVersioned {
+		return filepath.Join(deployPath, "releases", releaseDirName(tag), fileName)
+	}
+	return filepath.Join(deployPath, fileName)
+}
+
+// releaseDirName turns a tag into a directory name
+func releaseDirName(tag string) string {
+	return strings.ReplaceAll(tag, "/", "_")
+}
+
+// File moves tempPath into deployPath as fileName using the given strategy
+// and returns the final location of the file
+func File(tempPath, deployPath, fileName, tag, strategy string, keep int) (string, error) {
+	if !ValidStrategy(strategy) {
+		return "", fmt.Errorf("unsupported deploy strategy '%s', use %s or %s", strategy, StrategyOverwrite, StrategyVersioned)
+	}
+
+	if strategy == StrategyVersioned {
+		return Versioned(tempPath, deployPath, tag, fileName, keep)
+	}
+
+	finalPath := filepath.Join(deployPath, fileName)
+	if err := Move(tempPath, finalPath); err != nil {
+		return "", fmt.Errorf("error deploying file: %v", err)
+	}
+	return finalPath, nil
+}
+
+// Move renames src to dst, copying the file instead when they are on
+// different filesystems
+func Move(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// copyFile copies src to dst with the same permissions. The copy is made
+// next to dst first so dst is replaced atomically.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Versioned installs a file into <deployPath>/releases/<tag>/ and
+// atomically points the <deployPath>/current symlink at that directory,
+// keeping the newest keep releases for rollback
+func Versioned(tempPath, deployPath, tag, fileName string, keep int) (string, error) {
+	releasesDir := filepath.Join(deployPath, "releases")
+	releaseName := releaseDirName(tag)
+	releaseDir := filepath.Join(releasesDir, releaseName)
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		return "", fmt.Errorf("error creating release directory: %v", err)
+	}
+
+	finalPath := filepath.Join(releaseDir, fileName)
+	if err := Move(tempPath, finalPath); err != nil {
+		return "", fmt.Errorf("error deploying file: %v", err)
+	}
+
+	if err := switchLink(filepath.Join(deployPath, "current"), filepath.Join("releases", releaseName)); err != nil {
+		return "", err
+	}
+
+	if err := pruneReleases(releasesDir, releaseName, keep); err != nil {
+		return "", err
+	}
+
+	return finalPath, nil
+}
+
+// switchLink points link at target. The new link is created next to the old
+// one and renamed over the top, so link never points at a half-installed
+// release.
+func switchLink(link, target string) error {
+	tempLink := link + ".tmp"
+	os.Remove(tempLink)
+	if err := os.Symlink(target, tempLink); err != nil {
+		return fmt.Errorf("error creating %s symlink: %v", filepath.Base(link), err)
+	}
+	if err := os.Rename(tempLink, link); err != nil {
+		os.Remove(tempLink)
+		return fmt.Errorf("error switching %s symlink: %v", filepath.Base(link), err)
+	}
+	return nil
+}
+
+// pruneReleases removes the oldest release directories, never the current one
+func pruneReleases(releasesDir, current string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(releasesDir)
+	if err != nil {
+		return fmt.Errorf("error reading releases directory: %v", err)
+	}
+
+	type release struct {
+		name    string
+		modTime time.Time
+	}
+	var releases []release
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Name() == current {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		releases = append(releases, release{entry.Name(), info.ModTime()})
+	}
+
+	// The current release counts towards the number kept
+	if len(releases) < keep {
+		return nil
+	}
+
+	sort.Slice(releases, func(i, j int) bool {
+		return releases[i].modTime.After(releases[j].modTime)
+	})
+	for _, old := range releases[keep-1:] {
+		if err := os.RemoveAll(filepath.Join(releasesDir, old.name)); err != nil {
+			return fmt.Errorf("error removing old release %s: %v", old.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// ParseFileMode parses an octal file mode such as 0755
+func ParseFileMode(mode string) (os.FileMode, error) {
+	m, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || m > 0o7777 {
+		return 0, fmt.Errorf("invalid file mode '%s', expected an octal value such as 0755", mode)
+	}
+	return os.FileMode(m), nil
+}
+
+// lookupOwner resolves a user:group specification to numeric IDs.
+// Either part may be omitted or numeric, -1 leaves that ID unchanged.
+func lookupOwner(owner string) (int, int, error) {
+	uid, gid := -1, -1
+	userName, groupName, _ := strings.Cut(owner, ":")
+
+	if userName != "" {
+		id := userName
+		if _, err := strconv.Atoi(userName); err != nil {
+			u, err := user.Lookup(userName)
+			if err != nil {
+				return 0, 0, fmt.Errorf("error looking up user '%s': %v", userName, err)
+			}
+			id = u.Uid
+		}
+		uid, _ = strconv.Atoi(id)
+	}
+
+	if groupName != "" {
+		id := groupName
+		if _, err := strconv.Atoi(groupName); err != nil {
+			g, err := user.LookupGroup(groupName)
+			if err != nil {
+				return 0, 0, fmt.Errorf("error looking up group '%s': %v", groupName, err)
+			}
+			id = g.Gid
+		}
+		gid, _ = strconv.Atoi(id)
+	}
+
+	return uid, gid, nil
+}
+
+// SetPermissions applies the requested mode and ownership to a deployed file
+func SetPermissions(filePath, mode, owner string) error {
+	if mode != "" {
+		m, err := ParseFileMode(mode)
+		if err != nil {
+			return err
+		}
+		if err := os.Chmod(filePath, m); err != nil {
+			return fmt.Errorf("error setting file mode: %v", err)
+		}
+	}
+
+	if owner != "" {
+		uid, gid, err := lookupOwner(owner)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(filePath, uid, gid); err != nil {
+			if os.IsPermission(err) {
+				return fmt.Errorf("insufficient privileges to change owner of %s to %s", filePath, owner)
+			}
+			return fmt.Errorf("error setting file owner: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package deploy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot remembers what a deployment replaces so it can be rolled back
+type Snapshot struct {
+	path   string // Where the file is deployed
+	backup string // Copy of the file it replaces, empty if there was none
+	link   string // The current symlink of StrategyVersioned
+	target string // Where link pointed before, empty if it did not exist
+}
+
+// Checkpoint records the state of the deploy location of fileName before
+// File replaces it. Unless the snapshot is restored or discarded, a copy of
+// the old file stays next to it as <file>.rollback.
+func Checkpoint(deployPath, fileName, tag, strategy string) (*Snapshot, error) {
+	s := &Snapshot{path: Destination(deployPath, fileName, tag, strategy)}
+
+	if strategy == StrategyVersioned {
+		s.link = filepath.Join(deployPath, "current")
+		if target, err := os.Readlink(s.link); err == nil {
+			s.target = target
+		}
+	}
+
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("cannot back up %s, it is not a regular file", s.path)
+	}
+
+	// A hard link keeps the old file alive once it is renamed over
+	s.backup = s.path + ".rollback"
+	os.Remove(s.backup)
+	if err := os.Link(s.path, s.backup); err != nil {
+		if err := copyFile(s.path, s.backup); err != nil {
+			return nil, fmt.Errorf("error backing up %s: %v", s.path, err)
+		}
+	}
+	return s, nil
+}
+
+// Restore puts back what the deployment replaced
+func (s *Snapshot) Restore() error {
+	if s.backup != "" {
+		if err := os.Rename(s.backup, s.path); err != nil {
+			return fmt.Errorf("error restoring %s: %v", s.path, err)
+		}
+	} else if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %s: %v", s.path, err)
+	}
+
+	if s.link == "" {
+		return nil
+	}
+	if s.target == "" {
+		os.Remove(s.link)
+	} else if err := switchLink(s.link, s.target); err != nil {
+		return err
+	}
+	// Leave no empty directory behind for a release that was never installed
+	os.Remove(filepath.Dir(s.path))
+	return nil
+}
+
+// Discard drops the backup once the deployment is known to be good
+func (s *Snapshot) Discard() {
+	if s.backup != "" {
+		os.Remove(s.backup)
+	}
+}
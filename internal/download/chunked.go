@@ -0,0 +1,110 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// chunkedFile downloads url to filePath with opts.Chunks parallel range
+// requests written straight into place. It returns errNoRanges before
+// creating the file when the server ignores ranges.
+func chunkedFile(ctx context.Context, url, filePath string, opts Options) error {
+	label, size := opts.Label, opts.Size
+
+	// Probe with a one byte range, servers without range support send it all
+	probe, err := rangeRequest(ctx, opts.httpClient(), url, 0, 0)
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %w", label, err)
+	}
+	probe.Body.Close()
+	if probe.StatusCode != http.StatusPartialContent {
+		return errNoRanges
+	}
+	if !opts.ExpectHTML {
+		if mediaType, _, err := mime.ParseMediaType(probe.Header.Get("Content-Type")); err == nil && isHTML(mediaType) {
+			return fmt.Errorf("error downloading %s: %w (%s), authentication may be required", label, ErrHTMLPage, mediaType)
+		}
+	}
+
+	// The server knows the size better than the API
+	var total int64
+	if _, err := fmt.Sscanf(probe.Header.Get("Content-Range"), "bytes 0-0/%d", &total); err == nil && total > 0 {
+		size = total
+	}
+
+	out, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer out.Close()
+
+	if err := out.Truncate(size); err != nil {
+		out.Close()
+		os.Remove(filePath)
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+
+	bar := newProgress(opts, size)
+
+	chunkSize := (size + int64(opts.Chunks) - 1) / int64(opts.Chunks)
+	group, groupCtx := errgroup.WithContext(ctx)
+	for start := int64(0); start < size; start += chunkSize {
+		end := min(start+chunkSize, size) - 1
+		group.Go(func() error {
+			return fetchRange(groupCtx, url, out, start, end, opts, bar)
+		})
+	}
+	err = group.Wait()
+	bar.Finish(err)
+
+	if err != nil {
+		out.Close()
+		os.Remove(filePath)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error downloading %s: %w", label, err)
+	}
+	return nil
+}
+
+// fetchRange downloads bytes start to end (inclusive) of url into out
+func fetchRange(ctx context.Context, url string, out *os.File, start, end int64, opts Options, bar progress) error {
+	resp, err := rangeRequest(ctx, opts.httpClient(), url, start, end)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("bytes %d-%d: status %s", start, end, resp.Status)
+	}
+
+	length := end - start + 1
+	var body io.Reader = io.LimitReader(activityReader{resp.Body, opts.activity, opts.Received}, length)
+	if opts.RateLimit > 0 {
+		// Share the limit between the chunks
+		body = newRateLimitedReader(ctx, body, max(opts.RateLimit/int64(opts.Chunks), 1))
+	}
+	body = bar.NewProxyReader(body)
+
+	n, err := io.Copy(io.NewOffsetWriter(out, start), body)
+	if err != nil {
+		return err
+	}
+	if n != length {
+		return fmt.Errorf("bytes %d-%d: got %d of %d bytes", start, end, n, length)
+	}
+	return nil
+}
+
+// rangeRequest requests bytes start to end (inclusive) of url
+func rangeRequest(ctx context.Context, httpClient *http.Client, url string, start, end int64) (*http.Response, error) {
+	return getResolved(ctx, httpClient, url, fmt.Sprintf("bytes=%d-%d", start, end))
+}
@@ -0,0 +1,256 @@
+// Package download fetches files over HTTP with a progress bar
+package download
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// ChunkThreshold is the size from which downloads are split into chunks
+// when Options.Chunks asks for it, smaller files gain nothing from it
+const ChunkThreshold = 32 << 20
+
+// Options tune a single download
+type Options struct {
+	Label     string // Shown next to the progress bar and in errors
+	Size      int64  // Expected size, zero or less falls back to the Content-Length
+	RateLimit int64  // Maximum bytes per second, zero means unlimited
+	Chunks    int    // Parallel range requests for files of at least ChunkThreshold bytes
+
+	HideProgress bool      // Do not draw a progress bar
+	ProgressJSON io.Writer // Write ProgressEvents as JSON lines here instead of drawing a bar
+
+	HTTPClient   *http.Client  // Defaults to client.DownloadClient
+	StallTimeout time.Duration // Abort when no data arrives for this long, zero waits forever
+	ExpectHTML   bool          // The file is a web page, so an HTML response is not an error page
+
+	// Received, if set, counts the bytes received, across resumes and chunks
+	Received *atomic.Int64
+
+	activity func() // Called whenever data arrives, set by File
+}
+
+// httpClient returns the client downloads are made with
+func (o Options) httpClient() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+	return client.DownloadClient
+}
+
+// ErrStalled is returned when a download receives no data for StallTimeout
+var ErrStalled = errors.New("download stalled")
+
+// ErrHTMLPage is returned when the server answers with a web page, such as
+// a login page after a failed authentication, instead of the file
+var ErrHTMLPage = errors.New("server sent an HTML page instead of the file")
+
+// errNoRanges reports that the server does not serve byte ranges
+var errNoRanges = errors.New("server does not support range requests")
+
+// File downloads url to filePath, showing progress as it goes.
+// The partial file is removed if the download fails or ctx is cancelled.
+func File(ctx context.Context, url, filePath string, opts Options) error {
+	if opts.StallTimeout <= 0 {
+		return file(ctx, url, filePath, opts)
+	}
+
+	// Unlike a timeout for the whole request this leaves slow but steady
+	// transfers of large files alone
+	stallCtx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(opts.StallTimeout, func() { cancel(ErrStalled) })
+	defer func() {
+		timer.Stop()
+		cancel(nil)
+	}()
+	opts.activity = func() { timer.Reset(opts.StallTimeout) }
+
+	err := file(stallCtx, url, filePath, opts)
+	if err != nil && errors.Is(context.Cause(stallCtx), ErrStalled) && ctx.Err() == nil {
+		return fmt.Errorf("error downloading %s: no data received for %s: %w", opts.Label, opts.StallTimeout, ErrStalled)
+	}
+	return err
+}
+
+// file downloads url to filePath, in chunks when opts asks for it
+func file(ctx context.Context, url, filePath string, opts Options) error {
+	label, size := opts.Label, opts.Size
+
+	if opts.Chunks > 1 && size >= ChunkThreshold {
+		err := chunkedFile(ctx, url, filePath, opts)
+		if !errors.Is(err, errNoRanges) {
+			return err
+		}
+		client.Debugf("%s: %v, downloading in one piece", label, err)
+	}
+
+	resp, err := getResolved(ctx, opts.httpClient(), url, "")
+	if err != nil {
+		return fmt.Errorf("error downloading %s: %w", label, err)
+	}
+	defer func() { resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading %s, status: %s", label, resp.Status)
+	}
+
+	body := bufio.NewReader(resp.Body)
+	if !opts.ExpectHTML {
+		if err := checkNotHTML(resp.Header.Get("Content-Type"), body); err != nil {
+			return fmt.Errorf("error downloading %s: %w", label, err)
+		}
+	}
+	canResume := resp.Header.Get("Accept-Ranges") == "bytes"
+
+	// Source archives are generated on the fly and carry no size in the API
+	if size <= 0 {
+		size = resp.ContentLength
+	}
+
+	// Create the output file
+	out, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %v", err)
+	}
+	defer out.Close()
+
+	bar := newProgress(opts, size)
+	var written int64
+	readErr := false
+	for resumes := 0; ; resumes++ {
+		var n int64
+		n, readErr, err = copyBody(ctx, out, body, opts, bar)
+		written += n
+		if err == nil || !readErr || !canResume || resumes >= maxResumes || ctx.Err() != nil {
+			break
+		}
+
+		// A dropped connection, or an expired pre-signed URL, need not
+		// throw away what has arrived so far
+		client.Debugf("%s: %v, resuming at byte %d", label, err, written)
+		resp.Body.Close()
+		next, resumeErr := getResolved(ctx, opts.httpClient(), url, fmt.Sprintf("bytes=%d-", written))
+		if resumeErr != nil {
+			err = resumeErr
+			break
+		}
+		resp = next
+		if resp.StatusCode != http.StatusPartialContent {
+			err = fmt.Errorf("resuming at byte %d: status %s", written, resp.Status)
+			break
+		}
+		// A server may answer with another range than the one asked for
+		var start int64
+		if _, scanErr := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-", &start); scanErr != nil || start != written {
+			err = fmt.Errorf("resuming at byte %d: server sent range %q", written, resp.Header.Get("Content-Range"))
+			break
+		}
+		body = bufio.NewReader(resp.Body)
+	}
+	bar.Finish(err)
+
+	if err != nil {
+		out.Close()
+		os.Remove(filePath)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !readErr {
+			return fmt.Errorf("error writing to output file: %v", err)
+		}
+		return fmt.Errorf("error downloading %s: %v", label, err)
+	}
+
+	return nil
+}
+
+// maxResumes bounds how often a single download picks up where it broke off
+const maxResumes = 3
+
+// copyBody copies a response body to out with rate limiting and progress,
+// and reports whether a failure came from reading rather than writing
+func copyBody(ctx context.Context, out io.Writer, body io.Reader, opts Options, bar progress) (int64, bool, error) {
+	tracked := &readErrorReader{r: activityReader{body, opts.activity, opts.Received}}
+	var reader io.Reader = tracked
+	if opts.RateLimit > 0 {
+		reader = newRateLimitedReader(ctx, reader, opts.RateLimit)
+	}
+
+	n, err := io.Copy(out, bar.NewProxyReader(reader))
+	return n, err != nil && tracked.err != nil, err
+}
+
+// readErrorReader remembers the first read error other than io.EOF
+type readErrorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (t *readErrorReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err != nil && err != io.EOF && t.err == nil {
+		t.err = err
+	}
+	return n, err
+}
+
+// checkNotHTML fails with ErrHTMLPage when the Content-Type of a response,
+// or sniffing the start of its body, shows a web page
+func checkNotHTML(contentType string, body *bufio.Reader) error {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && isHTML(mediaType) {
+		return fmt.Errorf("%w (%s), authentication may be required", ErrHTMLPage, mediaType)
+	}
+
+	// Peek returns what there is when the body is shorter
+	head, _ := body.Peek(512)
+	if isHTML(http.DetectContentType(head)) {
+		return fmt.Errorf("%w, authentication may be required", ErrHTMLPage)
+	}
+	return nil
+}
+
+func isHTML(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "application/xhtml+xml")
+}
+
+// activityReader calls activity, if set, whenever data is read, and adds
+// what is read to received, if set
+type activityReader struct {
+	r        io.Reader
+	activity func()
+	received *atomic.Int64
+}
+
+func (a activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 && a.activity != nil {
+		a.activity()
+	}
+	if n > 0 && a.received != nil {
+		a.received.Add(int64(n))
+	}
+	return n, err
+}
+
+// startBar starts a progress bar for a download of size bytes
+func startBar(size int64, label string) *pb.ProgressBar {
+	bar := pb.Full.Start64(size)
+	bar.Set(pb.Bytes, true)
+	bar.SetTemplateString(`{{with string . "prefix"}}{{.}} {{end}}{{counters . }} {{bar . }} {{percent . }} {{speed . }} {{with string . "suffix"}}{{.}}{{end}}`)
+	bar.Set("prefix", "Downloading:")
+	bar.Set("suffix", fmt.Sprintf("[%s]", label))
+	return bar
+}
@@ -0,0 +1,99 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dropConnection closes the connection of w without a complete response
+func dropConnection(t *testing.T, w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	conn.Close()
+}
+
+func TestFileResume(t *testing.T) {
+	const content = "0123456789"
+	const dropAt = 4
+	tests := []struct {
+		name    string
+		resume  func(t *testing.T, w http.ResponseWriter) // Answers the request for the rest
+		wantErr bool
+	}{
+		{
+			name: "resumed",
+			resume: func(t *testing.T, w http.ResponseWriter) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", dropAt, len(content)-1, len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(content[dropAt:]))
+			},
+		},
+		{
+			name: "other range",
+			resume: func(t *testing.T, w http.ResponseWriter) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes 0-%d/%d", len(content)-1, len(content)))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte(content))
+			},
+			wantErr: true,
+		},
+		{
+			name: "whole file",
+			resume: func(t *testing.T, w http.ResponseWriter) {
+				w.Write([]byte(content))
+			},
+			wantErr: true,
+		},
+		{name: "connection dropped", resume: dropConnection, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") == "" {
+					// Send the start of the file, then drop the connection
+					w.Header().Set("Accept-Ranges", "bytes")
+					w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+					w.Write([]byte(content[:dropAt]))
+					http.NewResponseController(w).Flush()
+					dropConnection(t, w)
+					return
+				}
+				if r.Header.Get("Range") != fmt.Sprintf("bytes=%d-", dropAt) {
+					t.Errorf("Range = %q", r.Header.Get("Range"))
+				}
+				tt.resume(t, w)
+			}))
+			defer srv.Close()
+
+			filePath := filepath.Join(t.TempDir(), "app")
+			err := File(context.Background(), srv.URL, filePath, Options{Label: "app", HideProgress: true, HTTPClient: srv.Client()})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("File succeeded, want an error")
+				}
+				if _, err := os.Stat(filePath); err == nil {
+					t.Error("the partial file was left behind")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("File: %v", err)
+			}
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != content {
+				t.Errorf("downloaded %q, want %q", data, content)
+			}
+		})
+	}
+}
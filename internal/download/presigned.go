@@ -0,0 +1,85 @@
+package download
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+)
+
+// maxPresignRetries bounds how often an expired pre-signed URL is replaced
+const maxPresignRetries = 2
+
+// getResolved requests url, which may redirect to a pre-signed object storage
+// URL as Gitea does with SERVE_DIRECT storage. A request refused because the
+// pre-signed URL expired is retried from url, so the server signs a new one
+// rather than the stale one being reused. rangeHeader, if set, is sent as
+// the Range header.
+func getResolved(ctx context.Context, httpClient *http.Client, url, rangeHeader string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		resp, err := client.Do(httpClient, req)
+		if err != nil {
+			return nil, err
+		}
+
+		final := resp.Request.URL
+		expires, presigned := presignedExpiry(final)
+		if !presigned {
+			return resp, nil
+		}
+		refused := resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusBadRequest
+		if !refused || attempt >= maxPresignRetries {
+			if !expires.IsZero() {
+				client.Debugf("downloading from pre-signed URL on %s, valid until %s", final.Host, expires.Format(time.RFC3339))
+			}
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		client.Debugf("pre-signed URL on %s refused with %s, requesting a new one", final.Host, resp.Status)
+	}
+}
+
+// presignedExpiry reports whether u is a pre-signed S3 (signature version 2
+// or 4) or Google Cloud Storage URL, and when it expires if the URL says
+func presignedExpiry(u *url.URL) (time.Time, bool) {
+	query := u.Query()
+	switch {
+	case query.Has("X-Amz-Signature"):
+		return expiryAfter(query.Get("X-Amz-Date"), query.Get("X-Amz-Expires")), true
+	case query.Has("X-Goog-Signature"):
+		return expiryAfter(query.Get("X-Goog-Date"), query.Get("X-Goog-Expires")), true
+	case query.Has("Signature") && query.Has("Expires"):
+		seconds, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+		if err != nil {
+			return time.Time{}, true
+		}
+		return time.Unix(seconds, 0), true
+	}
+	return time.Time{}, false
+}
+
+// expiryAfter adds a lifetime in seconds to a signing time such as
+// 20240102T150405Z, zero when either is missing
+func expiryAfter(signed, lifetime string) time.Time {
+	t, err := time.Parse("20060102T150405Z", signed)
+	if err != nil {
+		return time.Time{}
+	}
+	seconds, err := strconv.Atoi(lifetime)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.Add(time.Duration(seconds) * time.Second)
+}
@@ -0,0 +1,164 @@
+package download
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// progressInterval is the time between two JSON progress events
+const progressInterval = 500 * time.Millisecond
+
+// progress reports how far a download is
+type progress interface {
+	NewProxyReader(r io.Reader) io.Reader // Counts what is read through it
+	Finish(err error)                     // Ends the display, err is the download result
+}
+
+// newProgress returns the progress display the options ask for
+func newProgress(opts Options, size int64) progress {
+	switch {
+	case opts.ProgressJSON != nil:
+		return newJSONProgress(opts.ProgressJSON, opts.Label, size)
+	case opts.HideProgress:
+		return noProgress{}
+	default:
+		return barProgress{startBar(size, opts.Label)}
+	}
+}
+
+type noProgress struct{}
+
+func (noProgress) NewProxyReader(r io.Reader) io.Reader { return r }
+func (noProgress) Finish(error)                         {}
+
+type barProgress struct {
+	bar *pb.ProgressBar
+}
+
+func (b barProgress) NewProxyReader(r io.Reader) io.Reader { return b.bar.NewProxyReader(r) }
+func (b barProgress) Finish(error)                         { b.bar.Finish() }
+
+// ProgressEvent is a line of --progress json output
+type ProgressEvent struct {
+	Event   string  `json:"event"` // start, progress, done or error
+	File    string  `json:"file"`
+	Bytes   int64   `json:"bytes"`
+	Total   int64   `json:"total,omitempty"` // Omitted when the size is unknown
+	Percent float64 `json:"percent,omitempty"`
+	Speed   int64   `json:"speed"`         // Average bytes per second
+	ETA     float64 `json:"eta,omitempty"` // Seconds left, omitted when unknown
+	Error   string  `json:"error,omitempty"`
+}
+
+// jsonProgress writes line-delimited ProgressEvents, safe for concurrent
+// use by chunked downloads
+type jsonProgress struct {
+	label string
+	total int64
+	start time.Time
+	done  atomic.Int64
+
+	mu       sync.Mutex
+	encoder  *json.Encoder
+	lastSent time.Time
+}
+
+func newJSONProgress(w io.Writer, label string, total int64) *jsonProgress {
+	p := &jsonProgress{label: label, total: total, start: time.Now(), encoder: json.NewEncoder(w)}
+	p.emit("start", nil)
+	return p
+}
+
+func (p *jsonProgress) NewProxyReader(r io.Reader) io.Reader {
+	return progressReader{r: r, p: p}
+}
+
+func (p *jsonProgress) Finish(err error) {
+	if err != nil {
+		p.emit("error", err)
+		return
+	}
+	p.emit("done", nil)
+}
+
+// add counts n more bytes and sends an event if one is due
+func (p *jsonProgress) add(n int) {
+	p.done.Add(int64(n))
+
+	p.mu.Lock()
+	due := time.Since(p.lastSent) >= progressInterval
+	p.mu.Unlock()
+	if due {
+		p.emit("progress", nil)
+	}
+}
+
+func (p *jsonProgress) emit(event string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	done := p.done.Load()
+	ev := ProgressEvent{Event: event, File: p.label, Bytes: done}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		ev.Speed = int64(float64(done) / elapsed)
+	}
+	if p.total > 0 {
+		ev.Total = p.total
+		ev.Percent = float64(int(float64(done)/float64(p.total)*1000)) / 10
+		if ev.Speed > 0 && done < p.total {
+			ev.ETA = float64(int(float64(p.total-done)/float64(ev.Speed)*10)) / 10
+		}
+	}
+
+	p.encoder.Encode(ev)
+	p.lastSent = time.Now()
+}
+
+type progressReader struct {
+	r io.Reader
+	p *jsonProgress
+}
+
+func (r progressReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.p.add(n)
+	return n, err
+}
+
+// Progress is the combined progress display of a transfer of several files,
+// such as a batch upload, as a bar or JSON events like downloads
+type Progress struct {
+	progress
+}
+
+// NewProgress starts a progress display for size bytes in total, showing
+// action, e.g. "Uploading:", in front of the bar. Only opts.HideProgress
+// and opts.ProgressJSON are used.
+func NewProgress(opts Options, action string, size int64) *Progress {
+	p := newProgress(opts, size)
+	if b, ok := p.(barProgress); ok {
+		b.bar.Set("prefix", action)
+	}
+	return &Progress{p}
+}
+
+// SetLabel changes what the display says is being transferred
+func (p *Progress) SetLabel(label string) {
+	switch display := p.progress.(type) {
+	case barProgress:
+		display.bar.Set("suffix", fmt.Sprintf("[%s]", label))
+	case *jsonProgress:
+		display.mu.Lock()
+		display.label = label
+		display.mu.Unlock()
+	}
+}
@@ -0,0 +1,68 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimitedReader throttles reads to a maximum number of bytes per second
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limit   int64
+	start   time.Time
+	written int64
+}
+
+func newRateLimitedReader(ctx context.Context, r io.Reader, limit int64) *rateLimitedReader {
+	return &rateLimitedReader{ctx: ctx, r: r, limit: limit, start: time.Now()}
+}
+
+func (l *rateLimitedReader) Read(p []byte) (int, error) {
+	// Read in chunks of at most a tenth of a second worth of data so the
+	// rate stays smooth even with large buffers
+	if chunk := l.limit / 10; chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+
+	n, err := l.r.Read(p)
+	l.written += int64(n)
+
+	// Sleep until the average rate since the start is back under the limit
+	expected := time.Duration(float64(l.written) / float64(l.limit) * float64(time.Second))
+	if wait := expected - time.Since(l.start); wait > 0 {
+		select {
+		case <-l.ctx.Done():
+			return n, l.ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return n, err
+}
+
+// ParseRate parses a transfer rate in bytes per second with an optional
+// K, M or G suffix (powers of 1024), e.g. 500K or 2M
+func ParseRate(value string) (int64, error) {
+	multipliers := map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30}
+
+	number := strings.ToUpper(strings.TrimSpace(value))
+	number = strings.TrimSuffix(number, "B")
+	multiplier := int64(1)
+	if len(number) > 0 {
+		if m, ok := multipliers[number[len(number)-1:]]; ok {
+			multiplier = m
+			number = number[:len(number)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate '%s', use e.g. 500K or 2M", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
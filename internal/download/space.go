@@ -0,0 +1,45 @@
+package download
+
+import "fmt"
+
+// SpaceError is returned when a filesystem lacks room for a download
+type SpaceError struct {
+	Dir       string
+	Needed    int64
+	Available int64
+}
+
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf("not enough free space in %s: %s needed, %s available",
+		e.Dir, FormatBytes(e.Needed), FormatBytes(e.Available))
+}
+
+// CheckFreeSpace fails with a SpaceError when the filesystem holding dir has
+// less than size bytes available. Filesystems whose free space cannot be
+// determined are assumed to have enough.
+func CheckFreeSpace(dir string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	available, ok := freeSpace(dir)
+	if !ok || available >= uint64(size) {
+		return nil
+	}
+
+	return &SpaceError{Dir: dir, Needed: size, Available: int64(available)}
+}
+
+// FormatBytes renders a byte count in binary units, e.g. 1.5 MiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
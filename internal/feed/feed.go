@@ -0,0 +1,155 @@
+// Package feed renders release histories as Atom feeds and iCalendar files
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+)
+
+// Entry is a release together with the repository it belongs to
+type Entry struct {
+	Repo    string // owner/name
+	Release client.Release
+}
+
+// Feed describes the feed the entries are rendered into
+type Feed struct {
+	ID      string // Permanent URI identifying the feed
+	Title   string
+	Link    string // Page the feed is about, optional
+	Limit   int    // Maximum number of entries, zero keeps all
+	Entries []Entry
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    *atomLink   `xml:"link,omitempty"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published,omitempty"`
+	Link      *atomLink   `xml:"link,omitempty"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Content   atomContent `xml:"content"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// WriteAtom writes the feed as an Atom document with the newest release
+// first. Drafts are left out.
+func (f Feed) WriteAtom(w io.Writer) error {
+	entries := make([]Entry, 0, len(f.Entries))
+	for _, entry := range f.Entries {
+		if !entry.Release.Draft {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return releaseTime(entries[i].Release).After(releaseTime(entries[j].Release))
+	})
+	if f.Limit > 0 && len(entries) > f.Limit {
+		entries = entries[:f.Limit]
+	}
+
+	// An empty feed has not been updated since it started
+	updated := time.Unix(0, 0).UTC()
+	if len(entries) > 0 {
+		updated = releaseTime(entries[0].Release)
+	}
+
+	doc := atomFeed{ID: f.ID, Title: f.Title, Updated: updated.Format(time.RFC3339)}
+	if f.Link != "" {
+		doc.Link = &atomLink{Href: f.Link, Rel: "alternate"}
+	}
+
+	for _, entry := range entries {
+		rel := entry.Release
+		title := rel.Name
+		if title == "" {
+			title = rel.TagName
+		}
+		if rel.Prerelease {
+			title += " (pre-release)"
+		}
+
+		content := rel.Body
+		if content == "" {
+			content = fmt.Sprintf("Release %s of %s", rel.TagName, entry.Repo)
+		}
+
+		id := rel.HTMLURL
+		if id == "" {
+			id = fmt.Sprintf("urn:gitea-release:%s:%s", entry.Repo, rel.TagName)
+		}
+
+		atomEntry := atomEntry{
+			ID:      id,
+			Title:   entry.Repo + " " + title,
+			Updated: releaseTime(rel).Format(time.RFC3339),
+			Content: atomContent{Type: "text", Body: content},
+		}
+		if rel.PublishedAt != "" {
+			atomEntry.Published = atomEntry.Updated
+		}
+		if rel.HTMLURL != "" {
+			atomEntry.Link = &atomLink{Href: rel.HTMLURL, Rel: "alternate"}
+		}
+		if name := authorName(rel.Author); name != "" {
+			atomEntry.Author = &atomPerson{Name: name}
+		}
+		doc.Entries = append(doc.Entries, atomEntry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("error encoding feed: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// releaseTime returns when a release was published, or created for
+// releases that were never published
+func releaseTime(rel client.Release) time.Time {
+	for _, value := range []string{rel.PublishedAt, rel.CreatedAt} {
+		if t, err := time.Parse(time.RFC3339, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+func authorName(user client.User) string {
+	if user.FullName != "" {
+		return user.FullName
+	}
+	return user.Login
+}
@@ -0,0 +1,79 @@
+package feed
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteICS writes the releases as an iCalendar file with one all-day event
+// per release on the day it was published (UTC). Drafts are left out.
+func (f Feed) WriteICS(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(b, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//gitea-release//Release history//EN")
+	line("CALSCALE", "GREGORIAN")
+	if f.Title != "" {
+		line("X-WR-CALNAME", icsEscape(f.Title))
+	}
+
+	for _, entry := range f.Entries {
+		rel := entry.Release
+		if rel.Draft {
+			continue
+		}
+		published := releaseTime(rel)
+
+		summary := entry.Repo + " " + rel.TagName
+		if rel.Prerelease {
+			summary += " (pre-release)"
+		}
+
+		line("BEGIN", "VEVENT")
+		line("UID", icsEscape(fmt.Sprintf("%s/%s@gitea-release", entry.Repo, rel.TagName)))
+		line("DTSTAMP", published.Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE", published.Format("20060102"))
+		line("DTEND;VALUE=DATE", published.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", icsEscape(summary))
+		if rel.Body != "" {
+			line("DESCRIPTION", icsEscape(rel.Body))
+		}
+		if rel.HTMLURL != "" {
+			line("URL", rel.HTMLURL)
+		}
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return b.Flush()
+}
+
+// icsEscape escapes a TEXT value as required by RFC 5545
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeFolded writes a content line, folding it into lines of at most 75
+// octets without splitting UTF-8 sequences. Continuation lines start with a
+// space, which counts towards their length.
+func writeFolded(b *bufio.Writer, s string) {
+	maxLine := 75
+	for len(s) > maxLine {
+		cut := maxLine
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut])
+		b.WriteString("\r\n ")
+		s = s[cut:]
+		maxLine = 74
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,487 @@
+// Package giteatest runs an in-memory stand-in for the parts of the Gitea
+// API that gitea-release uses, so commands and the release API can be
+// exercised without a live server
+package giteatest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+// Version is reported by /api/v1/version unless Server.Version is set
+const Version = "1.22.0"
+
+// Server is a fake Gitea instance holding releases in memory
+type Server struct {
+	*httptest.Server
+
+	// Token, if set, is required on every API request and asset download,
+	// as on a private repository
+	Token string
+
+	// Version, if set, is the Gitea version to act as. Before 1.18 there is
+	// no latest release endpoint and before 1.15 no tag endpoint. A Forgejo
+	// version such as 7.0.0+gitea-1.22.0 acts as Forgejo.
+	Version string
+
+	mu          sync.Mutex
+	repos       map[string]*fakeRepo // By owner/name
+	files       map[string][]byte    // Asset contents by UUID
+	nextID      int
+	requests    []string
+	rateLimited int // Requests still to answer with 429
+}
+
+type fakeRepo struct {
+	releases []*client.Release // Newest first, as the API lists them
+}
+
+// NewServer starts a fake Gitea instance. Close it when done.
+func NewServer() *Server {
+	s := &Server{repos: make(map[string]*fakeRepo), files: make(map[string][]byte)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/version", s.version)
+	mux.HandleFunc("GET /api/forgejo/v1/version", s.forgejoVersion)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}", s.getRepo)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/releases", s.listReleases)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/releases/latest", s.latestRelease)
+	mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/releases", s.createRelease)
+	mux.HandleFunc("PATCH /api/v1/repos/{owner}/{repo}/releases/{id}", s.editRelease)
+	mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/releases/{id}", s.deleteRelease)
+	mux.HandleFunc("POST /api/v1/repos/{owner}/{repo}/releases/{id}/assets", s.uploadAsset)
+	mux.HandleFunc("DELETE /api/v1/repos/{owner}/{repo}/releases/{id}/assets/{asset}", s.deleteAsset)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/tags/{tag}", s.getTag)
+	mux.HandleFunc("GET /attachments/{uuid}", s.download)
+
+	s.Server = httptest.NewServer(s.record(mux))
+	return s
+}
+
+// AddRelease publishes rel with the given asset contents by name and returns
+// the release as the API reports it. IDs, UUIDs, sizes and URLs are filled
+// in, and PublishedAt defaults to now.
+func (s *Server) AddRelease(owner, name string, rel client.Release, assets map[string][]byte) client.Release {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addRelease(owner, name, rel, assets)
+}
+
+// addRelease is AddRelease with mu held
+func (s *Server) addRelease(owner, name string, rel client.Release, assets map[string][]byte) client.Release {
+	repo := s.repos[owner+"/"+name]
+	if repo == nil {
+		repo = &fakeRepo{}
+		s.repos[owner+"/"+name] = repo
+	}
+
+	s.nextID++
+	rel.ID = s.nextID
+	if rel.Name == "" {
+		rel.Name = rel.TagName
+	}
+	if rel.PublishedAt == "" {
+		rel.PublishedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	if rel.CreatedAt == "" {
+		rel.CreatedAt = rel.PublishedAt
+	}
+	if rel.Author.Login == "" {
+		rel.Author = client.User{ID: 1, Login: owner}
+	}
+	rel.HTMLURL = fmt.Sprintf("%s/%s/%s/releases/tag/%s", s.URL, owner, name, rel.TagName)
+	rel.TarballURL = fmt.Sprintf("%s/%s/%s/archive/%s.tar.gz", s.URL, owner, name, rel.TagName)
+	rel.ZipballURL = fmt.Sprintf("%s/%s/%s/archive/%s.zip", s.URL, owner, name, rel.TagName)
+
+	names := make([]string, 0, len(assets))
+	for assetName := range assets {
+		names = append(names, assetName)
+	}
+	sort.Strings(names)
+
+	rel.Assets = nil
+	for _, assetName := range names {
+		rel.Assets = append(rel.Assets, s.newAsset(assetName, assets[assetName], rel.CreatedAt))
+	}
+
+	stored := rel
+	repo.releases = append([]*client.Release{&stored}, repo.releases...)
+	return stored
+}
+
+// Repo returns a release.Repo for a repository on the server
+func (s *Server) Repo(owner, name string) release.Repo {
+	return release.Repo{BaseURL: s.URL, Owner: owner, Name: name, Token: s.Token, HTTPClient: s.Client()}
+}
+
+// Requests returns the method and path of every request served so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// RateLimit answers the next n requests with 429 Too Many Requests and a
+// Retry-After of zero, so clients retry at once
+func (s *Server) RateLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimited = n
+}
+
+// newAsset stores data and describes it as an asset. Call with mu held.
+func (s *Server) newAsset(name string, data []byte, created string) client.Asset {
+	s.nextID++
+	uuid := fmt.Sprintf("00000000-0000-0000-0000-%012d", s.nextID)
+	s.files[uuid] = data
+	return client.Asset{
+		ID:                 s.nextID,
+		Name:               name,
+		Size:               int64(len(data)),
+		CreatedAt:          created,
+		UUID:               uuid,
+		BrowserDownloadURL: s.URL + "/attachments/" + uuid,
+	}
+}
+
+// record logs every request, applies RateLimit and checks the token
+func (s *Server) record(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		limited := s.rateLimited > 0
+		if limited {
+			s.rateLimited--
+		}
+		s.mu.Unlock()
+
+		if limited {
+			w.Header().Set("Retry-After", "0")
+			apiError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		if s.Token != "" && r.Header.Get("Authorization") != "token "+s.Token {
+			apiError(w, http.StatusUnauthorized, "token is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// findRepo returns the repository of a request, answering 404 when it does
+// not exist. Call with mu held.
+func (s *Server) findRepo(w http.ResponseWriter, r *http.Request) *fakeRepo {
+	repo := s.repos[r.PathValue("owner")+"/"+r.PathValue("repo")]
+	if repo == nil {
+		apiError(w, http.StatusNotFound, "repository does not exist")
+	}
+	return repo
+}
+
+// findRelease returns the release of a request by ID. Call with mu held.
+func (s *Server) findRelease(w http.ResponseWriter, r *http.Request) (*fakeRepo, int) {
+	repo := s.findRepo(w, r)
+	if repo == nil {
+		return nil, -1
+	}
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	for i, rel := range repo.releases {
+		if rel.ID == id {
+			return repo, i
+		}
+	}
+	apiError(w, http.StatusNotFound, "release does not exist")
+	return nil, -1
+}
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"version": s.giteaVersion()})
+}
+
+func (s *Server) forgejoVersion(w http.ResponseWriter, r *http.Request) {
+	forgejo, _, ok := strings.Cut(s.giteaVersion(), "+gitea-")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"version": forgejo})
+}
+
+func (s *Server) giteaVersion() string {
+	if s.Version != "" {
+		return s.Version
+	}
+	return Version
+}
+
+// before reports whether the server acts as a Gitea older than major.minor,
+// which answers 404 for endpoints it does not have yet
+func (s *Server) before(major, minor int) bool {
+	version := s.giteaVersion()
+	if _, gitea, ok := strings.Cut(version, "+gitea-"); ok {
+		version = gitea
+	}
+	var haveMajor, haveMinor int
+	fmt.Sscanf(version, "%d.%d", &haveMajor, &haveMinor)
+	return haveMajor < major || haveMajor == major && haveMinor < minor
+}
+
+func (s *Server) getRepo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo := s.findRepo(w, r)
+	if repo == nil {
+		return
+	}
+	owner, name := r.PathValue("owner"), r.PathValue("repo")
+	// Any token may write, as the owner's would, anonymous requests only read
+	authenticated := r.Header.Get("Authorization") != ""
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":            name,
+		"full_name":       owner + "/" + name,
+		"owner":           map[string]string{"login": owner},
+		"private":         s.Token != "",
+		"release_counter": len(repo.releases),
+		"permissions":     client.Permissions{Admin: authenticated, Push: authenticated, Pull: true},
+	})
+}
+
+func (s *Server) listReleases(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo := s.findRepo(w, r)
+	if repo == nil {
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = 30
+	}
+
+	releases := []client.Release{}
+	for i := (page - 1) * limit; i < len(repo.releases) && i < page*limit; i++ {
+		releases = append(releases, *repo.releases[i])
+	}
+	writeJSON(w, http.StatusOK, releases)
+}
+
+func (s *Server) latestRelease(w http.ResponseWriter, r *http.Request) {
+	if s.before(1, 18) {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo := s.findRepo(w, r)
+	if repo == nil {
+		return
+	}
+	// Like Gitea, latest skips drafts and pre-releases
+	for _, rel := range repo.releases {
+		if !rel.Draft && !rel.Prerelease {
+			writeJSON(w, http.StatusOK, rel)
+			return
+		}
+	}
+	apiError(w, http.StatusNotFound, "release does not exist")
+}
+
+func (s *Server) createRelease(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo := s.findRepo(w, r)
+	if repo == nil {
+		return
+	}
+
+	var opts client.CreateReleaseOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		apiError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if opts.TagName == "" {
+		apiError(w, http.StatusUnprocessableEntity, "tag_name is required")
+		return
+	}
+	for _, rel := range repo.releases {
+		if rel.TagName == opts.TagName {
+			apiError(w, http.StatusConflict, "release already exists")
+			return
+		}
+	}
+
+	rel := client.Release{TagName: opts.TagName, Target: opts.Target, Name: opts.Name, Body: opts.Body, Draft: opts.Draft, Prerelease: opts.Prerelease}
+	if rel.Target == "" {
+		rel.Target = "main"
+	}
+	writeJSON(w, http.StatusCreated, s.addRelease(r.PathValue("owner"), r.PathValue("repo"), rel, nil))
+}
+
+func (s *Server) editRelease(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, i := s.findRelease(w, r)
+	if repo == nil {
+		return
+	}
+
+	var opts client.EditReleaseOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		apiError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	rel := repo.releases[i]
+	if opts.Name != nil {
+		rel.Name = *opts.Name
+	}
+	if opts.Body != nil {
+		rel.Body = *opts.Body
+	}
+	if opts.Draft != nil {
+		rel.Draft = *opts.Draft
+	}
+	if opts.Prerelease != nil {
+		rel.Prerelease = *opts.Prerelease
+	}
+	writeJSON(w, http.StatusOK, rel)
+}
+
+func (s *Server) deleteRelease(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, i := s.findRelease(w, r)
+	if repo == nil {
+		return
+	}
+	repo.releases = append(repo.releases[:i], repo.releases[i+1:]...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) uploadAsset(w http.ResponseWriter, r *http.Request) {
+	// A link to an external file has no attachment
+	var data []byte
+	externalURL := r.FormValue("external_url")
+	if externalURL == "" {
+		file, _, err := r.FormFile("attachment")
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, i := s.findRelease(w, r)
+	if repo == nil {
+		return
+	}
+	rel := repo.releases[i]
+	asset := s.newAsset(r.URL.Query().Get("name"), data, time.Now().UTC().Format(time.RFC3339))
+	if externalURL != "" {
+		delete(s.files, asset.UUID)
+		asset.BrowserDownloadURL = externalURL
+		asset.Type = client.AssetTypeExternal
+	}
+	rel.Assets = append(rel.Assets, asset)
+	writeJSON(w, http.StatusCreated, asset)
+}
+
+func (s *Server) deleteAsset(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo, i := s.findRelease(w, r)
+	if repo == nil {
+		return
+	}
+	rel := repo.releases[i]
+	id, _ := strconv.Atoi(r.PathValue("asset"))
+	for j, asset := range rel.Assets {
+		if asset.ID == id {
+			delete(s.files, asset.UUID)
+			rel.Assets = append(rel.Assets[:j], rel.Assets[j+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+	apiError(w, http.StatusNotFound, "attachment does not exist")
+}
+
+func (s *Server) getTag(w http.ResponseWriter, r *http.Request) {
+	if s.before(1, 15) {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	repo := s.findRepo(w, r)
+	if repo == nil {
+		return
+	}
+	name := r.PathValue("tag")
+	for _, rel := range repo.releases {
+		if rel.TagName == name {
+			// A stable made-up commit per tag
+			sum := sha1.Sum([]byte(r.PathValue("owner") + "/" + r.PathValue("repo") + "@" + name))
+			sha := hex.EncodeToString(sum[:])
+			writeJSON(w, http.StatusOK, client.Tag{Name: name, ID: sha, Commit: client.TagCommit{SHA: sha, Created: rel.CreatedAt}})
+			return
+		}
+	}
+	apiError(w, http.StatusNotFound, "tag does not exist")
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	data, ok := s.files[r.PathValue("uuid")]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	// ServeContent answers range requests, as Gitea does
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiError answers in the error format of the Gitea API
+func apiError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
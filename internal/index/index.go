@@ -0,0 +1,266 @@
+// Package index writes a static index of releases and their assets: JSON
+// documents and, optionally, HTML pages that a plain web server can host as
+// a downloads page
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/download"
+)
+
+// Index is what is written: every repository with its releases
+type Index struct {
+	Generated time.Time
+	Repos     []Repo
+}
+
+// Repo is a repository of the index and its releases, newest first
+type Repo struct {
+	Alias    string
+	Name     string // owner/name
+	URL      string // Repository page on the Gitea instance
+	Releases []client.Release
+}
+
+// summary is a repository as listed in index.json
+type summary struct {
+	Alias           string `json:"alias"`
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	Releases        int    `json:"releases"`
+	Latest          string `json:"latest,omitempty"` // Tag of the newest release that is not a pre-release
+	LatestPublished string `json:"latest_published,omitempty"`
+	JSON            string `json:"json"`           // Document with the releases, relative to index.json
+	HTML            string `json:"html,omitempty"` // Page with the releases, with HTML output
+}
+
+// repoDocument is the JSON document of a repository
+type repoDocument struct {
+	Generated string    `json:"generated"`
+	Alias     string    `json:"alias"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Releases  []release `json:"releases"`
+}
+
+type release struct {
+	Tag        string  `json:"tag"`
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	Published  string  `json:"published"`
+	Prerelease bool    `json:"prerelease"`
+	Notes      string  `json:"notes"`
+	Assets     []asset `json:"assets"`
+}
+
+type asset struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Downloads int    `json:"downloads"`
+	URL       string `json:"url"`
+	External  bool   `json:"external,omitempty"` // Links to a file outside Gitea, the size is unknown
+}
+
+// unsafeChars are replaced in the file names made from aliases
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileName returns the name, without extension, of the files of a
+// repository
+func fileName(alias string) string {
+	return unsafeChars.ReplaceAllString(alias, "-")
+}
+
+// Write writes index.json and a <alias>.json per repository to dir, which
+// is created if needed, and with withHTML index.html and a <alias>.html
+// per repository. Every file is replaced in one step, so a web server
+// serving dir never hands out a partial one.
+func Write(dir string, idx Index, withHTML bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating %s: %v", dir, err)
+	}
+	generated := idx.Generated.UTC().Format(time.RFC3339)
+
+	summaries := make([]summary, 0, len(idx.Repos))
+	aliases := make(map[string]string) // By file name
+	for _, repo := range idx.Repos {
+		name := fileName(repo.Alias)
+		if other, ok := aliases[name]; ok {
+			return fmt.Errorf("repositories %s and %s would both be written to %s.json", other, repo.Alias, name)
+		}
+		aliases[name] = repo.Alias
+		s := summary{Alias: repo.Alias, Name: repo.Name, URL: repo.URL, Releases: len(repo.Releases), JSON: name + ".json"}
+		if withHTML {
+			s.HTML = name + ".html"
+		}
+		for _, rel := range repo.Releases {
+			if !rel.Prerelease {
+				s.Latest, s.LatestPublished = rel.TagName, rel.PublishedAt
+				break
+			}
+		}
+		summaries = append(summaries, s)
+
+		doc := repoDocument{Generated: generated, Alias: repo.Alias, Name: repo.Name, URL: repo.URL, Releases: []release{}}
+		for _, rel := range repo.Releases {
+			doc.Releases = append(doc.Releases, newRelease(rel))
+		}
+		if err := writeJSON(filepath.Join(dir, s.JSON), doc); err != nil {
+			return err
+		}
+		if withHTML {
+			if err := writeHTML(filepath.Join(dir, s.HTML), repoPage, struct {
+				Generated string
+				JSON      string
+				Repo      repoDocument
+			}{generated, s.JSON, doc}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := writeJSON(filepath.Join(dir, "index.json"), struct {
+		Generated string    `json:"generated"`
+		Repos     []summary `json:"repos"`
+	}{generated, summaries}); err != nil {
+		return err
+	}
+	if withHTML {
+		return writeHTML(filepath.Join(dir, "index.html"), indexPage, struct {
+			Generated string
+			Repos     []summary
+		}{generated, summaries})
+	}
+	return nil
+}
+
+func newRelease(rel client.Release) release {
+	r := release{
+		Tag:        rel.TagName,
+		Name:       rel.Name,
+		URL:        rel.HTMLURL,
+		Published:  rel.PublishedAt,
+		Prerelease: rel.Prerelease,
+		Notes:      rel.Body,
+		Assets:     []asset{},
+	}
+	for _, a := range rel.Assets {
+		r.Assets = append(r.Assets, asset{Name: a.Name, Size: a.Size, Downloads: a.DownloadCount, URL: a.BrowserDownloadURL, External: a.IsExternal()})
+	}
+	return r
+}
+
+func writeJSON(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", filepath.Base(filename), err)
+	}
+	return writeFile(filename, append(data, '\n'))
+}
+
+func writeHTML(filename string, page *template.Template, data interface{}) error {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		return fmt.Errorf("error rendering %s: %v", filepath.Base(filename), err)
+	}
+	return writeFile(filename, buf.Bytes())
+}
+
+// writeFile replaces filename with data through a temporary file
+func writeFile(filename string, data []byte) error {
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", filename, err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing %s: %v", filename, err)
+	}
+	return nil
+}
+
+var funcs = template.FuncMap{
+	"size": func(a asset) string {
+		if a.External {
+			return "external"
+		}
+		return download.FormatBytes(a.Size)
+	},
+	"date": func(published string) string {
+		t, err := time.Parse(time.RFC3339, published)
+		if err != nil {
+			return published
+		}
+		return t.UTC().Format("2006-01-02")
+	},
+}
+
+const style = `<style>
+body { font-family: system-ui, sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; color: #222; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; }
+td.num { text-align: right; }
+.pre { font-size: .8em; background: #fe9; padding: 0 .3em; border-radius: .2em; }
+pre { white-space: pre-wrap; background: #f6f6f6; padding: .6em; }
+footer { margin-top: 2em; color: #888; font-size: .8em; }
+</style>`
+
+var indexPage = template.Must(template.New("index").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Downloads</title>
+` + style + `
+</head>
+<body>
+<h1>Downloads</h1>
+<table>
+<tr><th>Repository</th><th>Latest</th><th>Published</th><th class="num">Releases</th></tr>
+{{- range .Repos}}
+<tr><td><a href="{{.HTML}}">{{.Name}}</a></td><td>{{or .Latest "-"}}</td><td>{{with .LatestPublished}}{{date .}}{{else}}-{{end}}</td><td class="num">{{.Releases}}</td></tr>
+{{- end}}
+</table>
+<footer>Generated {{date .Generated}} · <a href="index.json">index.json</a></footer>
+</body>
+</html>
+`))
+
+var repoPage = template.Must(template.New("repo").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Repo.Name}} downloads</title>
+` + style + `
+</head>
+<body>
+<p><a href="index.html">All downloads</a></p>
+<h1>{{.Repo.Name}}</h1>
+{{- range .Repo.Releases}}
+<h2>{{if .URL}}<a href="{{.URL}}">{{.Tag}}</a>{{else}}{{.Tag}}{{end}}{{if and .Name (ne .Name .Tag)}} {{.Name}}{{end}}{{if .Prerelease}} <span class="pre">pre-release</span>{{end}}</h2>
+<p>Published {{date .Published}}</p>
+{{- if .Assets}}
+<table>
+<tr><th>File</th><th class="num">Size</th><th class="num">Downloads</th></tr>
+{{- range .Assets}}
+<tr><td><a href="{{.URL}}">{{.Name}}</a></td><td class="num">{{size .}}</td><td class="num">{{.Downloads}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- with .Notes}}
+<details><summary>Release notes</summary><pre>{{.}}</pre></details>
+{{- end}}
+{{- else}}
+<p>No releases yet.</p>
+{{- end}}
+<footer>Generated {{date .Generated}} · <a href="{{.JSON}}">{{.JSON}}</a></footer>
+</body>
+</html>
+`))
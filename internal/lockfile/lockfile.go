@@ -0,0 +1,178 @@
+// Package lockfile records the assets gitea-release has installed so they
+// can be verified later
+package lockfile
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/runlock"
+)
+
+// Entry describes one installed file
+type Entry struct {
+	Alias        string    `json:"alias"`
+	Tag          string    `json:"tag"`
+	Asset        string    `json:"asset"`
+	Path         string    `json:"path"` // Absolute path of the installed file
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// Lockfile holds the installed files, at most one entry per path
+type Lockfile struct {
+	Entries []Entry `json:"entries"`
+}
+
+// PathFor returns the lockfile path that belongs to a config file,
+// gitea-release.json becomes gitea-release.lock.json. The lockfile of a
+// remote config file, given as a URL, is kept in the current directory.
+func PathFor(configFile string) string {
+	if strings.Contains(configFile, "://") {
+		configFile, _, _ = strings.Cut(configFile, "?")
+		configFile = path.Base(configFile)
+	}
+	return strings.TrimSuffix(configFile, filepath.Ext(configFile)) + ".lock.json"
+}
+
+// Load reads the lockfile at filename, a missing file is an empty lockfile
+func Load(filename string) (*Lockfile, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Lockfile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading lockfile: %v", err)
+	}
+
+	lock := &Lockfile{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("error decoding lockfile: %v", err)
+	}
+	return lock, nil
+}
+
+// Save writes the lockfile to filename, replacing it atomically
+func (l *Lockfile) Save(filename string) error {
+	sort.Slice(l.Entries, func(i, j int) bool {
+		if l.Entries[i].Alias != l.Entries[j].Alias {
+			return l.Entries[i].Alias < l.Entries[j].Alias
+		}
+		return l.Entries[i].Path < l.Entries[j].Path
+	})
+
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding lockfile: %v", err)
+	}
+
+	// A temporary file of its own, so concurrent saves never write into
+	// each other's copy
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error writing lockfile: %v", err)
+	}
+	tmp := file.Name()
+	_, err = file.Write(append(data, '\n'))
+	if err == nil {
+		err = file.Chmod(0644)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing lockfile: %v", err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error writing lockfile: %v", err)
+	}
+	return nil
+}
+
+// lockTimeout bounds the wait for another process updating the lockfile
+const lockTimeout = time.Minute
+
+// Update loads the lockfile at filename, changes it with fn and saves it,
+// holding a lock throughout so concurrent runs do not lose each other's
+// entries
+func Update(filename string, fn func(*Lockfile)) error {
+	lock, err := runlock.AcquireFile(context.Background(), filename+".lock", runlock.Options{Wait: true, Timeout: lockTimeout})
+	if err != nil {
+		return fmt.Errorf("error locking lockfile: %v", err)
+	}
+	defer lock.Release()
+
+	l, err := Load(filename)
+	if err != nil {
+		return err
+	}
+	fn(l)
+	return l.Save(filename)
+}
+
+// Record adds an entry, replacing any earlier entry for the same path
+func (l *Lockfile) Record(entry Entry) {
+	for i := range l.Entries {
+		if l.Entries[i].Path == entry.Path {
+			l.Entries[i] = entry
+			return
+		}
+	}
+	l.Entries = append(l.Entries, entry)
+}
+
+// ForAlias returns the entries recorded for a repository alias
+func (l *Lockfile) ForAlias(alias string) []Entry {
+	var entries []Entry
+	for _, entry := range l.Entries {
+		if entry.Alias == alias {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Installed returns the most recently recorded entry for an asset of a
+// repository alias
+func (l *Lockfile) Installed(alias, asset string) (Entry, bool) {
+	var latest Entry
+	found := false
+	for _, entry := range l.Entries {
+		if entry.Alias == alias && entry.Asset == asset && (!found || entry.DownloadedAt.After(latest.DownloadedAt)) {
+			latest = entry
+			found = true
+		}
+	}
+	return latest, found
+}
+
+// HashFile returns the hex encoded SHA256 digest and size of a file
+func HashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
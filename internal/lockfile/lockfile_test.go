@@ -0,0 +1,101 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPathFor(t *testing.T) {
+	tests := []struct {
+		configFile string
+		want       string
+	}{
+		{"gitea-release.json", "gitea-release.lock.json"},
+		{"/etc/gitea-release/config.json", "/etc/gitea-release/config.lock.json"},
+		{"config", "config.lock.json"},
+		{"https://platform.example.com/gitea-release/shared.json", "shared.lock.json"},
+		{"git+ssh://git@git.example.com/config.git//repos.json?ref=main", "repos.lock.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.configFile, func(t *testing.T) {
+			if got := PathFor(tt.configFile); got != tt.want {
+				t.Errorf("PathFor(%q) = %q, want %q", tt.configFile, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstalled(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	lock := &Lockfile{}
+	lock.Record(Entry{Alias: "app", Asset: "app", Path: "/opt/a/app", Tag: "v1.0.0", DownloadedAt: day(1)})
+	lock.Record(Entry{Alias: "app", Asset: "app", Path: "/opt/b/app", Tag: "v1.1.0", DownloadedAt: day(2)})
+	lock.Record(Entry{Alias: "lib", Asset: "lib", Path: "/opt/lib", Tag: "v0.1.0", DownloadedAt: day(3)})
+	// Replaces the first entry, recorded for the same path
+	lock.Record(Entry{Alias: "app", Asset: "app", Path: "/opt/a/app", Tag: "v1.2.0", DownloadedAt: day(4)})
+
+	tests := []struct {
+		alias, asset string
+		wantTag      string
+		wantFound    bool
+	}{
+		{"app", "app", "v1.2.0", true},
+		{"lib", "lib", "v0.1.0", true},
+		{"app", "other", "", false},
+		{"missing", "app", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alias+"/"+tt.asset, func(t *testing.T) {
+			entry, found := lock.Installed(tt.alias, tt.asset)
+			if found != tt.wantFound || entry.Tag != tt.wantTag {
+				t.Errorf("Installed = %q, %v, want %q, %v", entry.Tag, found, tt.wantTag, tt.wantFound)
+			}
+		})
+	}
+	if entries := lock.ForAlias("app"); len(entries) != 2 {
+		t.Errorf("ForAlias(app) = %d entries, want 2", len(entries))
+	}
+}
+
+func TestUpdateConcurrent(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "gitea-release.lock.json")
+
+	const runs = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, runs)
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- Update(filename, func(l *Lockfile) {
+				l.Record(Entry{Alias: "app", Path: fmt.Sprintf("/opt/app/%d", i)})
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+
+	lock, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Entries) != runs {
+		t.Errorf("lockfile has %d entries after %d updates", len(lock.Entries), runs)
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(filename), "*.tmp"))
+	if len(matches) > 0 {
+		t.Errorf("temporary files left behind: %v", matches)
+	}
+	if info, err := os.Stat(filename); err == nil && info.Mode().Perm() != 0644 {
+		t.Errorf("lockfile mode %v, want 0644", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,96 @@
+package notes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ChangelogSection returns the body of the section of a Keep a Changelog
+// file for a tag, such as the lines under "## [1.2.0] - 2024-05-01" for
+// v1.2.0, without its heading. Versions match with or without a leading v.
+func ChangelogSection(changelog, tag string) (string, error) {
+	version := strings.TrimPrefix(tag, "v")
+
+	var section []string
+	level := 0  // Heading level of the section, 0 until it is found
+	fence := "" // Marker of the code block the line is in, # in it is no heading
+	for _, line := range strings.Split(strings.ReplaceAll(changelog, "\r\n", "\n"), "\n") {
+		lineLevel, title := 0, ""
+		if fence == "" {
+			fence = fenceOpening(line)
+			if fence == "" {
+				lineLevel, title = heading(line)
+			}
+		} else if closesFence(line, fence) {
+			fence = ""
+		}
+		if level > 0 {
+			if lineLevel > 0 && lineLevel <= level {
+				break
+			}
+			section = append(section, line)
+			continue
+		}
+		if lineLevel > 0 && strings.TrimPrefix(headingVersion(title), "v") == version {
+			level = lineLevel
+		}
+	}
+	if level == 0 {
+		return "", fmt.Errorf("no section for %s in the changelog", tag)
+	}
+
+	body := strings.TrimSpace(strings.Join(section, "\n"))
+	if body == "" {
+		return "", fmt.Errorf("the changelog section for %s is empty", tag)
+	}
+	return body, nil
+}
+
+// heading returns the level and text of a Markdown ATX heading, or 0 for
+// other lines
+func heading(line string) (int, string) {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 6 || !strings.HasPrefix(line[level:], " ") {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(line[level:])
+}
+
+// fenceOpening returns the ``` or ~~~ marker a line opens a fenced code
+// block with, or "" for other lines
+func fenceOpening(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return ""
+	}
+	for _, char := range []string{"`", "~"} {
+		marker := trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, char))]
+		// Backtick fences cannot have backticks in their info string
+		if len(marker) >= 3 && (char == "~" || !strings.Contains(trimmed[len(marker):], "`")) {
+			return marker
+		}
+	}
+	return ""
+}
+
+// closesFence reports whether line ends the code block opened with marker:
+// a run of the same character, at least as long, and nothing else
+func closesFence(line, marker string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	trimmed = strings.TrimRight(trimmed, " \t")
+	return len(trimmed) >= len(marker) && strings.Trim(trimmed, marker[:1]) == ""
+}
+
+// headingVersion returns the version a changelog heading is for, as in
+// "[1.2.0] - 2024-05-01", "1.2.0 (2024-05-01)" or "[v1.2.0](https://...)"
+func headingVersion(title string) string {
+	if rest, ok := strings.CutPrefix(title, "["); ok {
+		version, _, _ := strings.Cut(rest, "]")
+		return strings.TrimSpace(version)
+	}
+	version, _, _ := strings.Cut(title, " ")
+	return version
+}
@@ -0,0 +1,95 @@
+package notes
+
+import (
+	"strings"
+	"testing"
+)
+
+const changelog = `# Changelog
+
+## [Unreleased]
+
+- Work in progress
+
+## [1.2.0] - 2024-05-01
+
+### Added
+
+- Feature
+
+## [1.1.0] - 2024-04-01
+
+Configure it with:
+
+` + "```" + `sh
+# 1.0.0 is not a heading here
+## [1.0.0]
+` + "```" + `
+
+~~~~
+## [0.9.0]
+~~~
+still in the block
+~~~~
+
+- Fix
+
+## [v1.0.0](https://example.com/compare/v0.9.0...v1.0.0)
+
+- First release
+
+## 0.9.0 (2024-01-01)
+
+## [0.8.0]
+
+- Old
+`
+
+func TestChangelogSection(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{name: "with subsections", tag: "v1.2.0", want: "### Added\n\n- Feature"},
+		{name: "without v", tag: "1.2.0", want: "### Added\n\n- Feature"},
+		{
+			name: "headings in code blocks",
+			tag:  "v1.1.0",
+			want: "Configure it with:\n\n```sh\n# 1.0.0 is not a heading here\n## [1.0.0]\n```\n\n~~~~\n## [0.9.0]\n~~~\nstill in the block\n~~~~\n\n- Fix",
+		},
+		{name: "linked heading", tag: "v1.0.0", want: "- First release"},
+		{name: "unreleased", tag: "Unreleased", want: "- Work in progress"},
+		{name: "last section", tag: "v0.8.0", want: "- Old"},
+		{name: "empty section", tag: "v0.9.0", wantErr: true},
+		{name: "missing", tag: "v2.0.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ChangelogSection(changelog, tt.tag)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ChangelogSection(%q) = %q, want an error", tt.tag, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ChangelogSection(%q): %v", tt.tag, err)
+			}
+			if got != tt.want {
+				t.Errorf("ChangelogSection(%q) =\n%s\nwant\n%s", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangelogSectionCRLF(t *testing.T) {
+	got, err := ChangelogSection(strings.ReplaceAll(changelog, "\n", "\r\n"), "v1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "### Added\n\n- Feature" {
+		t.Errorf("ChangelogSection = %q", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Package notes generates release notes from the issues and pull requests
+// of a milestone
+package notes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/client"
+)
+
+// otherSection collects entries without a label
+const otherSection = "Other"
+
+// FindMilestone returns the milestone named after a tag, with or without
+// its leading v
+func FindMilestone(milestones []client.Milestone, tag string) (client.Milestone, bool) {
+	version := strings.TrimPrefix(tag, "v")
+	for _, milestone := range milestones {
+		if milestone.Title == tag || strings.TrimPrefix(milestone.Title, "v") == version {
+			return milestone, true
+		}
+	}
+	return client.Milestone{}, false
+}
+
+// Markdown renders issues as markdown sections grouped by their first
+// label, sorted by name with unlabelled entries last. Pull requests that
+// were closed without being merged are left out.
+func Markdown(issues []client.Issue) string {
+	sections := make(map[string][]client.Issue)
+	for _, issue := range issues {
+		if issue.PullRequest != nil && !issue.PullRequest.Merged {
+			continue
+		}
+
+		section := otherSection
+		if len(issue.Labels) > 0 {
+			section = issue.Labels[0].Name
+		}
+		sections[section] = append(sections[section], issue)
+	}
+
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		if name != otherSection {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := sections[otherSection]; ok {
+		names = append(names, otherSection)
+	}
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "## %s\n\n", name)
+
+		entries := sections[name]
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Number < entries[j].Number })
+		for _, issue := range entries {
+			fmt.Fprintf(&b, "- %s (#%d)", issue.Title, issue.Number)
+			if issue.User.Login != "" {
+				fmt.Fprintf(&b, " @%s", issue.User.Login)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
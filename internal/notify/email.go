@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// sendEmail sends the event as a plain text mail. Authentication is only
+// attempted when a username is set, net/smtp refuses it without TLS except
+// on localhost.
+func sendEmail(t Target, e Event) error {
+	host, _, err := net.SplitHostPort(t.SMTP)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address '%s': %v", t.SMTP, err)
+	}
+
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", t.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(t.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", e.Title())
+	fmt.Fprintf(&msg, "Date: %s\r\n", e.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(e.Message(), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := smtp.SendMail(t.SMTP, auth, t.From, t.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package notify sends release and deploy notifications to chat, push and
+// email services
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	EventRelease       = "release"        // A new release was detected
+	EventDeploySuccess = "deploy_success" // A release was deployed
+	EventDeployFailure = "deploy_failure" // Deploying a release failed
+	EventRollback      = "rollback"       // A deployed release failed its health check and was undone
+)
+
+// Event is something that happened to a watched repository
+type Event struct {
+	Type  string    `json:"type"`
+	Alias string    `json:"alias"`
+	Repo  string    `json:"repo"` // owner/name
+	Tag   string    `json:"tag"`
+	URL   string    `json:"url,omitempty"` // Release page
+	Path  string    `json:"path,omitempty"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// Title returns a one line summary of the event
+func (e Event) Title() string {
+	switch e.Type {
+	case EventRelease:
+		return fmt.Sprintf("New release %s of %s", e.Tag, e.Repo)
+	case EventDeploySuccess:
+		return fmt.Sprintf("Deployed %s %s", e.Repo, e.Tag)
+	case EventDeployFailure:
+		return fmt.Sprintf("Deploying %s %s failed", e.Repo, e.Tag)
+	case EventRollback:
+		return fmt.Sprintf("Rolled back %s %s", e.Repo, e.Tag)
+	default:
+		return fmt.Sprintf("%s: %s %s", e.Type, e.Repo, e.Tag)
+	}
+}
+
+// Message returns the event as a short human readable text
+func (e Event) Message() string {
+	lines := []string{e.Title()}
+	if e.Path != "" {
+		lines = append(lines, "Path: "+e.Path)
+	}
+	if e.Error != "" {
+		lines = append(lines, "Error: "+e.Error)
+	}
+	if e.URL != "" {
+		lines = append(lines, e.URL)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Target is a configured notification destination
+type Target struct {
+	Type   string   `json:"type"`             // slack, webhook, ntfy, gotify or email
+	URL    string   `json:"url,omitempty"`    // Webhook, ntfy topic or Gotify server URL
+	Token  string   `json:"token,omitempty"`  // ntfy access token or Gotify application token
+	Events []string `json:"events,omitempty"` // Event types to send, all when empty
+
+	// Email settings
+	SMTP     string   `json:"smtp,omitempty"` // host:port
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+}
+
+// Wants reports whether the target is subscribed to an event type
+func (t Target) Wants(eventType string) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, e := range t.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that the target has the settings its type needs
+func (t Target) Validate() error {
+	switch t.Type {
+	case "slack", "webhook", "ntfy":
+		if t.URL == "" {
+			return fmt.Errorf("%s notifier needs a url", t.Type)
+		}
+	case "gotify":
+		if t.URL == "" || t.Token == "" {
+			return fmt.Errorf("gotify notifier needs a url and a token")
+		}
+	case "email":
+		if t.SMTP == "" || t.From == "" || len(t.To) == 0 {
+			return fmt.Errorf("email notifier needs smtp, from and to")
+		}
+	default:
+		return fmt.Errorf("unknown notifier type '%s', use slack, webhook, ntfy, gotify or email", t.Type)
+	}
+
+	for _, e := range t.Events {
+		switch e {
+		case EventRelease, EventDeploySuccess, EventDeployFailure, EventRollback:
+		default:
+			return fmt.Errorf("unknown event '%s', use %s, %s, %s or %s", e, EventRelease, EventDeploySuccess, EventDeployFailure, EventRollback)
+		}
+	}
+	return nil
+}
+
+// Send delivers an event to a target
+func Send(ctx context.Context, client *http.Client, t Target, e Event) error {
+	switch t.Type {
+	case "slack":
+		return postJSON(ctx, client, t.URL, nil, map[string]string{"text": e.Message()})
+	case "webhook":
+		return postJSON(ctx, client, t.URL, nil, e)
+	case "ntfy":
+		headers := map[string]string{"Title": e.Title()}
+		if e.Type == EventDeployFailure || e.Type == EventRollback {
+			headers["Priority"] = "high"
+			headers["Tags"] = "warning"
+		}
+		if t.Token != "" {
+			headers["Authorization"] = "Bearer " + t.Token
+		}
+		return post(ctx, client, t.URL, "text/plain", headers, []byte(e.Message()))
+	case "gotify":
+		priority := 5
+		if e.Type == EventDeployFailure || e.Type == EventRollback {
+			priority = 8
+		}
+		url := strings.TrimRight(t.URL, "/") + "/message"
+		headers := map[string]string{"X-Gotify-Key": t.Token}
+		return postJSON(ctx, client, url, headers, map[string]interface{}{
+			"title":    e.Title(),
+			"message":  e.Message(),
+			"priority": priority,
+		})
+	case "email":
+		return sendEmail(t, e)
+	default:
+		return fmt.Errorf("unknown notifier type '%s'", t.Type)
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, client, url, "application/json", headers, data)
+}
+
+func post(ctx context.Context, client *http.Client, url, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("POST %s: %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Package provenance verifies SLSA build provenance published with release
+// assets as signed in-toto attestations, and checks that the artifact was
+// built by the expected builder from the expected source repository
+package provenance
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/earentir/gitea-release/internal/cosign"
+)
+
+// Predicate types of SLSA provenance statements
+const (
+	SLSAv02 = "https://slsa.dev/provenance/v0.2"
+	SLSAv1  = "https://slsa.dev/provenance/v1"
+)
+
+// GitHubIssuer is the OIDC issuer of certificates made in GitHub Actions,
+// where most SLSA provenance is signed
+const GitHubIssuer = "https://token.actions.githubusercontent.com"
+
+// Policy is what the provenance of an artifact must show. Identities
+// without an @ match at any ref, so a builder workflow matches whichever
+// tag of it ran.
+type Policy struct {
+	BuilderID string // e.g. https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml
+	SourceURI string // Repository the artifact was built from, e.g. github.com/org/app
+
+	Signer string // Identity of the signing certificate, BuilderID when empty
+	Issuer string // OIDC issuer of the signing certificate, GitHubIssuer when empty
+
+	TrustedRoot string // Path to a Sigstore trusted_root.json, fetched through TUF when empty
+}
+
+// Provenance is what a verified attestation says about how an artifact was
+// built
+type Provenance struct {
+	PredicateType string
+	BuilderID     string
+	SourceURI     string
+}
+
+// Verify checks the file at artifactPath with the attestations in data,
+// Sigstore bundles as a single JSON document or one per line. One of them
+// must be signed by the policy's signer, name the artifact as a subject and
+// be SLSA provenance from the expected builder and source.
+func Verify(artifactPath string, data []byte, policy Policy) (Provenance, error) {
+	signer := policy.Signer
+	if signer == "" {
+		signer = policy.BuilderID
+	}
+	issuer := policy.Issuer
+	if issuer == "" {
+		issuer = GitHubIssuer
+	}
+	signing := cosign.Policy{IdentityRegexp: identityPattern(signer), Issuer: issuer, TrustedRoot: policy.TrustedRoot}
+
+	// A mismatch in verified provenance explains a failure better than
+	// the signature errors of attestations about other artifacts
+	var signatureErr, policyErr error
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var document json.RawMessage
+		if err := decoder.Decode(&document); err == io.EOF {
+			break
+		} else if err != nil {
+			return Provenance{}, fmt.Errorf("error parsing attestations: %v", err)
+		}
+
+		var envelope struct {
+			PayloadType string `json:"payloadType"`
+		}
+		if json.Unmarshal(document, &envelope) == nil && envelope.PayloadType != "" {
+			// The signing certificate of a bare DSSE envelope is only in
+			// the transparency log
+			signatureErr = errors.New("attestation is a bare DSSE envelope, only Sigstore bundles can be verified")
+			continue
+		}
+
+		statement, err := cosign.VerifyAttestation(artifactPath, document, signing)
+		if err != nil {
+			signatureErr = err
+			continue
+		}
+		p, err := parse(statement)
+		if err == nil {
+			err = policy.check(p)
+		}
+		if err != nil {
+			policyErr = err
+			continue
+		}
+		return p, nil
+	}
+
+	switch {
+	case policyErr != nil:
+		return Provenance{}, policyErr
+	case signatureErr != nil:
+		return Provenance{}, signatureErr
+	}
+	return Provenance{}, errors.New("no attestations found")
+}
+
+// check compares verified provenance with the policy
+func (policy Policy) check(p Provenance) error {
+	if !matchesIdentity(p.BuilderID, policy.BuilderID) {
+		return fmt.Errorf("built by %s, expected %s", p.BuilderID, policy.BuilderID)
+	}
+	if p.SourceURI == "" {
+		return errors.New("provenance does not name the source repository")
+	}
+	if normalizeSource(p.SourceURI) != normalizeSource(policy.SourceURI) {
+		return fmt.Errorf("built from %s, expected %s", p.SourceURI, policy.SourceURI)
+	}
+	return nil
+}
+
+// statement is the part of an in-toto statement with SLSA provenance that
+// is checked, for both predicate versions
+type statement struct {
+	PredicateType string `json:"predicateType"`
+	Predicate     struct {
+		// v0.2
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			ConfigSource struct {
+				URI string `json:"uri"`
+			} `json:"configSource"`
+		} `json:"invocation"`
+		Materials []struct {
+			URI string `json:"uri"`
+		} `json:"materials"`
+
+		// v1
+		RunDetails struct {
+			Builder struct {
+				ID string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+		BuildDefinition struct {
+			ExternalParameters struct {
+				Workflow struct {
+					Repository string `json:"repository"`
+				} `json:"workflow"`
+			} `json:"externalParameters"`
+			ResolvedDependencies []struct {
+				URI string `json:"uri"`
+			} `json:"resolvedDependencies"`
+		} `json:"buildDefinition"`
+	} `json:"predicate"`
+}
+
+// parse reads the builder and source from SLSA provenance
+func parse(data []byte) (Provenance, error) {
+	var s statement
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Provenance{}, fmt.Errorf("error parsing attestation: %v", err)
+	}
+
+	p := Provenance{PredicateType: s.PredicateType}
+	predicate := s.Predicate
+	switch s.PredicateType {
+	case SLSAv02:
+		p.BuilderID = predicate.Builder.ID
+		p.SourceURI = predicate.Invocation.ConfigSource.URI
+		if p.SourceURI == "" && len(predicate.Materials) > 0 {
+			p.SourceURI = predicate.Materials[0].URI
+		}
+	case SLSAv1:
+		p.BuilderID = predicate.RunDetails.Builder.ID
+		p.SourceURI = predicate.BuildDefinition.ExternalParameters.Workflow.Repository
+		if p.SourceURI == "" && len(predicate.BuildDefinition.ResolvedDependencies) > 0 {
+			p.SourceURI = predicate.BuildDefinition.ResolvedDependencies[0].URI
+		}
+	default:
+		return Provenance{}, fmt.Errorf("attestation is %s, not SLSA provenance", s.PredicateType)
+	}
+	return p, nil
+}
+
+// matchesIdentity reports whether an identity is the expected one, at any
+// ref when expected has none
+func matchesIdentity(actual, expected string) bool {
+	if actual == expected {
+		return true
+	}
+	return !strings.Contains(expected, "@") && strings.HasPrefix(actual, expected+"@")
+}
+
+// identityPattern is the regular expression of the certificate identities
+// matchesIdentity accepts
+func identityPattern(expected string) string {
+	if strings.Contains(expected, "@") {
+		return "^" + regexp.QuoteMeta(expected) + "$"
+	}
+	return "^" + regexp.QuoteMeta(expected) + "(@.*)?$"
+}
+
+// normalizeSource reduces a repository URI such as
+// git+https://github.com/Org/App.git@refs/tags/v1 to github.com/org/app
+func normalizeSource(uri string) string {
+	uri = strings.ToLower(strings.TrimPrefix(uri, "git+"))
+	if _, rest, ok := strings.Cut(uri, "://"); ok {
+		uri = rest
+	}
+	uri, _, _ = strings.Cut(uri, "@")
+	return strings.TrimSuffix(strings.TrimSuffix(uri, "/"), ".git")
+}
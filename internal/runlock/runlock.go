@@ -0,0 +1,115 @@
+// Package runlock keeps separate gitea-release processes from deploying
+// into the same place at once, with advisory locks on a file
+package runlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileName is the lock file created in a deploy directory
+const FileName = ".gitea-release.lock"
+
+// pollInterval is how often a waiting process tries the lock again
+const pollInterval = 250 * time.Millisecond
+
+// ErrLocked is returned when another process holds the lock
+var ErrLocked = errors.New("locked by another process")
+
+// Lock is a held lock, released by Release or when the process exits
+type Lock struct {
+	file *os.File
+}
+
+// Options control what happens when the lock is held by another process
+type Options struct {
+	Wait    bool          // Wait for the lock instead of failing with ErrLocked
+	Timeout time.Duration // Give up waiting after this long, zero waits forever
+}
+
+// Acquire takes the lock on FileName in dir, which is created if needed
+func Acquire(ctx context.Context, dir string, opts Options) (*Lock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating %s: %v", dir, err)
+	}
+	return acquire(ctx, filepath.Join(dir, FileName), dir, opts)
+}
+
+// AcquireFile takes the lock on the file at path rather than on a directory,
+// for state shared between runs that deploy to different places
+func AcquireFile(ctx context.Context, path string, opts Options) (*Lock, error) {
+	return acquire(ctx, path, path, opts)
+}
+
+// acquire locks the file at path, with name in the errors about it
+func acquire(ctx context.Context, path, name string, opts Options) (*Lock, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %v", err)
+	}
+
+	var deadline <-chan time.Time
+	if opts.Timeout > 0 {
+		timer := time.NewTimer(opts.Timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("error locking %s: %v", path, err)
+		}
+		if locked {
+			// The PID is only informational, the lock itself is what counts
+			file.Truncate(0)
+			file.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+			return &Lock{file: file}, nil
+		}
+
+		if !opts.Wait {
+			holder := holderPID(path)
+			file.Close()
+			return nil, fmt.Errorf("%s is %w%s", name, ErrLocked, holder)
+		}
+		select {
+		case <-ctx.Done():
+			file.Close()
+			return nil, ctx.Err()
+		case <-deadline:
+			file.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for the lock on %s", opts.Timeout, name)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Release gives the lock up. The file stays, removing it would let two
+// processes lock different files of the same name.
+func (l *Lock) Release() error {
+	if err := unlock(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// holderPID describes the process holding the lock, if it wrote its PID
+func holderPID(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	pid := strings.TrimSpace(string(data))
+	if _, err := strconv.Atoi(pid); err != nil {
+		return ""
+	}
+	return " (PID " + pid + ")"
+}
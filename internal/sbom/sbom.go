@@ -0,0 +1,190 @@
+// Package sbom reads SPDX and CycloneDX software bills of materials in their
+// JSON encodings
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Component is a package listed in an SBOM
+type Component struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	License string `json:"license,omitempty"`
+	PURL    string `json:"purl,omitempty"`
+}
+
+// Document is the format independent content of an SBOM
+type Document struct {
+	Format     string      `json:"format"` // e.g. SPDX-2.3 or CycloneDX-1.5
+	Name       string      `json:"name"`
+	Version    string      `json:"version,omitempty"` // Version of the described software, if given
+	Components []Component `json:"components"`
+}
+
+// Find returns the component with the given name
+func (d *Document) Find(name string) (Component, bool) {
+	for _, component := range d.Components {
+		if component.Name == name {
+			return component, true
+		}
+	}
+	return Component{}, false
+}
+
+// IsSBOMName reports whether an asset name looks like an SBOM in a JSON
+// format this package can read
+func IsSBOMName(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range []string{".spdx.json", ".cdx.json", ".cyclonedx.json", ".bom.json", ".sbom.json"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return strings.Contains(name, "sbom") && strings.HasSuffix(name, ".json")
+}
+
+// Parse detects the format of an SBOM and reads its components
+func Parse(data []byte) (*Document, error) {
+	var probe struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("error decoding SBOM: %v", err)
+	}
+
+	switch {
+	case probe.SPDXVersion != "":
+		return parseSPDX(data)
+	case probe.BOMFormat == "CycloneDX":
+		return parseCycloneDX(data)
+	default:
+		return nil, fmt.Errorf("unknown SBOM format, only SPDX and CycloneDX JSON are supported")
+	}
+}
+
+func parseSPDX(data []byte) (*Document, error) {
+	type spdxPackage struct {
+		SPDXID           string `json:"SPDXID"`
+		Name             string `json:"name"`
+		VersionInfo      string `json:"versionInfo"`
+		LicenseConcluded string `json:"licenseConcluded"`
+		LicenseDeclared  string `json:"licenseDeclared"`
+		ExternalRefs     []struct {
+			ReferenceType    string `json:"referenceType"`
+			ReferenceLocator string `json:"referenceLocator"`
+		} `json:"externalRefs"`
+	}
+	var spdx struct {
+		SPDXVersion       string        `json:"spdxVersion"`
+		Name              string        `json:"name"`
+		DocumentDescribes []string      `json:"documentDescribes"`
+		Packages          []spdxPackage `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &spdx); err != nil {
+		return nil, fmt.Errorf("error decoding SPDX document: %v", err)
+	}
+
+	doc := &Document{Format: spdx.SPDXVersion, Name: spdx.Name, Components: []Component{}}
+
+	described := make(map[string]bool)
+	for _, id := range spdx.DocumentDescribes {
+		described[id] = true
+	}
+
+	for _, pkg := range spdx.Packages {
+		// The described package is the software itself, not a component
+		if described[pkg.SPDXID] {
+			if doc.Version == "" {
+				doc.Version = pkg.VersionInfo
+			}
+			continue
+		}
+
+		component := Component{Name: pkg.Name, Version: pkg.VersionInfo, License: spdxLicense(pkg.LicenseConcluded)}
+		if component.License == "" {
+			component.License = spdxLicense(pkg.LicenseDeclared)
+		}
+		for _, ref := range pkg.ExternalRefs {
+			if ref.ReferenceType == "purl" {
+				component.PURL = ref.ReferenceLocator
+				break
+			}
+		}
+		doc.Components = append(doc.Components, component)
+	}
+
+	return doc, nil
+}
+
+// spdxLicense drops the placeholder values SPDX uses for unknown licenses
+func spdxLicense(license string) string {
+	if license == "NOASSERTION" || license == "NONE" {
+		return ""
+	}
+	return license
+}
+
+type cdxComponent struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	PURL     string `json:"purl"`
+	Licenses []struct {
+		License struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"license"`
+		Expression string `json:"expression"`
+	} `json:"licenses"`
+	Components []cdxComponent `json:"components"`
+}
+
+func (c cdxComponent) license() string {
+	var licenses []string
+	for _, l := range c.Licenses {
+		switch {
+		case l.Expression != "":
+			licenses = append(licenses, l.Expression)
+		case l.License.ID != "":
+			licenses = append(licenses, l.License.ID)
+		case l.License.Name != "":
+			licenses = append(licenses, l.License.Name)
+		}
+	}
+	return strings.Join(licenses, " OR ")
+}
+
+func parseCycloneDX(data []byte) (*Document, error) {
+	var cdx struct {
+		SpecVersion string `json:"specVersion"`
+		Metadata    struct {
+			Component cdxComponent `json:"component"`
+		} `json:"metadata"`
+		Components []cdxComponent `json:"components"`
+	}
+	if err := json.Unmarshal(data, &cdx); err != nil {
+		return nil, fmt.Errorf("error decoding CycloneDX document: %v", err)
+	}
+
+	doc := &Document{
+		Format:     "CycloneDX-" + cdx.SpecVersion,
+		Name:       cdx.Metadata.Component.Name,
+		Version:    cdx.Metadata.Component.Version,
+		Components: []Component{},
+	}
+
+	// Nested components are listed alongside their parents
+	var walk func(components []cdxComponent)
+	walk = func(components []cdxComponent) {
+		for _, c := range components {
+			doc.Components = append(doc.Components, Component{Name: c.Name, Version: c.Version, License: c.license(), PURL: c.PURL})
+			walk(c.Components)
+		}
+	}
+	walk(cdx.Components)
+
+	return doc, nil
+}
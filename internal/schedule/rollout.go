@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"fmt"
+	"hash/fnv"
+	"time"
+)
+
+// Rollout staggers deploys of a new release across the hosts running
+// watch against the same configuration. Each host falls into a fixed
+// bucket from 0 to 99 by its hostname: hosts below Percent are canaries
+// that deploy at once, the others wait Delay after the release was
+// published and then deploy spread out over Spread, in bucket order.
+type Rollout struct {
+	Percent int    `json:"percent"`          // Share of hosts that deploy at once
+	Delay   string `json:"delay"`            // e.g. 24h
+	Spread  string `json:"spread,omitempty"` // e.g. 6h, default all at once after Delay
+}
+
+// Validate checks the rollout settings
+func (r Rollout) Validate() error {
+	_, _, err := r.parse()
+	return err
+}
+
+func (r Rollout) parse() (delay, spread time.Duration, err error) {
+	if r.Percent < 0 || r.Percent > 100 {
+		return 0, 0, fmt.Errorf("invalid rollout percent %d, use 0 to 100", r.Percent)
+	}
+	if delay, err = time.ParseDuration(r.Delay); err != nil || delay < 0 {
+		return 0, 0, fmt.Errorf("invalid rollout delay '%s', use e.g. 24h", r.Delay)
+	}
+	if r.Spread != "" {
+		if spread, err = time.ParseDuration(r.Spread); err != nil || spread < 0 {
+			return 0, 0, fmt.Errorf("invalid rollout spread '%s', use e.g. 6h", r.Spread)
+		}
+	}
+	return delay, spread, nil
+}
+
+// Bucket places a host in 0 to 99 for a repository. It is the same on every
+// run, and repositories hash differently so the same hosts are not always
+// the canaries.
+func Bucket(host, alias string) int {
+	h := fnv.New32a()
+	h.Write([]byte(host + "/" + alias))
+	return int(h.Sum32() % 100)
+}
+
+// Due returns when a host in bucket may deploy a release published at
+// published
+func (r Rollout) Due(bucket int, published time.Time) (time.Time, error) {
+	delay, spread, err := r.parse()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if bucket < r.Percent {
+		return published, nil
+	}
+	wait := delay + spread*time.Duration(bucket-r.Percent)/time.Duration(100-r.Percent)
+	return published.Add(wait), nil
+}
@@ -0,0 +1,170 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+// at parses a UTC time such as "2024-01-07 02:30"
+func at(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse("2006-01-02 15:04", value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestCronMatches(t *testing.T) {
+	tests := []struct {
+		expr    string
+		time    string // 2024-01-07 is a Sunday
+		want    bool
+		wantErr bool
+	}{
+		{expr: "0 2 * * sun", time: "2024-01-07 02:00", want: true},
+		{expr: "0 2 * * sun", time: "2024-01-07 02:01", want: false},
+		{expr: "0 2 * * sun", time: "2024-01-08 02:00", want: false},
+		{expr: "0 2 * * 7", time: "2024-01-07 02:00", want: true},
+		{expr: "*/15 1-4 * * 1-5", time: "2024-01-08 03:45", want: true},
+		{expr: "*/15 1-4 * * 1-5", time: "2024-01-08 03:40", want: false},
+		{expr: "*/15 1-4 * * 1-5", time: "2024-01-07 03:45", want: false},
+		{expr: "5/20 * * * *", time: "2024-01-07 10:45", want: true},
+		{expr: "5/20 * * * *", time: "2024-01-07 10:00", want: false},
+		{expr: "0 0 1,15 jan-mar *", time: "2024-02-15 00:00", want: true},
+		{expr: "0 0 1,15 jan-mar *", time: "2024-04-15 00:00", want: false},
+		// Both day fields restricted: either one matching is enough
+		{expr: "0 0 1 * mon", time: "2024-01-08 00:00", want: true},
+		{expr: "0 0 1 * mon", time: "2024-02-01 00:00", want: true},
+		{expr: "0 0 1 * mon", time: "2024-02-02 00:00", want: false},
+		{expr: "0 2 * *", wantErr: true},
+		{expr: "60 2 * * *", wantErr: true},
+		{expr: "0 2 * * sunday", wantErr: true},
+		{expr: "0 4-2 * * *", wantErr: true},
+		{expr: "*/0 * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" at "+tt.time, func(t *testing.T) {
+			cron, err := ParseCron(tt.expr)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParseCron succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCron: %v", err)
+			}
+			if got := cron.Matches(at(t, tt.time)); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindows(t *testing.T) {
+	sunday := []Window{{Cron: "0 2 * * sun", Duration: "2h", Timezone: "UTC"}}
+	berlin := []Window{{Cron: "0 2 * * *", Duration: "1h", Timezone: "Europe/Berlin"}}
+	tests := []struct {
+		name     string
+		windows  []Window
+		time     string
+		wantOpen bool
+		wantNext string // "" when none within a year
+		wantErr  bool
+	}{
+		{name: "no windows", time: "2024-01-08 12:00", wantOpen: true},
+		{name: "opening", windows: sunday, time: "2024-01-07 02:00", wantOpen: true, wantNext: "2024-01-14 02:00"},
+		{name: "inside", windows: sunday, time: "2024-01-07 03:59", wantOpen: true, wantNext: "2024-01-14 02:00"},
+		{name: "closed", windows: sunday, time: "2024-01-07 04:00", wantNext: "2024-01-14 02:00"},
+		{name: "before", windows: sunday, time: "2024-01-06 23:00", wantNext: "2024-01-07 02:00"},
+		{name: "timezone", windows: berlin, time: "2024-01-08 01:30", wantOpen: true, wantNext: "2024-01-09 01:00"},
+		{name: "never", windows: []Window{{Cron: "0 0 31 2 *", Duration: "1h", Timezone: "UTC"}}, time: "2024-01-08 00:00"},
+		{name: "bad duration", windows: []Window{{Cron: "0 2 * * *", Duration: "30s"}}, time: "2024-01-08 00:00", wantErr: true},
+		{name: "bad timezone", windows: []Window{{Cron: "0 2 * * *", Duration: "1h", Timezone: "Mars/Olympus"}}, time: "2024-01-08 00:00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.windows); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate = %v, want error %v", err, tt.wantErr)
+			}
+			open, err := Open(tt.windows, at(t, tt.time))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Open succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			if open != tt.wantOpen {
+				t.Errorf("Open = %v, want %v", open, tt.wantOpen)
+			}
+
+			if tt.windows == nil {
+				return
+			}
+			next, err := NextOpening(tt.windows, at(t, tt.time))
+			if err != nil {
+				t.Fatalf("NextOpening: %v", err)
+			}
+			switch {
+			case tt.wantNext == "" && !next.IsZero():
+				t.Errorf("NextOpening = %s, want none", next)
+			case tt.wantNext != "" && !next.Equal(at(t, tt.wantNext)):
+				t.Errorf("NextOpening = %s, want %s", next.UTC(), tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestRolloutDue(t *testing.T) {
+	published := at(t, "2024-01-01 00:00")
+	tests := []struct {
+		name    string
+		rollout Rollout
+		bucket  int
+		want    time.Duration // After publishing
+		wantErr bool
+	}{
+		{name: "canary", rollout: Rollout{Percent: 10, Delay: "24h", Spread: "9h"}, bucket: 9, want: 0},
+		{name: "first after the canaries", rollout: Rollout{Percent: 10, Delay: "24h", Spread: "9h"}, bucket: 10, want: 24 * time.Hour},
+		{name: "spread", rollout: Rollout{Percent: 10, Delay: "24h", Spread: "9h"}, bucket: 55, want: 28*time.Hour + 30*time.Minute},
+		{name: "last", rollout: Rollout{Percent: 10, Delay: "24h", Spread: "9h"}, bucket: 99, want: 32*time.Hour + 54*time.Minute},
+		{name: "no spread", rollout: Rollout{Delay: "1h"}, bucket: 50, want: time.Hour},
+		{name: "everyone", rollout: Rollout{Percent: 100, Delay: "1h"}, bucket: 99, want: 0},
+		{name: "bad percent", rollout: Rollout{Percent: 101, Delay: "1h"}, wantErr: true},
+		{name: "bad delay", rollout: Rollout{Delay: "a day"}, wantErr: true},
+		{name: "negative spread", rollout: Rollout{Delay: "1h", Spread: "-1h"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, err := tt.rollout.Due(tt.bucket, published)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Due = %s, want an error", due)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Due: %v", err)
+			}
+			if got := due.Sub(published); got != tt.want {
+				t.Errorf("Due = %s after publishing, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBucket(t *testing.T) {
+	for _, host := range []string{"web-1", "web-2", "db", ""} {
+		bucket := Bucket(host, "app")
+		if bucket < 0 || bucket > 99 {
+			t.Errorf("Bucket(%q) = %d, want 0 to 99", host, bucket)
+		}
+		if again := Bucket(host, "app"); again != bucket {
+			t.Errorf("Bucket(%q) = %d, then %d", host, bucket, again)
+		}
+	}
+}
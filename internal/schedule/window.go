@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// searchLimit bounds how far ahead NextOpening looks for a window
+const searchLimit = 366 * 24 * time.Hour
+
+// Window is a recurring maintenance window that opens whenever Cron
+// matches and stays open for Duration
+type Window struct {
+	Cron     string `json:"cron"`               // e.g. "0 2 * * sun"
+	Duration string `json:"duration"`           // e.g. "2h" or "90m"
+	Timezone string `json:"timezone,omitempty"` // IANA name such as Europe/Berlin, default local time
+}
+
+// window is a Window ready for use
+type window struct {
+	cron     *Cron
+	duration time.Duration
+	location *time.Location
+}
+
+// parse checks the settings of a window
+func (w Window) parse() (window, error) {
+	cron, err := ParseCron(w.Cron)
+	if err != nil {
+		return window{}, err
+	}
+	duration, err := time.ParseDuration(w.Duration)
+	if err != nil || duration < time.Minute {
+		return window{}, fmt.Errorf("invalid window duration '%s', use e.g. 2h or 90m", w.Duration)
+	}
+	location := time.Local
+	if w.Timezone != "" {
+		if location, err = time.LoadLocation(w.Timezone); err != nil {
+			return window{}, fmt.Errorf("invalid window timezone '%s': %v", w.Timezone, err)
+		}
+	}
+	return window{cron, duration, location}, nil
+}
+
+// Validate reports the first invalid window
+func Validate(windows []Window) error {
+	for _, w := range windows {
+		if _, err := w.parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open reports whether the window is open at t, that is whether it opened
+// less than its duration before t
+func (w window) open(t time.Time) bool {
+	t = t.In(w.location)
+	start := t.Truncate(time.Minute)
+	for t.Sub(start) < w.duration {
+		if w.cron.Matches(start) {
+			return true
+		}
+		start = start.Add(-time.Minute)
+	}
+	return false
+}
+
+// Open reports whether any of the windows is open at t. Without windows
+// there is no restriction.
+func Open(windows []Window, t time.Time) (bool, error) {
+	if len(windows) == 0 {
+		return true, nil
+	}
+	for _, w := range windows {
+		parsed, err := w.parse()
+		if err != nil {
+			return false, err
+		}
+		if parsed.open(t) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NextOpening returns when the first of the windows opens after t, or the
+// zero time if none does within a year
+func NextOpening(windows []Window, t time.Time) (time.Time, error) {
+	var next time.Time
+	for _, w := range windows {
+		parsed, err := w.parse()
+		if err != nil {
+			return time.Time{}, err
+		}
+		start := t.In(parsed.location).Truncate(time.Minute).Add(time.Minute)
+		for end := t.Add(searchLimit); start.Before(end) && (next.IsZero() || start.Before(next)); start = start.Add(time.Minute) {
+			if parsed.cron.Matches(start) {
+				next = start
+				break
+			}
+		}
+	}
+	return next, nil
+}
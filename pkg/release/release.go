@@ -0,0 +1,646 @@
+// Package release exposes the release lookup, download and deploy logic of
+// gitea-release so that other programs can embed it.
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/earentir/gitea-release/internal/archive"
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/delta"
+	"github.com/earentir/gitea-release/internal/deploy"
+	"github.com/earentir/gitea-release/internal/download"
+)
+
+// Release identifiers that select a release by channel rather than by tag
+const (
+	Latest = "latest" // The newest published release, pre-releases included
+	Stable = "stable" // The newest release that is not a pre-release
+)
+
+// ErrUpToDate is returned by Fetch, with the path of the existing file,
+// when FetchOptions.Identical found the destination to already be the asset
+var ErrUpToDate = errors.New("already up to date")
+
+// Deploy strategies accepted in FetchOptions
+const (
+	StrategyOverwrite = deploy.StrategyOverwrite
+	StrategyVersioned = deploy.StrategyVersioned
+)
+
+// Release is a release as returned by the Gitea API
+type Release = client.Release
+
+// Asset is a file attached to a release
+type Asset = client.Asset
+
+// ProgressEvent is a line written to FetchOptions.ProgressJSON
+type ProgressEvent = download.ProgressEvent
+
+// Repo identifies a repository on a Gitea instance
+type Repo struct {
+	BaseURL string
+	Owner   string
+	Name    string
+	Token   string // API token, also sent with downloads; access is anonymous when empty
+
+	// Channel is what Find selects for an empty identifier, Stable, Latest
+	// or one of Channels. It defaults to Stable, so pre-releases are only
+	// picked up by repositories that opt in.
+	Channel string
+
+	// Channels are named channels, each a regular expression the tags of
+	// its releases match, e.g. "beta": "-beta". A name here replaces the
+	// built-in Stable or Latest and hides a tag of the same name.
+	Channels map[string]string
+
+	// Pinned, if set, is the tag Find selects for an empty identifier in
+	// place of the newest release of Channel
+	Pinned string
+
+	// Blocked are tags of known-bad releases, which are never the newest
+	// release of a channel. Find still returns them by tag.
+	Blocked []string
+
+	// HTTPClient, if set, is used for API requests and, without its
+	// timeout, for downloads. Tests can point its Transport at a fake server.
+	HTTPClient *http.Client
+}
+
+// api returns an API client for the Gitea instance of the repository
+func (r Repo) api() *client.Client {
+	api := client.New(r.BaseURL, r.Token)
+	if r.HTTPClient != nil {
+		api.HTTPClient = r.HTTPClient
+	}
+	return api
+}
+
+// downloadClient returns the HTTP client for downloads, which sends the
+// token to the Gitea instance as private repositories need it
+func (r Repo) downloadClient() *http.Client {
+	httpClient := *client.DownloadClient
+	if r.HTTPClient != nil {
+		// The API timeout would cut long transfers short
+		httpClient = *r.HTTPClient
+		httpClient.Timeout = 0
+	}
+	return client.Authenticate(&httpClient, r.BaseURL, r.Token)
+}
+
+// OpenAsset starts downloading an asset with the credentials of the
+// repository, for reading it without saving it. Close the body when done.
+func (r Repo) OpenAsset(ctx context.Context, asset Asset) (io.ReadCloser, error) {
+	resp, err := client.Get(ctx, r.downloadClient(), asset.BrowserDownloadURL)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", asset.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error downloading %s: %s", asset.Name, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// FetchOptions select what to download from a release and where to put it
+type FetchOptions struct {
+	Asset      string // Name of the asset to download
+	Source     string // Source archive format (tar.gz or zip) to download instead of an asset
+	SaveAs     string // Save under this name instead of the original file name
+	DeployPath string // Deploy into this directory instead of saving to the working directory
+	Strategy   string // Deploy strategy, defaults to StrategyOverwrite
+	Keep       int    // Number of releases kept by StrategyVersioned (0 keeps all)
+	Mode       string // File mode applied to the deployed file (e.g. 0755)
+	Owner      string // Owner (user:group) applied to the deployed file
+	TempDir    string // Download into this directory first, defaults to next to the destination
+
+	// ExtractFile, if set, is the path of a file inside the downloaded
+	// archive. Only that file is saved or deployed, named after its base
+	// name unless SaveAs is set; the archive itself is discarded.
+	ExtractFile string
+
+	// PreserveTimestamps sets the modification time of the file to when the
+	// asset was uploaded, or the release published for source archives
+	PreserveTimestamps bool
+
+	SkipSpaceCheck bool      // Do not check for free disk space before downloading
+	RateLimit      int64     // Maximum download speed in bytes per second, zero means unlimited
+	Chunks         int       // Parallel range requests for large assets, see download.ChunkThreshold
+	HideProgress   bool      // Do not draw a progress bar
+	ProgressJSON   io.Writer // Write ProgressEvent JSON lines here instead of drawing a bar
+
+	// Received, if set, counts the bytes downloaded, which is only the
+	// patch when Installed is used
+	Received *atomic.Int64
+
+	// StallTimeout aborts a download that receives no data for this long.
+	// Zero waits forever, there is no limit on the total transfer time.
+	StallTimeout time.Duration
+
+	// Verify, if set, is called with the completed download before it is
+	// moved into place. An error discards the download.
+	Verify func(ctx context.Context, filePath string) error
+
+	// PostVerify, if set, is called with the file once it is in place, with
+	// permissions applied. An error rolls the file (and the current symlink
+	// of StrategyVersioned) back to what was there before.
+	PostVerify func(ctx context.Context, finalPath string) error
+
+	// Installed, if set, is an intact copy of the asset from an earlier
+	// release. When the release carries a patch from that release, see
+	// delta.PatchNames, only the patch is downloaded and applied to it.
+	Installed *InstalledAsset
+
+	// Identical, if set, is called before downloading when the destination
+	// of an asset already exists with the asset's size, and reports whether
+	// it is the asset. If it is, nothing is downloaded. It is not used for
+	// source archives, ExtractFile or StrategyVersioned, whose current
+	// release may need switching even when the file is there.
+	Identical func(ctx context.Context, path string) (bool, error)
+
+	// ConfirmOverwrite, if set, is called before downloading when the
+	// destination already exists. An error aborts the fetch, without it
+	// the existing file is replaced.
+	ConfirmOverwrite func(path string) error
+}
+
+// RollbackError is returned when a deployed file failed PostVerify and what
+// it replaced was put back
+type RollbackError struct {
+	Path string
+	Err  error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%v, rolled back %s", e.Err, e.Path)
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// InstalledAsset is a copy of an asset from the release tagged Tag
+type InstalledAsset struct {
+	Tag  string
+	Path string
+}
+
+// List returns all releases of the repository
+func (r Repo) List(ctx context.Context) ([]Release, error) {
+	releases, err := r.api().GetReleases(ctx, r.Owner, r.Name, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting releases: %w", err)
+	}
+	return releases, nil
+}
+
+// Find returns the release with the given tag or title, the newest release
+// of a channel when identifier is Stable, Latest or one of Channels, or for
+// an empty identifier the Pinned release or that of the repository's
+// channel. Drafts and Blocked releases are never selected by channel.
+func (r Repo) Find(ctx context.Context, identifier string) (Release, error) {
+	if identifier == "" && r.Pinned != "" {
+		identifier = r.Pinned
+	}
+	if identifier == "" {
+		identifier = r.DefaultChannel()
+	}
+	if pattern, ok := r.Channels[identifier]; ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return Release{}, fmt.Errorf("invalid pattern for channel %s: %v", identifier, err)
+		}
+		return r.newestInChannel(ctx, identifier, func(rel Release) bool { return re.MatchString(rel.TagName) })
+	}
+	switch identifier {
+	case Stable:
+		if len(r.Blocked) > 0 {
+			// The latest endpoint cannot skip blocked releases
+			return r.newestInChannel(ctx, identifier, func(rel Release) bool { return !rel.Prerelease })
+		}
+		releases, err := r.api().GetReleases(ctx, r.Owner, r.Name, true)
+		if err != nil {
+			return Release{}, fmt.Errorf("error getting releases: %w", err)
+		}
+
+		if len(releases) == 0 {
+			return Release{}, fmt.Errorf("no releases found for %s/%s", r.Owner, r.Name)
+		}
+		return releases[0], nil
+	case Latest:
+		return r.newestInChannel(ctx, identifier, func(rel Release) bool { return true })
+	}
+
+	// Get all releases to find the specified one
+	releases, err := r.List(ctx)
+	if err != nil {
+		return Release{}, err
+	}
+
+	for _, release := range releases {
+		if release.TagName == identifier || release.Name == identifier {
+			return release, nil
+		}
+	}
+
+	return Release{}, fmt.Errorf("release with tag or title '%s' not found", identifier)
+}
+
+// DefaultChannel returns the channel Find follows for an empty identifier
+func (r Repo) DefaultChannel() string {
+	if r.Channel == "" {
+		return Stable
+	}
+	return r.Channel
+}
+
+// IsChannel reports whether Find takes name as a channel rather than a tag
+func (r Repo) IsChannel(name string) bool {
+	_, named := r.Channels[name]
+	return named || name == Stable || name == Latest
+}
+
+// IsBlocked reports whether tag is one of Blocked
+func (r Repo) IsBlocked(tag string) bool {
+	for _, blocked := range r.Blocked {
+		if blocked == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// newestInChannel returns the newest release of the named channel, the
+// first one in the list that matches and is neither a draft nor blocked
+func (r Repo) newestInChannel(ctx context.Context, name string, matches func(Release) bool) (Release, error) {
+	newest, found, err := r.api().FindNewest(ctx, r.Owner, r.Name, func(rel Release) bool {
+		return !rel.Draft && !r.IsBlocked(rel.TagName) && matches(rel)
+	})
+	if err != nil {
+		return Release{}, fmt.Errorf("error getting releases: %w", err)
+	}
+	if !found {
+		return Release{}, fmt.Errorf("no release of channel %s found for %s/%s", name, r.Owner, r.Name)
+	}
+	return newest, nil
+}
+
+// Commit returns the SHA of the commit the tag of rel points to
+func (r Repo) Commit(ctx context.Context, rel Release) (string, error) {
+	tag, err := r.api().GetTag(ctx, r.Owner, r.Name, rel.TagName)
+	if err != nil {
+		return "", fmt.Errorf("error getting tag %s: %w", rel.TagName, err)
+	}
+	return tag.Commit.SHA, nil
+}
+
+// Fetch downloads an asset or the source archive of rel and deploys it when
+// DeployPath is set. It returns the final location of the file.
+func (r Repo) Fetch(ctx context.Context, rel Release, opts FetchOptions) (string, error) {
+	if opts.Asset != "" && opts.Source != "" {
+		return "", fmt.Errorf("an asset and a source archive cannot be fetched together")
+	}
+
+	var fileURL, fileName, uploaded string
+	var fileSize int64
+	var external bool // The asset links to a file outside Gitea
+
+	switch {
+	case opts.Source != "":
+		// Gitea generates source archives for every tag
+		switch opts.Source {
+		case "tar.gz":
+			fileURL = rel.TarballURL
+		case "zip":
+			fileURL = rel.ZipballURL
+		default:
+			return "", fmt.Errorf("unsupported source format '%s', use tar.gz or zip", opts.Source)
+		}
+
+		if fileURL == "" {
+			return "", fmt.Errorf("no %s source archive available for release %s", opts.Source, rel.Name)
+		}
+
+		fileName = fmt.Sprintf("%s-%s.%s", r.Name, rel.TagName, opts.Source)
+		uploaded = rel.PublishedAt
+	case opts.Asset != "":
+		// Check if the asset exists
+		var assetExists bool
+		for _, asset := range rel.Assets {
+			if asset.Name == opts.Asset {
+				fileURL = asset.BrowserDownloadURL
+				fileSize = asset.Size
+				uploaded = asset.CreatedAt
+				external = asset.IsExternal()
+				assetExists = true
+				break
+			}
+		}
+
+		if !assetExists {
+			return "", fmt.Errorf("asset %s not found in release %s", opts.Asset, rel.Name)
+		}
+
+		fileName = opts.Asset
+	default:
+		return "", fmt.Errorf("no asset or source archive to fetch")
+	}
+
+	// Save under a different name if requested
+	saveName := fileName
+	if opts.ExtractFile != "" {
+		saveName = path.Base(strings.ReplaceAll(opts.ExtractFile, `\`, "/"))
+	}
+	if opts.SaveAs != "" {
+		saveName = opts.SaveAs
+	}
+
+	downloadOpts := download.Options{Label: fileName, Size: fileSize, RateLimit: opts.RateLimit, Chunks: opts.Chunks,
+		HideProgress: opts.HideProgress, ProgressJSON: opts.ProgressJSON, HTTPClient: r.downloadClient(),
+		StallTimeout: opts.StallTimeout, ExpectHTML: isHTMLName(fileName), Received: opts.Received}
+
+	if !opts.SkipSpaceCheck {
+		// Fail before the transfer rather than halfway through it
+		destDir := opts.DeployPath
+		if destDir == "" {
+			destDir = filepath.Dir(saveName)
+		}
+		if err := checkFreeSpace(destDir, fileSize); err != nil {
+			return "", err
+		}
+		if opts.TempDir != "" {
+			if err := checkFreeSpace(opts.TempDir, fileSize); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	verify := func(tempPath string) error {
+		if opts.Verify == nil {
+			return nil
+		}
+		if err := opts.Verify(ctx, tempPath); err != nil {
+			os.Remove(tempPath)
+			return err
+		}
+		return nil
+	}
+
+	fetchTo := func(tempPath string) error {
+		// A patch that fails in any way falls back to the full asset
+		patched, err := r.fetchPatch(ctx, rel, opts, fileSize, tempPath, downloadOpts)
+		if err == nil && patched {
+			err = verify(tempPath)
+			if err == nil {
+				return nil
+			}
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			client.Debugf("%s: %v, downloading the full asset", fileName, err)
+		}
+
+		if err := download.File(ctx, fileURL, tempPath, downloadOpts); err != nil {
+			return err
+		}
+		return verify(tempPath)
+	}
+
+	if opts.ExtractFile != "" {
+		// Verification covers the archive, which is what was published
+		fetchArchive := fetchTo
+		fetchTo = func(tempPath string) error {
+			archivePath := tempPath + "-" + fileName
+			defer os.Remove(archivePath)
+			if err := fetchArchive(archivePath); err != nil {
+				return err
+			}
+			if err := archive.ExtractFile(archivePath, opts.ExtractFile, tempPath); err != nil {
+				os.Remove(tempPath)
+				return fmt.Errorf("error extracting %s from %s: %v", opts.ExtractFile, fileName, err)
+			}
+			return nil
+		}
+	}
+
+	// upToDate reports whether the existing file at path is the asset
+	upToDate := func(path string) (bool, error) {
+		// The size of a link to an external file is not known
+		if opts.Identical == nil || opts.Asset == "" || opts.ExtractFile != "" || external {
+			return false, nil
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Size() != fileSize {
+			return false, nil
+		}
+		return opts.Identical(ctx, path)
+	}
+
+	// stamp gives the file in place the time of the asset
+	stamp := func(path string) error {
+		if !opts.PreserveTimestamps {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, uploaded)
+		if err != nil {
+			return fmt.Errorf("cannot preserve the timestamp of %s, %q is not a time", fileName, uploaded)
+		}
+		if err := os.Chtimes(path, t, t); err != nil {
+			return fmt.Errorf("error setting the modification time: %v", err)
+		}
+		return nil
+	}
+
+	confirm := func(path string) error {
+		if opts.ConfirmOverwrite == nil {
+			return nil
+		}
+		if _, err := os.Lstat(path); err != nil {
+			return nil
+		}
+		return opts.ConfirmOverwrite(path)
+	}
+
+	// Without a deploy path just download to the current directory
+	if opts.DeployPath == "" {
+		absPath, _ := filepath.Abs(saveName)
+		if same, err := upToDate(saveName); err != nil {
+			return "", err
+		} else if same {
+			return absPath, ErrUpToDate
+		}
+		if err := confirm(saveName); err != nil {
+			return "", err
+		}
+
+		tempPath := partialPath(opts.TempDir, saveName)
+		if err := fetchTo(tempPath); err != nil {
+			return "", err
+		}
+
+		return installChecked(ctx, opts, "", saveName, rel.TagName, StrategyOverwrite, func() (string, error) {
+			if err := deploy.Move(tempPath, saveName); err != nil {
+				return "", fmt.Errorf("error saving file: %v", err)
+			}
+			return absPath, stamp(absPath)
+		})
+	}
+
+	strategy := opts.Strategy
+	if strategy == "" {
+		strategy = StrategyOverwrite
+	}
+	if !deploy.ValidStrategy(strategy) {
+		return "", fmt.Errorf("unsupported deploy strategy '%s', use %s or %s", strategy, StrategyOverwrite, StrategyVersioned)
+	}
+
+	destination := deploy.Destination(opts.DeployPath, saveName, rel.TagName, strategy)
+	if strategy == StrategyOverwrite {
+		if same, err := upToDate(destination); err != nil {
+			return "", err
+		} else if same {
+			return destination, ErrUpToDate
+		}
+	}
+	if err := confirm(destination); err != nil {
+		return "", err
+	}
+
+	// Create deploy directory if it doesn't exist
+	if err := os.MkdirAll(opts.DeployPath, 0755); err != nil {
+		return "", fmt.Errorf("error creating deploy directory: %v", err)
+	}
+
+	// First download to a partial file so an interrupted download is never deployed
+	tempPath := partialPath(opts.TempDir, filepath.Join(opts.DeployPath, saveName))
+	if err := fetchTo(tempPath); err != nil {
+		return "", err
+	}
+
+	// Then move to deploy location
+	return installChecked(ctx, opts, opts.DeployPath, saveName, rel.TagName, strategy, func() (string, error) {
+		finalPath, err := deploy.File(tempPath, opts.DeployPath, saveName, rel.TagName, strategy, opts.Keep)
+		if err != nil {
+			return "", err
+		}
+		if err := deploy.SetPermissions(finalPath, opts.Mode, opts.Owner); err != nil {
+			return "", err
+		}
+		return finalPath, stamp(finalPath)
+	})
+}
+
+// installChecked runs install, which puts the downloaded file in place, and
+// then opts.PostVerify, rolling back if that fails
+func installChecked(ctx context.Context, opts FetchOptions, deployPath, fileName, tag, strategy string, install func() (string, error)) (string, error) {
+	if opts.PostVerify == nil {
+		return install()
+	}
+
+	snapshot, err := deploy.Checkpoint(deployPath, fileName, tag, strategy)
+	if err != nil {
+		return "", err
+	}
+	finalPath, err := install()
+	if err != nil {
+		snapshot.Discard()
+		return "", err
+	}
+
+	if err := opts.PostVerify(ctx, finalPath); err != nil {
+		if restoreErr := snapshot.Restore(); restoreErr != nil {
+			return "", fmt.Errorf("%v, and rolling back failed: %v", err, restoreErr)
+		}
+		return "", &RollbackError{Path: finalPath, Err: err}
+	}
+	snapshot.Discard()
+	return finalPath, nil
+}
+
+// fetchPatch builds the asset at tempPath from the installed copy and a
+// patch published in rel, and reports whether it did. A patched file of the
+// wrong size is discarded.
+func (r Repo) fetchPatch(ctx context.Context, rel Release, opts FetchOptions, size int64, tempPath string, downloadOpts download.Options) (bool, error) {
+	if opts.Installed == nil || opts.Asset == "" || opts.ExtractFile != "" || opts.Installed.Tag == rel.TagName {
+		return false, nil
+	}
+
+	var patch Asset
+	found := false
+	for _, name := range delta.PatchNames(opts.Asset, opts.Installed.Tag) {
+		for _, asset := range rel.Assets {
+			if asset.Name == name {
+				patch, found = asset, true
+			}
+		}
+	}
+	if !found {
+		return false, nil
+	}
+
+	patchPath := tempPath + ".patch"
+	defer os.Remove(patchPath)
+	downloadOpts.Label, downloadOpts.Size, downloadOpts.Chunks = patch.Name, patch.Size, 1
+	if err := download.File(ctx, patch.BrowserDownloadURL, patchPath, downloadOpts); err != nil {
+		return false, err
+	}
+
+	if err := delta.Apply(opts.Installed.Path, patchPath, tempPath); err != nil {
+		return false, err
+	}
+	if info, err := os.Stat(tempPath); err != nil || info.Size() != size {
+		os.Remove(tempPath)
+		return false, fmt.Errorf("patched file does not have the size of the asset")
+	}
+	client.Debugf("%s: applied %s to the copy from %s", opts.Asset, patch.Name, opts.Installed.Tag)
+	return true, nil
+}
+
+// isHTMLName reports whether an asset is itself a web page, which should not
+// be mistaken for an error page
+func isHTMLName(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".html", ".htm", ".xhtml":
+		return true
+	}
+	return false
+}
+
+// partialPath returns where the download for finalPath is written until it
+// is complete: finalPath.partial, or that file name inside tempDir if set
+func partialPath(tempDir, finalPath string) string {
+	partial := finalPath + ".partial"
+	if tempDir != "" {
+		return filepath.Join(tempDir, filepath.Base(partial))
+	}
+	return partial
+}
+
+// checkFreeSpace checks the free space of dir, or of its closest existing
+// parent when it is yet to be created
+func checkFreeSpace(dir string, size int64) error {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return download.CheckFreeSpace(dir, size)
+}
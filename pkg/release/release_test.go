@@ -0,0 +1,184 @@
+package release_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/earentir/gitea-release/internal/client"
+	"github.com/earentir/gitea-release/internal/giteatest"
+	"github.com/earentir/gitea-release/pkg/release"
+)
+
+// newServer serves a repository with two stable releases, a pre-release
+// and a draft, oldest first
+func newServer(t *testing.T) *giteatest.Server {
+	t.Helper()
+	srv := giteatest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.AddRelease("owner", "repo", client.Release{TagName: "v1.0.0", PublishedAt: "2024-01-01T00:00:00Z"}, map[string][]byte{"app": []byte("one")})
+	srv.AddRelease("owner", "repo", client.Release{TagName: "v1.1.0", Name: "Second", PublishedAt: "2024-02-01T00:00:00Z"}, map[string][]byte{"app": []byte("two")})
+	srv.AddRelease("owner", "repo", client.Release{TagName: "v2.0.0-beta.1", Prerelease: true, PublishedAt: "2024-03-01T00:00:00Z"}, nil)
+	srv.AddRelease("owner", "repo", client.Release{TagName: "v2.0.0-rc.1", Draft: true, PublishedAt: "2024-04-01T00:00:00Z"}, nil)
+	return srv
+}
+
+func TestRepoFind(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    string // Gitea version of the server, the default when empty
+		setup      func(*release.Repo)
+		identifier string
+		wantTag    string
+		wantErr    bool
+	}{
+		{name: "stable", identifier: release.Stable, wantTag: "v1.1.0"},
+		{name: "stable without the latest endpoint", version: "1.17.0", identifier: release.Stable, wantTag: "v1.1.0"},
+		{name: "latest skips drafts", identifier: release.Latest, wantTag: "v2.0.0-beta.1"},
+		{name: "default channel", identifier: "", wantTag: "v1.1.0"},
+		{name: "repository channel", setup: func(r *release.Repo) { r.Channel = release.Latest }, wantTag: "v2.0.0-beta.1"},
+		{name: "named channel", setup: func(r *release.Repo) { r.Channels = map[string]string{"beta": "-beta"} }, identifier: "beta", wantTag: "v2.0.0-beta.1"},
+		{name: "named channel without releases", setup: func(r *release.Repo) { r.Channels = map[string]string{"nightly": "-nightly"} }, identifier: "nightly", wantErr: true},
+		{name: "pinned", setup: func(r *release.Repo) { r.Pinned = "v1.0.0" }, wantTag: "v1.0.0"},
+		{name: "pinned, tag given", setup: func(r *release.Repo) { r.Pinned = "v1.0.0" }, identifier: "v1.1.0", wantTag: "v1.1.0"},
+		{name: "blocked", setup: func(r *release.Repo) { r.Blocked = []string{"v1.1.0"} }, identifier: release.Stable, wantTag: "v1.0.0"},
+		{name: "blocked, by tag", setup: func(r *release.Repo) { r.Blocked = []string{"v1.1.0"} }, identifier: "v1.1.0", wantTag: "v1.1.0"},
+		{name: "tag", identifier: "v1.0.0", wantTag: "v1.0.0"},
+		{name: "title", identifier: "Second", wantTag: "v1.1.0"},
+		{name: "draft by tag", identifier: "v2.0.0-rc.1", wantTag: "v2.0.0-rc.1"},
+		{name: "unknown tag", identifier: "v9.9.9", wantErr: true},
+		{name: "unknown repository", setup: func(r *release.Repo) { r.Name = "missing" }, identifier: release.Stable, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t)
+			srv.Version = tt.version
+			repo := srv.Repo("owner", "repo")
+			if tt.setup != nil {
+				tt.setup(&repo)
+			}
+
+			rel, err := repo.Find(context.Background(), tt.identifier)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Find(%q) = %s, want an error", tt.identifier, rel.TagName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Find(%q): %v", tt.identifier, err)
+			}
+			if rel.TagName != tt.wantTag {
+				t.Errorf("Find(%q) = %s, want %s", tt.identifier, rel.TagName, tt.wantTag)
+			}
+		})
+	}
+}
+
+func TestRepoFindToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"matching token", "secret", false},
+		{"wrong token", "guess", true},
+		{"anonymous", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t)
+			srv.Token = "secret"
+			repo := srv.Repo("owner", "repo")
+			repo.Token = tt.token
+
+			_, err := repo.Find(context.Background(), release.Stable)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Find with token %q: %v, want error %v", tt.token, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRepoFetch(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      string
+		opts     release.FetchOptions
+		token    string // Required by the server
+		wantFile string // Relative to the deploy directory
+		wantData string
+		wantErr  bool
+	}{
+		{name: "asset", tag: "v1.1.0", opts: release.FetchOptions{Asset: "app"}, wantFile: "app", wantData: "two"},
+		{name: "older release", tag: "v1.0.0", opts: release.FetchOptions{Asset: "app"}, wantFile: "app", wantData: "one"},
+		{name: "save as", tag: "v1.1.0", opts: release.FetchOptions{Asset: "app", SaveAs: "app-renamed"}, wantFile: "app-renamed", wantData: "two"},
+		{name: "private repository", tag: "v1.1.0", opts: release.FetchOptions{Asset: "app"}, token: "secret", wantFile: "app", wantData: "two"},
+		{name: "versioned", tag: "v1.1.0", opts: release.FetchOptions{Asset: "app", Strategy: release.StrategyVersioned}, wantFile: "current/app", wantData: "two"},
+		{name: "missing asset", tag: "v1.1.0", opts: release.FetchOptions{Asset: "other"}, wantErr: true},
+		{name: "nothing to fetch", tag: "v1.1.0", wantErr: true},
+		{name: "unknown strategy", tag: "v1.1.0", opts: release.FetchOptions{Asset: "app", Strategy: "copy"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newServer(t)
+			srv.Token = tt.token
+			repo := srv.Repo("owner", "repo")
+			rel, err := repo.Find(context.Background(), tt.tag)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+
+			dir := t.TempDir()
+			opts := tt.opts
+			opts.DeployPath = dir
+			opts.HideProgress = true
+			path, err := repo.Fetch(context.Background(), rel, opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Fetch = %s, want an error", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+			if err != nil {
+				t.Fatalf("reading the fetched file: %v", err)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("fetched %q, want %q", data, tt.wantData)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("Fetch returned %s: %v", path, err)
+			}
+		})
+	}
+}
+
+func TestRepoFetchUpToDate(t *testing.T) {
+	srv := newServer(t)
+	repo := srv.Repo("owner", "repo")
+	rel, err := repo.Find(context.Background(), release.Stable)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+
+	dir := t.TempDir()
+	opts := release.FetchOptions{
+		Asset:        "app",
+		DeployPath:   dir,
+		HideProgress: true,
+		Identical:    func(context.Context, string) (bool, error) { return true, nil },
+	}
+	if _, err := repo.Fetch(context.Background(), rel, opts); err != nil {
+		t.Fatalf("first Fetch: %v", err)
+	}
+	if _, err := repo.Fetch(context.Background(), rel, opts); !errors.Is(err, release.ErrUpToDate) {
+		t.Fatalf("second Fetch: %v, want ErrUpToDate", err)
+	}
+}